@@ -9,6 +9,9 @@ func NewPipes(rate float64, capacity int64) (net.Conn, net.Conn) {
 	return NewPipesWithClock(rate, capacity, nil)
 }
 
+// NewPipesWithClock is like NewPipes, but the buckets of both ends share the given clock, so
+// that faking the passage of time in tests governs both directions at once. If clock is nil,
+// the system clock is used.
 func NewPipesWithClock(rate float64, capacity int64, clock Clock) (net.Conn, net.Conn) {
 	bucket1 := NewBucketWithRateAndClock(rate, capacity, clock)
 	bucket2 := NewBucketWithRateAndClock(rate, capacity, clock)
@@ -21,6 +24,19 @@ func NewPipesWithClock(rate float64, capacity int64, clock Clock) (net.Conn, net
 	return ratedPipe1, ratedPipe2
 }
 
+// NewPipesWithReadWriteRates returns a pipe whose second end reads at most readRate B and writes
+// at most writeRate B every second, each direction having its own bucket. The first end is
+// not limited, so that every byte is only accounted once. If clock is nil, the system clock
+// is used.
+func NewPipesWithReadWriteRates(readRate float64, readCapacity int64, writeRate float64, writeCapacity int64, clock Clock) (net.Conn, net.Conn) {
+	readBucket := NewBucketWithRateAndClock(readRate, readCapacity, clock)
+	writeBucket := NewBucketWithRateAndClock(writeRate, writeCapacity, clock)
+
+	p1, p2 := net.Pipe()
+
+	return p1, ReadWriteConn(p2, readBucket, writeBucket)
+}
+
 func NewPipesWithRates(rate1, rate2 float64, capacity1, capacity2 int64, clock1, clock2 Clock) (net.Conn, net.Conn) {
 	bucket1 := NewBucketWithRateAndClock(rate1, capacity1, clock1)
 	bucket2 := NewBucketWithRateAndClock(rate2, capacity2, clock2)
@@ -0,0 +1,141 @@
+package ratelimit
+
+import (
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// manualClock is a Clock whose time only advances when Sleep is called.
+type manualClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *manualClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sleeps = append(c.sleeps, d)
+	c.now = c.now.Add(d)
+}
+
+func TestPipesShareClock(t *testing.T) {
+	clock := &manualClock{now: time.Unix(0, 0)}
+	p1, p2 := NewPipesWithClock(10, 10, clock)
+	defer p1.Close()
+	defer p2.Close()
+
+	transfer := func(n int) {
+		errc := make(chan error, 1)
+		go func() {
+			_, err := p1.Write(make([]byte, n))
+			errc <- err
+		}()
+		buf := make([]byte, n)
+		if read, err := p2.Read(buf); err != nil || read != n {
+			t.Fatalf("read %d bytes, err %v, want %d bytes", read, err, n)
+		}
+		if err := <-errc; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// both buckets start full, the first 10 bytes go through without waiting
+	transfer(10)
+	if len(clock.sleeps) != 0 {
+		t.Fatalf("unexpected waits: %v", clock.sleeps)
+	}
+
+	// the writer has to wait for 5 new tokens. As the clock is shared, the reader's bucket
+	// refilled during that time and the bytes are released without a second wait.
+	transfer(5)
+	if want := []time.Duration{500 * time.Millisecond}; !reflect.DeepEqual(clock.sleeps, want) {
+		t.Fatalf("waits = %v, want %v", clock.sleeps, want)
+	}
+	if elapsed := clock.Now().Sub(time.Unix(0, 0)); elapsed != 500*time.Millisecond {
+		t.Fatalf("elapsed = %v, want %v", elapsed, 500*time.Millisecond)
+	}
+}
+
+func TestConnStats(t *testing.T) {
+	clock := &manualClock{now: time.Unix(0, 0)}
+	p1, p2 := NewPipesWithReadWriteRates(10, 10, 10, 10, clock)
+	defer p1.Close()
+	defer p2.Close()
+
+	if _, ok := ConnStats(p1); ok {
+		t.Fatal("unexpected stats of a connection without limit")
+	}
+
+	transfer := func(from, to io.ReadWriter, n int) {
+		errc := make(chan error, 1)
+		go func() {
+			_, err := from.Write(make([]byte, n))
+			errc <- err
+		}()
+		if _, err := io.ReadFull(to, make([]byte, n)); err != nil {
+			t.Fatal(err)
+		}
+		if err := <-errc; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// writing 20 bytes with a capacity of 10 at 10 B/s blocks for 1s, the read bucket refilling meanwhile
+	transfer(p2, p1, 20)
+	transfer(p1, p2, 5)
+
+	stats, ok := ConnStats(p2)
+	if !ok {
+		t.Fatal("no stats")
+	}
+	if want := (Stats{BytesRead: 5, BytesWritten: 20, Blocked: time.Second}); stats != want {
+		t.Fatalf("stats = %+v, want %+v", stats, want)
+	}
+}
+
+func TestPipesReadWriteRates(t *testing.T) {
+	clock := &manualClock{now: time.Unix(0, 0)}
+	p1, p2 := NewPipesWithReadWriteRates(5, 5, 10, 10, clock)
+	defer p1.Close()
+	defer p2.Close()
+
+	// writing 20 bytes with a capacity of 10 at 10 B/s waits for 1s
+	errc := make(chan error, 1)
+	go func() {
+		_, err := p2.Write(make([]byte, 20))
+		errc <- err
+	}()
+	if _, err := io.ReadFull(p1, make([]byte, 20)); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if want := []time.Duration{time.Second}; !reflect.DeepEqual(clock.sleeps, want) {
+		t.Fatalf("waits = %v, want %v", clock.sleeps, want)
+	}
+
+	// reading 15 bytes with only 5 available at 5 B/s waits for 2s, whatever the write rate is
+	go func() {
+		_, err := p1.Write(make([]byte, 15))
+		errc <- err
+	}()
+	if n, err := p2.Read(make([]byte, 15)); err != nil || n != 15 {
+		t.Fatalf("read %d bytes, err %v, want 15 bytes", n, err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if want := []time.Duration{time.Second, 2 * time.Second}; !reflect.DeepEqual(clock.sleeps, want) {
+		t.Fatalf("waits = %v, want %v", clock.sleeps, want)
+	}
+}
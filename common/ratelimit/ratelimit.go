@@ -169,9 +169,16 @@ func NewBucketWithQuantumAndClock(fillInterval time.Duration, capacity, quantum
 // Wait takes count tokens from the bucket, waiting until they are
 // available.
 func (tb *Bucket) Wait(count int64) {
-	if d := tb.Take(count); d > 0 {
+	tb.wait(count)
+}
+
+// wait is Wait also returning how long it waited.
+func (tb *Bucket) wait(count int64) time.Duration {
+	d := tb.Take(count)
+	if d > 0 {
 		tb.clock.Sleep(d)
 	}
+	return d
 }
 
 // WaitMaxDuration is like Wait except that it will
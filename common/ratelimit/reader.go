@@ -7,6 +7,7 @@ package ratelimit
 import (
 	"io"
 	"net"
+	"sync/atomic"
 	"time"
 )
 
@@ -84,21 +85,60 @@ func (w *readWriteCloser) Close() error {
 	return w.w.Close()
 }
 
+// Stats are the counters of a rate limited connection.
+type Stats struct {
+	BytesRead    int64
+	BytesWritten int64
+	// Blocked is the time spent waiting for the buckets, as measured by their clocks
+	Blocked time.Duration
+}
+
+// ConnStats returns the counters of a connection returned by Conn or ReadWriteConn, false for
+// any other connection.
+func ConnStats(c net.Conn) (Stats, bool) {
+	p, ok := c.(*pipe)
+	if !ok {
+		return Stats{}, false
+	}
+	return Stats{
+		BytesRead:    atomic.LoadInt64(&p.read),
+		BytesWritten: atomic.LoadInt64(&p.written),
+		Blocked:      time.Duration(atomic.LoadInt64(&p.blocked)),
+	}, true
+}
+
 type pipe struct {
-	w      net.Conn
-	bucket *Bucket
+	// counters, first for their alignment
+	read    int64
+	written int64
+	blocked int64
+
+	w           net.Conn
+	readBucket  *Bucket
+	writeBucket *Bucket
 }
 
 func Conn(w net.Conn, bucket *Bucket) net.Conn {
+	return ReadWriteConn(w, bucket, bucket)
+}
+
+// ReadWriteConn returns a connection whose reads are rate limited by readBucket
+// and writes by writeBucket. A nil bucket leaves the direction unlimited.
+func ReadWriteConn(w net.Conn, readBucket, writeBucket *Bucket) net.Conn {
 	return &pipe{
-		w:      w,
-		bucket: bucket,
+		w:           w,
+		readBucket:  readBucket,
+		writeBucket: writeBucket,
 	}
 }
 
 func (w *pipe) Write(buf []byte) (int, error) {
-	w.bucket.Wait(int64(len(buf)))
-	return w.w.Write(buf)
+	if w.writeBucket != nil {
+		atomic.AddInt64(&w.blocked, int64(w.writeBucket.wait(int64(len(buf)))))
+	}
+	n, err := w.w.Write(buf)
+	atomic.AddInt64(&w.written, int64(n))
+	return n, err
 }
 
 func (w *pipe) Read(buf []byte) (int, error) {
@@ -106,7 +146,10 @@ func (w *pipe) Read(buf []byte) (int, error) {
 	if n <= 0 {
 		return n, err
 	}
-	w.bucket.Wait(int64(n))
+	atomic.AddInt64(&w.read, int64(n))
+	if w.readBucket != nil {
+		atomic.AddInt64(&w.blocked, int64(w.readBucket.wait(int64(n))))
+	}
 	return n, err
 }
 
@@ -156,4 +156,7 @@ type Syncer interface {
 	SyncPeer(address common.Address)
 
 	ResetPeerCache(address common.Address)
+
+	// PeersChanged notifies the engine that a peer was added or removed
+	PeersChanged()
 }
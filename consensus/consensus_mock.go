@@ -909,3 +909,15 @@ func (mr *MockSyncerMockRecorder) ResetPeerCache(address interface{}) *gomock.Ca
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetPeerCache", reflect.TypeOf((*MockSyncer)(nil).ResetPeerCache), address)
 }
+
+// PeersChanged mocks base method
+func (m *MockSyncer) PeersChanged() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "PeersChanged")
+}
+
+// PeersChanged indicates an expected call of PeersChanged
+func (mr *MockSyncerMockRecorder) PeersChanged() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PeersChanged", reflect.TypeOf((*MockSyncer)(nil).PeersChanged))
+}
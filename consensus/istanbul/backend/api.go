@@ -17,11 +17,23 @@
 package backend
 
 import (
+	"errors"
+
 	"github.com/clearmatics/autonity/common"
 	"github.com/clearmatics/autonity/consensus"
 	"github.com/clearmatics/autonity/rpc"
 )
 
+// maxValidatorsRange is the maximum number of blocks GetValidatorsRange can be queried for at once.
+const maxValidatorsRange = 1024
+
+var (
+	// errInvalidRange is returned when the first block of a range is after the last one.
+	errInvalidRange = errors.New("invalid block range")
+	// errRangeTooLarge is returned when a range covers more than maxValidatorsRange blocks.
+	errRangeTooLarge = errors.New("block range too large")
+)
+
 // API is a user facing RPC API to dump Istanbul state
 type API struct {
 	chain    consensus.ChainReader
@@ -38,6 +50,44 @@ func (api *API) GetValidators(number *rpc.BlockNumber) ([]common.Address, error)
 	return addresses, nil
 }
 
+// GetValidatorsRange retrieves the lists of authorized validators of every block between from and to included,
+// indexed by block number. At most maxValidatorsRange blocks can be queried at once.
+func (api *API) GetValidatorsRange(from, to *rpc.BlockNumber) (map[uint64][]common.Address, error) {
+	first, last := api.blockNumber(from), api.blockNumber(to)
+	if first > last {
+		return nil, errInvalidRange
+	}
+	if last-first >= maxValidatorsRange {
+		return nil, errRangeTooLarge
+	}
+
+	result := make(map[uint64][]common.Address, last-first+1)
+	for number := first; number <= last; number++ {
+		n := rpc.BlockNumber(number)
+		addresses, err := api.GetValidators(&n)
+		if err != nil {
+			return nil, err
+		}
+		result[number] = addresses
+	}
+	return result, nil
+}
+
+// IsValidator returns whether the address is an authorized validator at the specified block, the latest block is
+// used for nil, pending and latest.
+func (api *API) IsValidator(addr common.Address, number *rpc.BlockNumber) bool {
+	_, val := api.istanbul.Validators(api.blockNumber(number)).GetByAddress(addr)
+	return val != nil
+}
+
+// blockNumber resolves the given block number, the latest block being used for nil, pending and latest.
+func (api *API) blockNumber(number *rpc.BlockNumber) uint64 {
+	if number == nil || *number == rpc.LatestBlockNumber || *number == rpc.PendingBlockNumber {
+		return api.chain.CurrentHeader().Number.Uint64()
+	}
+	return uint64(*number)
+}
+
 // GetValidatorsAtHash retrieves the state snapshot at a given block.
 func (api *API) GetValidatorsAtHash(hash common.Hash) ([]common.Address, error) {
 	header := api.chain.GetHeaderByHash(hash)
@@ -0,0 +1,87 @@
+package backend
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/clearmatics/autonity/common"
+	"github.com/clearmatics/autonity/rpc"
+)
+
+func TestGetValidatorsRange(t *testing.T) {
+	chain, engine, err := newBlockChain(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api := &API{chain: chain, istanbul: engine}
+
+	genesisValidators := make([]common.Address, 0)
+	for _, val := range engine.Validators(0).List() {
+		genesisValidators = append(genesisValidators, val.Address())
+	}
+
+	from, to := rpc.BlockNumber(0), rpc.BlockNumber(1)
+	got, err := api.GetValidatorsRange(&from, &to)
+	if err != nil {
+		t.Fatalf("expected <nil>, got %v", err)
+	}
+	// the genesis block and block #1 have the same validators
+	want := map[uint64][]common.Address{
+		0: genesisValidators,
+		1: genesisValidators,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+
+	latest := rpc.LatestBlockNumber
+	got, err = api.GetValidatorsRange(&from, &latest)
+	if err != nil {
+		t.Fatalf("expected <nil>, got %v", err)
+	}
+	if !reflect.DeepEqual(got, map[uint64][]common.Address{0: genesisValidators}) {
+		t.Fatalf("want the genesis validators only, got %v", got)
+	}
+}
+
+func TestIsValidator(t *testing.T) {
+	chain, engine, err := newBlockChain(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api := &API{chain: chain, istanbul: engine}
+
+	member := engine.Validators(0).GetByIndex(0).Address()
+	other := common.HexToAddress("0x0123456789")
+
+	genesis, latest := rpc.BlockNumber(0), rpc.LatestBlockNumber
+	for _, number := range []*rpc.BlockNumber{&genesis, &latest} {
+		if !api.IsValidator(member, number) {
+			t.Fatalf("expected %v to be a validator at %v", member, *number)
+		}
+		if api.IsValidator(other, number) {
+			t.Fatalf("expected %v not to be a validator at %v", other, *number)
+		}
+	}
+}
+
+func TestGetValidatorsRangeRejected(t *testing.T) {
+	chain, engine, err := newBlockChain(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api := &API{chain: chain, istanbul: engine}
+
+	from, to := rpc.BlockNumber(0), rpc.BlockNumber(maxValidatorsRange)
+	if _, err := api.GetValidatorsRange(&from, &to); err != errRangeTooLarge {
+		t.Fatalf("expected %v, got %v", errRangeTooLarge, err)
+	}
+
+	from, to = rpc.BlockNumber(2), rpc.BlockNumber(1)
+	if _, err := api.GetValidatorsRange(&from, &to); err != errInvalidRange {
+		t.Fatalf("expected %v, got %v", errInvalidRange, err)
+	}
+}
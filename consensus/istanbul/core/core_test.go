@@ -17,13 +17,18 @@
 package core
 
 import (
+	"bytes"
+	"crypto/ecdsa"
 	"math/big"
 	"reflect"
+	"sort"
 	"testing"
 	"time"
 
+	"github.com/clearmatics/autonity/common"
 	"github.com/clearmatics/autonity/consensus/istanbul"
 	"github.com/clearmatics/autonity/core/types"
+	"github.com/clearmatics/autonity/crypto"
 	elog "github.com/clearmatics/autonity/log"
 )
 
@@ -76,3 +81,137 @@ func TestNewRequest(t *testing.T) {
 		}
 	}
 }
+
+func TestOrderedMessageSequence(t *testing.T) {
+	N := uint64(4)
+	F := uint64(1)
+
+	sys := NewOrderedTestSystemWithBackend(N, F)
+
+	close := sys.Run(true)
+	defer close()
+
+	sys.backends[0].NewRequest(makeBlock(1))
+
+	// one preprepare, then a prepare and a commit from every validator
+	want := 1 + 2*int(N)
+	consensusMsgs := func(b *testSystemBackend) []*message {
+		var msgs []*message
+		for _, payload := range b.ReceivedMsgs() {
+			msg := new(message)
+			if err := msg.FromPayload(payload, nil); err != nil {
+				t.Fatalf("failed to decode delivered message: %v", err)
+			}
+			if msg.Code == msgPreprepare || msg.Code == msgPrepare || msg.Code == msgCommit {
+				msgs = append(msgs, msg)
+			}
+		}
+		return msgs
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for _, backend := range sys.backends {
+		for backend.LenCommittedMsgs() < 1 || len(consensusMsgs(backend)) < want {
+			if time.Now().After(deadline) {
+				t.Fatalf("backend %d: timed out waiting for the block to be committed", backend.id)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	expected := consensusMsgs(sys.backends[0])
+	if len(expected) != want {
+		t.Fatalf("delivered messages mismatch: have %d, want %d", len(expected), want)
+	}
+	if expected[0].Code != msgPreprepare {
+		t.Errorf("first delivered message mismatch: have %v, want preprepare", expected[0])
+	}
+
+	// every validator sends its prepare before its commit
+	prepared := make(map[common.Address]bool)
+	committed := make(map[common.Address]bool)
+	for _, msg := range expected[1:] {
+		switch msg.Code {
+		case msgPrepare:
+			if prepared[msg.Address] || committed[msg.Address] {
+				t.Errorf("unexpected prepare from %v", msg.Address)
+			}
+			prepared[msg.Address] = true
+		case msgCommit:
+			if !prepared[msg.Address] || committed[msg.Address] {
+				t.Errorf("commit from %v not preceded by a single prepare", msg.Address)
+			}
+			committed[msg.Address] = true
+		default:
+			t.Errorf("unexpected message %v", msg)
+		}
+	}
+	if len(prepared) != int(N) || len(committed) != int(N) {
+		t.Errorf("senders mismatch: have %d prepares and %d commits, want %d", len(prepared), len(committed), N)
+	}
+
+	// all backends observe the very same sequence
+	for _, backend := range sys.backends[1:] {
+		if !reflect.DeepEqual(consensusMsgs(backend), expected) {
+			t.Errorf("backend %d: delivered sequence differs from backend 0", backend.id)
+		}
+	}
+}
+
+func TestProposerSelectionReproducible(t *testing.T) {
+	hexKeys := []string{
+		"b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291",
+		"8a1f9a8f95be41cd7ccb6168179afb4504aefe388d1e14474d32c45c72ce7b7a",
+		"49a7b37aa6f6645917e7b807e9d1c00d4fa71f18343b0d4122a4d2df64dd6fee",
+		"c87509a1c067bbde78beb793e6fa76530b6382a4c0241e5e4a9ec0a0f44dc0d3",
+	}
+	var (
+		addrs []common.Address
+		keys  []*ecdsa.PrivateKey
+	)
+	for _, hexKey := range hexKeys {
+		key, err := crypto.HexToECDSA(hexKey)
+		if err != nil {
+			t.Fatalf("failed to load key: %v", err)
+		}
+		addrs = append(addrs, crypto.PubkeyToAddress(key.PublicKey))
+		keys = append(keys, key)
+	}
+
+	// round robin starts from the lowest address and walks the sorted set
+	expected := make([]common.Address, len(addrs))
+	copy(expected, addrs)
+	sort.Slice(expected, func(i, j int) bool {
+		return bytes.Compare(expected[i].Bytes(), expected[j].Bytes()) < 0
+	})
+
+	proposers := func(sys *testSystem) [][]common.Address {
+		var sequences [][]common.Address
+		for _, backend := range sys.backends {
+			if backend.privateKey == nil || crypto.PubkeyToAddress(backend.privateKey.PublicKey) != backend.address {
+				t.Fatalf("backend %d: key does not match address %v", backend.id, backend.address)
+			}
+			valSet := backend.engine.(*core).valSet.Copy()
+			var sequence []common.Address
+			for round := uint64(0); round < uint64(2*len(addrs)); round++ {
+				valSet.CalcProposer(common.Address{}, round)
+				sequence = append(sequence, valSet.GetProposer().Address())
+			}
+			sequences = append(sequences, sequence)
+		}
+		return sequences
+	}
+
+	first := proposers(NewTestSystemWithValidators(addrs, keys, 1))
+	second := proposers(NewTestSystemWithValidators(addrs, keys, 1))
+	if !reflect.DeepEqual(first, second) {
+		t.Fatalf("proposer selection is not reproducible: have %v, want %v", second, first)
+	}
+	for i, sequence := range first {
+		for round, proposer := range sequence {
+			if want := expected[round%len(expected)]; proposer != want {
+				t.Errorf("backend %d, round %d: proposer mismatch: have %v, want %v", i, round, proposer, want)
+			}
+		}
+	}
+}
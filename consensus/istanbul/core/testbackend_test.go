@@ -45,9 +45,11 @@ type testSystemBackend struct {
 	committedMsgs []testCommittedMsgs
 	msgMutex      sync.RWMutex
 	sentMsgs      [][]byte // store the message when Send is called by core
+	receivedMsgs  [][]byte // store the delivered messages when the system is ordered
 
-	address common.Address
-	db      ethdb.Database
+	address    common.Address
+	privateKey *ecdsa.PrivateKey // nil when the validator was injected without a key
+	db         ethdb.Database
 }
 
 type testCommittedMsgs struct {
@@ -92,6 +94,22 @@ func (b *testSystemBackend) AddCommittedMsg(msg testCommittedMsgs) []testCommitt
 	return b.committedMsgs
 }
 
+func (b *testSystemBackend) addReceivedMsg(payload []byte) {
+	b.msgMutex.Lock()
+	defer b.msgMutex.Unlock()
+	b.receivedMsgs = append(b.receivedMsgs, payload)
+}
+
+// ReceivedMsgs returns the payloads delivered to the backend in delivery order.
+// Messages are only recorded when the test system is ordered.
+func (b *testSystemBackend) ReceivedMsgs() [][]byte {
+	b.msgMutex.RLock()
+	defer b.msgMutex.RUnlock()
+	msgs := make([][]byte, len(b.receivedMsgs))
+	copy(msgs, b.receivedMsgs)
+	return msgs
+}
+
 func (b *testSystemBackend) Send(message []byte, target common.Address) error {
 	testLogger.Info("enqueuing a message...", "address", b.Address())
 	b.sentMsgs = append(b.sentMsgs, message)
@@ -196,8 +214,17 @@ type testSystem struct {
 
 	queuedMessage chan istanbul.MessageEvent
 	quit          chan struct{}
+
+	// ordered makes every backend receive the queued messages one at a time
+	// and in queue order, instead of through a goroutine per message.
+	ordered bool
+	inboxes []chan istanbul.MessageEvent
 }
 
+// inboxSize is the number of messages an ordered backend can have pending
+// before the system stops consuming the queue.
+const inboxSize = 1024
+
 func newTestSystem(n uint64) *testSystem {
 	testLogger.SetHandler(elog.StdoutHandler)
 	return &testSystem{
@@ -208,24 +235,44 @@ func newTestSystem(n uint64) *testSystem {
 	}
 }
 
-func generateValidators(n int) []common.Address {
+func generateValidators(n int) ([]common.Address, []*ecdsa.PrivateKey) {
 	vals := make([]common.Address, 0)
+	keys := make([]*ecdsa.PrivateKey, 0)
 	for i := 0; i < n; i++ {
 		privateKey, _ := crypto.GenerateKey()
 		vals = append(vals, crypto.PubkeyToAddress(privateKey.PublicKey))
+		keys = append(keys, privateKey)
 	}
-	return vals
+	return vals, keys
 }
 
 func newTestValidatorSet(n int) istanbul.ValidatorSet {
-	return validator.NewSet(generateValidators(n), istanbul.RoundRobin)
+	addrs, _ := generateValidators(n)
+	return validator.NewSet(addrs, istanbul.RoundRobin)
 }
 
 // FIXME: int64 is needed for N and F
 func NewTestSystemWithBackend(n, f uint64) *testSystem {
+	addrs, keys := generateValidators(int(n))
+	return NewTestSystemWithValidators(addrs, keys, f)
+}
+
+// NewTestSystemWithValidators builds a test system from a fixed set of
+// validators, so that a scenario captured from a live network, such as a
+// specific proposer order, can be replayed. keys is optional: when given it
+// must hold the private key of each address, in the same order.
+func NewTestSystemWithValidators(addrs []common.Address, keys []*ecdsa.PrivateKey, f uint64) *testSystem {
 	testLogger.SetHandler(elog.StdoutHandler)
 
-	addrs := generateValidators(int(n))
+	n := uint64(len(addrs))
+	if len(keys) != 0 && len(keys) != len(addrs) {
+		panic("validator keys do not match the addresses")
+	}
+	keyByAddr := make(map[common.Address]*ecdsa.PrivateKey, len(keys))
+	for i, key := range keys {
+		keyByAddr[addrs[i]] = key
+	}
+
 	sys := newTestSystem(n)
 	config := istanbul.DefaultConfig
 
@@ -234,6 +281,7 @@ func NewTestSystemWithBackend(n, f uint64) *testSystem {
 		backend := sys.NewBackend(i)
 		backend.peers = vset
 		backend.address = vset.GetByIndex(i).Address()
+		backend.privateKey = keyByAddr[backend.address]
 
 		core := New(backend, config).(*core)
 		core.state = StateAcceptRequest
@@ -253,6 +301,15 @@ func NewTestSystemWithBackend(n, f uint64) *testSystem {
 	return sys
 }
 
+// NewOrderedTestSystemWithBackend is like NewTestSystemWithBackend, but every
+// backend receives the queued messages synchronously and in the order they
+// were enqueued, so that tests can rely on a deterministic delivery sequence.
+func NewOrderedTestSystemWithBackend(n, f uint64) *testSystem {
+	sys := NewTestSystemWithBackend(n, f)
+	sys.ordered = true
+	return sys
+}
+
 // listen will consume messages from queue and deliver a message to core
 func (t *testSystem) listen() {
 	for {
@@ -261,6 +318,12 @@ func (t *testSystem) listen() {
 			return
 		case queuedMessage := <-t.queuedMessage:
 			testLogger.Info("consuming a queue message...")
+			if t.ordered {
+				for _, inbox := range t.inboxes {
+					inbox <- queuedMessage
+				}
+				continue
+			}
 			for _, backend := range t.backends {
 				go backend.EventMux().Post(queuedMessage)
 			}
@@ -268,6 +331,20 @@ func (t *testSystem) listen() {
 	}
 }
 
+// deliver posts the messages of an ordered backend's inbox one after the
+// other, so the backend handles them in the order they were queued.
+func (t *testSystem) deliver(backend *testSystemBackend, inbox <-chan istanbul.MessageEvent) {
+	for {
+		select {
+		case <-t.quit:
+			return
+		case msg := <-inbox:
+			backend.addReceivedMsg(msg.Payload)
+			_ = backend.EventMux().Post(msg)
+		}
+	}
+}
+
 // Run will start system components based on given flag, and returns a closer
 // function that caller can control lifecycle
 //
@@ -279,6 +356,14 @@ func (t *testSystem) Run(core bool) func() {
 		}
 	}
 
+	if t.ordered {
+		t.inboxes = make([]chan istanbul.MessageEvent, len(t.backends))
+		for i, b := range t.backends {
+			t.inboxes[i] = make(chan istanbul.MessageEvent, inboxSize)
+			go t.deliver(b, t.inboxes[i])
+		}
+	}
+
 	go t.listen()
 	closer := func() { t.stop(core) }
 	return closer
@@ -35,3 +35,11 @@ type Peer interface {
 	// Send sends the message to this peer
 	Send(msgcode uint64, data interface{}) error
 }
+
+// CompressionPeer is implemented by the peers telling whether they accept compressed consensus messages
+type CompressionPeer interface {
+	Peer
+
+	// SupportsCompression returns whether the protocol version negotiated with the peer carries compressed messages
+	SupportsCompression() bool
+}
@@ -17,9 +17,16 @@
 package backend
 
 import (
+	"bytes"
+	"sort"
+
 	"github.com/clearmatics/autonity/common"
+	"github.com/clearmatics/autonity/common/hexutil"
 	"github.com/clearmatics/autonity/consensus"
 	"github.com/clearmatics/autonity/consensus/tendermint/core"
+	tendermintCrypto "github.com/clearmatics/autonity/consensus/tendermint/crypto"
+	"github.com/clearmatics/autonity/core/types"
+	"github.com/clearmatics/autonity/rlp"
 	"github.com/clearmatics/autonity/rpc"
 )
 
@@ -27,11 +34,28 @@ import (
 type API struct {
 	chain      consensus.ChainReader
 	tendermint core.Backend
+	evidence   evidenceStore
+	peers      validatorPeers
+}
+
+// validatorPeers reports the connections to the validators, implemented by Backend.
+type validatorPeers interface {
+	ConnectedValidators() *ValidatorPeers
+}
+
+// evidenceStore is the store of the fault evidence, implemented by Backend.
+type evidenceStore interface {
+	PutEvidence(ev *Evidence) error
+	IterateEvidence(fn func(*Evidence) bool) error
 }
 
 // GetValidators retrieves the list of authorized validators at the specified block.
 func (api *API) GetValidators(number *rpc.BlockNumber) ([]common.Address, error) {
-	validators := api.tendermint.Validators(uint64(*number)).List()
+	valSet, err := api.tendermint.Validators(uint64(*number))
+	if err != nil {
+		return nil, err
+	}
+	validators := valSet.List()
 	addresses := make([]common.Address, len(validators))
 	for i, validator := range validators {
 		addresses[i] = validator.Address()
@@ -39,6 +63,147 @@ func (api *API) GetValidators(number *rpc.BlockNumber) ([]common.Address, error)
 	return addresses, nil
 }
 
+// IsValidator returns whether the address is an authorized validator at the specified block, the latest block is
+// used for nil, pending and latest.
+func (api *API) IsValidator(addr common.Address, number *rpc.BlockNumber) bool {
+	valSet, err := api.tendermint.Validators(api.blockNumber(number))
+	if err != nil {
+		return false
+	}
+	_, val := valSet.GetByAddress(addr)
+	return val != nil
+}
+
+// GetNextProposer returns the proposer of the first round of the next block, computed from the validators of the
+// next block and the proposer of the last committed block.
+func (api *API) GetNextProposer() (common.Address, error) {
+	lastBlock, lastProposer := api.tendermint.LastCommittedProposal()
+	if lastBlock == nil {
+		return common.Address{}, errNotSynced
+	}
+
+	valSet, err := api.tendermint.Validators(lastBlock.NumberU64() + 1)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if valSet.Size() == 0 {
+		return common.Address{}, errNotSynced
+	}
+	return valSet.ProposerAt(lastProposer, 0), nil
+}
+
+// ValidatorSetSnapshot describes the validators of a block and the proposer of its first round.
+type ValidatorSetSnapshot struct {
+	Number     uint64           `json:"number"`
+	Validators []common.Address `json:"validators"`
+	Proposer   common.Address   `json:"proposer"`
+	Policy     string           `json:"policy"`
+}
+
+// ValidatorSetInfo returns the validators of the specified block along with the proposer of its first round and the
+// proposer policy in effect. The latest block is used for nil, pending and latest.
+func (api *API) ValidatorSetInfo(number *rpc.BlockNumber) (*ValidatorSetSnapshot, error) {
+	n := api.blockNumber(number)
+
+	// the first round proposer follows the proposer of the parent block, the genesis block having none
+	var lastProposer common.Address
+	if n > 1 {
+		parent := api.chain.GetHeaderByNumber(n - 1)
+		if parent == nil {
+			return nil, errUnknownBlock
+		}
+		var err error
+		if lastProposer, err = api.tendermint.Author(parent); err != nil {
+			return nil, err
+		}
+	}
+
+	valSet, err := api.tendermint.Validators(n)
+	if err != nil {
+		return nil, err
+	}
+	if valSet.Size() == 0 {
+		return nil, errUnknownBlock
+	}
+
+	validators := valSet.List()
+	snapshot := &ValidatorSetSnapshot{
+		Number:     n,
+		Validators: make([]common.Address, len(validators)),
+		Proposer:   valSet.ProposerAt(lastProposer, 0),
+		Policy:     valSet.Policy().String(),
+	}
+	for i, val := range validators {
+		snapshot.Validators[i] = val.Address()
+	}
+	return snapshot, nil
+}
+
+// blockNumber resolves the given block number, the latest block being used for nil, pending and latest.
+func (api *API) blockNumber(number *rpc.BlockNumber) uint64 {
+	if number == nil || *number == rpc.LatestBlockNumber || *number == rpc.PendingBlockNumber {
+		return api.chain.CurrentHeader().Number.Uint64()
+	}
+	return uint64(*number)
+}
+
+// ValidatorSetChanges lists the validators added and removed between two blocks, sorted by address.
+type ValidatorSetChanges struct {
+	Added   []common.Address `json:"added"`
+	Removed []common.Address `json:"removed"`
+}
+
+// ValidatorSetDiff returns the validators which are authorized at block b but not at block a, and the ones which
+// are authorized at block a but not at block b.
+func (api *API) ValidatorSetDiff(a, b uint64) (*ValidatorSetChanges, error) {
+	before, err := api.validatorsSet(a)
+	if err != nil {
+		return nil, err
+	}
+	after, err := api.validatorsSet(b)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := &ValidatorSetChanges{
+		Added:   make([]common.Address, 0),
+		Removed: make([]common.Address, 0),
+	}
+	for addr := range after {
+		if _, ok := before[addr]; !ok {
+			changes.Added = append(changes.Added, addr)
+		}
+	}
+	for addr := range before {
+		if _, ok := after[addr]; !ok {
+			changes.Removed = append(changes.Removed, addr)
+		}
+	}
+	sortAddresses(changes.Added)
+	sortAddresses(changes.Removed)
+	return changes, nil
+}
+
+// validatorsSet returns the authorized validators at the specified block.
+func (api *API) validatorsSet(number uint64) (map[common.Address]struct{}, error) {
+	valSet, err := api.tendermint.Validators(number)
+	if err != nil {
+		return nil, err
+	}
+	validators := valSet.List()
+	set := make(map[common.Address]struct{}, len(validators))
+	for _, val := range validators {
+		set[val.Address()] = struct{}{}
+	}
+	return set, nil
+}
+
+func sortAddresses(addrs []common.Address) {
+	sort.Slice(addrs, func(i, j int) bool {
+		return bytes.Compare(addrs[i].Bytes(), addrs[j].Bytes()) < 0
+	})
+}
+
 // GetValidatorsAtHash retrieves the state snapshot at a given block.
 func (api *API) GetValidatorsAtHash(hash common.Hash) ([]common.Address, error) {
 	header := api.chain.GetHeaderByHash(hash)
@@ -46,7 +211,11 @@ func (api *API) GetValidatorsAtHash(hash common.Hash) ([]common.Address, error)
 		return nil, errUnknownBlock
 	}
 
-	validators := api.tendermint.Validators(header.Number.Uint64()).List()
+	valSet, err := api.tendermint.Validators(header.Number.Uint64())
+	if err != nil {
+		return nil, err
+	}
+	validators := valSet.List()
 	addresses := make([]common.Address, len(validators))
 	for i, validator := range validators {
 		addresses[i] = validator.Address()
@@ -54,6 +223,41 @@ func (api *API) GetValidatorsAtHash(hash common.Hash) ([]common.Address, error)
 	return addresses, nil
 }
 
+// ConnectedValidators returns which validators of the next block are connected peers of the node and which are
+// missing, the node itself being left out.
+func (api *API) ConnectedValidators() *ValidatorPeers {
+	return api.peers.ConnectedValidators()
+}
+
+// CommittedSealCount returns the number of distinct validators of the specified block whose committed seal is in
+// its header, the seals which can't be recovered being skipped. Blocks without BFT extra data, like the genesis
+// block, have no seal. The latest block is used for nil, pending and latest.
+func (api *API) CommittedSealCount(number *rpc.BlockNumber) (int, error) {
+	header := api.chain.GetHeaderByNumber(api.blockNumber(number))
+	if header == nil {
+		return 0, errUnknownBlock
+	}
+	extra, err := types.ExtractBFTHeaderExtra(header)
+	if err != nil {
+		return 0, nil
+	}
+
+	valSet, err := api.tendermint.Validators(header.Number.Uint64())
+	if err != nil {
+		return 0, err
+	}
+	sealData := core.PrepareCommittedSeal(header.Hash())
+	signers := make(map[common.Address]struct{}, len(extra.CommittedSeal))
+	for _, seal := range extra.CommittedSeal {
+		signer, err := tendermintCrypto.CheckValidatorSignature(valSet, sealData, seal)
+		if err != nil {
+			continue
+		}
+		signers[signer] = struct{}{}
+	}
+	return len(signers), nil
+}
+
 // Get Autonity contract address
 func (api *API) GetContractAddress() common.Address {
 	return api.tendermint.GetContractAddress()
@@ -68,3 +272,49 @@ func (api *API) GetContractABI() string {
 func (api *API) GetWhitelist() []string {
 	return api.tendermint.WhiteList()
 }
+
+// GetEvidence returns the fault evidence stored for the given height.
+func (api *API) GetEvidence(height uint64) ([]*Evidence, error) {
+	evidence := make([]*Evidence, 0)
+	err := api.evidence.IterateEvidence(func(ev *Evidence) bool {
+		if ev.Height == height {
+			evidence = append(evidence, ev)
+		}
+		// the evidence is iterated by height
+		return ev.Height <= height
+	})
+	if err != nil {
+		return nil, err
+	}
+	return evidence, nil
+}
+
+// AdminAPI is an operator facing RPC API to manage the fault evidence, registered in the admin namespace so that it is
+// only reachable by the node administrators
+type AdminAPI struct {
+	tendermint core.Backend
+	evidence   evidenceStore
+}
+
+// ImportEvidence checks the RLP encoded evidence of a fault and adds it to the local evidence store, e.g. evidence
+// collected by another node. The evidence must hold two conflicting messages signed by a validator of its height,
+// matching its type, height, round and validator.
+func (api *AdminAPI) ImportEvidence(encoded hexutil.Bytes) error {
+	ev := new(Evidence)
+	if err := rlp.DecodeBytes(encoded, ev); err != nil {
+		return err
+	}
+	valSet, err := api.tendermint.Validators(ev.Height)
+	if err != nil {
+		return err
+	}
+	fault, err := core.CheckFault(ev.First, ev.Second, valSet)
+	if err != nil {
+		return err
+	}
+	if typ, ok := evidenceTypes[fault.Step]; !ok || typ != ev.Type || fault.Height.Uint64() != ev.Height ||
+		uint64(fault.Round) != ev.Round || fault.Validator != ev.Validator {
+		return errEvidenceMismatch
+	}
+	return api.evidence.PutEvidence(ev)
+}
@@ -1,6 +1,7 @@
 package backend
 
 import (
+	"crypto/ecdsa"
 	"math/big"
 	"reflect"
 	"testing"
@@ -8,10 +9,15 @@ import (
 	"github.com/golang/mock/gomock"
 
 	"github.com/clearmatics/autonity/common"
+	"github.com/clearmatics/autonity/common/hexutil"
 	"github.com/clearmatics/autonity/consensus"
+	"github.com/clearmatics/autonity/consensus/tendermint/config"
 	"github.com/clearmatics/autonity/consensus/tendermint/core"
 	"github.com/clearmatics/autonity/consensus/tendermint/validator"
+	"github.com/clearmatics/autonity/core/rawdb"
 	"github.com/clearmatics/autonity/core/types"
+	"github.com/clearmatics/autonity/crypto"
+	"github.com/clearmatics/autonity/rlp"
 	"github.com/clearmatics/autonity/rpc"
 )
 
@@ -29,7 +35,7 @@ func TestGetValidators(t *testing.T) {
 	valSet.EXPECT().List().Return([]validator.Validator{val})
 
 	backend := core.NewMockBackend(ctrl)
-	backend.EXPECT().Validators(uint64(1)).Return(valSet)
+	backend.EXPECT().Validators(uint64(1)).Return(valSet, nil)
 
 	API := &API{
 		tendermint: backend,
@@ -47,6 +53,218 @@ func TestGetValidators(t *testing.T) {
 	}
 }
 
+func TestAPIIsValidator(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	member := common.HexToAddress("0x0123456789")
+	other := common.HexToAddress("0x0987654321")
+
+	val := validator.NewMockValidator(ctrl)
+
+	valSet := validator.NewMockSet(ctrl)
+	valSet.EXPECT().GetByAddress(member).Return(0, val).AnyTimes()
+	valSet.EXPECT().GetByAddress(other).Return(-1, nil).AnyTimes()
+
+	chain := consensus.NewMockChainReader(ctrl)
+	chain.EXPECT().CurrentHeader().Return(&types.Header{Number: big.NewInt(5)}).AnyTimes()
+
+	backend := core.NewMockBackend(ctrl)
+	backend.EXPECT().Validators(uint64(1)).Return(valSet, nil).AnyTimes()
+	backend.EXPECT().Validators(uint64(5)).Return(valSet, nil).AnyTimes()
+
+	API := &API{
+		chain:      chain,
+		tendermint: backend,
+	}
+
+	bn := rpc.BlockNumber(1)
+	latest := rpc.LatestBlockNumber
+	for _, number := range []*rpc.BlockNumber{&bn, &latest, nil} {
+		if !API.IsValidator(member, number) {
+			t.Fatalf("expected %v to be a validator at %v", member, number)
+		}
+		if API.IsValidator(other, number) {
+			t.Fatalf("expected %v not to be a validator at %v", other, number)
+		}
+	}
+}
+
+func TestAPIGetNextProposer(t *testing.T) {
+	addrs := []common.Address{
+		common.HexToAddress("0x01"),
+		common.HexToAddress("0x02"),
+		common.HexToAddress("0x03"),
+	}
+	lastBlock := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(3)})
+
+	t.Run("validators known, next proposer returned", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		for i, lastProposer := range addrs {
+			backend := core.NewMockBackend(ctrl)
+			backend.EXPECT().LastCommittedProposal().Return(lastBlock, lastProposer)
+			backend.EXPECT().Validators(uint64(4)).Return(validator.NewSet(addrs, config.RoundRobin), nil)
+
+			API := &API{
+				tendermint: backend,
+			}
+
+			got, err := API.GetNextProposer()
+			if err != nil {
+				t.Fatalf("expected <nil>, got %v", err)
+			}
+			// round robin moves to the validator following the last proposer
+			if want := addrs[(i+1)%len(addrs)]; got != want {
+				t.Fatalf("want %v, got %v", want, got)
+			}
+		}
+	})
+
+	t.Run("validators unknown, error returned", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		backend := core.NewMockBackend(ctrl)
+		backend.EXPECT().LastCommittedProposal().Return(lastBlock, addrs[0])
+		backend.EXPECT().Validators(uint64(4)).Return(validator.NewSet(nil, config.RoundRobin), nil)
+
+		API := &API{
+			tendermint: backend,
+		}
+
+		if _, err := API.GetNextProposer(); err != errNotSynced {
+			t.Fatalf("expected %v, got %v", errNotSynced, err)
+		}
+	})
+}
+
+func TestAPIValidatorSetInfo(t *testing.T) {
+	addrs := []common.Address{
+		common.HexToAddress("0x01"),
+		common.HexToAddress("0x02"),
+		common.HexToAddress("0x03"),
+	}
+	parent := &types.Header{Number: big.NewInt(4)}
+	bn := rpc.BlockNumber(5)
+
+	t.Run("validators known, proposer returned", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		for _, lastProposer := range addrs {
+			chain := consensus.NewMockChainReader(ctrl)
+			chain.EXPECT().GetHeaderByNumber(uint64(4)).Return(parent)
+			backend := core.NewMockBackend(ctrl)
+			backend.EXPECT().Author(parent).Return(lastProposer, nil)
+			backend.EXPECT().Validators(uint64(5)).Return(validator.NewSet(addrs, config.RoundRobin), nil)
+
+			API := &API{
+				chain:      chain,
+				tendermint: backend,
+			}
+
+			got, err := API.ValidatorSetInfo(&bn)
+			if err != nil {
+				t.Fatalf("expected <nil>, got %v", err)
+			}
+			valSet := validator.NewSet(addrs, config.RoundRobin)
+			valSet.CalcProposer(lastProposer, 0)
+			want := &ValidatorSetSnapshot{
+				Number:     5,
+				Validators: addrs,
+				Proposer:   valSet.GetProposer().Address(),
+				Policy:     "round-robin",
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("want %v, got %v", want, got)
+			}
+		}
+	})
+
+	t.Run("parent unknown, error returned", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		chain := consensus.NewMockChainReader(ctrl)
+		chain.EXPECT().GetHeaderByNumber(uint64(4)).Return(nil)
+
+		API := &API{
+			chain:      chain,
+			tendermint: core.NewMockBackend(ctrl),
+		}
+
+		if _, err := API.ValidatorSetInfo(&bn); err != errUnknownBlock {
+			t.Fatalf("expected %v, got %v", errUnknownBlock, err)
+		}
+	})
+
+	t.Run("validators unknown, error returned", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		chain := consensus.NewMockChainReader(ctrl)
+		chain.EXPECT().GetHeaderByNumber(uint64(4)).Return(parent)
+		backend := core.NewMockBackend(ctrl)
+		backend.EXPECT().Author(parent).Return(addrs[0], nil)
+		backend.EXPECT().Validators(uint64(5)).Return(validator.NewSet(nil, config.RoundRobin), nil)
+
+		API := &API{
+			chain:      chain,
+			tendermint: backend,
+		}
+
+		if _, err := API.ValidatorSetInfo(&bn); err != errUnknownBlock {
+			t.Fatalf("expected %v, got %v", errUnknownBlock, err)
+		}
+	})
+}
+
+func TestAPIValidatorSetDiff(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	a := common.HexToAddress("0x01")
+	b := common.HexToAddress("0x02")
+	c := common.HexToAddress("0x03")
+	d := common.HexToAddress("0x04")
+	e := common.HexToAddress("0x05")
+
+	backend := core.NewMockBackend(ctrl)
+	backend.EXPECT().Validators(uint64(1)).Return(validator.NewSet([]common.Address{a, b, c, e}, config.RoundRobin), nil).AnyTimes()
+	backend.EXPECT().Validators(uint64(2)).Return(validator.NewSet([]common.Address{d, a, c}, config.RoundRobin), nil).AnyTimes()
+
+	API := &API{
+		tendermint: backend,
+	}
+
+	want := &ValidatorSetChanges{
+		Added:   []common.Address{d},
+		Removed: []common.Address{b, e},
+	}
+	if got, err := API.ValidatorSetDiff(1, 2); err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+
+	// the diff is symmetric
+	want = &ValidatorSetChanges{
+		Added:   []common.Address{b, e},
+		Removed: []common.Address{d},
+	}
+	if got, err := API.ValidatorSetDiff(2, 1); err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+
+	want = &ValidatorSetChanges{
+		Added:   []common.Address{},
+		Removed: []common.Address{},
+	}
+	if got, err := API.ValidatorSetDiff(1, 1); err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+}
+
 func TestGetValidatorsAtHash(t *testing.T) {
 	t.Run("unknown block given, error returned", func(t *testing.T) {
 		ctrl := gomock.NewController(t)
@@ -86,7 +304,7 @@ func TestGetValidatorsAtHash(t *testing.T) {
 		valSet.EXPECT().List().Return([]validator.Validator{val})
 
 		backend := core.NewMockBackend(ctrl)
-		backend.EXPECT().Validators(uint64(1)).Return(valSet)
+		backend.EXPECT().Validators(uint64(1)).Return(valSet, nil)
 
 		API := &API{
 			chain:      chain,
@@ -104,6 +322,60 @@ func TestGetValidatorsAtHash(t *testing.T) {
 	})
 }
 
+func TestAPICommittedSealCount(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	valSet, keys := newTestValidatorSet(4)
+	extra, err := types.PrepareExtra(nil, nil)
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	header := &types.Header{Number: big.NewInt(5), MixDigest: types.BFTDigest, Extra: extra}
+
+	// three validators signed the block, one of them twice, and a seal of a non validator is skipped
+	outsider, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	sealData := crypto.Keccak256(core.PrepareCommittedSeal(header.Hash()))
+	var seals [][]byte
+	for _, key := range []*ecdsa.PrivateKey{keys[0], keys[1], keys[2], keys[1], outsider} {
+		seal, err := crypto.Sign(sealData, key)
+		if err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		seals = append(seals, seal)
+	}
+	if err := types.WriteCommittedSeals(header, seals); err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+
+	chain := consensus.NewMockChainReader(ctrl)
+	chain.EXPECT().GetHeaderByNumber(uint64(5)).Return(header)
+	chain.EXPECT().GetHeaderByNumber(uint64(0)).Return(&types.Header{Number: big.NewInt(0)})
+	chain.EXPECT().GetHeaderByNumber(uint64(6)).Return(nil)
+	backend := core.NewMockBackend(ctrl)
+	backend.EXPECT().Validators(uint64(5)).Return(valSet, nil)
+	API := &API{chain: chain, tendermint: backend}
+
+	number := rpc.BlockNumber(5)
+	if count, err := API.CommittedSealCount(&number); count != 3 || err != nil {
+		t.Fatalf("have %d %v, want 3 <nil>", count, err)
+	}
+
+	// the genesis block has no seal
+	number = 0
+	if count, err := API.CommittedSealCount(&number); count != 0 || err != nil {
+		t.Fatalf("have %d %v, want 0 <nil>", count, err)
+	}
+
+	number = 6
+	if _, err := API.CommittedSealCount(&number); err != errUnknownBlock {
+		t.Fatalf("have %v, want %v", err, errUnknownBlock)
+	}
+}
+
 func TestAPIGetContractABI(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -160,3 +432,117 @@ func TestAPIGetWhitelist(t *testing.T) {
 		t.Fatalf("want %v, got %v", want, got)
 	}
 }
+
+func TestAPIGetEvidence(t *testing.T) {
+	b := &Backend{db: rawdb.NewMemoryDatabase()}
+	validator := common.HexToAddress("0x0123456789")
+	stored := []*Evidence{
+		{Type: ProposalEquivocation, Height: 3, Round: 0, Validator: validator, First: []byte{1}, Second: []byte{2}},
+		{Type: PrevoteDoubleVote, Height: 4, Round: 0, Validator: validator, First: []byte{3}, Second: []byte{4}},
+		{Type: PrecommitDoubleVote, Height: 4, Round: 2, Validator: validator, First: []byte{5}, Second: []byte{6}},
+	}
+	for _, ev := range stored {
+		if err := b.PutEvidence(ev); err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+	}
+	API := &API{evidence: b}
+
+	for height, want := range map[uint64][]*Evidence{3: stored[:1], 4: stored[1:], 5: {}} {
+		got, err := API.GetEvidence(height)
+		if err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("height %d: have %v, want %v", height, got, want)
+		}
+	}
+}
+
+func TestAdminAPIImportEvidence(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	valSet, keys := newTestValidatorSet(4)
+	offender := valSet.List()[1].Address()
+
+	// prevotes have the message code 1
+	signedVote := func(key *ecdsa.PrivateKey, code uint64, round int64, hash common.Hash) []byte {
+		vote, err := rlp.EncodeToBytes(&core.Vote{Round: big.NewInt(round), Height: big.NewInt(7), ProposedBlockHash: hash})
+		if err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		msg := &core.Message{Code: code, Msg: vote, Address: crypto.PubkeyToAddress(key.PublicKey)}
+		data, err := msg.PayloadNoSig()
+		if err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		if msg.Signature, err = crypto.Sign(crypto.Keccak256(data), key); err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		payload, err := msg.Payload()
+		if err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		return payload
+	}
+	blockA, blockB := common.BytesToHash([]byte{0xa}), common.BytesToHash([]byte{0xb})
+	first := signedVote(keys[1], 1, 2, blockA)
+
+	backend := core.NewMockBackend(ctrl)
+	backend.EXPECT().Validators(uint64(7)).Return(valSet, nil).AnyTimes()
+	b := &Backend{db: rawdb.NewMemoryDatabase()}
+	API := &API{tendermint: backend, evidence: b}
+	adminAPI := &AdminAPI{tendermint: backend, evidence: b}
+
+	encode := func(ev *Evidence) hexutil.Bytes {
+		encoded, err := rlp.EncodeToBytes(ev)
+		if err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		return encoded
+	}
+
+	cases := []struct {
+		name     string
+		evidence *Evidence
+		want     error
+	}{
+		{"same vote twice", &Evidence{Type: PrevoteDoubleVote, Height: 7, Round: 2, Validator: offender, First: first, Second: first}, core.ErrNoConflict},
+		{"votes of two rounds", &Evidence{Type: PrevoteDoubleVote, Height: 7, Round: 2, Validator: offender, First: first, Second: signedVote(keys[1], 1, 3, blockB)}, core.ErrNoConflict},
+		{"votes of two validators", &Evidence{Type: PrevoteDoubleVote, Height: 7, Round: 2, Validator: offender, First: first, Second: signedVote(keys[2], 1, 2, blockB)}, core.ErrNoConflict},
+		{"prevote and precommit", &Evidence{Type: PrevoteDoubleVote, Height: 7, Round: 2, Validator: offender, First: first, Second: signedVote(keys[1], 2, 2, blockB)}, core.ErrNoConflict},
+		{"wrong type", &Evidence{Type: PrecommitDoubleVote, Height: 7, Round: 2, Validator: offender, First: first, Second: signedVote(keys[1], 1, 2, blockB)}, errEvidenceMismatch},
+		{"wrong validator", &Evidence{Type: PrevoteDoubleVote, Height: 7, Round: 2, Validator: valSet.List()[0].Address(), First: first, Second: signedVote(keys[1], 1, 2, blockB)}, errEvidenceMismatch},
+		{"nil vote against a block vote", &Evidence{Type: PrevoteDoubleVote, Height: 7, Round: 2, Validator: offender, First: first, Second: signedVote(keys[1], 1, 2, common.Hash{})}, nil},
+	}
+	for _, c := range cases {
+		if err := adminAPI.ImportEvidence(encode(c.evidence)); err != c.want {
+			t.Fatalf("%s: have %v, want %v", c.name, err, c.want)
+		}
+	}
+
+	// messages of a non validator are rejected
+	outsider, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	outsiderAddress := crypto.PubkeyToAddress(outsider.PublicKey)
+	ev := &Evidence{Type: PrevoteDoubleVote, Height: 7, Round: 2, Validator: outsiderAddress,
+		First: signedVote(outsider, 1, 2, blockA), Second: signedVote(outsider, 1, 2, blockB)}
+	if err := adminAPI.ImportEvidence(encode(ev)); err == nil {
+		t.Fatalf("evidence of a non validator accepted")
+	}
+	if err := adminAPI.ImportEvidence(hexutil.Bytes{0x01}); err == nil {
+		t.Fatalf("malformed evidence accepted")
+	}
+
+	// only the valid evidence was stored
+	stored, err := API.GetEvidence(7)
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	if len(stored) != 1 || stored[0].Validator != offender || stored[0].Type != PrevoteDoubleVote {
+		t.Fatalf("have %v, want the prevote double vote of %v", stored, offender)
+	}
+}
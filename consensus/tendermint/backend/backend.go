@@ -20,8 +20,11 @@ import (
 	"context"
 	"crypto/ecdsa"
 	"errors"
+	"fmt"
 	"math/big"
+	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/clearmatics/autonity/common"
@@ -30,14 +33,18 @@ import (
 	tendermintCore "github.com/clearmatics/autonity/consensus/tendermint/core"
 	"github.com/clearmatics/autonity/consensus/tendermint/events"
 	"github.com/clearmatics/autonity/consensus/tendermint/validator"
+	"github.com/clearmatics/autonity/contracts/autonity"
 	"github.com/clearmatics/autonity/core"
+	"github.com/clearmatics/autonity/core/state"
 	"github.com/clearmatics/autonity/core/types"
 	"github.com/clearmatics/autonity/core/vm"
 	"github.com/clearmatics/autonity/crypto"
 	"github.com/clearmatics/autonity/ethdb"
 	"github.com/clearmatics/autonity/event"
 	"github.com/clearmatics/autonity/log"
+	"github.com/clearmatics/autonity/p2p/enode"
 	"github.com/clearmatics/autonity/params"
+	"github.com/clearmatics/autonity/trie"
 	"github.com/hashicorp/golang-lru"
 	"github.com/zfjagann/golang-ring"
 )
@@ -47,8 +54,19 @@ const (
 	fetcherID = "tendermint"
 	// ring buffer to be able to handle at maximum 10 rounds, 20 validators and 3 messages types
 	ringCapacity = 10 * 20 * 3
+	// number of nil votes waiting for their subscribers, the next ones are dropped
+	nilVoteQueueSize = 256
 )
 
+// lockStateKey is the database key of the persisted lock state of the core
+var lockStateKey = []byte("tendermint-lock-state")
+
+// sequenceKey is the database key of the persisted message sequence of the core
+var sequenceKey = []byte("tendermint-sequence")
+
+// gossipShuffle picks the peers a message is gossiped to when the fan-out is limited, replaced in tests
+var gossipShuffle = rand.Shuffle
+
 var (
 	// ErrUnauthorizedAddress is returned when given address cannot be found in
 	// current validator set.
@@ -69,12 +87,19 @@ func New(config *tendermintConfig.Config, privateKey *ecdsa.PrivateKey, db ethdb
 	if chainConfig.Tendermint.BlockPeriod != 0 {
 		config.BlockPeriod = chainConfig.Tendermint.BlockPeriod
 	}
+	if chainConfig.Tendermint.SequenceBlock != nil {
+		config.SequenceBlock = new(big.Int).Set(chainConfig.Tendermint.SequenceBlock)
+	}
 
 	config.SetProposerPolicy(tendermintConfig.ProposerPolicy(chainConfig.Tendermint.ProposerPolicy))
 
 	recents, _ := lru.NewARC(inmemorySnapshots)
 	recentMessages, _ := lru.NewARC(inmemoryPeers)
 	knownMessages, _ := lru.NewARC(inmemoryMessages)
+	verifiedProposals, _ := lru.New(inmemoryProposals)
+	recentValidators, _ := lru.New(inmemoryValidators)
+	recentStakes, _ := lru.New(inmemoryValidators)
+	recentPolicies, _ := lru.New(inmemoryPolicies)
 
 	pub := crypto.PubkeyToAddress(privateKey.PublicKey).String()
 	logger := log.New("addr", pub)
@@ -93,9 +118,17 @@ func New(config *tendermintConfig.Config, privateKey *ecdsa.PrivateKey, db ethdb
 		recentMessages: recentMessages,
 		knownMessages:  knownMessages,
 		vmConfig:       vmConfig,
+
+		verifiedProposals: verifiedProposals,
+		recentValidators:  recentValidators,
+		recentStakes:      recentStakes,
+		recentPolicies:    recentPolicies,
+		now:               time.Now,
+		nilVoteQueue:      make(chan events.NilVoteEvent, nilVoteQueueSize),
 	}
 
 	backend.pendingMessages.SetCapacity(ringCapacity)
+	go backend.sendNilVotes()
 	return backend
 }
 
@@ -114,15 +147,41 @@ type Backend struct {
 	currentBlock     func() *types.Block
 	hasBadBlock      func(hash common.Hash) bool
 
-	// the channels for tendermint engine notifications
+	// the channels for tendermint engine notifications. coreMu guards
+	// commitCh, proposedBlockHash, lastCommittedHash, coreStarted and stopped;
+	// none of them may be read or written without holding it.
 	commitCh          chan<- *types.Block
 	proposedBlockHash common.Hash
+	lastCommittedHash common.Hash // hash of the last block handed over by Commit
 	coreStarted       bool
 	stopped           chan struct{}
 	coreMu            sync.RWMutex
+	gossipWg          sync.WaitGroup // messages being sent by Gossip and SyncPeer, drained by Close
+
+	// peers a sync is being sent to, a peer is synced once at a time
+	syncingPeers   map[common.Address]struct{}
+	syncingPeersMu sync.Mutex
 
 	// Snapshots for recent block to speed up reorgs
 	recents *lru.ARCCache
+	// Validators of recent blocks keyed by the hash of their parent header
+	recentValidators *lru.Cache
+	// Stakes of the validators of recent blocks keyed by the hash of their parent header
+	recentStakes *lru.Cache
+	// Proposer policies of recent epochs keyed by the hash of the block they are read at
+	recentPolicies *lru.Cache
+
+	// clock used for the block timestamps checks, tests can freeze it
+	now func() time.Time
+
+	// nil votes go through a feed of their own rather than the event mux, the core queues them without waiting so
+	// that a monitoring subscriber which stops reading never holds up the consensus
+	nilVoteFeed  event.Feed
+	nilVoteQueue chan events.NilVoteEvent
+
+	// optional filter of the transactions of the proposals, none by default
+	txFilter   TransactionFilter
+	txFilterMu sync.RWMutex
 
 	// we save the last received p2p.messages in the ring buffer
 	pendingMessages ring.Ring
@@ -135,8 +194,30 @@ type Backend struct {
 	knownMessages  *lru.ARCCache // the cache of self messages
 
 	autonityContractAddress common.Address // Ethereum address of the white list contract
+	whitelist               []string       // whitelist of the last chain head
+	whitelistMu             sync.Mutex
+	epoch                   uint64 // epoch of the last chain head, valid once epochKnown is set
+	epochKnown              bool
+	epochMu                 sync.Mutex
+	policyContract          proposerPolicyContract // source of the proposer policy, the Autonity contract if nil
 	contractsMu             sync.RWMutex
 	vmConfig                *vm.Config
+
+	// proposals which already passed VerifyProposal by height and hash, until their height is committed
+	verifiedProposals       *lru.Cache
+	verifiedProposalsPruned uint64 // the committed height the cache was last pruned at
+	verifiedProposalsMu     sync.Mutex
+}
+
+// verifiedProposal is the cached outcome of a successful VerifyProposal call
+type verifiedProposal struct {
+	validators []common.Address
+}
+
+// proposalKey identifies a verified proposal in the cache
+type proposalKey struct {
+	number uint64
+	hash   common.Hash
 }
 
 // Address implements tendermint.Backend.Address
@@ -146,19 +227,69 @@ func (sb *Backend) Address() common.Address {
 	return sb.address
 }
 
-func (sb *Backend) Validators(number uint64) validator.Set {
+// Validators implements tendermint.Backend.Validators. An error is returned if the validators or, with the
+// stake-weighted policy, their stakes can't be read, so that no node elects a proposer from partial data.
+func (sb *Backend) Validators(number uint64) (validator.Set, error) {
 	validators, err := sb.retrieveSavedValidators(number, sb.blockchain)
-	proposerPolicy := sb.config.GetProposerPolicy()
 	if err != nil {
-		return validator.NewSet(nil, proposerPolicy)
+		return nil, err
+	}
+	proposerPolicy, err := sb.proposerPolicy(number)
+	if err != nil {
+		return nil, err
+	}
+	if proposerPolicy == tendermintConfig.StakeWeighted {
+		stakes, err := sb.retrieveStakes(number, validators)
+		if err != nil {
+			return nil, err
+		}
+		return validator.NewWeightedSet(number, validators, stakes, proposerPolicy), nil
+	}
+	return validator.NewSet(validators, proposerPolicy), nil
+}
+
+// retrieveStakes returns the stakes of the validators of the block at the given height, as recorded by the
+// Autonity contract in the state of its parent. The blocks before the contract is deployed have no stakes.
+//
+// The stakes are cached by the hash of the parent header they are read at, after a reorg the same height resolves to
+// another parent whose stakes can differ. A cached list is only used if it holds a stake for each of the validators.
+func (sb *Backend) retrieveStakes(number uint64, validators []common.Address) ([]uint64, error) {
+	if number <= 1 {
+		// the Autonity contract is deployed by block #1
+		return nil, nil
+	}
+
+	header := sb.blockchain.GetHeaderByNumber(number - 1)
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+
+	hash := header.Hash()
+	if stakes, ok := sb.recentStakes.Get(hash); ok && len(stakes.([]uint64)) == len(validators) {
+		return stakes.([]uint64), nil
+	}
+
+	state, err := sb.blockchain.StateAt(header.Root)
+	if err != nil {
+		sb.logger.Error("Failed to get state for validator stakes", "number", number, "err", err)
+		return nil, err
 	}
-	return validator.NewSet(validators, proposerPolicy)
+	stakes, err := sb.blockchain.GetAutonityContract().ContractGetStakes(sb.blockchain, header, state, validators)
+	if err != nil {
+		sb.logger.Error("Failed to get validator stakes", "number", number, "err", err)
+		return nil, err
+	}
+
+	sb.recentStakes.Add(hash, stakes)
+	return stakes, nil
 }
 
 // Broadcast implements tendermint.Backend.Broadcast
 func (sb *Backend) Broadcast(ctx context.Context, valSet validator.Set, payload []byte) error {
 	// send to others
-	sb.Gossip(ctx, valSet, payload)
+	if err := sb.Gossip(ctx, valSet, payload); err != nil {
+		return err
+	}
 	// send to self
 	msg := events.MessageEvent{
 		Payload: payload,
@@ -171,9 +302,16 @@ func (sb *Backend) postEvent(event interface{}) {
 	go sb.Post(event)
 }
 
-func (sb *Backend) AskSync(valSet validator.Set) {
+// AskSync asks a quorum of validators for their current height messages. A nil height sends an empty request,
+// otherwise the request carries the given view so that older rounds are left out.
+func (sb *Backend) AskSync(valSet validator.Set, height, round *big.Int) {
 	sb.logger.Info("Broadcasting consensus sync-me")
 
+	var request interface{} = []byte{}
+	if height != nil && round != nil {
+		request = &syncRequest{Height: height, Round: round}
+	}
+
 	targets := make(map[common.Address]struct{})
 	for _, val := range valSet.List() {
 		if val.Address() != sb.Address() {
@@ -190,14 +328,21 @@ func (sb *Backend) AskSync(valSet validator.Set) {
 				break
 			}
 			sb.logger.Info("Asking sync to", "addr", addr)
-			go p.Send(tendermintSyncMsg, []byte{}) //nolint
+			go p.Send(tendermintSyncMsg, request) //nolint
 			count++
 		}
 	}
 }
 
-// Broadcast implements tendermint.Backend.Gossip
-func (sb *Backend) Gossip(ctx context.Context, valSet validator.Set, payload []byte) {
+// Gossip implements tendermint.Backend.Gossip, ErrStoppedEngine is returned once the backend is closed.
+func (sb *Backend) Gossip(ctx context.Context, valSet validator.Set, payload []byte) error {
+	// the read lock is held until the sends are accounted in gossipWg, so that Close can drain them
+	sb.coreMu.RLock()
+	defer sb.coreMu.RUnlock()
+	if !sb.coreStarted {
+		return ErrStoppedEngine
+	}
+
 	hash := types.RLPHash(payload)
 	sb.knownMessages.Add(hash, true)
 
@@ -210,36 +355,51 @@ func (sb *Backend) Gossip(ctx context.Context, valSet validator.Set, payload []b
 
 	if sb.broadcaster != nil && len(targets) > 0 {
 		ps := sb.broadcaster.FindPeers(targets)
-		for addr, p := range ps {
-			ms, ok := sb.recentMessages.Get(addr)
-			var m *lru.ARCCache
-			if ok {
-				m, _ = ms.(*lru.ARCCache)
-				if _, k := m.Get(hash); k {
-					// This peer had this event, skip it
-					continue
-				}
-			} else {
-				m, _ = lru.NewARC(inmemoryMessages)
-			}
-
-			m.Add(hash, true)
-			sb.recentMessages.Add(addr, m)
+		for _, addr := range sb.gossipTargets(ps, hash) {
+			p := ps[addr]
+			sb.peerMessages(addr).Add(hash, true)
+
+			sb.gossipWg.Add(1)
+			go func(p consensus.Peer) {
+				defer sb.gossipWg.Done()
+				sb.sendPayload(p, payload) //nolint
+			}(p)
+		}
+	}
+	return nil
+}
 
-			go p.Send(tendermintMsg, payload) //nolint
+// gossipTargets returns the peers a message is sent to: those which aren't known to have it already, limited to a
+// random subset of config.GossipFanout peers if set. As every node gossips the messages it receives, the peers left
+// out get the message from the others.
+func (sb *Backend) gossipTargets(peers map[common.Address]consensus.Peer, hash common.Hash) []common.Address {
+	addrs := make([]common.Address, 0, len(peers))
+	for addr := range peers {
+		if _, k := sb.peerMessages(addr).Get(hash); k {
+			// This peer had this event, skip it
+			continue
 		}
+		addrs = append(addrs, addr)
+	}
+
+	fanout := sb.config.GetGossipFanout()
+	if fanout == 0 || len(addrs) <= fanout {
+		return addrs
 	}
+	// sorted first so that the selection only depends on gossipShuffle
+	sortAddresses(addrs)
+	gossipShuffle(len(addrs), func(i, j int) { addrs[i], addrs[j] = addrs[j], addrs[i] })
+	return addrs[:fanout]
 }
 
 // Commit implements tendermint.Backend.Commit
-func (sb *Backend) Commit(proposal types.Block, seals [][]byte) error {
+func (sb *Backend) Commit(proposal tendermintCore.Value, seals [][]byte) error {
 	// Check if the proposal is a valid block
-	block := &proposal
-
-	//if block == nil {
-	//	sb.logger.Error("Invalid proposal, %v", proposal)
-	//	return errInvalidProposal
-	//}
+	block, ok := proposal.(*types.Block)
+	if !ok || block == nil {
+		sb.logger.Error("Invalid proposal")
+		return errInvalidProposal
+	}
 
 	h := block.Header()
 	// Append seals into extra-data
@@ -247,19 +407,36 @@ func (sb *Backend) Commit(proposal types.Block, seals [][]byte) error {
 	if err != nil {
 		return err
 	}
+	// Ensure the block gathered enough seals to be accepted by the other validators
+	if _, err = sb.ValidateCommittedSeals(h); err != nil {
+		sb.logger.Error("Invalid committed seals", "number", block.NumberU64(), "seals", len(seals), "err", err)
+		return err
+	}
 	// update block's header
 	block = block.WithSeal(h)
 
-	sb.logger.Info("Committed", "address", sb.Address(), "hash", proposal.Hash(), "number", proposal.Number().Uint64())
+	// the same proposal can be committed again during round changes, it must not be handed over twice
+	if !sb.markCommitted(block) {
+		sb.logger.Debug("Block already committed", "hash", block.Hash(), "number", block.NumberU64())
+		return nil
+	}
+
+	sb.logger.Info("Committed", "address", sb.Address(), "hash", block.Hash(), "number", block.Number().Uint64())
+	if pruned, err := sb.PruneEvidence(block.NumberU64()); err != nil {
+		sb.logger.Error("Failed to prune fault evidence", "err", err)
+	} else if pruned > 0 {
+		sb.logger.Debug("Pruned fault evidence", "entries", pruned)
+	}
 	// - if the proposed and committed blocks are the same, send the proposed hash
 	//   to commit channel, which is being watched inside the engine.Seal() function.
 	// - otherwise, we try to insert the block.
 	// -- if success, the ChainHeadEvent event will be broadcasted, try to build
 	//    the next block and the previous Seal() will be stopped.
 	// -- otherwise, a error will be returned and a round change event will be fired.
-	if sb.proposedBlockHash == block.Hash() && !sb.isResultChanNil() {
-		// feed block hash to Seal() and wait the Seal() result
-		sb.sendResultChan(block)
+	if results := sb.proposedResultChan(block.Hash()); results != nil {
+		// feed block hash to Seal() and wait the Seal() result. The send happens
+		// outside coreMu so a slow miner cannot block Close or Seal.
+		results <- block
 		return nil
 	}
 
@@ -269,6 +446,39 @@ func (sb *Backend) Commit(proposal types.Block, seals [][]byte) error {
 	return nil
 }
 
+// markCommitted records block as the last committed one. It returns false if block was already handed over by
+// Commit or is already part of the chain.
+func (sb *Backend) markCommitted(block *types.Block) bool {
+	hash := block.Hash()
+	if sb.inChain(block) {
+		return false
+	}
+
+	sb.coreMu.Lock()
+	defer sb.coreMu.Unlock()
+	if sb.lastCommittedHash == hash {
+		return false
+	}
+	sb.lastCommittedHash = hash
+	return true
+}
+
+// inChain returns whether block is part of the local chain.
+func (sb *Backend) inChain(block *types.Block) bool {
+	if sb.currentBlock == nil {
+		return false
+	}
+	current := sb.currentBlock()
+	if current == nil || current.NumberU64() < block.NumberU64() {
+		return false
+	}
+	if current.NumberU64() == block.NumberU64() {
+		return current.Hash() == block.Hash()
+	}
+	header := sb.blockchain.GetHeaderByNumber(block.NumberU64())
+	return header != nil && header.Hash() == block.Hash()
+}
+
 func (sb *Backend) Post(ev interface{}) {
 	sb.eventMux.Post(ev)
 }
@@ -277,22 +487,176 @@ func (sb *Backend) Subscribe(types ...interface{}) *event.TypeMuxSubscription {
 	return sb.eventMux.Subscribe(types...)
 }
 
+// SubscribeWhitelistChanges returns a subscription delivering a WhitelistChangedEvent each time a new chain head
+// modifies the whitelist.
+func (sb *Backend) SubscribeWhitelistChanges() *event.TypeMuxSubscription {
+	return sb.eventMux.Subscribe(events.WhitelistChangedEvent{})
+}
+
+// SubscribeEpochs returns a subscription delivering an EpochEvent each time the chain head enters a new epoch.
+func (sb *Backend) SubscribeEpochs() *event.TypeMuxSubscription {
+	return sb.eventMux.Subscribe(events.EpochEvent{})
+}
+
+// SubscribeNilVotes delivers a NilVoteEvent on ch each time the node prevotes or precommits nil because a step
+// timeout expired. The nil votes sent while the subscribers don't keep up are dropped.
+func (sb *Backend) SubscribeNilVotes(ch chan<- events.NilVoteEvent) event.Subscription {
+	return sb.nilVoteFeed.Subscribe(ch)
+}
+
+// ReportNilVote implements core.Backend.ReportNilVote
+func (sb *Backend) ReportNilVote(ev events.NilVoteEvent) {
+	select {
+	case sb.nilVoteQueue <- ev:
+	default:
+		sb.logger.Debug("Nil vote dropped, its subscribers don't keep up", "height", ev.Height, "round", ev.Round)
+	}
+}
+
+// sendNilVotes delivers the queued nil votes to their subscribers for the lifetime of the backend.
+func (sb *Backend) sendNilVotes() {
+	for ev := range sb.nilVoteQueue {
+		sb.nilVoteFeed.Send(ev)
+	}
+}
+
+// SubscribeStalls returns a subscription delivering a StallEvent each time the height stays unchanged for longer
+// than the configured stall threshold. Events are posted synchronously, the subscriber must keep draining them.
+func (sb *Backend) SubscribeStalls() *event.TypeMuxSubscription {
+	return sb.eventMux.Subscribe(events.StallEvent{})
+}
+
 // VerifyProposal implements tendermint.Backend.VerifyProposal
-func (sb *Backend) VerifyProposal(proposal types.Block) (time.Duration, error) {
+func (sb *Backend) VerifyProposal(proposal tendermintCore.Value) (time.Duration, error) {
+	block, ok := proposal.(*types.Block)
+	if !ok {
+		sb.logger.Error("Invalid proposal")
+		return 0, errInvalidProposal
+	}
+
+	ctx := context.Background()
+	if sb.config.VerifyProposalTimeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(sb.config.VerifyProposalTimeout)*time.Millisecond)
+		defer cancel()
+	}
+	return sb.verifyProposal(ctx, block)
+}
+
+// VerifyProposals verifies several proposals, up to the configured number of workers at a time, each one against its
+// own copy of the state of its parent which must be known. The outcome of each proposal is returned at its index and
+// successful verifications are cached like the ones of VerifyProposal, hence this can be used to warm up the cache
+// during catch-up. Consensus still verifies the proposals it handles one at a time.
+func (sb *Backend) VerifyProposals(proposals []*types.Block) ([]time.Duration, []error) {
+	durations := make([]time.Duration, len(proposals))
+	errs := make([]error, len(proposals))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < sb.config.GetVerifyProposalWorkers() && w < len(proposals); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				durations[i], errs[i] = sb.VerifyProposal(proposals[i])
+			}
+		}()
+	}
+	for i := range proposals {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return durations, errs
+}
+
+// validatorsContract is the part of the Autonity contract the validators of a block are read from.
+type validatorsContract interface {
+	ContractGetValidators(chain consensus.ChainReader, header *types.Header, statedb *state.StateDB) ([]common.Address, error)
+}
+
+// DeriveExpectedValidators returns the validators the extra data of the header of the given block must contain. From
+// block #2 they are read from the Autonity contract, hence statedb must be the one of the block after its transactions
+// and the contract redistribution were applied. Block #1 has the validators of the genesis block, which are saved
+// before the contract is deployed.
+func (sb *Backend) DeriveExpectedValidators(blockNumber uint64, header *types.Header, statedb *state.StateDB) ([]common.Address, error) {
+	return sb.deriveExpectedValidators(sb.blockchain.GetAutonityContract(), blockNumber, header, statedb)
+}
+
+func (sb *Backend) deriveExpectedValidators(contract validatorsContract, blockNumber uint64, header *types.Header, statedb *state.StateDB) ([]common.Address, error) {
+	if blockNumber > 1 {
+		return contract.ContractGetValidators(sb.blockchain, header, statedb)
+	}
+	//genesis block and block #1 have the same validators
+	return sb.retrieveSavedValidators(1, sb.blockchain)
+}
+
+// checkProposalSignatures recovers the senders of the transactions of the proposal with up to workers goroutines and
+// returns the error of the first transaction whose signature is invalid, nothing is checked if workers is 0. The
+// remaining transactions are skipped once an invalid signature is found. The recovered senders are cached in the
+// transactions and reused when applying them.
+func (sb *Backend) checkProposalSignatures(block *types.Block, workers int) error {
+	txs := block.Transactions()
+	if workers <= 0 || len(txs) == 0 {
+		return nil
+	}
+	signer := types.MakeSigner(sb.blockchain.Config(), block.Number())
+	errs := make([]error, len(txs))
+
+	var (
+		next   int64 = -1
+		failed int32
+		wg     sync.WaitGroup
+	)
+	for w := 0; w < workers && w < len(txs); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for atomic.LoadInt32(&failed) == 0 {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= len(txs) {
+					return
+				}
+				if _, err := types.Sender(signer, txs[i]); err != nil {
+					errs[i] = err
+					atomic.StoreInt32(&failed, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			sb.logger.Warn("Proposal contains an invalid signature", "hash", block.Hash(), "tx", txs[i].Hash(), "err", err)
+			return &TransactionSignatureError{Index: i, Hash: txs[i].Hash(), Err: err}
+		}
+	}
+	return nil
+}
+
+// verifyProposal verifies the proposal, the application of its transactions is aborted once ctx is done.
+// On success the time spent verifying the proposal is returned.
+func (sb *Backend) verifyProposal(ctx context.Context, block *types.Block) (time.Duration, error) {
+	start := sb.now()
+
 	// Check if the proposal is a valid block
-	// TODO: fix always false statement and check for non nil
-	// TODO: use interface instead of type
-	block := &proposal
-	//if block == nil {
-	//	sb.logger.Error("Invalid proposal, %v", proposal)
-	//	return 0, errInvalidProposal
-	//}
+	if block == nil {
+		sb.logger.Error("Invalid proposal")
+		return 0, errInvalidProposal
+	}
 
 	// check bad block
 	if sb.HasBadProposal(block.Hash()) {
 		return 0, core.ErrBlacklistedHash
 	}
 
+	// the same proposal can be received several times during round changes
+	if _, ok := sb.getVerifiedProposal(block); ok {
+		return sb.now().Sub(start), nil
+	}
+
 	// verify the header of proposed block
 	err := sb.VerifyHeader(sb.blockchain, block.Header(), false)
 	// ignore errEmptyCommittedSeals error because we don't have the committed seals yet
@@ -302,15 +666,29 @@ func (sb *Backend) VerifyProposal(proposal types.Block) (time.Duration, error) {
 			validators []common.Address
 
 			usedGas        = new(uint64)
-			gp             = new(core.GasPool).AddGas(block.GasLimit())
 			header         = block.Header()
 			proposalNumber = header.Number.Uint64()
 			parent         = sb.blockchain.GetBlock(block.ParentHash(), block.NumberU64()-1)
 		)
+		if parent == nil {
+			return 0, consensus.ErrUnknownAncestor
+		}
+
+		// The gas pool is seeded from the declared gas limit, it must be checked before executing anything
+		if err = checkProposalGasLimit(header, parent.Header()); err != nil {
+			return 0, err
+		}
+		gp := new(core.GasPool).AddGas(block.GasLimit())
 
 		// We need to process all of the transaction to get the latest state to get the latest validators
 		state, stateErr := sb.blockchain.StateAt(parent.Root())
 		if stateErr != nil {
+			// a missing trie node means the state of the parent isn't available, e.g. pruned or not synced yet,
+			// rather than the proposal being invalid
+			if _, ok := stateErr.(*trie.MissingNodeError); ok {
+				sb.logger.Warn("Parent state of proposal unavailable", "hash", block.Hash(), "parent", parent.Hash(), "err", stateErr)
+				return 0, consensus.ErrPrunedAncestor
+			}
 			return 0, stateErr
 		}
 
@@ -319,12 +697,39 @@ func (sb *Backend) VerifyProposal(proposal types.Block) (time.Duration, error) {
 			return 0, err
 		}
 
+		// Reject the proposal before applying anything if its transactions can't fit in the block
+		if err = sb.checkProposalGas(block); err != nil {
+			return 0, err
+		}
+
+		// Recovering the senders is cheap compared to applying the transactions, reject a bad signature upfront
+		if err = sb.checkProposalSignatures(block, sb.config.GetVerifyProposalSignatureWorkers()); err != nil {
+			return 0, err
+		}
+
 		// sb.blockchain.Processor().Process() was not called because it calls back Finalize() and would have modified the proposal
-		// Instead only the transactions are applied to the copied state
+		// Instead only the transactions are applied to the copied state, following the same fee rules as the processor
+		minGasPrice := core.MinimumGasPrice(sb.blockchain.GetAutonityContract(), block, state)
+		txFilter := sb.transactionFilter()
 		for i, tx := range block.Transactions() {
+			select {
+			case <-ctx.Done():
+				sb.logger.Error("proposal verification aborted", "hash", block.Hash(), "tx", i, "err", ctx.Err())
+				return 0, errProposalVerificationTimeout
+			default:
+			}
+
+			if err = core.CheckMinimumGasPrice(tx, minGasPrice); err != nil {
+				return 0, err
+			}
+			if txFilter != nil {
+				if filterErr := txFilter(tx); filterErr != nil {
+					sb.logger.Warn("Proposal contains a filtered transaction", "hash", block.Hash(), "tx", tx.Hash(), "err", filterErr)
+					return 0, &FilteredTransactionError{Index: i, Hash: tx.Hash(), Err: filterErr}
+				}
+			}
+
 			state.Prepare(tx.Hash(), block.Hash(), i)
-			// Might be vulnerable to DoS Attack depending on gaslimit
-			// Todo : Double check
 			receipt, _, receiptErr := core.ApplyTransaction(sb.blockchain.Config(), sb.blockchain, nil, gp, state, header, tx, usedGas, *sb.vmConfig)
 			if receiptErr != nil {
 				return 0, receiptErr
@@ -354,16 +759,9 @@ func (sb *Backend) VerifyProposal(proposal types.Block) (time.Duration, error) {
 			return 0, err
 		}
 
-		if proposalNumber > 1 {
-			validators, err = sb.blockchain.GetAutonityContract().ContractGetValidators(sb.blockchain, header, state)
-			if err != nil {
-				return 0, err
-			}
-		} else {
-			validators, err = sb.retrieveSavedValidators(1, sb.blockchain) //genesis block and block #1 have the same validators
-			if err != nil {
-				return 0, err
-			}
+		validators, err = sb.DeriveExpectedValidators(proposalNumber, header, state)
+		if err != nil {
+			return 0, err
 		}
 
 		// Verify the validator set by comparing the validators in extra data and Soma-contract
@@ -377,7 +775,11 @@ func (sb *Backend) VerifyProposal(proposal types.Block) (time.Duration, error) {
 				"extra", tendermintExtra.Validators,
 				"current", validators,
 			)
-			return 0, errInconsistentValidatorSet
+			return 0, &ValidatorSetMismatchError{
+				Index:       -1,
+				ExpectedLen: len(validators),
+				ActualLen:   len(tendermintExtra.Validators),
+			}
 		}
 
 		for i := range validators {
@@ -389,18 +791,109 @@ func (sb *Backend) VerifyProposal(proposal types.Block) (time.Duration, error) {
 					"extra", tendermintExtra.Validators,
 					"current", validators,
 				)
-				return 0, errInconsistentValidatorSet
+				return 0, &ValidatorSetMismatchError{
+					Index:       i,
+					Expected:    validators[i],
+					Actual:      tendermintExtra.Validators[i],
+					ExpectedLen: len(validators),
+					ActualLen:   len(tendermintExtra.Validators),
+				}
 			}
 		}
 		// At this stage extradata field is consistent with the validator list returned by Soma-contract
+		sb.addVerifiedProposal(block, validators)
 
-		return 0, nil
+		return sb.now().Sub(start), nil
 	} else if err == consensus.ErrFutureBlock {
-		return time.Unix(int64(block.Header().Time), 0).Sub(now()), consensus.ErrFutureBlock
+		return time.Unix(int64(block.Header().Time), 0).Sub(sb.now()), consensus.ErrFutureBlock
 	}
 	return 0, err
 }
 
+// checkProposalGas ensures that the transactions of the block obviously exceeding the block gas limit are detected
+// without being executed. Since unused gas is refunded to the pool, only the gas limit of each transaction and the
+// intrinsic gas of all the transactions can be checked against the block gas limit.
+func (sb *Backend) checkProposalGas(block *types.Block) error {
+	var (
+		intrinsicGas uint64
+		homestead    = sb.blockchain.Config().IsHomestead(block.Number())
+	)
+	for _, tx := range block.Transactions() {
+		if tx.Gas() > block.GasLimit() {
+			return errProposalGasLimitExceeded
+		}
+		gas, err := core.IntrinsicGas(tx.Data(), tx.To() == nil, homestead)
+		if err != nil {
+			return err
+		}
+		intrinsicGas += gas
+		if intrinsicGas > block.GasLimit() {
+			return errProposalGasLimitExceeded
+		}
+	}
+	return nil
+}
+
+// checkProposalGasLimit ensures that the gas limit of the header is within the bounds allowed by its parent, the same
+// way the block validator of ethash does, so that a crafted header can't declare an arbitrarily large gas limit.
+func checkProposalGasLimit(header, parent *types.Header) error {
+	// Verify that the gas limit is <= 2^63-1
+	if header.GasLimit > maxGasLimit {
+		return errInvalidGasLimit
+	}
+	// Verify that the gas limit remains within allowed bounds
+	diff := int64(parent.GasLimit) - int64(header.GasLimit)
+	if diff < 0 {
+		diff *= -1
+	}
+	limit := parent.GasLimit / params.GasLimitBoundDivisor
+	if uint64(diff) >= limit || header.GasLimit < params.MinGasLimit {
+		return errInvalidGasLimit
+	}
+	return nil
+}
+
+// getVerifiedProposal returns the cached result of a previous successful verification of the block.
+func (sb *Backend) getVerifiedProposal(block *types.Block) (*verifiedProposal, bool) {
+	sb.verifiedProposalsMu.Lock()
+	defer sb.verifiedProposalsMu.Unlock()
+
+	if block.NumberU64() <= sb.pruneVerifiedProposals() {
+		return nil, false
+	}
+	v, ok := sb.verifiedProposals.Get(proposalKey{number: block.NumberU64(), hash: block.Hash()})
+	if !ok {
+		return nil, false
+	}
+	return v.(*verifiedProposal), true
+}
+
+func (sb *Backend) addVerifiedProposal(block *types.Block, validators []common.Address) {
+	sb.verifiedProposalsMu.Lock()
+	defer sb.verifiedProposalsMu.Unlock()
+
+	if block.NumberU64() <= sb.pruneVerifiedProposals() {
+		return
+	}
+	sb.verifiedProposals.Add(proposalKey{number: block.NumberU64(), hash: block.Hash()}, &verifiedProposal{validators: validators})
+}
+
+// pruneVerifiedProposals removes the proposals of the committed heights from the cache, the proposals of the heights
+// above being kept whatever the order they are looked up in. It returns the committed height and must be called with
+// verifiedProposalsMu held.
+func (sb *Backend) pruneVerifiedProposals() uint64 {
+	committed := sb.blockchain.CurrentBlock().NumberU64()
+	if committed > sb.verifiedProposalsPruned {
+		for _, key := range sb.verifiedProposals.Keys() {
+			if key.(proposalKey).number <= committed {
+				sb.verifiedProposals.Remove(key)
+			}
+		}
+		sb.verifiedProposalsPruned = committed
+	}
+	return committed
+}
+
 // Sign implements tendermint.Backend.Sign
 func (sb *Backend) Sign(data []byte) ([]byte, error) {
 	hashData := crypto.Keccak256(data)
@@ -447,6 +940,30 @@ func (sb *Backend) LastCommittedProposal() (*types.Block, common.Address) {
 	return block, proposer
 }
 
+// RecentProposers returns the proposers of up to the last n committed blocks, most recent first. The walk stops
+// at block #1 as the genesis block has no proposer, hence fewer than n addresses are returned on a short chain.
+func (sb *Backend) RecentProposers(n int) []common.Address {
+	if n <= 0 {
+		return []common.Address{}
+	}
+	header := sb.currentBlock().Header()
+	if number := header.Number.Uint64(); number < uint64(n) {
+		n = int(number)
+	}
+
+	proposers := make([]common.Address, 0, n)
+	for len(proposers) < n && header != nil && header.Number.Sign() > 0 {
+		proposer, err := sb.Author(header)
+		if err != nil {
+			sb.logger.Error("Failed to get block proposer", "number", header.Number, "err", err)
+			break
+		}
+		proposers = append(proposers, proposer)
+		header = sb.blockchain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+	}
+	return proposers
+}
+
 func (sb *Backend) HasBadProposal(hash common.Hash) bool {
 	if sb.hasBadBlock == nil {
 		return false
@@ -464,19 +981,222 @@ func (sb *Backend) GetContractABI() string {
 
 // Whitelist for the current block
 func (sb *Backend) WhiteList() []string {
-	db, err := sb.blockchain.State()
+	enodes, err := sb.whiteList()
 	if err != nil {
 		sb.logger.Error("Failed to get block white list", "err", err)
 		return nil
 	}
+	return enodes
+}
+
+func (sb *Backend) whiteList() ([]string, error) {
+	db, err := sb.blockchain.State()
+	if err != nil {
+		return nil, err
+	}
 
 	enodes, err := sb.blockchain.GetAutonityContract().GetWhitelist(sb.blockchain.CurrentBlock(), db)
+	if err != nil {
+		return nil, err
+	}
+
+	return enodes.StrList, nil
+}
+
+// postWhitelistChange posts a WhitelistChangedEvent if the whitelist of the current block differs from the one
+// of the previous chain head.
+func (sb *Backend) postWhitelistChange() {
+	if sb.blockchain == nil {
+		return
+	}
+
+	whitelist, err := sb.whiteList()
 	if err != nil {
 		sb.logger.Error("Failed to get block white list", "err", err)
-		return nil
+		return
+	}
+
+	sb.whitelistMu.Lock()
+	added, removed := diffEnodes(sb.whitelist, whitelist)
+	sb.whitelist = whitelist
+	sb.whitelistMu.Unlock()
+
+	if len(added) == 0 && len(removed) == 0 {
+		return
 	}
+	sb.logger.Info("Whitelist changed", "added", added, "removed", removed)
+	sb.postEvent(events.WhitelistChangedEvent{Added: added, Removed: removed})
+}
 
-	return enodes.StrList
+// proposerPolicyContract is the part of the Autonity contract the proposer policy is read from.
+type proposerPolicyContract interface {
+	GetProposerPolicy(header *types.Header, statedb *state.StateDB) (uint64, error)
+}
+
+// proposerPolicy returns the proposer policy of the block at the given height. The governance sets it in the
+// Autonity contract, and the blocks of an epoch use the policy in the state of the last block of the previous epoch,
+// so that every node derives the same policy for a height whatever its chain head. The configured policy is used
+// until the contract has one, as well as during the first epoch.
+func (sb *Backend) proposerPolicy(number uint64) (tendermintConfig.ProposerPolicy, error) {
+	configured := sb.config.GetProposerPolicy()
+	if sb.config.Epoch == 0 || number <= 1 {
+		return configured, nil
+	}
+	boundary := (number - 1) / sb.config.Epoch * sb.config.Epoch
+	// the Autonity contract is deployed by block #1
+	if boundary < 1 {
+		return configured, nil
+	}
+
+	header := sb.blockchain.GetHeaderByNumber(boundary)
+	if header == nil {
+		return 0, errUnknownBlock
+	}
+	if policy, ok := sb.recentPolicies.Get(header.Hash()); ok {
+		return policy.(tendermintConfig.ProposerPolicy), nil
+	}
+
+	contract := sb.policyContract
+	if contract == nil {
+		autonityContract := sb.blockchain.GetAutonityContract()
+		if autonityContract == nil {
+			return configured, nil
+		}
+		contract = autonityContract
+	}
+	statedb, err := sb.blockchain.StateAt(header.Root)
+	if err != nil {
+		sb.logger.Error("Failed to get state for proposer policy", "number", boundary, "err", err)
+		return 0, err
+	}
+
+	policy := configured
+	p, err := contract.GetProposerPolicy(header, statedb)
+	switch {
+	case err == autonity.ErrNoProposerPolicy:
+	case err != nil:
+		sb.logger.Error("Failed to read proposer policy", "number", boundary, "err", err)
+		return 0, err
+	case tendermintConfig.ProposerPolicy(p) > tendermintConfig.StakeWeighted:
+		sb.logger.Warn("Ignoring unknown proposer policy", "number", boundary, "policy", p)
+	default:
+		policy = tendermintConfig.ProposerPolicy(p)
+	}
+
+	sb.recentPolicies.Add(header.Hash(), policy)
+	return policy, nil
+}
+
+// postEpochChange posts an EpochEvent if the current block is in a later epoch than the previous chain head, the
+// first chain head seen only setting the current epoch. Several epochs may be crossed at once during a sync, a single
+// event is posted then.
+func (sb *Backend) postEpochChange() {
+	if sb.blockchain == nil || sb.config.Epoch == 0 {
+		return
+	}
+
+	head := sb.blockchain.CurrentBlock()
+	epoch := head.NumberU64() / sb.config.Epoch
+
+	sb.epochMu.Lock()
+	first := !sb.epochKnown
+	crossed := !first && epoch > sb.epoch
+	sb.epoch, sb.epochKnown = epoch, true
+	sb.epochMu.Unlock()
+
+	if !crossed {
+		return
+	}
+	valSet, err := sb.Validators(head.NumberU64() + 1)
+	if err != nil {
+		sb.logger.Warn("Failed to get the validators of the new epoch", "number", head.Number(), "err", err)
+		return
+	}
+	validators := valSet.List()
+	addresses := make([]common.Address, len(validators))
+	for i, val := range validators {
+		addresses[i] = val.Address()
+	}
+	sb.logger.Info("New epoch", "epoch", epoch, "number", head.Number(), "validators", len(addresses))
+	sb.postEvent(events.EpochEvent{Epoch: epoch, Number: head.Number(), Validators: addresses})
+}
+
+// diffEnodes returns the enodes of next which are not in prev and the enodes of prev which are not in next. An enode
+// naming the same node as one of the other list is not reported, so that a whitelisted node whose address changed is
+// neither removed nor added again.
+func diffEnodes(prev, next []string) (added []string, removed []string) {
+	prevSet := make(map[string]struct{}, len(prev))
+	for _, e := range prev {
+		prevSet[e] = struct{}{}
+	}
+	nextSet := make(map[string]struct{}, len(next))
+	for _, e := range next {
+		nextSet[e] = struct{}{}
+		if _, ok := prevSet[e]; !ok {
+			added = append(added, e)
+		}
+	}
+	for _, e := range prev {
+		if _, ok := nextSet[e]; !ok {
+			removed = append(removed, e)
+		}
+	}
+	if len(added) == 0 || len(removed) == 0 {
+		return added, removed
+	}
+
+	// only the changed enodes are parsed, those which don't parse are told apart by their text alone
+	removedNodes := make([]*enode.Node, len(removed))
+	for i, e := range removed {
+		removedNodes[i], _ = enode.ParseV4WithResolve(e)
+	}
+	moved := make([]bool, len(removed))
+	stillAdded := added[:0]
+	for _, e := range added {
+		node, _ := enode.ParseV4WithResolve(e)
+		same := false
+		for i, prevNode := range removedNodes {
+			if node != nil && prevNode != nil && !moved[i] && enode.SameIdentity(node, prevNode) {
+				moved[i], same = true, true
+				break
+			}
+		}
+		if !same {
+			stillAdded = append(stillAdded, e)
+		}
+	}
+	stillRemoved := removed[:0]
+	for i, e := range removed {
+		if !moved[i] {
+			stillRemoved = append(stillRemoved, e)
+		}
+	}
+	if len(stillAdded) == 0 {
+		stillAdded = nil
+	}
+	if len(stillRemoved) == 0 {
+		stillRemoved = nil
+	}
+	return stillAdded, stillRemoved
+}
+
+// WhiteListNodes returns the parsed whitelist for the current block, malformed enodes are skipped.
+func (sb *Backend) WhiteListNodes() []*enode.Node {
+	return sb.parseWhiteList(sb.WhiteList())
+}
+
+func (sb *Backend) parseWhiteList(enodes []string) []*enode.Node {
+	nodes := make([]*enode.Node, 0, len(enodes))
+	for _, enodeStr := range enodes {
+		// the host of a whitelisted enode can be a domain name
+		node, err := enode.ParseV4WithResolve(enodeStr)
+		if err != nil {
+			sb.logger.Warn("Skipping malformed whitelist enode", "enode", enodeStr, "err", err)
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
 }
 
 func (sb *Backend) GetPrivateKey() *ecdsa.PrivateKey {
@@ -496,12 +1216,127 @@ func (sb *Backend) SetPrivateKey(key *ecdsa.PrivateKey) {
 	sb.address = crypto.PubkeyToAddress(key.PublicKey)
 }
 
-// Synchronize new connected peer with current height state
-func (sb *Backend) SyncPeer(address common.Address, messages []*tendermintCore.Message) {
+// SetTransactionFilter sets the filter consulted for every transaction of the proposals being verified, nil
+// removes it. Proposals are only checked against the consensus rules by default, and proposals already verified
+// are not checked again.
+func (sb *Backend) SetTransactionFilter(filter TransactionFilter) {
+	sb.txFilterMu.Lock()
+	defer sb.txFilterMu.Unlock()
+
+	sb.txFilter = filter
+}
+
+func (sb *Backend) transactionFilter() TransactionFilter {
+	sb.txFilterMu.RLock()
+	defer sb.txFilterMu.RUnlock()
+
+	return sb.txFilter
+}
+
+// ValidatorPeers splits validators between the ones which are connected peers of the node and the missing ones.
+type ValidatorPeers struct {
+	Connected []common.Address `json:"connected"`
+	Missing   []common.Address `json:"missing"`
+}
+
+// ConnectedValidators returns which validators of the next block are connected peers of the node, the node itself
+// being left out.
+func (sb *Backend) ConnectedValidators() *ValidatorPeers {
+	valSet, err := sb.Validators(sb.currentBlock().NumberU64() + 1)
+	if err != nil {
+		sb.logger.Warn("Failed to get the validators of the next block", "err", err)
+	}
+	return sb.connectedValidators(valSet)
+}
+
+func (sb *Backend) connectedValidators(valSet validator.Set) *ValidatorPeers {
+	var validators []validator.Validator
+	if valSet != nil {
+		validators = valSet.List()
+	}
+	targets := make(map[common.Address]struct{}, len(validators))
+	for _, val := range validators {
+		if val.Address() != sb.Address() {
+			targets[val.Address()] = struct{}{}
+		}
+	}
+
+	var ps map[common.Address]consensus.Peer
+	if sb.broadcaster != nil && len(targets) > 0 {
+		ps = sb.broadcaster.FindPeers(targets)
+	}
+	peers := &ValidatorPeers{
+		Connected: make([]common.Address, 0, len(targets)),
+		Missing:   make([]common.Address, 0, len(targets)),
+	}
+	for _, val := range validators {
+		if _, ok := targets[val.Address()]; !ok {
+			continue
+		}
+		if _, ok := ps[val.Address()]; ok {
+			peers.Connected = append(peers.Connected, val.Address())
+		} else {
+			peers.Missing = append(peers.Missing, val.Address())
+		}
+	}
+	return peers
+}
+
+// PeersChanged implements consensus.Syncer.PeersChanged, the peer metrics follow the validators connecting and
+// disconnecting.
+func (sb *Backend) PeersChanged() {
+	sb.updatePeerMetrics()
+}
+
+// updatePeerMetrics updates the gauges of the validators of the next block connected to the node.
+func (sb *Backend) updatePeerMetrics() {
+	if sb.currentBlock == nil || sb.blockchain == nil {
+		return
+	}
+	connected, quorumReachable, err := sb.peerConnectivity()
+	if err != nil {
+		sb.logger.Warn("Failed to get the validators of the next block", "err", err)
+		return
+	}
+	tendermintConnectedValidatorsGauge.Update(int64(connected))
+	if quorumReachable {
+		tendermintQuorumReachableGauge.Update(1)
+	} else {
+		tendermintQuorumReachableGauge.Update(0)
+	}
+}
+
+// peerConnectivity returns how many validators of the next block are connected to the node and whether they reach a
+// quorum, the node itself counting toward it when it is one of them.
+func (sb *Backend) peerConnectivity() (connected int, quorumReachable bool, err error) {
+	valSet, err := sb.Validators(sb.currentBlock().NumberU64() + 1)
+	if err != nil {
+		return 0, false, err
+	}
+	connected = len(sb.connectedValidators(valSet).Connected)
+
+	reachable := connected
+	if _, val := valSet.GetByAddress(sb.Address()); val != nil {
+		reachable++
+	}
+	return connected, valSet.Size() > 0 && reachable >= valSet.Quorum(), nil
+}
+
+// SyncPeer synchronizes a newly connected peer with the current height state. The messages are sent in the
+// background in batches of config.SyncBatchSize separated by config.SyncBatchDelay, until ctx is done. The request is
+// dropped while a previous sync is still being sent to the peer.
+func (sb *Backend) SyncPeer(ctx context.Context, address common.Address, messages []*tendermintCore.Message) {
 	if sb.broadcaster == nil {
 		return
 	}
 
+	// the read lock is held until the sync is accounted in gossipWg, so that Close can drain it
+	sb.coreMu.RLock()
+	defer sb.coreMu.RUnlock()
+	if !sb.coreStarted {
+		return
+	}
+
 	sb.logger.Info("Syncing", "peer", address)
 	targets := map[common.Address]struct{}{address: {}}
 	ps := sb.broadcaster.FindPeers(targets)
@@ -509,22 +1344,131 @@ func (sb *Backend) SyncPeer(address common.Address, messages []*tendermintCore.M
 	if !connected {
 		return
 	}
+	payloads := make([][]byte, 0, len(messages))
 	for _, msg := range messages {
 		payload, err := msg.Payload()
 		if err != nil {
 			sb.logger.Debug("Sending", "code", msg.GetCode(), "sig", msg.GetSignature(), "err", err)
 			continue
 		}
-		//We do not save sync messages in the arc cache as recipient could not have been able to process some previous sent.
-		go p.Send(tendermintMsg, payload) //nolint
+		payloads = append(payloads, payload)
+	}
+
+	sb.syncingPeersMu.Lock()
+	defer sb.syncingPeersMu.Unlock()
+	if _, ok := sb.syncingPeers[address]; ok {
+		sb.logger.Debug("Sync already in progress", "peer", address)
+		return
+	}
+	if sb.syncingPeers == nil {
+		sb.syncingPeers = make(map[common.Address]struct{})
+	}
+	sb.syncingPeers[address] = struct{}{}
+
+	sb.gossipWg.Add(1)
+	go func() {
+		defer sb.gossipWg.Done()
+		sb.sendSyncBatches(ctx, address, p, payloads)
+
+		sb.syncingPeersMu.Lock()
+		delete(sb.syncingPeers, address)
+		sb.syncingPeersMu.Unlock()
+	}()
+}
+
+func (sb *Backend) sendSyncBatches(ctx context.Context, address common.Address, p consensus.Peer, payloads [][]byte) {
+	batchSize := sb.config.GetSyncBatchSize()
+	delay := sb.config.GetSyncBatchDelay()
+	for start := 0; start < len(payloads); start += batchSize {
+		if start > 0 {
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				sb.logger.Debug("Syncing aborted", "peer", address, "sent", start, "total", len(payloads))
+				return
+			}
+		}
+		end := start + batchSize
+		if end > len(payloads) {
+			end = len(payloads)
+		}
+		for _, payload := range payloads[start:end] {
+			//We do not save sync messages in the arc cache as recipient could not have been able to process some previous sent.
+			sb.sendPayload(p, payload) //nolint
+		}
+	}
+}
+
+// ResetAllPeerCaches forgets which messages every peer is known to have, so that they are gossiped to all of them
+// again, e.g. once a network partition heals. The messages known to the local node are forgotten too if
+// includeKnown is set. Gossip is held off for the duration.
+func (sb *Backend) ResetAllPeerCaches(includeKnown bool) {
+	sb.coreMu.Lock()
+	defer sb.coreMu.Unlock()
+
+	sb.recentMessages.Purge()
+	if includeKnown {
+		sb.knownMessages.Purge()
 	}
 }
 
 func (sb *Backend) ResetPeerCache(address common.Address) {
 	ms, ok := sb.recentMessages.Get(address)
-	var m *lru.ARCCache
-	if ok {
-		m, _ = ms.(*lru.ARCCache)
+	if !ok {
+		return
+	}
+	if m, ok := ms.(*lru.ARCCache); ok && m != nil {
 		m.Purge()
+		return
+	}
+	// the next message from or to the peer rebuilds its cache
+	sb.logger.Error("Invalid peer message cache, dropping it", "peer", address, "type", fmt.Sprintf("%T", ms))
+	sb.recentMessages.Remove(address)
+}
+
+// peerMessages returns the cache of the messages the peer is known to have, creating it if needed. An entry of an
+// unexpected type is logged and replaced by a new cache.
+func (sb *Backend) peerMessages(address common.Address) *lru.ARCCache {
+	if ms, ok := sb.recentMessages.Get(address); ok {
+		if m, ok := ms.(*lru.ARCCache); ok && m != nil {
+			return m
+		}
+		sb.logger.Error("Invalid peer message cache, rebuilding it", "peer", address, "type", fmt.Sprintf("%T", ms))
+	}
+	m, _ := lru.NewARC(inmemoryMessages)
+	sb.recentMessages.Add(address, m)
+	return m
+}
+
+// SaveLockState implements tendermint.Backend.SaveLockState
+func (sb *Backend) SaveLockState(data []byte) error {
+	return sb.db.Put(lockStateKey, data)
+}
+
+// LoadLockState implements tendermint.Backend.LoadLockState
+func (sb *Backend) LoadLockState() ([]byte, error) {
+	has, err := sb.db.Has(lockStateKey)
+	if err != nil || !has {
+		return nil, err
+	}
+	return sb.db.Get(lockStateKey)
+}
+
+// ForgetMessage implements tendermint.Backend.ForgetMessage
+func (sb *Backend) ForgetMessage(payload []byte) {
+	sb.knownMessages.Remove(types.RLPHash(payload))
+}
+
+// SaveSequence implements tendermint.Backend.SaveSequence
+func (sb *Backend) SaveSequence(data []byte) error {
+	return sb.db.Put(sequenceKey, data)
+}
+
+// LoadSequence implements tendermint.Backend.LoadSequence
+func (sb *Backend) LoadSequence() ([]byte, error) {
+	has, err := sb.db.Has(sequenceKey)
+	if err != nil || !has {
+		return nil, err
 	}
+	return sb.db.Get(sequenceKey)
 }
@@ -20,12 +20,16 @@ import (
 	"bytes"
 	"context"
 	"crypto/ecdsa"
+	"errors"
 	"fmt"
 	"math"
 	"math/big"
+	"net"
 	"reflect"
+	"runtime"
 	"sort"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -38,13 +42,18 @@ import (
 	"github.com/clearmatics/autonity/consensus/tendermint/config"
 	tendermintCore "github.com/clearmatics/autonity/consensus/tendermint/core"
 	tendermintCrypto "github.com/clearmatics/autonity/consensus/tendermint/crypto"
+	"github.com/clearmatics/autonity/consensus/tendermint/events"
 	"github.com/clearmatics/autonity/consensus/tendermint/validator"
+	"github.com/clearmatics/autonity/contracts/autonity"
 	"github.com/clearmatics/autonity/core"
 	"github.com/clearmatics/autonity/core/rawdb"
+	"github.com/clearmatics/autonity/core/state"
 	"github.com/clearmatics/autonity/core/types"
 	"github.com/clearmatics/autonity/core/vm"
 	"github.com/clearmatics/autonity/crypto"
+	"github.com/clearmatics/autonity/event"
 	"github.com/clearmatics/autonity/log"
+	"github.com/clearmatics/autonity/p2p/enode"
 	"github.com/clearmatics/autonity/params"
 	"github.com/clearmatics/autonity/rlp"
 )
@@ -83,13 +92,38 @@ func TestAskSync(t *testing.T) {
 		logger:        log.New("backend", "test", "id", 0),
 	}
 	b.SetBroadcaster(broadcaster)
-	b.AskSync(valSet)
+	b.AskSync(valSet, nil, nil)
 	<-time.NewTimer(2 * time.Second).C
 	if atomic.LoadUint64(&counter) != 5 {
 		t.Fatalf("ask sync message transmission failure")
 	}
 }
 
+func TestAskSyncWithView(t *testing.T) {
+	valSet, _ := newTestValidatorSet(1)
+	addr := valSet.GetByIndex(0).Address()
+	broadcaster := newFakeBroadcaster(addr)
+	b := &Backend{
+		logger: log.New("backend", "test", "id", 0),
+	}
+	b.SetBroadcaster(broadcaster)
+
+	b.AskSync(valSet, big.NewInt(3), big.NewInt(2))
+
+	p := broadcaster.peers[addr]
+	deadline := time.Now().Add(5 * time.Second)
+	for p.sentCount() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("sync request not sent")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	want := &syncRequest{Height: big.NewInt(3), Round: big.NewInt(2)}
+	if have := p.sent[0]; !reflect.DeepEqual(have, want) {
+		t.Fatalf("have %v, want %v", have, want)
+	}
+}
+
 func TestGossip(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -146,16 +180,92 @@ func TestGossip(t *testing.T) {
 	b := &Backend{
 		knownMessages:  knownMessages,
 		recentMessages: recentMessages,
+		coreStarted:    true,
 	}
 	b.SetBroadcaster(broadcaster)
 
-	b.Gossip(context.Background(), valSet, payload)
+	if err := b.Gossip(context.Background(), valSet, payload); err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
 	<-time.NewTimer(2 * time.Second).C
 	if atomic.LoadUint64(&counter) != 4 {
 		t.Fatalf("gossip message transmission failure")
 	}
 }
 
+func TestCloseDrainsGossip(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	valSet, _ := newTestValidatorSet(2)
+	payload, err := rlp.EncodeToBytes([]byte("data"))
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+
+	sending := make(chan struct{})
+	release := make(chan struct{})
+	mockedPeer := consensus.NewMockPeer(ctrl)
+	mockedPeer.EXPECT().Send(gomock.Any(), gomock.Any()).Do(func(msgCode, data interface{}) {
+		close(sending)
+		<-release
+	}).Times(1)
+
+	broadcaster := consensus.NewMockBroadcaster(ctrl)
+	broadcaster.EXPECT().FindPeers(gomock.Any()).Return(map[common.Address]consensus.Peer{
+		valSet.GetByIndex(0).Address(): mockedPeer,
+	})
+
+	knownMessages, err := lru.NewARC(inmemoryMessages)
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	recentMessages, err := lru.NewARC(inmemoryMessages)
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	b := &Backend{
+		knownMessages:  knownMessages,
+		recentMessages: recentMessages,
+		coreStarted:    true,
+		stopped:        make(chan struct{}),
+	}
+	b.SetBroadcaster(broadcaster)
+
+	if err := b.Gossip(context.Background(), valSet, payload); err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	<-sending
+
+	closed := make(chan error)
+	go func() {
+		closed <- b.Close()
+	}()
+
+	// the message being gossiped must be sent before the backend is closed
+	select {
+	case err := <-closed:
+		t.Fatalf("Close returned before the gossip was drained, err=%v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	if err := <-closed; err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+
+	select {
+	case <-b.stopped:
+	default:
+		t.Fatal("backend not stopped after Close")
+	}
+	if err := b.Gossip(context.Background(), valSet, payload); err != ErrStoppedEngine {
+		t.Fatalf("Expected %v, got %v", ErrStoppedEngine, err)
+	}
+	if err := b.Broadcast(context.Background(), valSet, payload); err != ErrStoppedEngine {
+		t.Fatalf("Expected %v, got %v", ErrStoppedEngine, err)
+	}
+}
+
 func TestVerifyProposal(t *testing.T) {
 	blockchain, backend := newBlockChain(1)
 	blocks := make([]*types.Block, 5)
@@ -168,48 +278,621 @@ func TestVerifyProposal(t *testing.T) {
 			parent = blocks[i-1]
 		}
 
-		block, errBlock := makeBlockWithoutSeal(blockchain, backend, parent)
-		if errBlock != nil {
-			t.Fatalf("could not create block %d, err=%s", i, errBlock)
-		}
-		header := block.Header()
+		block, errBlock := makeBlockWithoutSeal(blockchain, backend, parent)
+		if errBlock != nil {
+			t.Fatalf("could not create block %d, err=%s", i, errBlock)
+		}
+		header := block.Header()
+
+		seal, errS := backend.Sign(types.SigHash(header).Bytes())
+		if errS != nil {
+			t.Fatalf("could not sign %d, err=%s", i, errS)
+		}
+		if err := types.WriteSeal(header, seal); err != nil {
+			t.Fatalf("could not write seal %d, err=%s", i, err)
+		}
+		block = block.WithSeal(header)
+
+		// We need to sleep to avoid verifying a block in the future
+		time.Sleep(time.Duration(backend.config.BlockPeriod) * time.Second)
+		if _, err := backend.VerifyProposal(block); err != nil {
+			t.Fatalf("could not verify block %d, err=%s", i, err)
+		}
+		// VerifyProposal dont need committed seals
+		committedSeal, errSC := backend.Sign(PrepareCommittedSeal(block.Hash()))
+		if errSC != nil {
+			t.Fatalf("could not sign commit %d, err=%s", i, errS)
+		}
+		// Append seals into extra-data
+		if err := types.WriteCommittedSeals(header, [][]byte{committedSeal}); err != nil {
+			t.Fatalf("could not write committed seal %d, err=%s", i, err)
+		}
+		block = block.WithSeal(header)
+
+		state, stateErr := blockchain.State()
+		if stateErr != nil {
+			t.Fatalf("could not retrieve state %d, err=%s", i, stateErr)
+		}
+		if status, errW := blockchain.WriteBlockWithState(block, nil, state); status != core.CanonStatTy && errW != nil {
+			t.Fatalf("write block failure %d, err=%s", i, errW)
+		}
+		blocks[i] = block
+	}
+
+}
+
+func TestVerifyProposalNil(t *testing.T) {
+	b := &Backend{
+		config: config.DefaultConfig(),
+		logger: log.New("backend", "test", "id", 0),
+	}
+
+	if _, err := b.VerifyProposal(nil); err != errInvalidProposal {
+		t.Fatalf("error mismatch: have %v, want %v", err, errInvalidProposal)
+	}
+}
+
+func TestVerifyProposalCache(t *testing.T) {
+	blockchain, backend := newBlockChain(1)
+
+	makeSealedBlock := func(parent *types.Block) *types.Block {
+		block, err := makeBlockWithoutSeal(blockchain, backend, parent)
+		if err != nil {
+			t.Fatalf("could not create block, err=%s", err)
+		}
+		block, err = backend.updateBlock(block)
+		if err != nil {
+			t.Fatalf("could not seal block, err=%s", err)
+		}
+		return block
+	}
+
+	block := makeSealedBlock(blockchain.Genesis())
+	// We need to sleep to avoid verifying a block in the future
+	time.Sleep(time.Duration(backend.config.BlockPeriod) * time.Second)
+
+	if _, err := backend.VerifyProposal(block); err != nil {
+		t.Fatalf("could not verify block, err=%s", err)
+	}
+
+	cached, ok := backend.getVerifiedProposal(block)
+	if !ok {
+		t.Fatal("expected the verified proposal to be cached")
+	}
+	extra, err := types.ExtractBFTHeaderExtra(block.Header())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cached.validators, extra.Validators) {
+		t.Fatalf("validators mismatch: have %v, want %v", cached.validators, extra.Validators)
+	}
+
+	if _, err := backend.VerifyProposal(block); err != nil {
+		t.Fatalf("expected cached result <nil>, got %v", err)
+	}
+
+	// the proposals of several heights above the committed one are kept whatever the lookup order
+	futureBlock := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(2)})
+	backend.addVerifiedProposal(futureBlock, nil)
+	for _, b := range []*types.Block{futureBlock, block, futureBlock} {
+		if _, ok := backend.getVerifiedProposal(b); !ok {
+			t.Fatalf("expected the proposal of height %d to be cached", b.NumberU64())
+		}
+	}
+
+	state, err := blockchain.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := blockchain.WriteBlockWithState(block, nil, state); err != nil {
+		t.Fatal(err)
+	}
+
+	nextBlock := makeSealedBlock(block)
+	time.Sleep(time.Duration(backend.config.BlockPeriod) * time.Second)
+
+	if _, err := backend.VerifyProposal(nextBlock); err != nil {
+		t.Fatalf("could not verify block, err=%s", err)
+	}
+	if backend.verifiedProposals.Contains(proposalKey{number: 1, hash: block.Hash()}) {
+		t.Fatal("expected the proposals of the committed height to be pruned")
+	}
+	if !backend.verifiedProposals.Contains(proposalKey{number: 2, hash: nextBlock.Hash()}) {
+		t.Fatal("expected the new height proposal to be cached")
+	}
+	if !backend.verifiedProposals.Contains(proposalKey{number: 2, hash: futureBlock.Hash()}) {
+		t.Fatal("expected the other proposal of the new height to be kept")
+	}
+}
+
+func TestVerifyProposalDuration(t *testing.T) {
+	blockchain, backend := newBlockChain(1)
+	block, err := makeBlockWithoutSeal(blockchain, backend, blockchain.Genesis())
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err = backend.updateBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// We need to sleep to avoid verifying a block in the future
+	time.Sleep(time.Duration(backend.config.BlockPeriod) * time.Second)
+	duration, err := backend.VerifyProposal(block)
+	if err != nil {
+		t.Fatalf("could not verify block, err=%s", err)
+	}
+	if duration <= 0 {
+		t.Fatalf("expected a positive verification duration, got %v", duration)
+	}
+}
+
+func TestVerifyProposalGasLimitExceeded(t *testing.T) {
+	blockchain, backend := newBlockChain(1)
+	block, err := makeBlockWithoutSeal(blockchain, backend, blockchain.Genesis())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := block.Header()
+	tx := types.NewTransaction(0, common.Address{}, common.Big1, header.GasLimit+1, common.Big1, nil)
+	tx, err = types.SignTx(tx, types.NewEIP155Signer(big.NewInt(1)), backend.privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err = backend.updateBlock(types.NewBlock(header, types.Transactions{tx}, nil, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// We need to sleep to avoid verifying a block in the future
+	time.Sleep(time.Duration(backend.config.BlockPeriod) * time.Second)
+	if _, err := backend.VerifyProposal(block); err != errProposalGasLimitExceeded {
+		t.Fatalf("error mismatch: have %v, want %v", err, errProposalGasLimitExceeded)
+	}
+}
+
+func TestVerifyProposalUnknownParent(t *testing.T) {
+	blockchain, backend := newBlockChain(1)
+	block, err := makeBlockWithoutSeal(blockchain, backend, blockchain.Genesis())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the proposal builds on a block which hasn't been imported
+	header := block.Header()
+	header.ParentHash = common.HexToHash("0x0123456789")
+	block, err = backend.updateBlock(types.NewBlock(header, block.Transactions(), nil, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// We need to sleep to avoid verifying a block in the future
+	time.Sleep(time.Duration(backend.config.BlockPeriod) * time.Second)
+	if _, err := backend.VerifyProposal(block); err != consensus.ErrUnknownAncestor {
+		t.Fatalf("error mismatch: have %v, want %v", err, consensus.ErrUnknownAncestor)
+	}
+}
+
+func TestVerifyProposalParentStateUnavailable(t *testing.T) {
+	// the trie nodes aren't cached, so that the state is read from the database
+	blockchain, backend, _ := newBlockChainWithCache(1, &core.CacheConfig{TrieDirtyDisabled: true})
+	parent := blockchain.Genesis()
+	block, err := makeBlockWithoutSeal(blockchain, backend, parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block, err = backend.updateBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	// the state of the parent is pruned
+	if err := backend.db.Delete(parent.Root().Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	// We need to sleep to avoid verifying a block in the future
+	time.Sleep(time.Duration(backend.config.BlockPeriod) * time.Second)
+	if _, err := backend.VerifyProposal(block); err != consensus.ErrPrunedAncestor {
+		t.Fatalf("error mismatch: have %v, want %v", err, consensus.ErrPrunedAncestor)
+	}
+}
+
+func TestVerifyProposalInvalidGasLimit(t *testing.T) {
+	blockchain, backend := newBlockChain(1)
+	parent := blockchain.Genesis()
+	block, err := makeBlockWithoutSeal(blockchain, backend, parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// We need to sleep to avoid verifying a block in the future
+	time.Sleep(time.Duration(backend.config.BlockPeriod) * time.Second)
+
+	for _, gasLimit := range []uint64{math.MaxUint64, maxGasLimit + 1, parent.GasLimit() * 2, params.MinGasLimit - 1} {
+		header := block.Header()
+		header.GasLimit = gasLimit
+		proposal, err := backend.updateBlock(block.WithSeal(header))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := backend.VerifyProposal(proposal); err != errInvalidGasLimit {
+			t.Fatalf("gas limit %d: error mismatch: have %v, want %v", gasLimit, err, errInvalidGasLimit)
+		}
+	}
+}
+
+func TestVerifyProposalMinimumGasPrice(t *testing.T) {
+	blockchain, backend := newBlockChain(1)
+	block, err := makeBlockWithoutSeal(blockchain, backend, blockchain.Genesis())
+	if err != nil {
+		t.Fatal(err)
+	}
+	proposal, err := backend.updateBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend.now = func() time.Time {
+		return time.Unix(int64(proposal.Time()), 0)
+	}
+
+	// the proposal and the processor must agree on both rejecting and accepting the fees
+	process := func() (uint64, error) {
+		state, err := blockchain.StateAt(blockchain.Genesis().Root())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, usedGas, err := blockchain.Processor().Process(proposal, state, vm.Config{})
+		return usedGas, err
+	}
+
+	// block #1 reads the minimum gas price from the genesis config, which also feeds the contract deployment
+	contractConfig := blockchain.Config().AutonityContractConfig
+	minGasPrice := contractConfig.MinGasPrice
+	defer func() { contractConfig.MinGasPrice = minGasPrice }()
+	contractConfig.MinGasPrice = proposal.Transactions()[0].GasPrice().Uint64() + 1
+
+	if _, err := backend.VerifyProposal(proposal); err != core.ErrGasPriceBelowMinimum {
+		t.Fatalf("error mismatch: have %v, want %v", err, core.ErrGasPriceBelowMinimum)
+	}
+	if _, err := process(); err != core.ErrGasPriceBelowMinimum {
+		t.Fatalf("processor error mismatch: have %v, want %v", err, core.ErrGasPriceBelowMinimum)
+	}
+
+	contractConfig.MinGasPrice = minGasPrice
+	if _, err := backend.VerifyProposal(proposal); err != nil {
+		t.Fatalf("error mismatch: have %v, want nil", err)
+	}
+	usedGas, err := process()
+	if err != nil {
+		t.Fatalf("processor error mismatch: have %v, want nil", err)
+	}
+	if usedGas != proposal.GasUsed() {
+		t.Fatalf("used gas mismatch: have %d, want %d", usedGas, proposal.GasUsed())
+	}
+}
+
+func TestVerifyProposalTransactionFilter(t *testing.T) {
+	blockchain, backend := newBlockChain(1)
+	block, err := makeBlockWithoutSeal(blockchain, backend, blockchain.Genesis())
+	if err != nil {
+		t.Fatal(err)
+	}
+	proposal, err := backend.updateBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend.now = func() time.Time {
+		return time.Unix(int64(proposal.Time()), 0)
+	}
+
+	errBlacklisted := errors.New("blacklisted recipient")
+	blacklist := func(addr common.Address) TransactionFilter {
+		return func(tx *types.Transaction) error {
+			if tx.To() != nil && *tx.To() == addr {
+				return errBlacklisted
+			}
+			return nil
+		}
+	}
+
+	// all the transactions of the proposal are sent to the zero address
+	backend.SetTransactionFilter(blacklist(common.Address{}))
+	_, err = backend.VerifyProposal(proposal)
+	filterErr, ok := err.(*FilteredTransactionError)
+	if !ok {
+		t.Fatalf("error mismatch: have %v, want %T", err, filterErr)
+	}
+	if filterErr.Index != 0 || filterErr.Hash != proposal.Transactions()[0].Hash() || !errors.Is(err, errBlacklisted) {
+		t.Fatalf("unexpected filtered transaction error %v", err)
+	}
+
+	backend.SetTransactionFilter(blacklist(getInvalidAddress()))
+	if _, err := backend.VerifyProposal(proposal); err != nil {
+		t.Fatalf("error mismatch: have %v, want nil", err)
+	}
+}
+
+func TestVerifyProposalSignatureCheck(t *testing.T) {
+	blockchain, backend := newBlockChain(1)
+	block, err := makeBlockWithoutSeal(blockchain, backend, blockchain.Genesis())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// replace the signature of the last transaction by an invalid one
+	txs := block.Transactions()
+	badIndex := len(txs) - 1
+	txs[badIndex], err = txs[badIndex].WithSignature(types.NewEIP155Signer(big.NewInt(1)), make([]byte, 65))
+	if err != nil {
+		t.Fatal(err)
+	}
+	proposal, err := backend.updateBlock(types.NewBlock(block.Header(), txs, nil, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend.now = func() time.Time {
+		return time.Unix(int64(proposal.Time()), 0)
+	}
+
+	// the filter is called before applying each transaction
+	var applied int32
+	backend.SetTransactionFilter(func(*types.Transaction) error {
+		atomic.AddInt32(&applied, 1)
+		return nil
+	})
+
+	backend.config.VerifyProposalSignatureWorkers = 2
+	_, err = backend.VerifyProposal(proposal)
+	sigErr, ok := err.(*TransactionSignatureError)
+	if !ok {
+		t.Fatalf("error mismatch: have %v, want %T", err, sigErr)
+	}
+	if sigErr.Index != badIndex || sigErr.Hash != txs[badIndex].Hash() || !errors.Is(err, types.ErrInvalidSig) {
+		t.Fatalf("unexpected signature error %v", err)
+	}
+	if n := atomic.LoadInt32(&applied); n != 0 {
+		t.Fatalf("applied transactions: have %d, want 0", n)
+	}
+
+	// without the check the invalid signature is only found once the previous transactions are applied
+	backend.config.VerifyProposalSignatureWorkers = 0
+	if _, err := backend.VerifyProposal(proposal); err == nil {
+		t.Fatal("expected an error, got <nil>")
+	}
+	if n := atomic.LoadInt32(&applied); n != int32(len(txs)) {
+		t.Fatalf("applied transactions: have %d, want %d", n, len(txs))
+	}
+}
+
+// fakeValidatorsContract returns fixed validators and records the headers it is called with.
+type fakeValidatorsContract struct {
+	validators []common.Address
+	err        error
+	headers    []*types.Header
+}
+
+func (c *fakeValidatorsContract) ContractGetValidators(_ consensus.ChainReader, header *types.Header, _ *state.StateDB) ([]common.Address, error) {
+	c.headers = append(c.headers, header)
+	return c.validators, c.err
+}
+
+func TestDeriveExpectedValidatorsBlockOne(t *testing.T) {
+	blockchain, backend := newBlockChain(4)
+	genesisExtra, err := types.ExtractBFTHeaderExtra(blockchain.Genesis().Header())
+	if err != nil {
+		t.Fatal(err)
+	}
+	contract := &fakeValidatorsContract{validators: []common.Address{getInvalidAddress()}}
+
+	header := makeHeader(blockchain.Genesis(), backend.config)
+	validators, err := backend.deriveExpectedValidators(contract, 1, header, nil)
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	if !reflect.DeepEqual(validators, genesisExtra.Validators) {
+		t.Fatalf("validators mismatch: have %v, want %v", validators, genesisExtra.Validators)
+	}
+	if len(contract.headers) != 0 {
+		t.Fatalf("contract calls: have %d, want 0", len(contract.headers))
+	}
+}
+
+func TestDeriveExpectedValidatorsFromContract(t *testing.T) {
+	blockchain, backend := newBlockChain(1)
+	errContract := errors.New("contract failure")
+	header := &types.Header{Number: big.NewInt(5)}
+
+	contract := &fakeValidatorsContract{validators: []common.Address{{1}, {2}, {3}}}
+	validators, err := backend.deriveExpectedValidators(contract, header.Number.Uint64(), header, nil)
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	if !reflect.DeepEqual(validators, contract.validators) {
+		t.Fatalf("validators mismatch: have %v, want %v", validators, contract.validators)
+	}
+	if len(contract.headers) != 1 || contract.headers[0] != header {
+		t.Fatalf("contract not called with the header of the block: %v", contract.headers)
+	}
+
+	// the validators of the genesis block must not be used as a fallback
+	contract = &fakeValidatorsContract{err: errContract}
+	if _, err := backend.deriveExpectedValidators(contract, 2, blockchain.CurrentHeader(), nil); err != errContract {
+		t.Fatalf("error mismatch: have %v, want %v", err, errContract)
+	}
+}
+
+// newIndependentProposals returns n distinct proposals on top of the genesis block, they only differ by their vanity.
+func newIndependentProposals(n int) (*Backend, []*types.Block, error) {
+	blockchain, backend := newBlockChain(1)
+	block, err := makeBlockWithoutSeal(blockchain, backend, blockchain.Genesis())
+	if err != nil {
+		return nil, nil, err
+	}
+	proposals := make([]*types.Block, n)
+	for i := range proposals {
+		header := block.Header()
+		header.Extra[0] = byte(i)
+		if proposals[i], err = backend.updateBlock(block.WithSeal(header)); err != nil {
+			return nil, nil, err
+		}
+	}
+	backend.now = func() time.Time {
+		return time.Unix(int64(block.Time()), 0)
+	}
+	return backend, proposals, nil
+}
+
+func TestVerifyProposals(t *testing.T) {
+	backend, proposals, err := newIndependentProposals(6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend.config.VerifyProposalWorkers = 3
+
+	// an invalid proposal doesn't affect the others
+	header := proposals[2].Header()
+	header.GasLimit = maxGasLimit + 1
+	if proposals[2], err = backend.updateBlock(proposals[2].WithSeal(header)); err != nil {
+		t.Fatal(err)
+	}
+
+	_, errs := backend.VerifyProposals(proposals)
+	if len(errs) != len(proposals) {
+		t.Fatalf("have %d results, want %d", len(errs), len(proposals))
+	}
+	for i, err := range errs {
+		want := error(nil)
+		if i == 2 {
+			want = errInvalidGasLimit
+		}
+		if err != want {
+			t.Errorf("proposal %d: error mismatch: have %v, want %v", i, err, want)
+		}
+		if _, cached := backend.getVerifiedProposal(proposals[i]); cached != (want == nil) {
+			t.Errorf("proposal %d: have cached %v, want %v", i, cached, want == nil)
+		}
+	}
+}
+
+func BenchmarkVerifyProposals(b *testing.B) {
+	for _, workers := range []uint64{1, 4} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			backend, proposals, err := newIndependentProposals(8)
+			if err != nil {
+				b.Fatal(err)
+			}
+			backend.config.VerifyProposalWorkers = workers
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				backend.verifiedProposals.Purge()
+				if _, errs := backend.VerifyProposals(proposals); errs[0] != nil {
+					b.Fatal(errs[0])
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyProposalFutureBlockDelay(t *testing.T) {
+	blockchain, backend := newBlockChain(1)
+	block, err := makeBlockWithoutSeal(blockchain, backend, blockchain.Genesis())
+	if err != nil {
+		t.Fatal(err)
+	}
+	proposal, err := backend.updateBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the proposal is timestamped 7 seconds ahead of the frozen clock
+	const ahead = 7 * time.Second
+	backend.now = func() time.Time {
+		return time.Unix(int64(proposal.Time()), 0).Add(-ahead)
+	}
+
+	delay, err := backend.VerifyProposal(proposal)
+	if err != consensus.ErrFutureBlock {
+		t.Fatalf("error mismatch: have %v, want %v", err, consensus.ErrFutureBlock)
+	}
+	if delay != ahead {
+		t.Fatalf("delay mismatch: have %v, want %v", delay, ahead)
+	}
+}
+
+func TestVerifyProposalInconsistentValidatorSet(t *testing.T) {
+	blockchain, backend := newBlockChain(1)
+	block, err := makeBlockWithoutSeal(blockchain, backend, blockchain.Genesis())
+	if err != nil {
+		t.Fatal(err)
+	}
 
-		seal, errS := backend.Sign(types.SigHash(header).Bytes())
-		if errS != nil {
-			t.Fatalf("could not sign %d, err=%s", i, errS)
+	// We need to sleep to avoid verifying a block in the future
+	time.Sleep(time.Duration(backend.config.BlockPeriod) * time.Second)
+
+	other := common.HexToAddress("0x0123456789")
+	tests := []struct {
+		validators []common.Address
+		want       ValidatorSetMismatchError
+	}{
+		{
+			validators: []common.Address{backend.address, other},
+			want:       ValidatorSetMismatchError{Index: -1, ExpectedLen: 1, ActualLen: 2},
+		},
+		{
+			validators: []common.Address{other},
+			want:       ValidatorSetMismatchError{Index: 0, Expected: backend.address, Actual: other, ExpectedLen: 1, ActualLen: 1},
+		},
+	}
+	for _, test := range tests {
+		header := block.Header()
+		header.Extra, err = types.PrepareExtra(nil, test.validators)
+		if err != nil {
+			t.Fatal(err)
 		}
-		if err := types.WriteSeal(header, seal); err != nil {
-			t.Fatalf("could not write seal %d, err=%s", i, err)
+		proposal, err := backend.updateBlock(block.WithSeal(header))
+		if err != nil {
+			t.Fatal(err)
 		}
-		block = block.WithSeal(header)
 
-		// We need to sleep to avoid verifying a block in the future
-		time.Sleep(time.Duration(backend.config.BlockPeriod) * time.Second)
-		if _, err := backend.VerifyProposal(*block); err != nil {
-			t.Fatalf("could not verify block %d, err=%s", i, err)
+		_, err = backend.VerifyProposal(proposal)
+		var mismatch *ValidatorSetMismatchError
+		if !errors.As(err, &mismatch) {
+			t.Fatalf("error mismatch: have %v, want %T", err, mismatch)
 		}
-		// VerifyProposal dont need committed seals
-		committedSeal, errSC := backend.Sign(PrepareCommittedSeal(block.Hash()))
-		if errSC != nil {
-			t.Fatalf("could not sign commit %d, err=%s", i, errS)
+		if !errors.Is(err, errInconsistentValidatorSet) {
+			t.Fatalf("error %v does not wrap %v", err, errInconsistentValidatorSet)
 		}
-		// Append seals into extra-data
-		if err := types.WriteCommittedSeals(header, [][]byte{committedSeal}); err != nil {
-			t.Fatalf("could not write committed seal %d, err=%s", i, err)
+		if *mismatch != test.want {
+			t.Fatalf("error fields mismatch: have %+v, want %+v", *mismatch, test.want)
 		}
-		block = block.WithSeal(header)
+	}
+}
 
-		state, stateErr := blockchain.State()
-		if stateErr != nil {
-			t.Fatalf("could not retrieve state %d, err=%s", i, stateErr)
-		}
-		if status, errW := blockchain.WriteBlockWithState(block, nil, state); status != core.CanonStatTy && errW != nil {
-			t.Fatalf("write block failure %d, err=%s", i, errW)
-		}
-		blocks[i] = block
+func TestVerifyProposalTimeout(t *testing.T) {
+	blockchain, backend := newBlockChain(1)
+	block, err := makeBlockWithoutSeal(blockchain, backend, blockchain.Genesis())
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err = backend.updateBlock(block)
+	if err != nil {
+		t.Fatal(err)
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// We need to sleep to avoid verifying a block in the future
+	time.Sleep(time.Duration(backend.config.BlockPeriod) * time.Second)
+	if _, err := backend.verifyProposal(ctx, block); err != errProposalVerificationTimeout {
+		t.Fatalf("error mismatch: have %v, want %v", err, errProposalVerificationTimeout)
+	}
+	if _, ok := backend.getVerifiedProposal(block); ok {
+		t.Fatal("aborted proposal must not be cached")
+	}
 }
+
 func TestResetPeerCache(t *testing.T) {
 	addr := common.HexToAddress("0x01234567890")
 	msgCache, err := lru.NewARC(inmemoryMessages)
@@ -234,6 +917,103 @@ func TestResetPeerCache(t *testing.T) {
 	}
 }
 
+func TestInvalidPeerCache(t *testing.T) {
+	valSet, _ := newTestValidatorSet(2)
+	validators := valSet.List()
+	bad := validators[0].Address()
+	payload, err := rlp.EncodeToBytes([]byte("data"))
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	hash := types.RLPHash(payload)
+
+	newBackend := func(broadcaster consensus.Broadcaster) *Backend {
+		b := newGossipBackend(t, broadcaster)
+		b.logger = log.New("backend", "test", "id", 0)
+		b.recentMessages.Add(bad, "not a cache")
+		return b
+	}
+	checkRebuilt := func(b *Backend) {
+		ms, ok := b.recentMessages.Get(bad)
+		if !ok {
+			t.Fatalf("peer cache missing")
+		}
+		m, ok := ms.(*lru.ARCCache)
+		if !ok {
+			t.Fatalf("have peer cache of type %T, want *lru.ARCCache", ms)
+		}
+		if !m.Contains(hash) {
+			t.Fatalf("message not recorded in the rebuilt peer cache")
+		}
+	}
+
+	t.Run("gossip rebuilds the cache", func(t *testing.T) {
+		broadcaster := newFakeBroadcaster(validators[0].Address(), validators[1].Address())
+		b := newBackend(broadcaster)
+		if err := b.Gossip(context.Background(), valSet, payload); err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		b.gossipWg.Wait()
+		if have := broadcaster.peers[bad].sentCount(); have != 1 {
+			t.Fatalf("have %d messages sent, want 1", have)
+		}
+		checkRebuilt(b)
+	})
+
+	t.Run("received message rebuilds the cache", func(t *testing.T) {
+		b := newBackend(nil)
+		b.eventMux = event.NewTypeMuxSilent(log.New("backend", "test", "id", 0))
+		if _, err := b.HandleMsg(bad, makeMsg(tendermintMsg, payload)); err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		checkRebuilt(b)
+	})
+
+	t.Run("reset drops the cache", func(t *testing.T) {
+		b := newBackend(nil)
+		b.ResetPeerCache(bad)
+		if b.recentMessages.Contains(bad) {
+			t.Fatalf("invalid peer cache kept")
+		}
+	})
+}
+
+func TestResetAllPeerCaches(t *testing.T) {
+	for _, includeKnown := range []bool{false, true} {
+		recentMessages, err := lru.NewARC(inmemoryPeers)
+		if err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		knownMessages, err := lru.NewARC(inmemoryMessages)
+		if err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		hash := common.HexToHash("0x01")
+		knownMessages.Add(hash, true)
+		for i := 0; i < 5; i++ {
+			msgCache, err := lru.NewARC(inmemoryMessages)
+			if err != nil {
+				t.Fatalf("Expected <nil>, got %v", err)
+			}
+			msgCache.Add(hash, true)
+			recentMessages.Add(common.BigToAddress(big.NewInt(int64(i))), msgCache)
+		}
+
+		b := &Backend{
+			recentMessages: recentMessages,
+			knownMessages:  knownMessages,
+		}
+		b.ResetAllPeerCaches(includeKnown)
+
+		if recentMessages.Len() != 0 {
+			t.Fatalf("includeKnown %v: have %d peer caches, want 0", includeKnown, recentMessages.Len())
+		}
+		if have := knownMessages.Contains(hash); have == includeKnown {
+			t.Fatalf("includeKnown %v: known message kept %v", includeKnown, have)
+		}
+	}
+}
+
 func TestHasBadProposal(t *testing.T) {
 	t.Run("callback is not set, false returned", func(t *testing.T) {
 		b := &Backend{}
@@ -336,55 +1116,45 @@ func TestCheckValidatorSignature(t *testing.T) {
 
 func TestCommit(t *testing.T) {
 	t.Run("broadcaster is not set", func(t *testing.T) {
-		backend := newBackend()
+		chain, backend, keys := newBlockChainWithKeys(4)
+		block, err := makeBlockWithoutSeal(chain, backend, chain.Genesis())
+		if err != nil {
+			t.Fatal(err)
+		}
+		expBlock, err := backend.updateBlock(block)
+		if err != nil {
+			t.Fatal(err)
+		}
 
 		commitCh := make(chan *types.Block, 1)
 		backend.setResultChan(commitCh)
+		backend.SetProposedBlockHash(expBlock.Hash())
 
 		// Case: it's a proposer, so the Backend.commit will receive channel result from Backend.Commit function
 		testCases := []struct {
 			expectedErr       error
 			expectedSignature [][]byte
-			expectedBlock     func() types.Block
 		}{
 			{
 				// normal case
 				nil,
-				[][]byte{append([]byte{1}, bytes.Repeat([]byte{0x00}, types.BFTExtraSeal-1)...)},
-				func() types.Block {
-					chain, engine := newBlockChain(1)
-					block, err := makeBlockWithoutSeal(chain, engine, chain.Genesis())
-					if err != nil {
-						t.Fatal(err)
-					}
-					expectedBlock, _ := engine.updateBlock(block)
-					return *expectedBlock
-				},
+				signCommittedSeals(expBlock.Hash(), keys[:3]...),
 			},
 			{
 				// invalid signature
 				types.ErrInvalidCommittedSeals,
-				nil,
-				func() types.Block {
-					chain, engine := newBlockChain(1)
-					block, err := makeBlockWithoutSeal(chain, engine, chain.Genesis())
-					if err != nil {
-						t.Fatal(err)
-					}
-					expectedBlock, _ := engine.updateBlock(block)
-					return *expectedBlock
-				},
+				[][]byte{{0x01}, {0x01}, {0x01}},
+			},
+			{
+				// less seals than quorum
+				errInsufficientCommittedSeals,
+				signCommittedSeals(expBlock.Hash(), keys[0]),
 			},
 		}
 
 		for _, test := range testCases {
-			expBlock := test.expectedBlock()
-
-			backend.proposedBlockHash = expBlock.Hash()
-			if err := backend.Commit(expBlock, test.expectedSignature); err != nil {
-				if err != test.expectedErr {
-					t.Errorf("error mismatch: have %v, want %v", err, test.expectedErr)
-				}
+			if err := backend.Commit(expBlock, test.expectedSignature); err != test.expectedErr {
+				t.Errorf("error mismatch: have %v, want %v", err, test.expectedErr)
 			}
 
 			if test.expectedErr == nil {
@@ -405,58 +1175,351 @@ func TestCommit(t *testing.T) {
 		ctrl := gomock.NewController(t)
 		defer ctrl.Finish()
 
-		blockFactory := func() types.Block {
-			chain, engine := newBlockChain(1)
-			block, err := makeBlockWithoutSeal(chain, engine, chain.Genesis())
-			if err != nil {
-				t.Fatal(err)
-			}
-			expectedBlock, _ := engine.updateBlock(block)
-			return *expectedBlock
+		chain, b := newBlockChain(1)
+		block, err := makeBlockWithoutSeal(chain, b, chain.Genesis())
+		if err != nil {
+			t.Fatal(err)
 		}
-
-		newBlock := blockFactory()
-		seals := [][]byte{append([]byte{1}, bytes.Repeat([]byte{0x00}, types.BFTExtraSeal-1)...)}
+		newBlock, _ := b.updateBlock(block)
+		seals := signCommittedSeals(newBlock.Hash(), b.privateKey)
 
 		broadcaster := consensus.NewMockBroadcaster(ctrl)
 		broadcaster.EXPECT().Enqueue(fetcherID, gomock.Any())
 
-		b := &Backend{
-			broadcaster: broadcaster,
-			logger:      log.New("backend", "test", "id", 0),
+		b.SetBroadcaster(broadcaster)
+
+		err = b.Commit(newBlock, seals)
+		if err != nil {
+			t.Fatalf("expected <nil>, got %v", err)
+		}
+	})
+
+	t.Run("committed twice", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		chain, b := newBlockChain(1)
+		block, err := makeBlockWithoutSeal(chain, b, chain.Genesis())
+		if err != nil {
+			t.Fatal(err)
 		}
+		newBlock, _ := b.updateBlock(block)
+		seals := signCommittedSeals(newBlock.Hash(), b.privateKey)
+
+		// the second commit must not enqueue the block again
+		broadcaster := consensus.NewMockBroadcaster(ctrl)
+		broadcaster.EXPECT().Enqueue(fetcherID, gomock.Any()).Times(1)
 		b.SetBroadcaster(broadcaster)
 
-		err := b.Commit(newBlock, seals)
+		for i := 0; i < 2; i++ {
+			if err := b.Commit(newBlock, seals); err != nil {
+				t.Fatalf("commit %d: expected <nil>, got %v", i, err)
+			}
+		}
+	})
+
+	t.Run("block already in the chain", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		chain, b := newBlockChain(1)
+		block, err := makeBlockWithoutSeal(chain, b, chain.Genesis())
 		if err != nil {
+			t.Fatal(err)
+		}
+		newBlock, _ := b.updateBlock(block)
+		seals := signCommittedSeals(newBlock.Hash(), b.privateKey)
+		header := newBlock.Header()
+		if err = types.WriteCommittedSeals(header, seals); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Until(time.Unix(int64(newBlock.Time()), 0)))
+		if _, err = chain.InsertChain(types.Blocks{newBlock.WithSeal(header)}); err != nil {
+			t.Fatal(err)
+		}
+
+		// no call is expected on the broadcaster
+		b.SetBroadcaster(consensus.NewMockBroadcaster(ctrl))
+		if err := b.Commit(newBlock, seals); err != nil {
 			t.Fatalf("expected <nil>, got %v", err)
 		}
 	})
+
+	t.Run("nil proposal", func(t *testing.T) {
+		b := &Backend{
+			logger: log.New("backend", "test", "id", 0),
+		}
+
+		if err := b.Commit(nil, nil); err != errInvalidProposal {
+			t.Fatalf("error mismatch: have %v, want %v", err, errInvalidProposal)
+		}
+	})
+}
+
+// TestCommitConcurrentWithSeal is meant to be run with -race: Commit reads the
+// proposed hash and the result channel while Seal and the core keep replacing them.
+func TestCommitConcurrentWithSeal(t *testing.T) {
+	chain, engine := newBlockChain(1)
+	block, err := makeBlockWithoutSeal(chain, engine, chain.Genesis())
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err = engine.updateBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seals := signCommittedSeals(block.Hash(), engine.privateKey)
+
+	const rounds = 100
+	commitCh := make(chan *types.Block, 2*rounds)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		// Seal simulation: register the result channel, then the core proposes the block
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			engine.setResultChan(commitCh)
+			engine.SetProposedBlockHash(block.Hash())
+			engine.SetProposedBlockHash(common.Hash{})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			if err := engine.Commit(block, seals); err != nil {
+				t.Errorf("error mismatch: have %v, want nil", err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	// whether it went to Seal or not, the block is handed over only once
+	if n := len(commitCh); n > 1 {
+		t.Fatalf("expected at most 1 block on the result channel, got %d", n)
+	}
+}
+
+func TestValidateCommittedSeals(t *testing.T) {
+	chain, engine, keys := newBlockChainWithKeys(4)
+	block, err := makeBlockWithoutSeal(chain, engine, chain.Genesis())
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err = engine.updateBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outsider, _ := crypto.GenerateKey()
+
+	testCases := []struct {
+		name  string
+		seals [][]byte
+		err   error
+	}{
+		{"valid", signCommittedSeals(block.Hash(), keys[:3]...), nil},
+		{"empty", [][]byte{}, types.ErrEmptyCommittedSeals},
+		{"wrong length", append(signCommittedSeals(block.Hash(), keys[:2]...), []byte{0x01}), types.ErrInvalidCommittedSeals},
+		{"duplicate signer", signCommittedSeals(block.Hash(), keys[0], keys[1], keys[0]), errDuplicateCommittedSeal},
+		{"sub quorum", signCommittedSeals(block.Hash(), keys[:2]...), errInsufficientCommittedSeals},
+		{"unknown signer", signCommittedSeals(block.Hash(), keys[0], keys[1], outsider), types.ErrInvalidCommittedSeals},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			// the seals are written as is, WriteCommittedSeals would reject the malformed ones
+			header := block.Header()
+			extra, err := types.ExtractBFTHeaderExtra(header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			extra.CommittedSeal = test.seals
+			payload, err := rlp.EncodeToBytes(extra)
+			if err != nil {
+				t.Fatal(err)
+			}
+			header.Extra = append(header.Extra[:types.BFTExtraVanity], payload...)
+
+			signers, err := engine.ValidateCommittedSeals(header)
+			if err != test.err {
+				t.Fatalf("error mismatch: have %v, want %v", err, test.err)
+			}
+			if err != nil {
+				return
+			}
+			for i, key := range keys[:3] {
+				if addr := crypto.PubkeyToAddress(key.PublicKey); signers[i] != addr {
+					t.Errorf("signer %d mismatch: have %v, want %v", i, signers[i], addr)
+				}
+			}
+		})
+	}
+}
+
+func TestGetProposer(t *testing.T) {
+	chain, engine := newBlockChain(1)
+	block, err := makeBlock(chain, engine, chain.Genesis())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = chain.InsertChain(types.Blocks{block})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := engine.GetProposer(1)
+	actual := engine.Address()
+	if actual != expected {
+		t.Errorf("proposer mismatch: have %v, want %v", actual.Hex(), expected.Hex())
+	}
+}
+
+func TestValidatorsStakeWeighted(t *testing.T) {
+	chain, engine := newBlockChain(1)
+	block, err := makeBlock(chain, engine, chain.Genesis())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = chain.InsertChain(types.Blocks{block}); err != nil {
+		t.Fatal(err)
+	}
+
+	engine.config.SetProposerPolicy(config.StakeWeighted)
+	valSet, err := engine.Validators(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if valSet.Policy() != config.StakeWeighted {
+		t.Fatalf("policy mismatch: have %v, want %v", valSet.Policy(), config.StakeWeighted)
+	}
+	expected := chain.Config().AutonityContractConfig.Users[0].Stake
+	if weight := valSet.Weight(engine.Address()); weight != expected {
+		t.Fatalf("weight mismatch: have %d, want %d", weight, expected)
+	}
+	if _, ok := engine.recentStakes.Get(block.Hash()); !ok {
+		t.Fatal("expected stakes to be cached")
+	}
+}
+
+func TestRetrieveStakesReorg(t *testing.T) {
+	chain, engine := newBlockChain(1)
+	block, err := makeBlock(chain, engine, chain.Genesis())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = chain.InsertChain(types.Blocks{block}); err != nil {
+		t.Fatal(err)
+	}
+
+	validators := []common.Address{engine.Address()}
+	stakes, err := engine.retrieveStakes(2, validators)
+	if err != nil {
+		t.Fatalf("expected <nil>, got %v", err)
+	}
+
+	// the stakes cached for other validators are read again
+	others := []common.Address{engine.Address(), engine.Address()}
+	otherStakes, err := engine.retrieveStakes(2, others)
+	if err != nil {
+		t.Fatalf("expected <nil>, got %v", err)
+	}
+	if want := []uint64{stakes[0], stakes[0]}; !reflect.DeepEqual(otherStakes, want) {
+		t.Fatalf("stakes mismatch: have %v, want %v", otherStakes, want)
+	}
+
+	// the parent is reorged to a block whose state isn't available, its stakes are read rather than served from the
+	// cache of the abandoned parent
+	header := types.CopyHeader(block.Header())
+	header.Root = common.HexToHash("0x01")
+	rawdb.WriteHeader(engine.db, header)
+	rawdb.WriteCanonicalHash(engine.db, header.Hash(), 1)
+	if _, err := engine.retrieveStakes(2, validators); err == nil {
+		t.Fatal("expected the stakes of the new parent to be read")
+	}
+
+	// the stakes of the abandoned parent are served again once it is back
+	rawdb.WriteCanonicalHash(engine.db, block.Hash(), 1)
+	cached, err := engine.retrieveStakes(2, others)
+	if err != nil {
+		t.Fatalf("expected <nil>, got %v", err)
+	}
+	if !reflect.DeepEqual(cached, otherStakes) {
+		t.Fatalf("stakes mismatch: have %v, want %v", cached, otherStakes)
+	}
+}
+
+func TestValidatorsStakeWeightedMissingState(t *testing.T) {
+	chain, engine := newBlockChain(1)
+	block, err := makeBlock(chain, engine, chain.Genesis())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = chain.InsertChain(types.Blocks{block}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a canonical block whose state isn't available
+	header := types.CopyHeader(block.Header())
+	header.Number = big.NewInt(2)
+	header.ParentHash = block.Hash()
+	header.Root = common.HexToHash("0x01")
+	rawdb.WriteHeader(engine.db, header)
+	rawdb.WriteCanonicalHash(engine.db, header.Hash(), 2)
+
+	// the stakes can't be read, no set falling back to equal weights is returned
+	engine.config.SetProposerPolicy(config.StakeWeighted)
+	if valSet, err := engine.Validators(3); err == nil {
+		t.Fatalf("expected an error, got %v", valSet)
+	}
+	if _, ok := engine.recentStakes.Get(header.Hash()); ok {
+		t.Fatal("expected the failure not to be cached")
+	}
+
+	// the other policies don't need the stakes
+	engine.config.SetProposerPolicy(config.RoundRobin)
+	if _, err := engine.Validators(3); err != nil {
+		t.Fatalf("expected <nil>, got %v", err)
+	}
 }
 
-func TestGetProposer(t *testing.T) {
-	chain, engine := newBlockChain(1)
-	block, err := makeBlock(chain, engine, chain.Genesis())
-	if err != nil {
-		t.Fatal(err)
+func TestLockState(t *testing.T) {
+	b := &Backend{db: rawdb.NewMemoryDatabase()}
+
+	data, err := b.LoadLockState()
+	if err != nil || data != nil {
+		t.Fatalf("expected no lock state, got %v %v", data, err)
 	}
 
-	_, err = chain.InsertChain(types.Blocks{block})
+	if err := b.SaveLockState([]byte{0x1, 0x2}); err != nil {
+		t.Fatalf("expected <nil>, got %v", err)
+	}
+	data, err = b.LoadLockState()
+	if err != nil || !bytes.Equal(data, []byte{0x1, 0x2}) {
+		t.Fatalf("lock state mismatch: have %v %v, want %v", data, err, []byte{0x1, 0x2})
+	}
+}
+
+func TestForgetMessage(t *testing.T) {
+	knownMessages, err := lru.NewARC(inmemoryMessages)
 	if err != nil {
-		t.Fatal(err)
+		t.Fatalf("Expected <nil>, got %v", err)
 	}
+	b := &Backend{knownMessages: knownMessages}
 
-	expected := engine.GetProposer(1)
-	actual := engine.Address()
-	if actual != expected {
-		t.Errorf("proposer mismatch: have %v, want %v", actual.Hex(), expected.Hex())
+	payload := []byte{0x1, 0x2}
+	b.knownMessages.Add(types.RLPHash(payload), true)
+	b.ForgetMessage(payload)
+	if b.knownMessages.Contains(types.RLPHash(payload)) {
+		t.Fatalf("expected the message to be forgotten")
 	}
 }
 
 func TestSyncPeer(t *testing.T) {
 	t.Run("no broadcaster set, nothing done", func(t *testing.T) {
 		b := &Backend{}
-		b.SyncPeer(common.HexToAddress("0x0123456789"), nil)
+		b.SyncPeer(context.Background(), common.HexToAddress("0x0123456789"), nil)
 	})
 
 	t.Run("valid params given, messages sent", func(t *testing.T) {
@@ -495,13 +1558,125 @@ func TestSyncPeer(t *testing.T) {
 		b := &Backend{
 			logger:         log.New("backend", "test", "id", 0),
 			recentMessages: recentMessages,
+			coreStarted:    true,
+		}
+		b.SetBroadcaster(broadcaster)
+
+		b.SyncPeer(context.Background(), peerAddr1, messages)
+		b.gossipWg.Wait()
+	})
+
+	t.Run("engine stopped, nothing sent", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		b := &Backend{logger: log.New("backend", "test", "id", 0)}
+		b.SetBroadcaster(consensus.NewMockBroadcaster(ctrl))
+		b.SyncPeer(context.Background(), common.HexToAddress("0x0123456789"), nil)
+	})
+}
+
+func TestSyncPeerBatches(t *testing.T) {
+	peerAddr := common.HexToAddress("0x0123456789")
+	messages := make([]*tendermintCore.Message, 10)
+	for i := range messages {
+		messages[i] = &tendermintCore.Message{Code: uint64(i), Address: peerAddr}
+	}
+	newSyncBackend := func(batchSize, batchDelay uint64) (*Backend, *fakePeer) {
+		broadcaster := newFakeBroadcaster(peerAddr)
+		b := &Backend{
+			config:      &config.Config{SyncBatchSize: batchSize, SyncBatchDelay: batchDelay},
+			logger:      log.New("backend", "test", "id", 0),
+			coreStarted: true,
 		}
 		b.SetBroadcaster(broadcaster)
+		return b, broadcaster.peers[peerAddr]
+	}
+	waitSent := func(p *fakePeer, want int) {
+		deadline := time.Now().Add(5 * time.Second)
+		for p.sentCount() < want {
+			if time.Now().After(deadline) {
+				t.Fatalf("have %d messages sent, want %d", p.sentCount(), want)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	t.Run("all messages sent in batches", func(t *testing.T) {
+		b, p := newSyncBackend(3, 1)
+		b.SyncPeer(context.Background(), peerAddr, messages)
+		waitSent(p, len(messages))
+
+		time.Sleep(20 * time.Millisecond)
+		if have := p.sentCount(); have != len(messages) {
+			t.Fatalf("have %d messages sent, want %d", have, len(messages))
+		}
+		for i, data := range p.sent {
+			want, err := messages[i].Payload()
+			if err != nil {
+				t.Fatalf("Expected <nil>, got %v", err)
+			}
+			if !bytes.Equal(data.([]byte), want) {
+				t.Fatalf("message %d: payload mismatch", i)
+			}
+		}
+	})
+
+	t.Run("one batch sent before the delay, none after cancellation", func(t *testing.T) {
+		b, p := newSyncBackend(3, uint64(time.Hour/time.Millisecond))
+		ctx, cancel := context.WithCancel(context.Background())
+		b.SyncPeer(ctx, peerAddr, messages)
+		waitSent(p, 3)
+
+		time.Sleep(20 * time.Millisecond)
+		if have := p.sentCount(); have != 3 {
+			t.Fatalf("have %d messages sent, want %d", have, 3)
+		}
+		cancel()
+		time.Sleep(20 * time.Millisecond)
+		if have := p.sentCount(); have != 3 {
+			t.Fatalf("have %d messages sent after cancellation, want %d", have, 3)
+		}
+	})
+
+	t.Run("one sync in flight per peer, drained by close", func(t *testing.T) {
+		b, p := newSyncBackend(3, uint64(time.Hour/time.Millisecond))
+		b.stopped = make(chan struct{})
+		ctx, cancel := context.WithCancel(context.Background())
+		b.SyncPeer(ctx, peerAddr, messages)
+		waitSent(p, 3)
+
+		// the peer is still being synced, the new request is dropped
+		b.SyncPeer(ctx, peerAddr, messages)
+		time.Sleep(20 * time.Millisecond)
+		if have := p.sentCount(); have != 3 {
+			t.Fatalf("have %d messages sent, want %d", have, 3)
+		}
 
-		b.SyncPeer(peerAddr1, messages)
+		closed := make(chan struct{})
+		go func() {
+			b.Close() //nolint
+			close(closed)
+		}()
+		select {
+		case <-closed:
+			t.Fatalf("closed while a sync is in flight")
+		case <-time.After(20 * time.Millisecond):
+		}
+		cancel()
+		select {
+		case <-closed:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("sync not drained by close")
+		}
 
-		wait := time.NewTimer(time.Second)
-		<-wait.C
+		// the peer can be synced again once the previous sync is over
+		b.coreStarted = true
+		b.SyncPeer(context.Background(), peerAddr, messages[:1])
+		b.gossipWg.Wait()
+		if have := p.sentCount(); have != 4 {
+			t.Fatalf("have %d messages sent, want %d", have, 4)
+		}
 	})
 }
 
@@ -541,6 +1716,57 @@ func TestBackendLastCommittedProposal(t *testing.T) {
 	})
 }
 
+func TestBackendRecentProposers(t *testing.T) {
+	chain, engine := newBlockChain(1)
+	if proposers := engine.RecentProposers(3); len(proposers) != 0 {
+		t.Fatalf("expected no proposers at genesis, got %v", proposers)
+	}
+
+	// the blocks are sealed and committed by hand, the single validator is the proposer of all of them
+	parent := chain.Genesis()
+	for i := 0; i < 3; i++ {
+		block, err := makeBlockWithoutSeal(chain, engine, parent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if block, err = engine.updateBlock(block); err != nil {
+			t.Fatal(err)
+		}
+		header := block.Header()
+		if err = types.WriteCommittedSeals(header, signCommittedSeals(block.Hash(), engine.privateKey)); err != nil {
+			t.Fatal(err)
+		}
+		block = block.WithSeal(header)
+		// like Seal, wait for the block timestamp otherwise the block is queued as a future block
+		time.Sleep(time.Until(time.Unix(int64(block.Time()), 0)))
+		if _, err = chain.InsertChain(types.Blocks{block}); err != nil {
+			t.Fatal(err)
+		}
+		parent = block
+	}
+
+	testCases := []struct {
+		n    int
+		want int
+	}{
+		{n: 0, want: 0},
+		{n: 2, want: 2},
+		{n: 3, want: 3},
+		{n: 10, want: 3},
+	}
+	for _, test := range testCases {
+		proposers := engine.RecentProposers(test.n)
+		if len(proposers) != test.want {
+			t.Fatalf("have %d proposers for n=%d, want %d", len(proposers), test.n, test.want)
+		}
+		for _, proposer := range proposers {
+			if proposer != engine.Address() {
+				t.Fatalf("have proposer %v, want %v", proposer, engine.Address())
+			}
+		}
+	}
+}
+
 func TestBackendGetContractAddress(t *testing.T) {
 	chain, engine := newBlockChain(1)
 	block, err := makeBlock(chain, engine, chain.Genesis())
@@ -577,6 +1803,402 @@ func TestBackendWhiteList(t *testing.T) {
 	if strings.Compare(whitelist[0], expectedWhitelist) != 0 {
 		t.Fatalf("unexpected returned whitelist")
 	}
+
+	nodes := engine.WhiteListNodes()
+	if len(nodes) != 1 || nodes[0].URLv4() != expectedWhitelist {
+		t.Fatalf("unexpected returned whitelist nodes %v", nodes)
+	}
+}
+
+func TestBackendWhiteListChanged(t *testing.T) {
+	chain, engine := newBlockChain(1)
+	sub := engine.SubscribeWhitelistChanges()
+	defer sub.Unsubscribe()
+
+	waitChange := func() events.WhitelistChangedEvent {
+		select {
+		case ev := <-sub.Chan():
+			return ev.Data.(events.WhitelistChangedEvent)
+		case <-time.After(time.Second):
+			t.Fatal("whitelist change not notified")
+		}
+		return events.WhitelistChangedEvent{}
+	}
+
+	block, err := makeBlock(chain, engine, chain.Genesis())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = chain.InsertChain(types.Blocks{block}); err != nil {
+		t.Fatal(err)
+	}
+	go engine.NewChainHead()
+
+	ev := waitChange()
+	if !reflect.DeepEqual(ev.Added, []string{EnodeStub}) || len(ev.Removed) != 0 {
+		t.Fatalf("unexpected whitelist change %+v", ev)
+	}
+
+	// simulate a previous head whitelisting an extra node which has been removed since
+	const removedEnode = "enode://d73b857969c86415c0c000371bcebd9ed3cca6c376032b3f65e58e9e2b79276fbc6f59eb1e22fcd6356ab95f42a666f70afd4985933bd8f3e05beb1a2bf8fdde@172.25.0.12:30303"
+	engine.whitelistMu.Lock()
+	engine.whitelist = []string{EnodeStub, removedEnode}
+	engine.whitelistMu.Unlock()
+
+	block, err = makeBlock(chain, engine, block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = chain.InsertChain(types.Blocks{block}); err != nil {
+		t.Fatal(err)
+	}
+	go engine.NewChainHead()
+
+	ev = waitChange()
+	if len(ev.Added) != 0 || !reflect.DeepEqual(ev.Removed, []string{removedEnode}) {
+		t.Fatalf("unexpected whitelist change %+v", ev)
+	}
+
+	// an unchanged whitelist must not be notified
+	go engine.NewChainHead()
+	select {
+	case ev := <-sub.Chan():
+		t.Fatalf("unexpected whitelist change %+v", ev.Data)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestBackendEpochChanged(t *testing.T) {
+	chain, engine := newBlockChain(1)
+	engine.config.Epoch = 2
+	sub := engine.SubscribeEpochs()
+	defer sub.Unsubscribe()
+
+	newHead := func(parent *types.Block) *types.Block {
+		block, err := makeBlock(chain, engine, parent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = chain.InsertChain(types.Blocks{block}); err != nil {
+			t.Fatal(err)
+		}
+		if err := engine.NewChainHead(); err != nil {
+			t.Fatal(err)
+		}
+		return block
+	}
+	noEpochChange := func() {
+		select {
+		case ev := <-sub.Chan():
+			t.Fatalf("unexpected epoch change %+v", ev.Data)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	// the first head only sets the current epoch
+	block := newHead(chain.Genesis())
+	noEpochChange()
+
+	block = newHead(block)
+	select {
+	case ev := <-sub.Chan():
+		epoch := ev.Data.(events.EpochEvent)
+		want := []common.Address{engine.Address()}
+		if epoch.Epoch != 1 || epoch.Number.Uint64() != 2 || !reflect.DeepEqual(epoch.Validators, want) {
+			t.Fatalf("unexpected epoch change %+v, want epoch 1 at block 2 with validators %v", epoch, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("epoch change not notified")
+	}
+
+	// the same head or another head of the same epoch is not notified
+	if err := engine.NewChainHead(); err != nil {
+		t.Fatal(err)
+	}
+	newHead(block)
+	noEpochChange()
+}
+
+// fakePolicyContract returns the proposer policy set at the height of the state it is read at, and records these
+// heights.
+type fakePolicyContract struct {
+	mu       sync.Mutex
+	policies map[uint64]config.ProposerPolicy
+	numbers  []uint64
+}
+
+func (c *fakePolicyContract) GetProposerPolicy(header *types.Header, _ *state.StateDB) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.numbers = append(c.numbers, header.Number.Uint64())
+	policy, ok := c.policies[header.Number.Uint64()]
+	if !ok {
+		return 0, autonity.ErrNoProposerPolicy
+	}
+	return uint64(policy), nil
+}
+
+func TestBackendReportNilVote(t *testing.T) {
+	_, engine := newBlockChain(1)
+
+	ch := make(chan events.NilVoteEvent, 1)
+	sub := engine.SubscribeNilVotes(ch)
+	want := events.NilVoteEvent{Height: big.NewInt(1), Round: 2, Step: "prevote"}
+	engine.ReportNilVote(want)
+	select {
+	case have := <-ch:
+		if !reflect.DeepEqual(have, want) {
+			t.Fatalf("nil vote mismatch: have %v, want %v", have, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("nil vote not delivered")
+	}
+	sub.Unsubscribe()
+
+	// a subscriber which stops reading doesn't hold up the reports, the nil votes are dropped instead
+	stuck := engine.SubscribeNilVotes(make(chan events.NilVoteEvent))
+	defer stuck.Unsubscribe()
+	reported := make(chan struct{})
+	go func() {
+		for i := 0; i < 2*nilVoteQueueSize; i++ {
+			engine.ReportNilVote(events.NilVoteEvent{Height: big.NewInt(1), Round: int64(i), Step: "precommit"})
+		}
+		close(reported)
+	}()
+	select {
+	case <-reported:
+	case <-time.After(time.Second):
+		t.Fatal("nil vote reports held up by a subscriber")
+	}
+}
+
+func TestBackendProposerPolicyEpochChange(t *testing.T) {
+	chain, engine, keys := newBlockChainWithKeys(4)
+	engine.config.Epoch = 2
+	engine.config.SetProposerPolicy(config.RoundRobin)
+	// the governance sets the sticky policy during the first epoch and removes it during the second one
+	contract := &fakePolicyContract{policies: map[uint64]config.ProposerPolicy{2: config.Sticky}}
+	engine.policyContract = contract
+
+	newHead := func(parent *types.Block) *types.Block {
+		block, err := makeBlockWithoutSeal(chain, engine, parent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if block, err = engine.updateBlock(block); err != nil {
+			t.Fatal(err)
+		}
+		header := block.Header()
+		if err := types.WriteCommittedSeals(header, signCommittedSeals(block.Hash(), keys[:3]...)); err != nil {
+			t.Fatal(err)
+		}
+		block = block.WithSeal(header)
+		engine.now = func() time.Time {
+			return time.Unix(int64(block.Time()), 0)
+		}
+		if _, err := chain.InsertChain(types.Blocks{block}); err != nil {
+			t.Fatal(err)
+		}
+		if err := engine.NewChainHead(); err != nil {
+			t.Fatal(err)
+		}
+		return block
+	}
+	policyAt := func(number uint64) config.ProposerPolicy {
+		valSet, err := engine.Validators(number)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return valSet.Policy()
+	}
+
+	block := chain.Genesis()
+	for i := 0; i < 4; i++ {
+		block = newHead(block)
+	}
+
+	// every height uses the policy of the state ending the previous epoch, whatever the chain head
+	for _, test := range []struct {
+		number uint64
+		want   config.ProposerPolicy
+	}{
+		{2, config.RoundRobin},
+		{3, config.Sticky},
+		{4, config.Sticky},
+		{5, config.RoundRobin},
+	} {
+		if have := policyAt(test.number); have != test.want {
+			t.Fatalf("policy of block %d: have %v, want %v", test.number, have, test.want)
+		}
+	}
+
+	// the sticky policy keeps the proposer of the previous block
+	valSet, err := engine.Validators(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := valSet.List()[1].Address()
+	if have := valSet.ProposerAt(last, 0); have != last {
+		t.Fatalf("sticky proposer: have %v, want %v", have, last)
+	}
+
+	// the configured policy isn't changed and the policy of an epoch is read once
+	if have := engine.config.GetProposerPolicy(); have != config.RoundRobin {
+		t.Fatalf("configured policy: have %v, want %v", have, config.RoundRobin)
+	}
+	policyAt(3)
+	contract.mu.Lock()
+	defer contract.mu.Unlock()
+	if want := []uint64{2, 4}; !reflect.DeepEqual(contract.numbers, want) {
+		t.Fatalf("policy read at %v, want %v", contract.numbers, want)
+	}
+}
+
+func TestBackendConnectedValidators(t *testing.T) {
+	_, engine := newBlockChain(4)
+	valSet, err := engine.Validators(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	validators := valSet.List()
+	var others []common.Address
+	targets := make(map[common.Address]struct{})
+	for _, val := range validators {
+		if val.Address() != engine.Address() {
+			others = append(others, val.Address())
+			targets[val.Address()] = struct{}{}
+		}
+	}
+	if len(others) != 3 {
+		t.Fatalf("have %d other validators, want 3", len(others))
+	}
+
+	// only one of the other validators is a connected peer, the node itself is neither connected nor missing
+	broadcaster := newFakeBroadcaster(others[1], common.HexToAddress("0x0123456789"))
+	engine.SetBroadcaster(broadcaster)
+
+	API := &API{peers: engine}
+	peers := API.ConnectedValidators()
+	if want := []common.Address{others[1]}; !reflect.DeepEqual(peers.Connected, want) {
+		t.Fatalf("have connected %v, want %v", peers.Connected, want)
+	}
+	if want := []common.Address{others[0], others[2]}; !reflect.DeepEqual(peers.Missing, want) {
+		t.Fatalf("have missing %v, want %v", peers.Missing, want)
+	}
+	broadcaster.mu.Lock()
+	defer broadcaster.mu.Unlock()
+	if last := broadcaster.finds[len(broadcaster.finds)-1]; !reflect.DeepEqual(last, targets) {
+		t.Fatalf("have targets %v, want %v", last, targets)
+	}
+}
+
+func TestBackendPeerMetrics(t *testing.T) {
+	_, engine := newBlockChain(4)
+	valSet, err := engine.Validators(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var others []common.Address
+	for _, val := range valSet.List() {
+		if val.Address() != engine.Address() {
+			others = append(others, val.Address())
+		}
+	}
+	broadcaster := newFakeBroadcaster(others[0])
+	engine.SetBroadcaster(broadcaster)
+	check := func(wantConnected int, wantReachable bool) {
+		t.Helper()
+		engine.PeersChanged()
+		connected, reachable, err := engine.peerConnectivity()
+		if err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		if connected != wantConnected {
+			t.Fatalf("have %d connected validators, want %d", connected, wantConnected)
+		}
+		if reachable != wantReachable {
+			t.Fatalf("have quorum reachable %v, want %v", reachable, wantReachable)
+		}
+	}
+
+	// the node and one other validator are short of the quorum of 3
+	check(1, false)
+
+	// a second validator connecting reaches it
+	broadcaster.mu.Lock()
+	broadcaster.peers[others[2]] = &fakePeer{}
+	broadcaster.mu.Unlock()
+	check(2, true)
+
+	// and it is lost again once the validator disconnects
+	broadcaster.mu.Lock()
+	delete(broadcaster.peers, others[2])
+	broadcaster.mu.Unlock()
+	check(1, false)
+}
+
+func TestDiffEnodes(t *testing.T) {
+	added, removed := diffEnodes([]string{"a", "b", "c"}, []string{"b", "c", "d"})
+	if !reflect.DeepEqual(added, []string{"d"}) {
+		t.Fatalf("unexpected added enodes %v", added)
+	}
+	if !reflect.DeepEqual(removed, []string{"a"}) {
+		t.Fatalf("unexpected removed enodes %v", removed)
+	}
+
+	added, removed = diffEnodes([]string{"a"}, []string{"a"})
+	if len(added) != 0 || len(removed) != 0 {
+		t.Fatalf("expected no difference, got added %v removed %v", added, removed)
+	}
+
+	// a node whose IP changed is neither removed nor added
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := enode.NewV4(&key.PublicKey, net.ParseIP("172.25.0.11"), 30303, 30303).URLv4()
+	moved := enode.NewV4(&key.PublicKey, net.ParseIP("172.25.0.12"), 30303, 30303).URLv4()
+	other := enode.NewV4(&otherKey.PublicKey, net.ParseIP("172.25.0.11"), 30303, 30303).URLv4()
+	added, removed = diffEnodes([]string{node, "a"}, []string{moved, "a"})
+	if len(added) != 0 || len(removed) != 0 {
+		t.Fatalf("expected no difference, got added %v removed %v", added, removed)
+	}
+
+	// another node taking over its IP replaces it
+	added, removed = diffEnodes([]string{node}, []string{other})
+	if !reflect.DeepEqual(added, []string{other}) || !reflect.DeepEqual(removed, []string{node}) {
+		t.Fatalf("unexpected difference, got added %v removed %v", added, removed)
+	}
+}
+
+func TestBackendParseWhiteList(t *testing.T) {
+	b := &Backend{
+		logger: log.New("backend", "test", "id", 0),
+	}
+	const pubkey = "d73b857969c86415c0c000371bcebd9ed3cca6c376032b3f65e58e9e2b79276fbc6f59eb1e22fcd6356ab95f42a666f70afd4985933bd8f3e05beb1a2bf8fdde"
+
+	nodes := b.parseWhiteList([]string{
+		EnodeStub,
+		"enode://" + pubkey + "@localhost:30304",
+		"enode://" + pubkey[:10] + "@172.25.0.11:30303",
+		"http://" + pubkey + "@172.25.0.11:30303",
+		"enode://" + pubkey + "@172.25.0.11:port",
+		"not an enode",
+	})
+
+	if len(nodes) != 2 {
+		t.Fatalf("expected 2 valid enodes, got %d", len(nodes))
+	}
+	if nodes[0].URLv4() != EnodeStub {
+		t.Fatalf("enode mismatch: have %v, want %v", nodes[0].URLv4(), EnodeStub)
+	}
+	if !nodes[1].IP().IsLoopback() || nodes[1].TCP() != 30304 {
+		t.Fatalf("expected localhost to be resolved, got %v", nodes[1].URLv4())
+	}
 }
 
 /**
@@ -636,7 +2258,100 @@ func newBackend() (b *Backend) {
 // in this test, we can set n to 1, and it means we can process Istanbul and commit a
 // block by one node. Otherwise, if n is larger than 1, we have to generate
 // other fake events to process Istanbul.
+func TestCoreStartStopNoGoroutineLeak(t *testing.T) {
+	chain, _ := newBlockChain(1)
+	engine := chain.Engine().(consensus.BFT)
+
+	if err := engine.Close(); err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	baseline := runtime.NumGoroutine()
+
+	for i := 0; i < 10; i++ {
+		if err := engine.Start(context.Background(), chain, chain.CurrentBlock, chain.HasBadBlock); err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		if err := engine.Close(); err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+	}
+
+	// leave some time to the goroutines not owned by the core, such as timers, to exit
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > baseline && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > baseline {
+		t.Fatalf("goroutines leaked: %d running, expected at most %d", n, baseline)
+	}
+}
+
+func TestCoreStopWaitsForGoroutines(t *testing.T) {
+	consensusLoops := []string{
+		"(*core).handleNewUnminedBlockEvent(",
+		"(*core).handleConsensusEvents(",
+		"(*core).syncLoop(",
+	}
+	// cores started by other tests are never stopped, only the loops of this one have to be gone after Stop
+	running := func() map[string]int {
+		buf := make([]byte, 1<<24)
+		stacks := string(buf[:runtime.Stack(buf, true)])
+		counts := make(map[string]int)
+		for _, fn := range consensusLoops {
+			counts[fn] = strings.Count(stacks, fn)
+		}
+		return counts
+	}
+	started := func(base map[string]int) bool {
+		counts := running()
+		for _, fn := range consensusLoops {
+			if counts[fn] != base[fn]+1 {
+				return false
+			}
+		}
+		return true
+	}
+
+	base := running()
+	chain, b := newBlockChain(1)
+	engine := chain.Engine().(consensus.BFT)
+
+	// the sync loop only starts once the first round got a proposal
+	if _, err := makeBlock(chain, b, chain.Genesis()); err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !started(base) {
+		if time.Now().After(deadline) {
+			t.Fatalf("consensus loops not started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := engine.Close(); err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+
+	after := running()
+	for _, fn := range consensusLoops {
+		if after[fn] != base[fn] {
+			t.Errorf("%s still running after Stop", strings.TrimSuffix(fn, "("))
+		}
+	}
+}
+
 func newBlockChain(n int) (*core.BlockChain, *Backend) {
+	chain, b, _ := newBlockChainWithKeys(n)
+	return chain, b
+}
+
+// newBlockChainWithKeys is newBlockChain also returning the keys of the genesis validators.
+func newBlockChainWithKeys(n int) (*core.BlockChain, *Backend, []*ecdsa.PrivateKey) {
+	return newBlockChainWithCache(n, nil)
+}
+
+// newBlockChainWithCache is newBlockChainWithKeys with the given cache config of the chain, nil meaning the default.
+func newBlockChainWithCache(n int, cacheConfig *core.CacheConfig) (*core.BlockChain, *Backend, []*ecdsa.PrivateKey) {
 	genesis, nodeKeys := getGenesisAndKeys(n)
 	memDB := rawdb.NewMemoryDatabase()
 	cfg := config.DefaultConfig()
@@ -645,7 +2360,7 @@ func newBlockChain(n int) (*core.BlockChain, *Backend) {
 	c := tendermintCore.New(b, cfg)
 
 	genesis.MustCommit(memDB)
-	blockchain, err := core.NewBlockChain(memDB, nil, genesis.Config, c, vm.Config{}, nil, core.NewTxSenderCacher())
+	blockchain, err := core.NewBlockChain(memDB, cacheConfig, genesis.Config, c, vm.Config{}, nil, core.NewTxSenderCacher())
 	if err != nil {
 		panic(err)
 	}
@@ -655,8 +2370,8 @@ func newBlockChain(n int) (*core.BlockChain, *Backend) {
 		panic(err)
 	}
 
-	validators := b.Validators(0)
-	if validators.Size() == 0 {
+	validators, err := b.Validators(0)
+	if err != nil || validators.Size() == 0 {
 		panic("failed to get validators")
 	}
 	proposerAddr := validators.GetProposer().Address()
@@ -669,7 +2384,16 @@ func newBlockChain(n int) (*core.BlockChain, *Backend) {
 		}
 	}
 
-	return blockchain, b
+	return blockchain, b, nodeKeys
+}
+
+// signCommittedSeals returns the committed seals of the block hash signed by each of the keys.
+func signCommittedSeals(hash common.Hash, keys ...*ecdsa.PrivateKey) [][]byte {
+	seals := make([][]byte, len(keys))
+	for i, key := range keys {
+		seals[i], _ = crypto.Sign(crypto.Keccak256(tendermintCore.PrepareCommittedSeal(hash)), key)
+	}
+	return seals
 }
 
 func getGenesisAndKeys(n int) (*core.Genesis, []*ecdsa.PrivateKey) {
@@ -0,0 +1,382 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/clearmatics/autonity/common"
+	"github.com/clearmatics/autonity/consensus"
+	"github.com/clearmatics/autonity/consensus/tendermint/config"
+	tendermintCore "github.com/clearmatics/autonity/consensus/tendermint/core"
+	"github.com/clearmatics/autonity/consensus/tendermint/events"
+	"github.com/clearmatics/autonity/core/types"
+	"github.com/clearmatics/autonity/event"
+	"github.com/clearmatics/autonity/log"
+	"github.com/clearmatics/autonity/rlp"
+	"github.com/golang/snappy"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// fakeBroadcaster is a consensus.Broadcaster recording the calls made on it, it
+// returns the registered peers which are among the requested targets.
+type fakeBroadcaster struct {
+	mu       sync.Mutex
+	peers    map[common.Address]*fakePeer
+	finds    []map[common.Address]struct{}
+	enqueued []*types.Block
+}
+
+func newFakeBroadcaster(addresses ...common.Address) *fakeBroadcaster {
+	fb := &fakeBroadcaster{peers: make(map[common.Address]*fakePeer)}
+	for _, addr := range addresses {
+		fb.peers[addr] = &fakePeer{}
+	}
+	return fb
+}
+
+func (fb *fakeBroadcaster) Enqueue(id string, block *types.Block) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	fb.enqueued = append(fb.enqueued, block)
+}
+
+func (fb *fakeBroadcaster) FindPeers(targets map[common.Address]struct{}) map[common.Address]consensus.Peer {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	fb.finds = append(fb.finds, targets)
+	ps := make(map[common.Address]consensus.Peer)
+	for addr := range targets {
+		if p, ok := fb.peers[addr]; ok {
+			ps[addr] = p
+		}
+	}
+	return ps
+}
+
+// fakePeer is a consensus.Peer recording the messages sent to it.
+type fakePeer struct {
+	mu          sync.Mutex
+	sent        []interface{}
+	codes       []uint64
+	compression bool
+}
+
+func (p *fakePeer) SupportsCompression() bool {
+	return p.compression
+}
+
+func (p *fakePeer) Send(msgcode uint64, data interface{}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sent = append(p.sent, data)
+	p.codes = append(p.codes, msgcode)
+	return nil
+}
+
+func (p *fakePeer) sentCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.sent)
+}
+
+func newGossipBackend(t *testing.T, broadcaster consensus.Broadcaster) *Backend {
+	knownMessages, err := lru.NewARC(inmemoryMessages)
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	recentMessages, err := lru.NewARC(inmemoryMessages)
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	b := &Backend{
+		knownMessages:  knownMessages,
+		recentMessages: recentMessages,
+		coreStarted:    true,
+	}
+	b.SetBroadcaster(broadcaster)
+	return b
+}
+
+func TestGossipSkipsSeenPeers(t *testing.T) {
+	valSet, _ := newTestValidatorSet(4)
+	var addresses []common.Address
+	for _, val := range valSet.List() {
+		addresses = append(addresses, val.Address())
+	}
+	broadcaster := newFakeBroadcaster(addresses...)
+	b := newGossipBackend(t, broadcaster)
+
+	payload, err := rlp.EncodeToBytes([]byte("data"))
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+
+	// the message is sent once to every peer however many times it is gossiped
+	for i := 0; i < 3; i++ {
+		if err := b.Gossip(context.Background(), valSet, payload); err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		b.gossipWg.Wait()
+	}
+	for addr, p := range broadcaster.peers {
+		if have := p.sentCount(); have != 1 {
+			t.Errorf("peer %v: have %d messages, want 1", addr.String(), have)
+		}
+	}
+
+	// a new message reaches every peer again
+	other, err := rlp.EncodeToBytes([]byte("other"))
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	if err := b.Gossip(context.Background(), valSet, other); err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	b.gossipWg.Wait()
+	for addr, p := range broadcaster.peers {
+		if have := p.sentCount(); have != 2 {
+			t.Errorf("peer %v: have %d messages, want 2", addr.String(), have)
+		}
+	}
+	if len(broadcaster.finds) != 4 {
+		t.Fatalf("have %d FindPeers calls, want 4", len(broadcaster.finds))
+	}
+}
+
+func TestGossipSkipsPeerWithMessage(t *testing.T) {
+	valSet, _ := newTestValidatorSet(3)
+	validators := valSet.List()
+	broadcaster := newFakeBroadcaster(validators[0].Address(), validators[1].Address(), validators[2].Address())
+	b := newGossipBackend(t, broadcaster)
+
+	payload, err := rlp.EncodeToBytes([]byte("data"))
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	seen, err := lru.NewARC(inmemoryMessages)
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	seen.Add(types.RLPHash(payload), true)
+	b.recentMessages.Add(validators[1].Address(), seen)
+
+	if err := b.Gossip(context.Background(), valSet, payload); err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	b.gossipWg.Wait()
+	for i, val := range validators {
+		want := 1
+		if i == 1 {
+			want = 0
+		}
+		if have := broadcaster.peers[val.Address()].sentCount(); have != want {
+			t.Errorf("peer %d: have %d messages, want %d", i, have, want)
+		}
+	}
+}
+
+func TestGossipFanout(t *testing.T) {
+	valSet, _ := newTestValidatorSet(10)
+	var addresses []common.Address
+	for _, val := range valSet.List() {
+		addresses = append(addresses, val.Address())
+	}
+	broadcaster := newFakeBroadcaster(addresses...)
+	b := newGossipBackend(t, broadcaster)
+	b.config = &config.Config{GossipFanout: 3}
+
+	payload, err := rlp.EncodeToBytes([]byte("data"))
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	sent := func() (total, peers int) {
+		for _, p := range broadcaster.peers {
+			total += p.sentCount()
+			if p.sentCount() > 0 {
+				peers++
+			}
+		}
+		return total, peers
+	}
+
+	if err := b.Gossip(context.Background(), valSet, payload); err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	b.gossipWg.Wait()
+	if total, peers := sent(); total != 3 || peers != 3 {
+		t.Fatalf("have %d messages sent to %d peers, want 3 to 3", total, peers)
+	}
+
+	// gossiping the message again picks among the peers which don't have it yet
+	if err := b.Gossip(context.Background(), valSet, payload); err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	b.gossipWg.Wait()
+	if total, peers := sent(); total != 6 || peers != 6 {
+		t.Fatalf("have %d messages sent to %d peers, want 6 to 6", total, peers)
+	}
+}
+
+func TestGossipFanoutReachesAll(t *testing.T) {
+	defer func(shuffle func(int, func(int, int))) { gossipShuffle = shuffle }(gossipShuffle)
+	gossipShuffle = rand.New(rand.NewSource(1)).Shuffle
+
+	const n, fanout = 30, 6
+	valSet, _ := newTestValidatorSet(n)
+	var addresses []common.Address
+	for _, val := range valSet.List() {
+		addresses = append(addresses, val.Address())
+	}
+	index := make(map[common.Address]int, n)
+	nodes := make([]*Backend, n)
+	broadcasters := make([]*fakeBroadcaster, n)
+	for i, addr := range addresses {
+		index[addr] = i
+		broadcasters[i] = newFakeBroadcaster(addresses...)
+		nodes[i] = newGossipBackend(t, broadcasters[i])
+		nodes[i].address = addr
+		nodes[i].config = &config.Config{GossipFanout: fanout}
+	}
+
+	payload, err := rlp.EncodeToBytes([]byte("data"))
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	hash := types.RLPHash(payload)
+
+	// every node gossips the message the first time it gets it, as the core does, and records who sent it
+	received := map[int]bool{0: true}
+	delivered := make([]map[common.Address]int, n)
+	queue := []int{0}
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		if err := nodes[i].Gossip(context.Background(), valSet, payload); err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		nodes[i].gossipWg.Wait()
+
+		if delivered[i] == nil {
+			delivered[i] = make(map[common.Address]int)
+		}
+		for _, addr := range addresses {
+			count := broadcasters[i].peers[addr].sentCount()
+			if count == delivered[i][addr] {
+				continue
+			}
+			delivered[i][addr] = count
+			j := index[addr]
+			nodes[j].peerMessages(addresses[i]).Add(hash, true)
+			if !received[j] {
+				received[j] = true
+				queue = append(queue, j)
+			}
+		}
+	}
+
+	if len(received) != n {
+		t.Fatalf("message reached %d nodes, want %d", len(received), n)
+	}
+	var total int
+	for _, fb := range broadcasters {
+		for _, p := range fb.peers {
+			total += p.sentCount()
+		}
+	}
+	if total > n*fanout {
+		t.Fatalf("have %d messages sent, want at most %d", total, n*fanout)
+	}
+	t.Logf("%d messages sent with a fan-out of %d, %d without", total, fanout, n*(n-1))
+}
+
+func TestGossipCompression(t *testing.T) {
+	valSet, _ := newTestValidatorSet(3)
+	validators := valSet.List()
+	broadcaster := newFakeBroadcaster(validators[0].Address(), validators[1].Address(), validators[2].Address())
+	broadcaster.peers[validators[1].Address()].compression = true
+	b := newGossipBackend(t, broadcaster)
+	b.config = &config.Config{CompressionThreshold: 256}
+
+	// a proposal carries a block, large and repetitive enough to be worth compressing
+	proposal := &tendermintCore.Message{
+		Code:    0, // proposal
+		Msg:     bytes.Repeat([]byte("block"), 1000),
+		Address: validators[0].Address(),
+	}
+	payload, err := proposal.Payload()
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	// a vote is small and sent as is
+	vote, err := (&tendermintCore.Message{Code: 1, Address: validators[0].Address()}).Payload()
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+
+	for _, p := range [][]byte{payload, vote} {
+		if err := b.Gossip(context.Background(), valSet, p); err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		b.gossipWg.Wait()
+	}
+
+	// the peer on an older protocol version gets everything uncompressed
+	if old := broadcaster.peers[validators[2].Address()]; len(old.codes) != 2 || old.codes[0] != tendermintMsg || old.codes[1] != tendermintMsg {
+		t.Fatalf("have codes %v, want [%d %d]", old.codes, tendermintMsg, tendermintMsg)
+	}
+
+	p := broadcaster.peers[validators[1].Address()]
+	if len(p.codes) != 2 || p.codes[0] != tendermintCompressedMsg || p.codes[1] != tendermintMsg {
+		t.Fatalf("have codes %v, want [%d %d]", p.codes, tendermintCompressedMsg, tendermintMsg)
+	}
+	if compressed := p.sent[0].([]byte); len(compressed) >= len(payload) {
+		t.Fatalf("have %d compressed bytes, want less than %d", len(compressed), len(payload))
+	}
+
+	// the receiving side decompresses the message before handing it to the core
+	eventMux := event.NewTypeMuxSilent(log.New("backend", "test", "id", 0))
+	sub := eventMux.Subscribe(events.MessageEvent{})
+	defer sub.Unsubscribe()
+	receiver := newGossipBackend(t, newFakeBroadcaster())
+	receiver.eventMux = eventMux
+	receiver.logger = log.New("backend", "test", "id", 0)
+	if _, err := receiver.HandleMsg(validators[0].Address(), makeMsg(p.codes[0], p.sent[0])); err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+
+	select {
+	case ev := <-sub.Chan():
+		data := ev.Data.(events.MessageEvent).Payload
+		if !bytes.Equal(data, payload) {
+			t.Fatalf("have payload of %d bytes, want %d", len(data), len(payload))
+		}
+		decoded := new(tendermintCore.Message)
+		if _, err := decoded.FromPayload(data, nil, nil); err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		if !bytes.Equal(decoded.Msg, proposal.Msg) || decoded.Address != proposal.Address {
+			t.Fatalf("have %v, want %v", decoded, proposal)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("message not posted")
+	}
+}
+
+func TestHandleCompressedMsgTooLarge(t *testing.T) {
+	b := newGossipBackend(t, newFakeBroadcaster())
+	b.config = &config.Config{MaxPayloadSize: 1024}
+	b.logger = log.New("backend", "test", "id", 0)
+
+	// the size claimed by the snappy header is checked before anything is allocated for it
+	if _, err := b.HandleMsg(common.Address{}, makeMsg(tendermintCompressedMsg, snappy.Encode(nil, make([]byte, 2048)))); err != errPayloadTooLarge {
+		t.Fatalf("have %v, want %v", err, errPayloadTooLarge)
+	}
+	forged := []byte{0xff, 0xff, 0xff, 0xff, 0x0f}
+	if _, err := b.HandleMsg(common.Address{}, makeMsg(tendermintCompressedMsg, forged)); err != errPayloadTooLarge {
+		t.Fatalf("have %v, want %v", err, errPayloadTooLarge)
+	}
+}
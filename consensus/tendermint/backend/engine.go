@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"math/big"
 	"time"
 
@@ -37,9 +38,12 @@ import (
 )
 
 const (
-	inmemorySnapshots = 128 // Number of recent vote snapshots to keep in memory
-	inmemoryPeers     = 40
-	inmemoryMessages  = 1024
+	inmemorySnapshots  = 128 // Number of recent vote snapshots to keep in memory
+	inmemoryPeers      = 40
+	inmemoryMessages   = 1024
+	inmemoryProposals  = 16  // Number of verified proposals of the heights not yet committed to keep in memory
+	inmemoryValidators = 256 // Number of recent validator lists to keep in memory
+	inmemoryPolicies   = 16  // Number of the proposer policies of recent epochs to keep in memory
 )
 
 // ErrStartedEngine is returned if the engine is already started
@@ -47,7 +51,7 @@ var ErrStartedEngine = errors.New("started engine")
 
 var (
 	// errInvalidProposal is returned when a prposal is malformed.
-	//errInvalidProposal = errors.New("invalid proposal")
+	errInvalidProposal = errors.New("invalid proposal")
 	// errUnknownBlock is returned when the list of validators is requested for a block
 	// that is not part of the local blockchain.
 	errUnknownBlock = errors.New("unknown block")
@@ -67,17 +71,88 @@ var (
 	errInconsistentValidatorSet = errors.New("inconsistent validator set")
 	// errInvalidTimestamp is returned if the timestamp of a block is lower than the previous block's timestamp + the minimum block period.
 	errInvalidTimestamp = errors.New("invalid timestamp")
+	// errInsufficientCommittedSeals is returned if less than a quorum of committed seals is committed.
+	errInsufficientCommittedSeals = errors.New("insufficient committed seals")
+	// errDuplicateCommittedSeal is returned if a validator signed more than one of the committed seals.
+	errDuplicateCommittedSeal = errors.New("duplicate committed seal")
+	// errProposalGasLimitExceeded is returned if the transactions of a proposal can't fit in the block gas limit.
+	errProposalGasLimitExceeded = errors.New("proposal transactions exceed block gas limit")
+	// errProposalVerificationTimeout is returned if applying the transactions of a proposal took too long.
+	errProposalVerificationTimeout = errors.New("proposal verification timed out")
+	// errInvalidGasLimit is returned if the gas limit of a proposal is out of the bounds allowed by its parent.
+	errInvalidGasLimit = errors.New("invalid gas limit")
+	// errNotSynced is returned when the validators of the next block are not known because the node isn't synced.
+	errNotSynced = errors.New("node not synced")
+	// errEvidenceMismatch is returned when submitted fault evidence doesn't describe the fault its messages prove.
+	errEvidenceMismatch = errors.New("evidence doesn't match its messages")
 )
+
 var (
 	defaultDifficulty = big.NewInt(1)
-	nilUncleHash      = types.CalcUncleHash(nil) // Always Keccak256(RLP([])) as uncles are meaningless outside of PoW.
+	maxGasLimit       = uint64(0x7fffffffffffffff) // Maximum gas limit of a block, as enforced by ethash.
+	nilUncleHash      = types.CalcUncleHash(nil)   // Always Keccak256(RLP([])) as uncles are meaningless outside of PoW.
 	emptyNonce        = types.BlockNonce{}
-	now               = time.Now
 
 	nonceAuthVote = hexutil.MustDecode("0xffffffffffffffff") // Magic nonce number to vote on adding a new validator
 	nonceDropVote = hexutil.MustDecode("0x0000000000000000") // Magic nonce number to vote on removing a validator.
 )
 
+// ValidatorSetMismatchError is returned when the validator set in the extra-data of a proposal differs from the one
+// computed from the Autonity contract. It wraps errInconsistentValidatorSet.
+type ValidatorSetMismatchError struct {
+	Index       int            // index of the first differing validator, -1 if the lengths differ
+	Expected    common.Address // validator computed from the contract at Index
+	Actual      common.Address // validator found in the extra-data at Index
+	ExpectedLen int            // number of validators computed from the contract
+	ActualLen   int            // number of validators found in the extra-data
+}
+
+func (e *ValidatorSetMismatchError) Error() string {
+	if e.Index < 0 {
+		return fmt.Sprintf("%v: have %d validators, want %d", errInconsistentValidatorSet, e.ActualLen, e.ExpectedLen)
+	}
+	return fmt.Sprintf("%v: validator %d is %v, want %v", errInconsistentValidatorSet, e.Index, e.Actual.String(), e.Expected.String())
+}
+
+func (e *ValidatorSetMismatchError) Unwrap() error {
+	return errInconsistentValidatorSet
+}
+
+// TransactionFilter is consulted for every transaction of a proposal, the proposal is rejected if it returns an error.
+type TransactionFilter func(tx *types.Transaction) error
+
+// FilteredTransactionError is returned when a proposal contains a transaction rejected by the TransactionFilter.
+// It wraps the error returned by the filter.
+type FilteredTransactionError struct {
+	Index int         // index of the transaction in the proposal
+	Hash  common.Hash // hash of the transaction
+	Err   error       // error returned by the filter
+}
+
+func (e *FilteredTransactionError) Error() string {
+	return fmt.Sprintf("transaction %d (%v) rejected by filter: %v", e.Index, e.Hash.String(), e.Err)
+}
+
+func (e *FilteredTransactionError) Unwrap() error {
+	return e.Err
+}
+
+// TransactionSignatureError is returned when a proposal contains a transaction whose sender can't be recovered.
+// It wraps the error returned by the signer.
+type TransactionSignatureError struct {
+	Index int         // index of the transaction in the proposal
+	Hash  common.Hash // hash of the transaction
+	Err   error       // error returned by the signer
+}
+
+func (e *TransactionSignatureError) Error() string {
+	return fmt.Sprintf("transaction %d (%v) has an invalid signature: %v", e.Index, e.Hash.String(), e.Err)
+}
+
+func (e *TransactionSignatureError) Unwrap() error {
+	return e.Err
+}
+
 // Author retrieves the Ethereum address of the account that minted the given
 // block, which may be different from the header's coinbase if a consensus
 // engine is based on signatures.
@@ -102,7 +177,7 @@ func (sb *Backend) verifyHeader(chain consensus.ChainReader, header *types.Heade
 	}
 
 	// Don't waste time checking blocks from the future
-	if big.NewInt(int64(header.Time)).Cmp(big.NewInt(now().Unix())) > 0 {
+	if big.NewInt(int64(header.Time)).Cmp(big.NewInt(sb.now().Unix())) > 0 {
 		return consensus.ErrFutureBlock
 	}
 
@@ -240,37 +315,60 @@ func (sb *Backend) verifyCommittedSeals(chain consensus.ChainReader, header *typ
 	if err != nil {
 		return err
 	}
+	_, err = sb.checkCommittedSeals(header.Hash(), extra.CommittedSeal, validators)
+	return err
+}
+
+// ValidateCommittedSeals checks the committed seals of header against the validator set of its block.
+// The addresses of the validators who signed the seals are returned in the order of the seals.
+func (sb *Backend) ValidateCommittedSeals(header *types.Header) ([]common.Address, error) {
+	extra, err := types.ExtractBFTHeaderExtra(header)
+	if err != nil {
+		return nil, err
+	}
+	valSet, err := sb.Validators(header.Number.Uint64())
+	if err != nil {
+		return nil, err
+	}
+	return sb.checkCommittedSeals(header.Hash(), extra.CommittedSeal, valSet)
+}
+
+// checkCommittedSeals recovers the signer of every seal over the block hash. Each seal must be well formed
+// and signed by a distinct member of validators, and there must be at least a quorum of them.
+func (sb *Backend) checkCommittedSeals(hash common.Hash, seals [][]byte, validators validator.Set) ([]common.Address, error) {
 	// The length of Committed seals should be larger than 0
-	if len(extra.CommittedSeal) == 0 {
-		return types.ErrEmptyCommittedSeals
+	if len(seals) == 0 {
+		return nil, types.ErrEmptyCommittedSeals
+	}
+	for _, seal := range seals {
+		if len(seal) != types.BFTExtraSeal {
+			return nil, types.ErrInvalidCommittedSeals
+		}
+	}
+	if len(seals) < validators.Quorum() {
+		return nil, errInsufficientCommittedSeals
 	}
 
-	// Check whether the committed seals are generated by parent's validators
-	validSeal := 0
-	proposalSeal := tendermintCore.PrepareCommittedSeal(header.Hash())
-	// 1. Get committed seals from current header
-	for _, seal := range extra.CommittedSeal {
-		// 2. Get the original address by seal and parent block hash
+	proposalSeal := tendermintCore.PrepareCommittedSeal(hash)
+	signers := make([]common.Address, 0, len(seals))
+	seen := make(map[common.Address]struct{}, len(seals))
+	for _, seal := range seals {
 		addr, err := types.GetSignatureAddress(proposalSeal, seal)
 		if err != nil {
 			sb.logger.Error("not a valid address", "err", err)
-			return types.ErrInvalidSignature
+			return nil, types.ErrInvalidSignature
 		}
-		// Every validator can have only one seal. If more than one seals are signed by a
-		// validator, the validator cannot be found and errInvalidCommittedSeals is returned.
-		if validators.RemoveValidator(addr) {
-			validSeal++
-		} else {
-			return types.ErrInvalidCommittedSeals
+		if _, ok := seen[addr]; ok {
+			return nil, errDuplicateCommittedSeal
 		}
+		if _, v := validators.GetByAddress(addr); v == nil {
+			return nil, types.ErrInvalidCommittedSeals
+		}
+		seen[addr] = struct{}{}
+		signers = append(signers, addr)
 	}
 
-	// The length of validSeal should be larger than a Quorum of nodes
-	if validSeal < validators.Quorum() {
-		return types.ErrInvalidCommittedSeals
-	}
-
-	return nil
+	return signers, nil
 }
 
 // VerifySeal checks whether the crypto seal on a header is valid according to
@@ -306,14 +404,21 @@ func (sb *Backend) Prepare(chain consensus.ChainReader, header *types.Header) er
 	// use the same difficulty for all blocks
 	header.Difficulty = defaultDifficulty
 
-	// set header's timestamp
-	header.Time = new(big.Int).Add(big.NewInt(int64(parent.Time)), new(big.Int).SetUint64(sb.config.BlockPeriod)).Uint64()
-	if int64(header.Time) < time.Now().Unix() {
-		header.Time = uint64(time.Now().Unix())
-	}
+	header.Time = sb.proposalTime(parent)
 	return nil
 }
 
+// proposalTime returns the timestamp of a block built on top of parent: the current time, but no earlier than
+// BlockPeriod seconds after the parent as verifyHeader would reject the block otherwise. Seal waits until this
+// time before proposing the block.
+func (sb *Backend) proposalTime(parent *types.Header) uint64 {
+	earliest := parent.Time + sb.config.BlockPeriod
+	if now := sb.now().Unix(); now > int64(earliest) {
+		return uint64(now)
+	}
+	return earliest
+}
+
 // Finalize runs any post-transaction state modifications (e.g. block rewards)
 // and assembles the final block.
 //
@@ -421,6 +526,7 @@ func (sb *Backend) getValidators(header *types.Header, chain consensus.ChainRead
 func (sb *Backend) Seal(chain consensus.ChainReader, block *types.Block, results chan<- *types.Block, stop <-chan struct{}) error {
 	sb.coreMu.RLock()
 	isStarted := sb.coreStarted
+	stopped := sb.stopped
 	sb.coreMu.RUnlock()
 	if !isStarted {
 		return ErrStoppedEngine
@@ -431,7 +537,11 @@ func (sb *Backend) Seal(chain consensus.ChainReader, block *types.Block, results
 	number := header.Number.Uint64()
 
 	// Bail out if we're unauthorized to sign a block
-	if _, v := sb.Validators(number).GetByAddress(sb.Address()); v == nil {
+	valSet, err := sb.Validators(number)
+	if err != nil {
+		return err
+	}
+	if _, v := valSet.GetByAddress(sb.Address()); v == nil {
 		sb.logger.Error("error validator errUnauthorized", "addr", sb.address.String())
 		return errUnauthorized
 	}
@@ -441,18 +551,18 @@ func (sb *Backend) Seal(chain consensus.ChainReader, block *types.Block, results
 		sb.logger.Error("Error ancestor")
 		return consensus.ErrUnknownAncestor
 	}
-	block, err := sb.updateBlock(block)
+	block, err = sb.updateBlock(block)
 	if err != nil {
 		sb.logger.Error("seal error updateBlock", "err", err.Error())
 		return err
 	}
 
 	// wait for the timestamp of header, use this to adjust the block period
-	delay := time.Unix(int64(block.Header().Time), 0).Sub(now())
+	delay := time.Unix(int64(block.Header().Time), 0).Sub(sb.now())
 	select {
 	case <-time.After(delay):
 		// nothing to do
-	case <-sb.stopped:
+	case <-stopped:
 		return nil
 	case <-stop:
 		return nil
@@ -475,18 +585,17 @@ func (sb *Backend) setResultChan(results chan<- *types.Block) {
 	sb.commitCh = results
 }
 
-func (sb *Backend) sendResultChan(block *types.Block) {
-	sb.coreMu.Lock()
-	defer sb.coreMu.Unlock()
-
-	sb.commitCh <- block
-}
-
-func (sb *Backend) isResultChanNil() bool {
+// proposedResultChan returns the channel Seal is waiting on if hash is the
+// block we proposed, or nil otherwise. The hash and the channel are read under
+// the same lock so Commit never pairs a proposal with a stale channel.
+func (sb *Backend) proposedResultChan(hash common.Hash) chan<- *types.Block {
 	sb.coreMu.RLock()
 	defer sb.coreMu.RUnlock()
 
-	return sb.commitCh == nil
+	if sb.commitCh == nil || sb.proposedBlockHash != hash {
+		return nil
+	}
+	return sb.commitCh
 }
 
 // CalcDifficulty is the difficulty adjustment algorithm. It returns the difficulty
@@ -497,6 +606,9 @@ func (sb *Backend) CalcDifficulty(chain consensus.ChainReader, time uint64, pare
 }
 
 func (sb *Backend) SetProposedBlockHash(hash common.Hash) {
+	sb.coreMu.Lock()
+	defer sb.coreMu.Unlock()
+
 	sb.proposedBlockHash = hash
 }
 
@@ -522,8 +634,13 @@ func (sb *Backend) APIs(chain consensus.ChainReader) []rpc.API {
 	return []rpc.API{{
 		Namespace: "tendermint",
 		Version:   "1.0",
-		Service:   &API{chain: chain, tendermint: sb},
+		Service:   &API{chain: chain, tendermint: sb, evidence: sb, peers: sb},
 		Public:    true,
+	}, {
+		Namespace: "admin",
+		Version:   "1.0",
+		Service:   &AdminAPI{tendermint: sb, evidence: sb},
+		Public:    false,
 	}}
 }
 
@@ -539,6 +656,7 @@ func (sb *Backend) Start(ctx context.Context, chain consensus.ChainReader, curre
 
 	// clear previous data
 	sb.proposedBlockHash = common.Hash{}
+	sb.lastCommittedHash = common.Hash{}
 
 	sb.blockchainInitMu.Lock()
 	sb.blockchain = chain.(*core.BlockChain) // in the case of Finalize() called before the engine start()
@@ -552,21 +670,33 @@ func (sb *Backend) Start(ctx context.Context, chain consensus.ChainReader, curre
 	return nil
 }
 
-// Stop implements consensus.tendermint.Stop
+// Close implements consensus.tendermint.Stop
+//
+// The backend shuts down in order: it first stops accepting new messages, Gossip and Broadcast
+// returning ErrStoppedEngine from then on, then waits for the messages being gossiped to be sent
+// and finally signals it is stopped.
 func (sb *Backend) Close() error {
 	sb.coreMu.Lock()
-	defer sb.coreMu.Unlock()
 	if !sb.coreStarted {
+		sb.coreMu.Unlock()
 		return ErrStoppedEngine
 	}
 	sb.coreStarted = false
+	stopped := sb.stopped
+	sb.coreMu.Unlock()
+
+	sb.gossipWg.Wait()
 
-	close(sb.stopped)
+	close(stopped)
 
 	return nil
 }
 
 // retrieve list of validators for the block at height passed as parameter
+//
+// The validators are cached by the hash of the parent header they are decoded from rather than by height:
+// after a reorg or a SetHead the same height can resolve to a different parent, which must not be served the
+// validators of the abandoned branch.
 func (sb *Backend) retrieveSavedValidators(number uint64, chain consensus.ChainReader) ([]common.Address, error) {
 	if number == 0 {
 		number = 1
@@ -577,13 +707,24 @@ func (sb *Backend) retrieveSavedValidators(number uint64, chain consensus.ChainR
 		return nil, errUnknownBlock
 	}
 
+	hash := header.Hash()
+	if validators, ok := sb.recentValidators.Get(hash); ok {
+		return copyAddresses(validators.([]common.Address)), nil
+	}
+
 	tendermintExtra, err := types.ExtractBFTHeaderExtra(header)
 	if err != nil {
 		return nil, err
 	}
 
+	sb.recentValidators.Add(hash, copyAddresses(tendermintExtra.Validators))
 	return tendermintExtra.Validators, nil
+}
 
+func copyAddresses(addrs []common.Address) []common.Address {
+	cpy := make([]common.Address, len(addrs))
+	copy(cpy, addrs)
+	return cpy
 }
 
 // retrieve list of validators for the block header passed as parameter
@@ -45,6 +45,39 @@ func TestPrepare(t *testing.T) {
 	}
 }
 
+func TestPrepareRespectsBlockPeriod(t *testing.T) {
+	chain, engine := newBlockChain(1)
+	engine.config.BlockPeriod = 5
+	parent := chain.Genesis().Header()
+
+	tests := []struct {
+		now  int64
+		want uint64
+	}{
+		// a proposal made right after its parent waits for the block period
+		{int64(parent.Time), parent.Time + 5},
+		{int64(parent.Time) + 4, parent.Time + 5},
+		{int64(parent.Time) + 5, parent.Time + 5},
+		// a late proposal uses the current time
+		{int64(parent.Time) + 60, parent.Time + 60},
+	}
+	for _, test := range tests {
+		engine.now = func() time.Time {
+			return time.Unix(test.now, 0)
+		}
+		header := makeHeader(chain.Genesis(), engine.config)
+		if err := engine.Prepare(chain, header); err != nil {
+			t.Fatalf("error mismatch: have %v, want nil", err)
+		}
+		if header.Time != test.want {
+			t.Errorf("now %d: have timestamp %d, want %d", test.now, header.Time, test.want)
+		}
+		if header.Time < parent.Time+engine.config.BlockPeriod {
+			t.Errorf("now %d: timestamp %d closer than the block period to the parent %d", test.now, header.Time, parent.Time)
+		}
+	}
+}
+
 func TestSealCommittedOtherHash(t *testing.T) {
 	chain, engine := newBlockChain(4)
 
@@ -63,7 +96,7 @@ func TestSealCommittedOtherHash(t *testing.T) {
 		if !ok {
 			t.Errorf("unexpected event comes: %v", reflect.TypeOf(ev.Data))
 		}
-		err = engine.Commit(*otherBlock, [][]byte{})
+		err = engine.Commit(otherBlock, [][]byte{})
 		if err != nil {
 			t.Error("commit should not return error", err.Error())
 		}
@@ -190,7 +223,7 @@ func TestVerifyHeader(t *testing.T) {
 		t.Fatal(err)
 	}
 	header = block.Header()
-	header.Time = new(big.Int).Add(big.NewInt(now().Unix()), new(big.Int).SetUint64(10)).Uint64()
+	header.Time = new(big.Int).Add(big.NewInt(engine.now().Unix()), new(big.Int).SetUint64(10)).Uint64()
 	err = engine.VerifyHeader(chain, header, false)
 	if err != consensus.ErrFutureBlock {
 		t.Errorf("error mismatch: have %v, want %v", err, consensus.ErrFutureBlock)
@@ -269,7 +302,7 @@ func TestVerifyHeaders(t *testing.T) {
 		headers = append(headers, blocks[i].Header())
 	}
 
-	now = func() time.Time {
+	engine.now = func() time.Time {
 		return time.Unix(int64(headers[size-1].Time), 0)
 	}
 
@@ -326,7 +359,7 @@ func TestVerifyHeadersAbortValidation(t *testing.T) {
 		headers = append(headers, blocks[i].Header())
 	}
 
-	now = func() time.Time {
+	engine.now = func() time.Time {
 		return time.Unix(int64(headers[size-1].Time), 0)
 	}
 
@@ -387,7 +420,7 @@ func TestVerifyErrorHeaders(t *testing.T) {
 		headers = append(headers, blocks[i].Header())
 	}
 
-	now = func() time.Time {
+	engine.now = func() time.Time {
 		return time.Unix(int64(headers[size-1].Time), 0)
 	}
 
@@ -554,6 +587,13 @@ func TestAPIs(t *testing.T) {
 	if APIS[0].Namespace != "tendermint" {
 		t.Fatalf("expected 'tendermint', got %v", APIS[0].Namespace)
 	}
+	// the evidence is imported through the private admin namespace only
+	if len(APIS) != 2 || APIS[1].Namespace != "admin" || APIS[1].Public {
+		t.Fatalf("expected private 'admin' API, got %v", APIS[1:])
+	}
+	if _, ok := APIS[1].Service.(*AdminAPI); !ok {
+		t.Fatalf("expected admin API, got %T", APIS[1].Service)
+	}
 }
 
 func TestClose(t *testing.T) {
@@ -587,3 +627,220 @@ func TestBackendSealHash(t *testing.T) {
 		t.Fatalf("expected not empty string")
 	}
 }
+
+func TestAuthor(t *testing.T) {
+	b := newBackend()
+	headers := makeSignedHeaders(t, b, 2)
+
+	for _, header := range headers {
+		author, err := b.Author(header)
+		if err != nil {
+			t.Fatalf("expected <nil>, got %v", err)
+		}
+		if author != b.Address() {
+			t.Fatalf("author mismatch: have %v, want %v", author.Hex(), b.Address().Hex())
+		}
+		// cached result must be returned for the same header
+		if again, err := b.Author(header); err != nil || again != author {
+			t.Fatalf("cached author mismatch: have %v %v, want %v <nil>", again.Hex(), err, author.Hex())
+		}
+	}
+}
+
+func BenchmarkAuthor(b *testing.B) {
+	backend := newBackend()
+	headers := makeSignedHeaders(b, backend, 100)
+
+	b.Run("ecrecover", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			header := headers[i%len(headers)]
+			extra, err := types.ExtractBFTHeaderExtra(header)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := types.GetSignatureAddress(types.SigHash(header).Bytes(), extra.Seal); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("cached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := backend.Author(headers[i%len(headers)]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestRetrieveSavedValidatorsCache(t *testing.T) {
+	chain, engine := newBlockChain(1)
+	parent := chain.Genesis()
+	for i := 0; i < 3; i++ {
+		block, err := makeBlock(chain, engine, parent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = chain.InsertChain(types.Blocks{block}); err != nil {
+			t.Fatal(err)
+		}
+		if err = engine.NewChainHead(); err != nil {
+			t.Fatal(err)
+		}
+		parent = block
+	}
+
+	for number := uint64(1); number <= chain.CurrentBlock().NumberU64()+1; number++ {
+		parentHeader := chain.GetHeaderByNumber(number - 1)
+		extra, err := types.ExtractBFTHeaderExtra(parentHeader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		validators, err := engine.retrieveSavedValidators(number, chain)
+		if err != nil {
+			t.Fatalf("expected <nil>, got %v", err)
+		}
+		if !reflect.DeepEqual(validators, extra.Validators) {
+			t.Fatalf("validators mismatch at %d: have %v, want %v", number, validators, extra.Validators)
+		}
+		if _, ok := engine.recentValidators.Get(parentHeader.Hash()); !ok {
+			t.Fatalf("expected validators at %d to be cached", number)
+		}
+
+		// altering a returned list must not corrupt the cache
+		validators[0] = common.Address{}
+		cached, err := engine.retrieveSavedValidators(number, chain)
+		if err != nil {
+			t.Fatalf("expected <nil>, got %v", err)
+		}
+		if !reflect.DeepEqual(cached, extra.Validators) {
+			t.Fatalf("cached validators mismatch at %d: have %v, want %v", number, cached, extra.Validators)
+		}
+	}
+
+	if _, err := engine.retrieveSavedValidators(chain.CurrentBlock().NumberU64()+2, chain); err != errUnknownBlock {
+		t.Fatalf("expected %v, got %v", errUnknownBlock, err)
+	}
+}
+
+// reorgedChain serves its own headers in place of the canonical ones, as a chain rewound by SetHead would
+type reorgedChain struct {
+	consensus.ChainReader
+	headers map[uint64]*types.Header
+}
+
+func (c *reorgedChain) GetHeaderByNumber(number uint64) *types.Header {
+	if header, ok := c.headers[number]; ok {
+		return header
+	}
+	return c.ChainReader.GetHeaderByNumber(number)
+}
+
+func TestRetrieveSavedValidatorsReorg(t *testing.T) {
+	chain, engine := newBlockChain(1)
+	block, err := makeBlock(chain, engine, chain.Genesis())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = chain.InsertChain(types.Blocks{block}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = engine.retrieveSavedValidators(2, chain); err != nil {
+		t.Fatalf("expected <nil>, got %v", err)
+	}
+
+	want := []common.Address{common.HexToAddress("0x1"), common.HexToAddress("0x2")}
+	header := types.CopyHeader(block.Header())
+	header.Extra, err = types.PrepareExtra(header.Extra, want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reorged := &reorgedChain{ChainReader: chain, headers: map[uint64]*types.Header{1: header}}
+
+	validators, err := engine.retrieveSavedValidators(2, reorged)
+	if err != nil {
+		t.Fatalf("expected <nil>, got %v", err)
+	}
+	if !reflect.DeepEqual(validators, want) {
+		t.Fatalf("validators mismatch after reorg: have %v, want %v", validators, want)
+	}
+}
+
+func BenchmarkRetrieveSavedValidators(b *testing.B) {
+	chain, engine := newBlockChain(4)
+	header := chain.CurrentHeader()
+
+	b.Run("decode", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := types.ExtractBFTHeaderExtra(chain.GetHeaderByNumber(header.Number.Uint64())); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("cached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := engine.retrieveSavedValidators(header.Number.Uint64()+1, chain); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func makeSignedHeaders(t testing.TB, b *Backend, n int) []*types.Header {
+	headers := make([]*types.Header, n)
+	for i := range headers {
+		extra, err := types.PrepareExtra([]byte{}, []common.Address{b.Address()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		header := &types.Header{
+			Number: big.NewInt(int64(i + 1)),
+			Extra:  extra,
+		}
+		seal, err := b.Sign(types.SigHash(header).Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := types.WriteSeal(header, seal); err != nil {
+			t.Fatal(err)
+		}
+		headers[i] = header
+	}
+	return headers
+}
+
+func TestInsertChainSubQuorumSeals(t *testing.T) {
+	chain, engine, keys := newBlockChainWithKeys(4)
+	block, err := makeBlockWithoutSeal(chain, engine, chain.Genesis())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block, err = engine.updateBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	withSeals := func(seals [][]byte) *types.Block {
+		header := block.Header()
+		if err := types.WriteCommittedSeals(header, seals); err != nil {
+			t.Fatal(err)
+		}
+		return block.WithSeal(header)
+	}
+
+	// a block sealed by less than a quorum of its validators is rejected on import
+	if _, err := chain.InsertChain(types.Blocks{withSeals(signCommittedSeals(block.Hash(), keys[:2]...))}); err != errInsufficientCommittedSeals {
+		t.Fatalf("error mismatch: have %v, want %v", err, errInsufficientCommittedSeals)
+	}
+	if chain.CurrentBlock().NumberU64() != 0 {
+		t.Fatalf("have head %d, want 0", chain.CurrentBlock().NumberU64())
+	}
+
+	if _, err := chain.InsertChain(types.Blocks{withSeals(signCommittedSeals(block.Hash(), keys[:3]...))}); err != nil {
+		t.Fatalf("error mismatch: have %v, want nil", err)
+	}
+	if chain.CurrentBlock().Hash() != block.Hash() {
+		t.Fatalf("have head %v, want %v", chain.CurrentBlock().Hash(), block.Hash())
+	}
+}
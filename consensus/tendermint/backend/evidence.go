@@ -0,0 +1,162 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/big"
+
+	"github.com/clearmatics/autonity/common"
+	"github.com/clearmatics/autonity/common/hexutil"
+	"github.com/clearmatics/autonity/rlp"
+)
+
+// EvidenceType is the kind of fault an Evidence proves.
+type EvidenceType uint8
+
+const (
+	// ProposalEquivocation is a proposer signing two proposals for the same round
+	ProposalEquivocation EvidenceType = iota
+	// PrevoteDoubleVote is a validator signing two different prevotes for the same round
+	PrevoteDoubleVote
+	// PrecommitDoubleVote is a validator signing two different precommits for the same round
+	PrecommitDoubleVote
+)
+
+// evidencePrefix is the database key prefix of the fault evidence, followed by the height and round as big endian
+// uint64 so that the evidence is iterated by height, then the validator address and the evidence type.
+var evidencePrefix = []byte("tendermint-evidence-")
+
+// Evidence is the proof of a fault committed by a validator, the two conflicting messages it signed. It is stored
+// RLP encoded.
+type Evidence struct {
+	Type      EvidenceType   `json:"type"`
+	Height    uint64         `json:"height"`
+	Round     uint64         `json:"round"`
+	Validator common.Address `json:"validator"`
+	First     hexutil.Bytes  `json:"first"`
+	Second    hexutil.Bytes  `json:"second"`
+}
+
+// evidenceTypes maps the step of the conflicting messages to the evidence type.
+var evidenceTypes = map[string]EvidenceType{
+	"propose":   ProposalEquivocation,
+	"prevote":   PrevoteDoubleVote,
+	"precommit": PrecommitDoubleVote,
+}
+
+func evidenceKey(height, round uint64, validator common.Address, typ EvidenceType) []byte {
+	key := make([]byte, 0, len(evidencePrefix)+8+8+common.AddressLength+1)
+	key = append(key, evidencePrefix...)
+	key = append(key, encodeUint64(height)...)
+	key = append(key, encodeUint64(round)...)
+	key = append(key, validator.Bytes()...)
+	return append(key, byte(typ))
+}
+
+func encodeUint64(n uint64) []byte {
+	enc := make([]byte, 8)
+	binary.BigEndian.PutUint64(enc, n)
+	return enc
+}
+
+// PutEvidence stores the evidence, replacing the one of the same height, round, validator and type if any.
+func (sb *Backend) PutEvidence(ev *Evidence) error {
+	data, err := rlp.EncodeToBytes(ev)
+	if err != nil {
+		return err
+	}
+	return sb.db.Put(evidenceKey(ev.Height, ev.Round, ev.Validator, ev.Type), data)
+}
+
+// GetEvidence returns the stored evidence of the given fault, nil if there is none.
+func (sb *Backend) GetEvidence(height, round uint64, validator common.Address, typ EvidenceType) (*Evidence, error) {
+	key := evidenceKey(height, round, validator, typ)
+	has, err := sb.db.Has(key)
+	if err != nil || !has {
+		return nil, err
+	}
+	data, err := sb.db.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	ev := new(Evidence)
+	if err := rlp.DecodeBytes(data, ev); err != nil {
+		return nil, err
+	}
+	return ev, nil
+}
+
+// IterateEvidence calls fn on the stored evidence ordered by height and round until it returns false.
+func (sb *Backend) IterateEvidence(fn func(*Evidence) bool) error {
+	it := sb.db.NewIteratorWithPrefix(evidencePrefix)
+	defer it.Release()
+	for it.Next() {
+		ev := new(Evidence)
+		if err := rlp.DecodeBytes(it.Value(), ev); err != nil {
+			return err
+		}
+		if !fn(ev) {
+			break
+		}
+	}
+	return it.Error()
+}
+
+// PruneEvidence deletes the evidence older than config.EvidenceWindow blocks before the given height, it returns how
+// many entries were deleted.
+func (sb *Backend) PruneEvidence(height uint64) (int, error) {
+	window := sb.config.GetEvidenceWindow()
+	if height <= window {
+		return 0, nil
+	}
+	end := append(append([]byte(nil), evidencePrefix...), encodeUint64(height-window)...)
+
+	var keys [][]byte
+	it := sb.db.NewIteratorWithPrefix(evidencePrefix)
+	for it.Next() {
+		if bytes.Compare(it.Key(), end) >= 0 {
+			break
+		}
+		keys = append(keys, append([]byte(nil), it.Key()...))
+	}
+	err := it.Error()
+	it.Release()
+	if err != nil {
+		return 0, err
+	}
+
+	batch := sb.db.NewBatch()
+	for _, key := range keys {
+		if err := batch.Delete(key); err != nil {
+			return 0, err
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return 0, err
+	}
+	return len(keys), nil
+}
+
+// StoreEvidence implements core.Backend.StoreEvidence
+func (sb *Backend) StoreEvidence(step string, height *big.Int, round int64, validator common.Address, first, second []byte) {
+	typ, ok := evidenceTypes[step]
+	if !ok {
+		sb.logger.Error("Unknown step of fault evidence", "step", step, "validator", validator)
+		return
+	}
+	evidence := newEvidence(typ, height, round, validator, first, second)
+	if err := sb.PutEvidence(evidence); err != nil {
+		sb.logger.Error("Failed to store fault evidence", "type", evidence.Type, "validator", evidence.Validator, "err", err)
+	}
+}
+
+func newEvidence(typ EvidenceType, height *big.Int, round int64, validator common.Address, first, second []byte) *Evidence {
+	return &Evidence{
+		Type:      typ,
+		Height:    height.Uint64(),
+		Round:     uint64(round),
+		Validator: validator,
+		First:     first,
+		Second:    second,
+	}
+}
@@ -0,0 +1,128 @@
+package backend
+
+import (
+	"bytes"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/clearmatics/autonity/common"
+	"github.com/clearmatics/autonity/consensus/tendermint/config"
+	"github.com/clearmatics/autonity/core/rawdb"
+	"github.com/clearmatics/autonity/log"
+)
+
+func TestEvidenceStore(t *testing.T) {
+	b := &Backend{db: rawdb.NewMemoryDatabase()}
+	validator := common.HexToAddress("0x0123456789")
+
+	stored := []*Evidence{
+		{Type: PrecommitDoubleVote, Height: 300, Round: 0, Validator: validator, First: []byte{1}, Second: []byte{2}},
+		{Type: ProposalEquivocation, Height: 2, Round: 1, Validator: validator, First: []byte{3}, Second: []byte{4}},
+		{Type: PrevoteDoubleVote, Height: 2, Round: 1, Validator: validator, First: []byte{5}, Second: []byte{6}},
+		{Type: PrevoteDoubleVote, Height: 2, Round: 0, Validator: validator, First: []byte{7}, Second: []byte{8}},
+	}
+	for _, ev := range stored {
+		if err := b.PutEvidence(ev); err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+	}
+
+	// every fault of the same validator in the same round is kept apart
+	for _, want := range stored {
+		have, err := b.GetEvidence(want.Height, want.Round, want.Validator, want.Type)
+		if err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		if !reflect.DeepEqual(have, want) {
+			t.Fatalf("have %v, want %v", have, want)
+		}
+	}
+	if have, err := b.GetEvidence(2, 0, validator, ProposalEquivocation); have != nil || err != nil {
+		t.Fatalf("have %v %v, want no evidence", have, err)
+	}
+
+	// the evidence is iterated by height and round
+	var iterated []*Evidence
+	if err := b.IterateEvidence(func(ev *Evidence) bool {
+		iterated = append(iterated, ev)
+		return true
+	}); err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	want := []*Evidence{stored[3], stored[1], stored[2], stored[0]}
+	if !reflect.DeepEqual(iterated, want) {
+		t.Fatalf("have %v, want %v", iterated, want)
+	}
+
+	// the iteration stops when asked to
+	count := 0
+	if err := b.IterateEvidence(func(ev *Evidence) bool {
+		count++
+		return false
+	}); err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("have %d evidence iterated, want 1", count)
+	}
+}
+
+func TestPruneEvidence(t *testing.T) {
+	b := &Backend{
+		db:     rawdb.NewMemoryDatabase(),
+		config: &config.Config{EvidenceWindow: 100},
+	}
+	validator := common.HexToAddress("0x0123456789")
+	for _, height := range []uint64{1, 49, 50, 51, 200} {
+		if err := b.PutEvidence(&Evidence{Type: PrevoteDoubleVote, Height: height, Validator: validator}); err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+	}
+
+	// nothing is old enough yet
+	if pruned, err := b.PruneEvidence(100); pruned != 0 || err != nil {
+		t.Fatalf("have %d %v, want 0 <nil>", pruned, err)
+	}
+
+	// the evidence of the heights more than the window behind is deleted
+	if pruned, err := b.PruneEvidence(150); pruned != 2 || err != nil {
+		t.Fatalf("have %d %v, want 2 <nil>", pruned, err)
+	}
+	var heights []uint64
+	if err := b.IterateEvidence(func(ev *Evidence) bool {
+		heights = append(heights, ev.Height)
+		return true
+	}); err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	if !reflect.DeepEqual(heights, []uint64{50, 51, 200}) {
+		t.Fatalf("have heights %v, want [50 51 200]", heights)
+	}
+}
+
+func TestStoreEvidence(t *testing.T) {
+	b := &Backend{
+		db:     rawdb.NewMemoryDatabase(),
+		logger: log.New("backend", "test", "id", 0),
+	}
+	validator := common.HexToAddress("0x0123456789")
+
+	b.StoreEvidence("propose", big.NewInt(3), 1, validator, []byte{1}, []byte{2})
+	b.StoreEvidence("precommit", big.NewInt(3), 1, validator, []byte{3}, []byte{4})
+	b.StoreEvidence("unknown", big.NewInt(3), 1, validator, []byte{5}, []byte{6})
+
+	want := map[EvidenceType][]byte{ProposalEquivocation: {1}, PrecommitDoubleVote: {3}}
+	for typ, first := range want {
+		ev, err := b.GetEvidence(3, 1, validator, typ)
+		if err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		if ev == nil || !bytes.Equal(ev.First, first) {
+			t.Fatalf("evidence %d: have %v, want first message %v", typ, ev, first)
+		}
+	}
+	if ev, err := b.GetEvidence(3, 1, validator, PrevoteDoubleVote); ev != nil || err != nil {
+		t.Fatalf("have %v %v, want no evidence", ev, err)
+	}
+}
@@ -21,17 +21,23 @@ import (
 	"context"
 	"errors"
 	"github.com/clearmatics/autonity/common"
+	"github.com/clearmatics/autonity/common/ratelimit"
 	"github.com/clearmatics/autonity/consensus"
 	"github.com/clearmatics/autonity/consensus/tendermint/events"
 	"github.com/clearmatics/autonity/core/types"
 	"github.com/clearmatics/autonity/p2p"
-	"github.com/hashicorp/golang-lru"
+	"github.com/golang/snappy"
 	"io"
+	"math/big"
+	"time"
 )
 
 const (
 	tendermintMsg     = 0x11
 	tendermintSyncMsg = 0x12
+	// tendermintCompressedMsg is a tendermintMsg whose payload is snappy compressed, only sent to the peers which
+	// negotiated a protocol version carrying it
+	tendermintCompressedMsg = 0x13
 )
 
 type UnhandledMsg struct {
@@ -42,15 +48,37 @@ type UnhandledMsg struct {
 var (
 	// errDecodeFailed is returned when decode message fails
 	errDecodeFailed = errors.New("fail to decode tendermint message")
+	// errPayloadTooLarge is returned when a compressed message would decompress above the maximum payload size
+	errPayloadTooLarge = errors.New("decompressed tendermint message too large")
 )
 
-// Protocol implements consensus.Handler.Protocol
+// syncRequest is the payload of a sync message carrying the view of the requesting peer, peers running an older
+// version send an empty payload instead.
+type syncRequest struct {
+	Height *big.Int
+	Round  *big.Int
+}
+
+// Protocol implements consensus.Handler.Protocol, the compressed message code is only used with the peers which
+// negotiated it.
 func (sb *Backend) Protocol() (protocolName string, extraMsgCodes uint64) {
-	return "tendermint", 2 //nolint
+	return "tendermint", 3 //nolint
 }
 
+// HandleUnhandledMsgs replays the messages received while the core was stopped, at most config.ReplayRate per
+// second so that a restart doesn't flood the core. It returns once they are all handled or ctx is done, the core
+// runs it in a goroutine its Stop waits for.
 func (sb *Backend) HandleUnhandledMsgs(ctx context.Context) {
+	rate := sb.config.GetReplayRate()
+	bucket := ratelimit.NewBucketWithRate(float64(rate), 1)
 	for unhandled := sb.pendingMessages.Dequeue(); unhandled != nil; unhandled = sb.pendingMessages.Dequeue() {
+		if wait := bucket.Take(1); wait > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+		}
 		select {
 		case <-ctx.Done():
 			return
@@ -68,7 +96,7 @@ func (sb *Backend) HandleUnhandledMsgs(ctx context.Context) {
 
 // HandleMsg implements consensus.Handler.HandleMsg
 func (sb *Backend) HandleMsg(addr common.Address, msg p2p.Msg) (bool, error) {
-	if msg.Code != tendermintMsg && msg.Code != tendermintSyncMsg {
+	if msg.Code != tendermintMsg && msg.Code != tendermintSyncMsg && msg.Code != tendermintCompressedMsg {
 		return false, nil
 	}
 
@@ -76,7 +104,7 @@ func (sb *Backend) HandleMsg(addr common.Address, msg p2p.Msg) (bool, error) {
 	defer sb.coreMu.Unlock()
 
 	switch msg.Code {
-	case tendermintMsg:
+	case tendermintMsg, tendermintCompressedMsg:
 		if !sb.coreStarted {
 			buffer := new(bytes.Buffer)
 			if _, err := io.Copy(buffer, msg.Payload); err != nil {
@@ -92,19 +120,27 @@ func (sb *Backend) HandleMsg(addr common.Address, msg p2p.Msg) (bool, error) {
 		if err := msg.Decode(&data); err != nil {
 			return true, errDecodeFailed
 		}
+		if msg.Code == tendermintCompressedMsg {
+			// check the claimed size before snappy allocates it
+			size, err := snappy.DecodedLen(data)
+			if err != nil {
+				return true, errDecodeFailed
+			}
+			if max := sb.maxPayloadSize(); size > max {
+				sb.logger.Warn("Rejected oversized compressed message", "from", addr, "size", size, "max", max)
+				return true, errPayloadTooLarge
+			}
+			decoded, err := snappy.Decode(nil, data)
+			if err != nil {
+				return true, errDecodeFailed
+			}
+			data = decoded
+		}
 
 		hash := types.RLPHash(data)
 
 		// Mark peer's message
-		ms, ok := sb.recentMessages.Get(addr)
-		var m *lru.ARCCache
-		if ok {
-			m, _ = ms.(*lru.ARCCache)
-		} else {
-			m, _ = lru.NewARC(inmemoryMessages)
-			sb.recentMessages.Add(addr, m)
-		}
-		m.Add(hash, true)
+		sb.peerMessages(addr).Add(hash, true)
 
 		// Mark self known message
 		if _, ok := sb.knownMessages.Get(hash); ok {
@@ -114,14 +150,20 @@ func (sb *Backend) HandleMsg(addr common.Address, msg p2p.Msg) (bool, error) {
 
 		sb.postEvent(events.MessageEvent{
 			Payload: data,
+			Sender:  addr,
 		})
 	case tendermintSyncMsg:
 		if !sb.coreStarted {
 			sb.logger.Info("Sync message received but core not running")
 			return true, nil // we return nil as we don't want to shutdown the connection if core is stopped
 		}
-		sb.logger.Info("Received sync message", "from", addr)
-		sb.postEvent(events.SyncEvent{Addr: addr})
+		ev := events.SyncEvent{Addr: addr}
+		var request syncRequest
+		if err := msg.Decode(&request); err == nil {
+			ev.Height, ev.Round = request.Height, request.Round
+		}
+		sb.logger.Info("Received sync message", "from", addr, "height", ev.Height, "round", ev.Round)
+		sb.postEvent(ev)
 	default:
 		return false, nil
 	}
@@ -129,6 +171,29 @@ func (sb *Backend) HandleMsg(addr common.Address, msg p2p.Msg) (bool, error) {
 	return true, nil
 }
 
+// sendPayload sends a consensus message to p, compressed if it is larger than config.CompressionThreshold and p
+// supports compressed messages.
+func (sb *Backend) sendPayload(p consensus.Peer, payload []byte) error {
+	if threshold := sb.config.GetCompressionThreshold(); threshold > 0 && len(payload) > threshold {
+		if cp, ok := p.(consensus.CompressionPeer); ok && cp.SupportsCompression() {
+			return p.Send(tendermintCompressedMsg, snappy.Encode(nil, payload))
+		}
+	}
+	return p.Send(tendermintMsg, payload)
+}
+
+// maxPayloadSize returns the size above which the core rejects consensus messages, derived from the gas limit of
+// the current block.
+func (sb *Backend) maxPayloadSize() int {
+	var gasLimit uint64
+	if sb.currentBlock != nil {
+		if block := sb.currentBlock(); block != nil {
+			gasLimit = block.GasLimit()
+		}
+	}
+	return sb.config.GetMaxPayloadSize(gasLimit)
+}
+
 // SetBroadcaster implements consensus.Handler.SetBroadcaster
 func (sb *Backend) SetBroadcaster(broadcaster consensus.Broadcaster) {
 	sb.broadcaster = broadcaster
@@ -136,10 +201,17 @@ func (sb *Backend) SetBroadcaster(broadcaster consensus.Broadcaster) {
 
 func (sb *Backend) NewChainHead() error {
 	sb.coreMu.RLock()
-	defer sb.coreMu.RUnlock()
-	if !sb.coreStarted {
+	started := sb.coreStarted
+	if started {
+		sb.postEvent(events.CommitEvent{})
+	}
+	sb.coreMu.RUnlock()
+	if !started {
 		return ErrStoppedEngine
 	}
-	sb.postEvent(events.CommitEvent{})
+	// the contract and state reads below are done without holding coreMu, so that HandleMsg isn't stalled
+	sb.postWhitelistChange()
+	sb.postEpochChange()
+	sb.updatePeerMetrics()
 	return nil
 }
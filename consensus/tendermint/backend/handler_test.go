@@ -17,11 +17,14 @@
 package backend
 
 import (
+	"context"
 	"github.com/clearmatics/autonity/consensus/tendermint/events"
+	"math/big"
 	"testing"
 	"time"
 
 	"github.com/clearmatics/autonity/common"
+	"github.com/clearmatics/autonity/consensus/tendermint/config"
 	"github.com/clearmatics/autonity/core/types"
 	"github.com/clearmatics/autonity/event"
 	"github.com/clearmatics/autonity/log"
@@ -109,7 +112,36 @@ func TestSynchronisationMessage(t *testing.T) {
 		select {
 		case <-timer.C:
 			t.Fatalf("sync message not posted")
-		case <-sub.Chan():
+		case ev := <-sub.Chan():
+			// an empty payload from an older peer carries no view, everything is sent
+			if syncEvent := ev.Data.(events.SyncEvent); syncEvent.Height != nil || syncEvent.Round != nil {
+				t.Fatalf("have view %v/%v, want none", syncEvent.Height, syncEvent.Round)
+			}
+		}
+	})
+
+	t.Run("engine running, requester view posted", func(t *testing.T) {
+		eventMux := event.NewTypeMuxSilent(log.New("backend", "test", "id", 0))
+		sub := eventMux.Subscribe(events.SyncEvent{})
+		b := &Backend{
+			coreStarted: true,
+			logger:      log.New("backend", "test", "id", 0),
+			eventMux:    eventMux,
+		}
+		msg := makeMsg(tendermintSyncMsg, &syncRequest{Height: big.NewInt(5), Round: big.NewInt(1)})
+		addr := common.BytesToAddress([]byte("address"))
+		if res, err := b.HandleMsg(addr, msg); !res || err != nil {
+			t.Fatalf("HandleMsg unexpected return")
+		}
+		timer := time.NewTimer(2 * time.Second)
+		select {
+		case <-timer.C:
+			t.Fatalf("sync message not posted")
+		case ev := <-sub.Chan():
+			syncEvent := ev.Data.(events.SyncEvent)
+			if syncEvent.Height.Cmp(big.NewInt(5)) != 0 || syncEvent.Round.Cmp(big.NewInt(1)) != 0 {
+				t.Fatalf("have view %v/%v, want 5/1", syncEvent.Height, syncEvent.Round)
+			}
 		}
 	})
 }
@@ -121,8 +153,8 @@ func TestProtocol(t *testing.T) {
 	if name != "tendermint" {
 		t.Fatalf("expected 'tendermint', got %v", name)
 	}
-	if code != 2 {
-		t.Fatalf("expected 2, got %v", code)
+	if code != 3 {
+		t.Fatalf("expected 3, got %v", code)
 	}
 }
 
@@ -153,3 +185,73 @@ func makeMsg(msgcode uint64, data interface{}) p2p.Msg {
 	size, r, _ := rlp.EncodeToReader(data)
 	return p2p.Msg{Code: msgcode, Size: uint32(size), Payload: r}
 }
+
+func TestHandleUnhandledMsgs(t *testing.T) {
+	newReplayBackend := func(rate uint64, n int) (*Backend, *event.TypeMuxSubscription) {
+		eventMux := event.NewTypeMuxSilent(log.New("backend", "test", "id", 0))
+		b := &Backend{
+			config:      &config.Config{ReplayRate: rate},
+			coreStarted: true,
+			logger:      log.New("backend", "test", "id", 0),
+			eventMux:    eventMux,
+		}
+		b.pendingMessages.SetCapacity(ringCapacity)
+		for i := 0; i < n; i++ {
+			b.pendingMessages.Enqueue(UnhandledMsg{
+				addr: common.BytesToAddress([]byte{byte(i)}),
+				msg:  makeMsg(tendermintSyncMsg, []byte{}),
+			})
+		}
+		return b, eventMux.Subscribe(events.SyncEvent{})
+	}
+
+	t.Run("replay is rate limited", func(t *testing.T) {
+		b, sub := newReplayBackend(50, 11)
+		defer sub.Unsubscribe()
+
+		start := time.Now()
+		b.HandleUnhandledMsgs(context.Background())
+		// the first message goes through at once, each other one waits for a token
+		if elapsed, min := time.Since(start), 10*time.Second/50; elapsed < min*9/10 {
+			t.Fatalf("replayed in %v, want at least %v", elapsed, min)
+		}
+		if b.pendingMessages.ContentSize() != 0 {
+			t.Fatalf("have %d messages left, want 0", b.pendingMessages.ContentSize())
+		}
+		for i := 0; i < 11; i++ {
+			select {
+			case <-sub.Chan():
+			case <-time.After(2 * time.Second):
+				t.Fatalf("have %d replayed messages, want 11", i)
+			}
+		}
+	})
+
+	t.Run("cancellation stops the replay", func(t *testing.T) {
+		b, sub := newReplayBackend(1, 5)
+		defer sub.Unsubscribe()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			b.HandleUnhandledMsgs(ctx)
+			close(done)
+		}()
+		select {
+		case <-sub.Chan():
+		case <-time.After(2 * time.Second):
+			t.Fatalf("first message not replayed")
+		}
+
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("replay still running after cancellation")
+		}
+		// the message waiting for a token when ctx was cancelled is dropped
+		if have := b.pendingMessages.ContentSize(); have != 3 {
+			t.Fatalf("have %d messages left, want 3", have)
+		}
+	})
+}
@@ -0,0 +1,11 @@
+package backend
+
+import (
+	"github.com/clearmatics/autonity/metrics"
+)
+
+var (
+	// the connectivity to the validators, losing the quorum of them is the leading sign of a stall
+	tendermintConnectedValidatorsGauge = metrics.NewRegisteredGauge("tendermint/peers/connected_validators", nil)
+	tendermintQuorumReachableGauge     = metrics.NewRegisteredGauge("tendermint/peers/quorum_reachable", nil)
+)
@@ -17,7 +17,12 @@
 package config
 
 import (
+	"errors"
+	"math/big"
 	"sync"
+	"time"
+
+	"github.com/clearmatics/autonity/params"
 )
 
 type ProposerPolicy uint64
@@ -25,24 +30,342 @@ type ProposerPolicy uint64
 const (
 	RoundRobin ProposerPolicy = iota
 	Sticky
+	StakeWeighted
 )
 
+func (p ProposerPolicy) String() string {
+	switch p {
+	case RoundRobin:
+		return "round-robin"
+	case Sticky:
+		return "sticky"
+	case StakeWeighted:
+		return "stake-weighted"
+	default:
+		return "unknown"
+	}
+}
+
 type Config struct {
 	RequestTimeout uint64         `toml:",omitempty"` // The timeout for each Istanbul round in milliseconds.
 	BlockPeriod    uint64         `toml:",omitempty"` // Default minimum difference between two consecutive block's timestamps in second
 	ProposerPolicy ProposerPolicy `toml:",omitempty"` // The policy for proposer selection
 	Epoch          uint64         `toml:",omitempty"` // The number of blocks after which to checkpoint and reset the pending votes
+	// The maximum time spent applying the transactions of a proposal in milliseconds, 0 means no limit. The limit is
+	// local to the node and a proposal going over it is prevoted nil, so that slower validators may reject a proposal
+	// the others accept. It is disabled by default, the gas limit bounding the verification on every node alike.
+	VerifyProposalTimeout uint64 `toml:",omitempty"`
+	// The number of proposals VerifyProposals verifies at the same time, 0 means one at a time.
+	VerifyProposalWorkers uint64 `toml:",omitempty"`
+	// The number of goroutines checking the transaction signatures of a proposal before applying its transactions,
+	// 0 disables the check.
+	VerifyProposalSignatureWorkers uint64 `toml:",omitempty"`
+
+	// The step timeouts of the first round and their increase per round in milliseconds, 0 means the default value.
+	ProposeTimeout        int64 `toml:",omitempty"`
+	ProposeTimeoutDelta   int64 `toml:",omitempty"`
+	PrevoteTimeout        int64 `toml:",omitempty"`
+	PrevoteTimeoutDelta   int64 `toml:",omitempty"`
+	PrecommitTimeout      int64 `toml:",omitempty"`
+	PrecommitTimeoutDelta int64 `toml:",omitempty"`
+	// The maximum time in milliseconds randomly added to the propose timeout so that the validators don't change round
+	// in lockstep, 0 means none. It is capped to the propose timeout delta.
+	ProposeTimeoutJitter uint64 `toml:",omitempty"`
+	// The time in milliseconds spent gathering more precommits once a quorum is reached before committing, so that
+	// the block carries more committed seals, 0 means committing at once.
+	CommitTimeout uint64 `toml:",omitempty"`
+
+	// The number of consensus messages per second accepted from a validator and the burst allowed above it, 0 means no
+	// limit.
+	MessageRate  uint64 `toml:",omitempty"`
+	MessageBurst uint64 `toml:",omitempty"`
+	// The maximum number of peers a message is gossiped to, the others getting it from them, 0 means all peers.
+	GossipFanout uint64 `toml:",omitempty"`
+	// The size in bytes above which gossiped messages are snappy compressed, 0 means no compression. Only the peers
+	// which negotiated a protocol version carrying compressed messages get them compressed.
+	CompressionThreshold uint64 `toml:",omitempty"`
+	// The number of messages per second replayed among those received while the engine was stopped, 0 means the default.
+	ReplayRate uint64 `toml:",omitempty"`
+	// The size in bytes above which consensus messages are rejected before being decoded, 0 means the default derived
+	// from the block gas limit.
+	MaxPayloadSize uint64 `toml:",omitempty"`
+
+	// The number of heights and rounds ahead of the current ones for which messages are accepted, 0 means the default.
+	FutureHeightWindow uint64 `toml:",omitempty"`
+	FutureRoundWindow  uint64 `toml:",omitempty"`
+
+	// The number of the most recent past rounds of the current height whose state is kept, 0 means the default.
+	OldRoundStates uint64 `toml:",omitempty"`
+
+	// The time in milliseconds the height may stay unchanged before a StallEvent is posted, 0 means the default.
+	StallThreshold uint64 `toml:",omitempty"`
+
+	// The number of messages sent at once when syncing a peer and the pause between two batches in milliseconds,
+	// 0 means the default.
+	SyncBatchSize  uint64 `toml:",omitempty"`
+	SyncBatchDelay uint64 `toml:",omitempty"`
+
+	// The number of blocks fault evidence is kept for so that it can be submitted, 0 means the default.
+	EvidenceWindow uint64 `toml:",omitempty"`
+
+	// The height from which consensus messages carry a sequence, nil means never. It is set from the chain config.
+	SequenceBlock *big.Int `toml:",omitempty"`
 
 	sync.RWMutex
 }
 
+const (
+	defaultProposeTimeout        = 3000
+	defaultProposeTimeoutDelta   = 500
+	defaultPrevoteTimeout        = 1000
+	defaultPrevoteTimeoutDelta   = 500
+	defaultPrecommitTimeout      = 1000
+	defaultPrecommitTimeoutDelta = 500
+
+	defaultFutureHeightWindow = 100
+	defaultFutureRoundWindow  = 1000
+
+	defaultOldRoundStates = 50
+
+	defaultReplayRate = 500
+
+	// room left in a message payload for the header, seals and signature of a proposal around its transactions
+	payloadOverhead = 1024 * 1024
+
+	defaultStallThreshold = 60000
+
+	defaultSyncBatchSize  = 20
+	defaultSyncBatchDelay = 50
+
+	defaultEvidenceWindow = 100000
+)
+
+var errNegativeTimeout = errors.New("tendermint step timeouts must not be negative")
+
 func DefaultConfig() *Config {
 	return &Config{
 		RequestTimeout: 10000,
 		BlockPeriod:    1,
 		ProposerPolicy: RoundRobin,
 		Epoch:          30000,
+
+		ProposeTimeout:        defaultProposeTimeout,
+		ProposeTimeoutDelta:   defaultProposeTimeoutDelta,
+		PrevoteTimeout:        defaultPrevoteTimeout,
+		PrevoteTimeoutDelta:   defaultPrevoteTimeoutDelta,
+		PrecommitTimeout:      defaultPrecommitTimeout,
+		PrecommitTimeoutDelta: defaultPrecommitTimeoutDelta,
+
+		MessageRate:  1000,
+		MessageBurst: 2000,
+		ReplayRate:   defaultReplayRate,
+
+		FutureHeightWindow: defaultFutureHeightWindow,
+		FutureRoundWindow:  defaultFutureRoundWindow,
+
+		OldRoundStates: defaultOldRoundStates,
+
+		StallThreshold: defaultStallThreshold,
+
+		SyncBatchSize:  defaultSyncBatchSize,
+		SyncBatchDelay: defaultSyncBatchDelay,
+
+		EvidenceWindow: defaultEvidenceWindow,
+	}
+}
+
+// Validate checks that the configured step timeouts are usable.
+func (cfg *Config) Validate() error {
+	for _, t := range []int64{
+		cfg.ProposeTimeout, cfg.ProposeTimeoutDelta,
+		cfg.PrevoteTimeout, cfg.PrevoteTimeoutDelta,
+		cfg.PrecommitTimeout, cfg.PrecommitTimeoutDelta,
+	} {
+		if t < 0 {
+			return errNegativeTimeout
+		}
+	}
+	return nil
+}
+
+// TimeoutPropose returns the propose timeout of the given round. A nil config uses the default timeouts.
+func (cfg *Config) TimeoutPropose(round int64) time.Duration {
+	if cfg == nil {
+		return stepTimeout(0, 0, defaultProposeTimeout, defaultProposeTimeoutDelta, round)
+	}
+	return stepTimeout(cfg.ProposeTimeout, cfg.ProposeTimeoutDelta, defaultProposeTimeout, defaultProposeTimeoutDelta, round)
+}
+
+// TimeoutPrevote returns the prevote timeout of the given round. A nil config uses the default timeouts.
+func (cfg *Config) TimeoutPrevote(round int64) time.Duration {
+	if cfg == nil {
+		return stepTimeout(0, 0, defaultPrevoteTimeout, defaultPrevoteTimeoutDelta, round)
+	}
+	return stepTimeout(cfg.PrevoteTimeout, cfg.PrevoteTimeoutDelta, defaultPrevoteTimeout, defaultPrevoteTimeoutDelta, round)
+}
+
+// TimeoutPrecommit returns the precommit timeout of the given round. A nil config uses the default timeouts.
+func (cfg *Config) TimeoutPrecommit(round int64) time.Duration {
+	if cfg == nil {
+		return stepTimeout(0, 0, defaultPrecommitTimeout, defaultPrecommitTimeoutDelta, round)
+	}
+	return stepTimeout(cfg.PrecommitTimeout, cfg.PrecommitTimeoutDelta, defaultPrecommitTimeout, defaultPrecommitTimeoutDelta, round)
+}
+
+// GetProposeTimeoutJitter returns the maximum time randomly added to the propose timeout. It is capped to the
+// increment of the propose timeout between two rounds, so that the timeout of a round never exceeds the one of the
+// next round without jitter and the timeouts keep on growing with the rounds.
+func (cfg *Config) GetProposeTimeoutJitter() time.Duration {
+	if cfg == nil {
+		return 0
+	}
+	jitter := time.Duration(cfg.ProposeTimeoutJitter) * time.Millisecond
+	if delta := cfg.TimeoutPropose(1) - cfg.TimeoutPropose(0); jitter > delta {
+		return delta
+	}
+	return jitter
+}
+
+// GetCommitTimeout returns how long precommits are gathered after a quorum is reached before committing.
+func (cfg *Config) GetCommitTimeout() time.Duration {
+	if cfg == nil {
+		return 0
+	}
+	return time.Duration(cfg.CommitTimeout) * time.Millisecond
+}
+
+// GetFutureHeightWindow returns how many heights ahead of the current one messages are accepted.
+func (cfg *Config) GetFutureHeightWindow() uint64 {
+	if cfg == nil || cfg.FutureHeightWindow == 0 {
+		return defaultFutureHeightWindow
+	}
+	return cfg.FutureHeightWindow
+}
+
+// GetFutureRoundWindow returns how many rounds ahead of the current one messages are accepted.
+func (cfg *Config) GetFutureRoundWindow() uint64 {
+	if cfg == nil || cfg.FutureRoundWindow == 0 {
+		return defaultFutureRoundWindow
+	}
+	return cfg.FutureRoundWindow
+}
+
+// IsSequenced returns whether the consensus messages of the given height carry a sequence.
+func (cfg *Config) IsSequenced(height *big.Int) bool {
+	return cfg != nil && cfg.SequenceBlock != nil && height != nil && cfg.SequenceBlock.Cmp(height) <= 0
+}
+
+// GetMessageRate returns how many consensus messages per second are accepted from a validator and the burst allowed
+// above it, never below the rate. A zero rate means no limit.
+func (cfg *Config) GetMessageRate() (rate, burst uint64) {
+	if cfg == nil {
+		return 0, 0
+	}
+	rate, burst = cfg.MessageRate, cfg.MessageBurst
+	if burst < rate {
+		burst = rate
+	}
+	return rate, burst
+}
+
+// GetGossipFanout returns how many peers a message is gossiped to at most, 0 meaning all of them.
+func (cfg *Config) GetGossipFanout() int {
+	if cfg == nil {
+		return 0
+	}
+	return int(cfg.GossipFanout)
+}
+
+// GetCompressionThreshold returns the size above which gossiped messages are compressed, 0 meaning never.
+func (cfg *Config) GetCompressionThreshold() int {
+	if cfg == nil {
+		return 0
+	}
+	return int(cfg.CompressionThreshold)
+}
+
+// GetReplayRate returns how many of the messages received while the engine was stopped are replayed per second.
+func (cfg *Config) GetReplayRate() uint64 {
+	if cfg == nil || cfg.ReplayRate == 0 {
+		return defaultReplayRate
+	}
+	return cfg.ReplayRate
+}
+
+// GetMaxPayloadSize returns the size above which consensus messages are rejected. By default it is the size of a
+// proposal whose transactions are made of the cheapest data filling the given gas limit.
+func (cfg *Config) GetMaxPayloadSize(gasLimit uint64) int {
+	if cfg == nil || cfg.MaxPayloadSize == 0 {
+		return int(gasLimit/params.TxDataZeroGas) + payloadOverhead
+	}
+	return int(cfg.MaxPayloadSize)
+}
+
+// GetOldRoundStates returns how many past rounds of the current height keep their state.
+func (cfg *Config) GetOldRoundStates() int64 {
+	if cfg == nil || cfg.OldRoundStates == 0 {
+		return defaultOldRoundStates
+	}
+	return int64(cfg.OldRoundStates)
+}
+
+// GetVerifyProposalWorkers returns how many proposals can be verified at the same time by VerifyProposals.
+func (cfg *Config) GetVerifyProposalWorkers() int {
+	if cfg == nil || cfg.VerifyProposalWorkers == 0 {
+		return 1
+	}
+	return int(cfg.VerifyProposalWorkers)
+}
+
+// GetVerifyProposalSignatureWorkers returns how many goroutines check the transaction signatures of a proposal
+// before its transactions are applied, 0 means the check is disabled.
+func (cfg *Config) GetVerifyProposalSignatureWorkers() int {
+	if cfg == nil {
+		return 0
+	}
+	return int(cfg.VerifyProposalSignatureWorkers)
+}
+
+// GetStallThreshold returns how long the height may stay unchanged before the node is considered stalled.
+func (cfg *Config) GetStallThreshold() time.Duration {
+	if cfg == nil || cfg.StallThreshold == 0 {
+		return defaultStallThreshold * time.Millisecond
+	}
+	return time.Duration(cfg.StallThreshold) * time.Millisecond
+}
+
+// GetSyncBatchSize returns how many messages are sent at once when syncing a peer.
+func (cfg *Config) GetSyncBatchSize() int {
+	if cfg == nil || cfg.SyncBatchSize == 0 {
+		return defaultSyncBatchSize
+	}
+	return int(cfg.SyncBatchSize)
+}
+
+// GetSyncBatchDelay returns the pause between two batches of messages sent when syncing a peer.
+func (cfg *Config) GetSyncBatchDelay() time.Duration {
+	if cfg == nil || cfg.SyncBatchDelay == 0 {
+		return defaultSyncBatchDelay * time.Millisecond
+	}
+	return time.Duration(cfg.SyncBatchDelay) * time.Millisecond
+}
+
+// GetEvidenceWindow returns for how many blocks fault evidence is kept.
+func (cfg *Config) GetEvidenceWindow() uint64 {
+	if cfg == nil || cfg.EvidenceWindow == 0 {
+		return defaultEvidenceWindow
+	}
+	return cfg.EvidenceWindow
+}
+
+func stepTimeout(base, delta, defaultBase, defaultDelta, round int64) time.Duration {
+	if base == 0 {
+		base = defaultBase
+	}
+	if delta == 0 {
+		delta = defaultDelta
 	}
+	return time.Duration(base+round*delta) * time.Millisecond
 }
 
 func (cfg *Config) SetProposerPolicy(p ProposerPolicy) {
@@ -0,0 +1,257 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeoutsScaleWithRound(t *testing.T) {
+	cfg := DefaultConfig()
+	for round := int64(0); round < 5; round++ {
+		if got, want := cfg.TimeoutPropose(round), time.Duration(3000+500*round)*time.Millisecond; got != want {
+			t.Errorf("propose timeout of round %d: got %v, want %v", round, got, want)
+		}
+		if got, want := cfg.TimeoutPrevote(round), time.Duration(1000+500*round)*time.Millisecond; got != want {
+			t.Errorf("prevote timeout of round %d: got %v, want %v", round, got, want)
+		}
+		if got, want := cfg.TimeoutPrecommit(round), time.Duration(1000+500*round)*time.Millisecond; got != want {
+			t.Errorf("precommit timeout of round %d: got %v, want %v", round, got, want)
+		}
+	}
+}
+
+func TestTimeoutsFromConfig(t *testing.T) {
+	cfg := &Config{
+		ProposeTimeout:        200,
+		ProposeTimeoutDelta:   20,
+		PrevoteTimeout:        100,
+		PrevoteTimeoutDelta:   10,
+		PrecommitTimeout:      50,
+		PrecommitTimeoutDelta: 5,
+	}
+	if got := cfg.TimeoutPropose(3); got != 260*time.Millisecond {
+		t.Errorf("propose timeout: got %v, want %v", got, 260*time.Millisecond)
+	}
+	if got := cfg.TimeoutPrevote(3); got != 130*time.Millisecond {
+		t.Errorf("prevote timeout: got %v, want %v", got, 130*time.Millisecond)
+	}
+	if got := cfg.TimeoutPrecommit(3); got != 65*time.Millisecond {
+		t.Errorf("precommit timeout: got %v, want %v", got, 65*time.Millisecond)
+	}
+}
+
+func TestTimeoutsDefaultWhenUnset(t *testing.T) {
+	var nilConfig *Config
+	for _, cfg := range []*Config{{}, nilConfig} {
+		if got, want := cfg.TimeoutPropose(2), DefaultConfig().TimeoutPropose(2); got != want {
+			t.Errorf("propose timeout: got %v, want %v", got, want)
+		}
+		if got, want := cfg.TimeoutPrevote(2), DefaultConfig().TimeoutPrevote(2); got != want {
+			t.Errorf("prevote timeout: got %v, want %v", got, want)
+		}
+		if got, want := cfg.TimeoutPrecommit(2), DefaultConfig().TimeoutPrecommit(2); got != want {
+			t.Errorf("precommit timeout: got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Fatalf("default config: got %v, want nil", err)
+	}
+	if err := (&Config{}).Validate(); err != nil {
+		t.Fatalf("empty config: got %v, want nil", err)
+	}
+
+	invalid := []*Config{
+		{ProposeTimeout: -1},
+		{ProposeTimeoutDelta: -1},
+		{PrevoteTimeout: -1},
+		{PrevoteTimeoutDelta: -1},
+		{PrecommitTimeout: -1},
+		{PrecommitTimeoutDelta: -1},
+	}
+	for i, cfg := range invalid {
+		if err := cfg.Validate(); err != errNegativeTimeout {
+			t.Errorf("config %d: got %v, want %v", i, err, errNegativeTimeout)
+		}
+	}
+}
+
+func TestFutureWindows(t *testing.T) {
+	var nilConfig *Config
+	if got := nilConfig.GetFutureHeightWindow(); got != defaultFutureHeightWindow {
+		t.Errorf("height window: got %d, want %d", got, defaultFutureHeightWindow)
+	}
+	if got := (&Config{}).GetFutureRoundWindow(); got != defaultFutureRoundWindow {
+		t.Errorf("round window: got %d, want %d", got, defaultFutureRoundWindow)
+	}
+	cfg := &Config{FutureHeightWindow: 3, FutureRoundWindow: 7}
+	if got := cfg.GetFutureHeightWindow(); got != 3 {
+		t.Errorf("height window: got %d, want %d", got, 3)
+	}
+	if got := cfg.GetFutureRoundWindow(); got != 7 {
+		t.Errorf("round window: got %d, want %d", got, 7)
+	}
+}
+
+func TestVerifyProposalWorkers(t *testing.T) {
+	var nilConfig *Config
+	if got := nilConfig.GetVerifyProposalWorkers(); got != 1 {
+		t.Errorf("verify proposal workers: got %d, want %d", got, 1)
+	}
+	if got := (&Config{VerifyProposalWorkers: 4}).GetVerifyProposalWorkers(); got != 4 {
+		t.Errorf("verify proposal workers: got %d, want %d", got, 4)
+	}
+}
+
+func TestVerifyProposalSignatureWorkers(t *testing.T) {
+	var nilConfig *Config
+	if got := nilConfig.GetVerifyProposalSignatureWorkers(); got != 0 {
+		t.Errorf("verify proposal signature workers: got %d, want %d", got, 0)
+	}
+	if got := (&Config{VerifyProposalSignatureWorkers: 4}).GetVerifyProposalSignatureWorkers(); got != 4 {
+		t.Errorf("verify proposal signature workers: got %d, want %d", got, 4)
+	}
+}
+
+func TestStallThreshold(t *testing.T) {
+	var nilConfig *Config
+	if got := nilConfig.GetStallThreshold(); got != defaultStallThreshold*time.Millisecond {
+		t.Errorf("stall threshold: got %v, want %v", got, defaultStallThreshold*time.Millisecond)
+	}
+	if got := (&Config{StallThreshold: 1500}).GetStallThreshold(); got != 1500*time.Millisecond {
+		t.Errorf("stall threshold: got %v, want %v", got, 1500*time.Millisecond)
+	}
+}
+
+func TestSyncBatch(t *testing.T) {
+	var nilConfig *Config
+	if got := nilConfig.GetSyncBatchSize(); got != defaultSyncBatchSize {
+		t.Errorf("sync batch size: got %d, want %d", got, defaultSyncBatchSize)
+	}
+	if got := nilConfig.GetSyncBatchDelay(); got != defaultSyncBatchDelay*time.Millisecond {
+		t.Errorf("sync batch delay: got %v, want %v", got, defaultSyncBatchDelay*time.Millisecond)
+	}
+	cfg := &Config{SyncBatchSize: 5, SyncBatchDelay: 200}
+	if got := cfg.GetSyncBatchSize(); got != 5 {
+		t.Errorf("sync batch size: got %d, want %d", got, 5)
+	}
+	if got := cfg.GetSyncBatchDelay(); got != 200*time.Millisecond {
+		t.Errorf("sync batch delay: got %v, want %v", got, 200*time.Millisecond)
+	}
+}
+
+func TestOldRoundStates(t *testing.T) {
+	var nilConfig *Config
+	if got := nilConfig.GetOldRoundStates(); got != defaultOldRoundStates {
+		t.Errorf("old round states: got %d, want %d", got, defaultOldRoundStates)
+	}
+	if got := (&Config{OldRoundStates: 8}).GetOldRoundStates(); got != 8 {
+		t.Errorf("old round states: got %d, want %d", got, 8)
+	}
+}
+
+func TestProposerPolicyString(t *testing.T) {
+	for policy, want := range map[ProposerPolicy]string{
+		RoundRobin:        "round-robin",
+		Sticky:            "sticky",
+		StakeWeighted:     "stake-weighted",
+		ProposerPolicy(7): "unknown",
+	} {
+		if got := policy.String(); got != want {
+			t.Errorf("policy %d: got %q, want %q", uint64(policy), got, want)
+		}
+	}
+}
+
+func TestReplayRate(t *testing.T) {
+	var nilConfig *Config
+	if got := nilConfig.GetReplayRate(); got != defaultReplayRate {
+		t.Errorf("replay rate: got %d, want %d", got, defaultReplayRate)
+	}
+	if got := (&Config{ReplayRate: 20}).GetReplayRate(); got != 20 {
+		t.Errorf("replay rate: got %d, want %d", got, 20)
+	}
+}
+
+func TestGossipFanout(t *testing.T) {
+	var nilConfig *Config
+	if got := nilConfig.GetGossipFanout(); got != 0 {
+		t.Errorf("gossip fanout: got %d, want %d", got, 0)
+	}
+	if got := (&Config{GossipFanout: 6}).GetGossipFanout(); got != 6 {
+		t.Errorf("gossip fanout: got %d, want %d", got, 6)
+	}
+}
+
+func TestCompressionThreshold(t *testing.T) {
+	var nilConfig *Config
+	if got := nilConfig.GetCompressionThreshold(); got != 0 {
+		t.Errorf("compression threshold: got %d, want %d", got, 0)
+	}
+	if got := (&Config{CompressionThreshold: 1024}).GetCompressionThreshold(); got != 1024 {
+		t.Errorf("compression threshold: got %d, want %d", got, 1024)
+	}
+}
+
+func TestMessageRate(t *testing.T) {
+	var nilConfig *Config
+	if rate, burst := nilConfig.GetMessageRate(); rate != 0 || burst != 0 {
+		t.Errorf("message rate: got %d %d, want 0 0", rate, burst)
+	}
+	if rate, burst := (&Config{MessageRate: 10, MessageBurst: 20}).GetMessageRate(); rate != 10 || burst != 20 {
+		t.Errorf("message rate: got %d %d, want 10 20", rate, burst)
+	}
+	// the burst is never below the rate
+	if rate, burst := (&Config{MessageRate: 10}).GetMessageRate(); rate != 10 || burst != 10 {
+		t.Errorf("message rate: got %d %d, want 10 10", rate, burst)
+	}
+}
+
+func TestEvidenceWindow(t *testing.T) {
+	var nilConfig *Config
+	if got := nilConfig.GetEvidenceWindow(); got != defaultEvidenceWindow {
+		t.Errorf("evidence window: got %d, want %d", got, defaultEvidenceWindow)
+	}
+	if got := (&Config{EvidenceWindow: 10}).GetEvidenceWindow(); got != 10 {
+		t.Errorf("evidence window: got %d, want %d", got, 10)
+	}
+}
+
+func TestProposeTimeoutJitter(t *testing.T) {
+	var nilConfig *Config
+	if got := nilConfig.GetProposeTimeoutJitter(); got != 0 {
+		t.Errorf("propose timeout jitter: got %d, want %d", got, 0)
+	}
+	if got := (&Config{ProposeTimeoutJitter: 200}).GetProposeTimeoutJitter(); got != 200*time.Millisecond {
+		t.Errorf("propose timeout jitter: got %d, want %d", got, 200*time.Millisecond)
+	}
+	// the jitter doesn't exceed the increment of the timeout between two rounds
+	if got := (&Config{ProposeTimeoutJitter: 200, ProposeTimeoutDelta: 50}).GetProposeTimeoutJitter(); got != 50*time.Millisecond {
+		t.Errorf("propose timeout jitter: got %d, want %d", got, 50*time.Millisecond)
+	}
+}
+
+func TestMaxPayloadSize(t *testing.T) {
+	var nilConfig *Config
+	if got := nilConfig.GetMaxPayloadSize(8000000); got != 2000000+payloadOverhead {
+		t.Errorf("max payload size: got %d, want %d", got, 2000000+payloadOverhead)
+	}
+	if got := (&Config{}).GetMaxPayloadSize(0); got != payloadOverhead {
+		t.Errorf("max payload size: got %d, want %d", got, payloadOverhead)
+	}
+	if got := (&Config{MaxPayloadSize: 4096}).GetMaxPayloadSize(8000000); got != 4096 {
+		t.Errorf("max payload size: got %d, want %d", got, 4096)
+	}
+}
+
+func TestCommitTimeout(t *testing.T) {
+	var nilConfig *Config
+	if got := nilConfig.GetCommitTimeout(); got != 0 {
+		t.Errorf("commit timeout: got %d, want %d", got, 0)
+	}
+	if got := (&Config{CommitTimeout: 200}).GetCommitTimeout(); got != 200*time.Millisecond {
+		t.Errorf("commit timeout: got %d, want %d", got, 200*time.Millisecond)
+	}
+}
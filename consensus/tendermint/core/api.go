@@ -0,0 +1,58 @@
+package core
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/clearmatics/autonity/common"
+)
+
+// API is an RPC API to inspect the consensus state
+type API struct {
+	core *core
+}
+
+// AdminAPI is an operator facing RPC API to intervene in the consensus state, registered in the admin namespace
+// so that it is only reachable by the node administrators
+type AdminAPI struct {
+	core *core
+}
+
+// ForceRoundChange moves the consensus at the given height to its next round.
+func (api *AdminAPI) ForceRoundChange(ctx context.Context, height uint64) error {
+	return api.core.ForceRoundChange(ctx, new(big.Int).SetUint64(height))
+}
+
+// RequestSync asks the network for the current consensus state right away, e.g. to speed up the recovery of a node
+// left behind by a network blip.
+func (api *API) RequestSync() {
+	api.core.RequestSync()
+}
+
+// SetProposingEnabled turns the proposing of new blocks on or off while the node keeps on voting, letting operators
+// take a validator through a risky window without it proposing.
+func (api *AdminAPI) SetProposingEnabled(enabled bool) {
+	api.core.SetProposingEnabled(enabled)
+}
+
+// GetLockedValueHash returns the hash of the value the node is locked on, the zero hash if there is none.
+func (api *API) GetLockedValueHash() common.Hash {
+	return api.core.LockedValueHash()
+}
+
+// GetValidValueHash returns the hash of the valid value of the node, the zero hash if there is none.
+func (api *API) GetValidValueHash() common.Hash {
+	return api.core.ValidValueHash()
+}
+
+// GetRoundTally returns the number of prevotes and precommits received in the current round for each block hash and
+// the number of nil votes, showing how the votes accumulate.
+func (api *API) GetRoundTally() *RoundTally {
+	return api.core.CurrentRoundTally()
+}
+
+// GetBacklog returns the number of messages received for each future round and the depth of the backlog,
+// helping to diagnose why the consensus is not moving to a new round.
+func (api *API) GetBacklog() *BacklogInfo {
+	return api.core.GetBacklogInfo()
+}
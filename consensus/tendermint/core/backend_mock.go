@@ -8,6 +8,7 @@ import (
 	context "context"
 	common "github.com/clearmatics/autonity/common"
 	consensus "github.com/clearmatics/autonity/consensus"
+	events "github.com/clearmatics/autonity/consensus/tendermint/events"
 	validator "github.com/clearmatics/autonity/consensus/tendermint/validator"
 	state "github.com/clearmatics/autonity/core/state"
 	types "github.com/clearmatics/autonity/core/types"
@@ -311,11 +312,12 @@ func (mr *MockBackendMockRecorder) Address() *gomock.Call {
 }
 
 // Validators mocks base method
-func (m *MockBackend) Validators(number uint64) validator.Set {
+func (m *MockBackend) Validators(number uint64) (validator.Set, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Validators", number)
 	ret0, _ := ret[0].(validator.Set)
-	return ret0
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // Validators indicates an expected call of Validators
@@ -354,6 +356,30 @@ func (mr *MockBackendMockRecorder) Post(ev interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Post", reflect.TypeOf((*MockBackend)(nil).Post), ev)
 }
 
+// StoreEvidence mocks base method
+func (m *MockBackend) StoreEvidence(step string, height *big.Int, round int64, validator common.Address, first, second []byte) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "StoreEvidence", step, height, round, validator, first, second)
+}
+
+// StoreEvidence indicates an expected call of StoreEvidence
+func (mr *MockBackendMockRecorder) StoreEvidence(step, height, round, validator, first, second interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StoreEvidence", reflect.TypeOf((*MockBackend)(nil).StoreEvidence), step, height, round, validator, first, second)
+}
+
+// ReportNilVote mocks base method
+func (m *MockBackend) ReportNilVote(ev events.NilVoteEvent) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "ReportNilVote", ev)
+}
+
+// ReportNilVote indicates an expected call of ReportNilVote
+func (mr *MockBackendMockRecorder) ReportNilVote(ev interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReportNilVote", reflect.TypeOf((*MockBackend)(nil).ReportNilVote), ev)
+}
+
 // Broadcast mocks base method
 func (m *MockBackend) Broadcast(ctx context.Context, valSet validator.Set, payload []byte) error {
 	m.ctrl.T.Helper()
@@ -369,9 +395,11 @@ func (mr *MockBackendMockRecorder) Broadcast(ctx, valSet, payload interface{}) *
 }
 
 // Gossip mocks base method
-func (m *MockBackend) Gossip(ctx context.Context, valSet validator.Set, payload []byte) {
+func (m *MockBackend) Gossip(ctx context.Context, valSet validator.Set, payload []byte) error {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "Gossip", ctx, valSet, payload)
+	ret := m.ctrl.Call(m, "Gossip", ctx, valSet, payload)
+	ret0, _ := ret[0].(error)
+	return ret0
 }
 
 // Gossip indicates an expected call of Gossip
@@ -381,7 +409,7 @@ func (mr *MockBackendMockRecorder) Gossip(ctx, valSet, payload interface{}) *gom
 }
 
 // Commit mocks base method
-func (m *MockBackend) Commit(proposalBlock types.Block, seals [][]byte) error {
+func (m *MockBackend) Commit(proposalBlock Value, seals [][]byte) error {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Commit", proposalBlock, seals)
 	ret0, _ := ret[0].(error)
@@ -395,7 +423,7 @@ func (mr *MockBackendMockRecorder) Commit(proposalBlock, seals interface{}) *gom
 }
 
 // VerifyProposal mocks base method
-func (m *MockBackend) VerifyProposal(arg0 types.Block) (time.Duration, error) {
+func (m *MockBackend) VerifyProposal(arg0 Value) (time.Duration, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "VerifyProposal", arg0)
 	ret0, _ := ret[0].(time.Duration)
@@ -494,15 +522,15 @@ func (mr *MockBackendMockRecorder) SetProposedBlockHash(hash interface{}) *gomoc
 }
 
 // SyncPeer mocks base method
-func (m *MockBackend) SyncPeer(address common.Address, messages []*Message) {
+func (m *MockBackend) SyncPeer(ctx context.Context, address common.Address, messages []*Message) {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "SyncPeer", address, messages)
+	m.ctrl.Call(m, "SyncPeer", ctx, address, messages)
 }
 
 // SyncPeer indicates an expected call of SyncPeer
-func (mr *MockBackendMockRecorder) SyncPeer(address, messages interface{}) *gomock.Call {
+func (mr *MockBackendMockRecorder) SyncPeer(ctx, address, messages interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SyncPeer", reflect.TypeOf((*MockBackend)(nil).SyncPeer), address, messages)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SyncPeer", reflect.TypeOf((*MockBackend)(nil).SyncPeer), ctx, address, messages)
 }
 
 // ResetPeerCache mocks base method
@@ -518,15 +546,15 @@ func (mr *MockBackendMockRecorder) ResetPeerCache(address interface{}) *gomock.C
 }
 
 // AskSync mocks base method
-func (m *MockBackend) AskSync(set validator.Set) {
+func (m *MockBackend) AskSync(set validator.Set, height, round *big.Int) {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "AskSync", set)
+	m.ctrl.Call(m, "AskSync", set, height, round)
 }
 
 // AskSync indicates an expected call of AskSync
-func (mr *MockBackendMockRecorder) AskSync(set interface{}) *gomock.Call {
+func (mr *MockBackendMockRecorder) AskSync(set, height, round interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AskSync", reflect.TypeOf((*MockBackend)(nil).AskSync), set)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AskSync", reflect.TypeOf((*MockBackend)(nil).AskSync), set, height, round)
 }
 
 // HandleUnhandledMsgs mocks base method
@@ -582,3 +610,73 @@ func (mr *MockBackendMockRecorder) WhiteList() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WhiteList", reflect.TypeOf((*MockBackend)(nil).WhiteList))
 }
+
+// SaveLockState mocks base method
+func (m *MockBackend) SaveLockState(data []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveLockState", data)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveLockState indicates an expected call of SaveLockState
+func (mr *MockBackendMockRecorder) SaveLockState(data interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveLockState", reflect.TypeOf((*MockBackend)(nil).SaveLockState), data)
+}
+
+// LoadLockState mocks base method
+func (m *MockBackend) LoadLockState() ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LoadLockState")
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LoadLockState indicates an expected call of LoadLockState
+func (mr *MockBackendMockRecorder) LoadLockState() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoadLockState", reflect.TypeOf((*MockBackend)(nil).LoadLockState))
+}
+
+// ForgetMessage mocks base method
+func (m *MockBackend) ForgetMessage(payload []byte) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "ForgetMessage", payload)
+}
+
+// ForgetMessage indicates an expected call of ForgetMessage
+func (mr *MockBackendMockRecorder) ForgetMessage(payload interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ForgetMessage", reflect.TypeOf((*MockBackend)(nil).ForgetMessage), payload)
+}
+
+// SaveSequence mocks base method
+func (m *MockBackend) SaveSequence(data []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveSequence", data)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveSequence indicates an expected call of SaveSequence
+func (mr *MockBackendMockRecorder) SaveSequence(data interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveSequence", reflect.TypeOf((*MockBackend)(nil).SaveSequence), data)
+}
+
+// LoadSequence mocks base method
+func (m *MockBackend) LoadSequence() ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LoadSequence")
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LoadSequence indicates an expected call of LoadSequence
+func (mr *MockBackendMockRecorder) LoadSequence() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoadSequence", reflect.TypeOf((*MockBackend)(nil).LoadSequence))
+}
@@ -18,7 +18,9 @@ package core
 
 import (
 	"math/big"
+	"sync/atomic"
 
+	"github.com/clearmatics/autonity/common"
 	"github.com/clearmatics/autonity/consensus/tendermint/validator"
 	"gopkg.in/karalabe/cookiejar.v2/collections/prque"
 )
@@ -49,10 +51,19 @@ func (c *core) checkMessage(round *big.Int, height *big.Int, step Step) error {
 	}
 
 	if height.Cmp(c.currentRoundState.Height()) > 0 {
+		// messages too far ahead are dropped instead of filling the backlog
+		maxHeight := new(big.Int).Add(c.currentRoundState.Height(), new(big.Int).SetUint64(c.config.GetFutureHeightWindow()))
+		if height.Cmp(maxHeight) > 0 {
+			return errFarFutureMessage
+		}
 		return errFutureHeightMessage
 	} else if height.Cmp(c.currentRoundState.Height()) < 0 {
 		return errOldHeightMessage
 	} else if round.Cmp(c.currentRoundState.Round()) > 0 {
+		maxRound := new(big.Int).Add(c.currentRoundState.Round(), new(big.Int).SetUint64(c.config.GetFutureRoundWindow()))
+		if round.Cmp(maxRound) > 0 {
+			return errFarFutureMessage
+		}
 		return errFutureRoundMessage
 	} else if round.Cmp(c.currentRoundState.Round()) < 0 {
 		return errOldRoundMessage
@@ -64,7 +75,7 @@ func (c *core) checkMessage(round *big.Int, height *big.Int, step Step) error {
 }
 
 func (c *core) storeBacklog(msg *Message, src validator.Validator) {
-	logger := c.logger.New("from", src, "step", c.currentRoundState.Step())
+	logger := c.roundLogger().New("from", src)
 
 	if src.Address() == c.address {
 		logger.Warn("Backlog from self")
@@ -96,6 +107,7 @@ func (c *core) storeBacklog(msg *Message, src validator.Validator) {
 		}
 	}
 	c.backlogs[src] = backlogPrque
+	atomic.StoreUint32(&c.backlogPending, 1)
 }
 
 func (c *core) processBacklog() {
@@ -107,7 +119,7 @@ func (c *core) processBacklog() {
 			continue
 		}
 
-		logger := c.logger.New("from", src, "step", c.currentRoundState.Step())
+		logger := c.roundLogger().New("from", src)
 		var isFuture bool
 
 		// We stop processing if
@@ -156,6 +168,52 @@ func (c *core) processBacklog() {
 			})
 		}
 	}
+
+	var pending uint32
+	for _, backlog := range c.backlogs {
+		if backlog != nil && !backlog.Empty() {
+			pending = 1
+			break
+		}
+	}
+	atomic.StoreUint32(&c.backlogPending, pending)
+}
+
+// BacklogInfo is a snapshot of the future messages held by the core.
+type BacklogInfo struct {
+	// FutureRoundsChange is the number of messages received for each future round of the current height
+	FutureRoundsChange map[int64]int64 `json:"futureRoundsChange"`
+	// Backlogs is the number of backlogged messages of each validator
+	Backlogs map[common.Address]int `json:"backlogs"`
+	// Depth is the total number of backlogged messages
+	Depth int `json:"depth"`
+}
+
+// GetBacklogInfo returns a copy of the future round counters and of the backlog sizes, it is safe to call while
+// the core is running.
+func (c *core) GetBacklogInfo() *BacklogInfo {
+	info := &BacklogInfo{
+		FutureRoundsChange: make(map[int64]int64),
+		Backlogs:           make(map[common.Address]int),
+	}
+
+	c.futureRoundsChangeMu.RLock()
+	for round, count := range c.futureRoundsChange {
+		info.FutureRoundsChange[round] = count
+	}
+	c.futureRoundsChangeMu.RUnlock()
+
+	c.backlogsMu.Lock()
+	for src, backlog := range c.backlogs {
+		if backlog == nil {
+			continue
+		}
+		info.Backlogs[src.Address()] += backlog.Size()
+		info.Depth += backlog.Size()
+	}
+	c.backlogsMu.Unlock()
+
+	return info
 }
 
 func toPriority(msgCode uint64, r *big.Int, h *big.Int) float32 {
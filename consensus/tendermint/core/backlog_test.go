@@ -3,6 +3,7 @@ package core
 import (
 	"math/big"
 	"reflect"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -10,6 +11,7 @@ import (
 	"gopkg.in/karalabe/cookiejar.v2/collections/prque"
 
 	"github.com/clearmatics/autonity/common"
+	"github.com/clearmatics/autonity/consensus/tendermint/config"
 	"github.com/clearmatics/autonity/consensus/tendermint/validator"
 	"github.com/clearmatics/autonity/core/types"
 	"github.com/clearmatics/autonity/log"
@@ -69,6 +71,65 @@ func TestCheckMessage(t *testing.T) {
 		}
 	})
 
+	t.Run("given future height at the edge of the window, error returned", func(t *testing.T) {
+		c := &core{
+			config:            &config.Config{FutureHeightWindow: 5},
+			currentRoundState: NewRoundState(big.NewInt(2), big.NewInt(3)),
+		}
+
+		err := c.checkMessage(big.NewInt(0), big.NewInt(8), propose)
+		if err != errFutureHeightMessage {
+			t.Fatalf("have %v, want %v", err, errFutureHeightMessage)
+		}
+	})
+
+	t.Run("given future height beyond the window, error returned", func(t *testing.T) {
+		c := &core{
+			config:            &config.Config{FutureHeightWindow: 5},
+			currentRoundState: NewRoundState(big.NewInt(2), big.NewInt(3)),
+		}
+
+		err := c.checkMessage(big.NewInt(0), big.NewInt(9), propose)
+		if err != errFarFutureMessage {
+			t.Fatalf("have %v, want %v", err, errFarFutureMessage)
+		}
+	})
+
+	t.Run("given future round at the edge of the window, error returned", func(t *testing.T) {
+		c := &core{
+			config:            &config.Config{FutureRoundWindow: 10},
+			currentRoundState: NewRoundState(big.NewInt(2), big.NewInt(3)),
+		}
+
+		err := c.checkMessage(big.NewInt(12), big.NewInt(3), propose)
+		if err != errFutureRoundMessage {
+			t.Fatalf("have %v, want %v", err, errFutureRoundMessage)
+		}
+	})
+
+	t.Run("given future round beyond the window, error returned", func(t *testing.T) {
+		c := &core{
+			config:            &config.Config{FutureRoundWindow: 10},
+			currentRoundState: NewRoundState(big.NewInt(2), big.NewInt(3)),
+		}
+
+		err := c.checkMessage(big.NewInt(13), big.NewInt(3), propose)
+		if err != errFarFutureMessage {
+			t.Fatalf("have %v, want %v", err, errFarFutureMessage)
+		}
+	})
+
+	t.Run("given absurd round without config, error returned", func(t *testing.T) {
+		c := &core{
+			currentRoundState: NewRoundState(big.NewInt(2), big.NewInt(3)),
+		}
+
+		err := c.checkMessage(big.NewInt(1<<31), big.NewInt(3), propose)
+		if err != errFarFutureMessage {
+			t.Fatalf("have %v, want %v", err, errFarFutureMessage)
+		}
+	})
+
 	t.Run("given old round, error returned", func(t *testing.T) {
 		c := &core{
 			currentRoundState: NewRoundState(big.NewInt(2), big.NewInt(2)),
@@ -169,6 +230,58 @@ func TestStoreBacklog(t *testing.T) {
 	})
 }
 
+func TestGetBacklogInfo(t *testing.T) {
+	c := &core{
+		logger:             log.New("backend", "test", "id", 0),
+		address:            common.HexToAddress("0x1234567890"),
+		currentRoundState:  NewRoundState(big.NewInt(1), big.NewInt(2)),
+		backlogs:           make(map[validator.Validator]*prque.Prque),
+		futureRoundsChange: map[int64]int64{2: 1, 5: 3},
+	}
+	api := &API{core: c}
+
+	votePayload, err := Encode(&Vote{Round: big.NewInt(2), Height: big.NewInt(2)})
+	if err != nil {
+		t.Fatalf("have %v, want nil", err)
+	}
+	msg := &Message{Code: msgPrevote, Msg: votePayload}
+
+	val1 := validator.New(common.HexToAddress("0x0987654321"))
+	val2 := validator.New(common.HexToAddress("0x0987654322"))
+
+	// the accessor must be safe to call while the core stores future messages
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			api.GetBacklog()
+		}
+	}()
+	c.storeBacklog(msg, val1)
+	c.storeBacklog(msg, val1)
+	c.storeBacklog(msg, val2)
+	<-done
+
+	want := &BacklogInfo{
+		FutureRoundsChange: map[int64]int64{2: 1, 5: 3},
+		Backlogs: map[common.Address]int{
+			val1.Address(): 2,
+			val2.Address(): 1,
+		},
+		Depth: 3,
+	}
+	info := api.GetBacklog()
+	if !reflect.DeepEqual(info, want) {
+		t.Fatalf("have %+v, want %+v", info, want)
+	}
+
+	// the returned info is a snapshot, changing it doesn't affect the core
+	info.FutureRoundsChange[2] = 10
+	if c.futureRoundsChange[2] != 1 {
+		t.Fatalf("have %v, want 1", c.futureRoundsChange[2])
+	}
+}
+
 func TestProcessBacklog(t *testing.T) {
 	t.Run("valid proposal received", func(t *testing.T) {
 		proposal := &Proposal{
@@ -465,3 +578,81 @@ func TestProcessBacklog(t *testing.T) {
 		<-timeout.C
 	})
 }
+
+func TestSetStepProcessesBacklog(t *testing.T) {
+	vote := &Vote{
+		Round:  big.NewInt(1),
+		Height: big.NewInt(2),
+	}
+	votePayload, err := Encode(vote)
+	if err != nil {
+		t.Fatalf("have %v, want nil", err)
+	}
+	msg := &Message{
+		Code: msgPrevote,
+		Msg:  votePayload,
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	val := newTestValidatorSet(1).GetByIndex(0)
+	evChan := make(chan interface{}, 1)
+	backendMock := NewMockBackend(ctrl)
+	backendMock.EXPECT().Post(backlogEvent{src: val, msg: msg}).Do(func(ev interface{}) {
+		evChan <- ev
+	})
+
+	c := &core{
+		logger:            log.New("backend", "test", "id", 0),
+		backend:           backendMock,
+		address:           common.HexToAddress("0x1234567890"),
+		backlogs:          make(map[validator.Validator]*prque.Prque),
+		currentRoundState: NewRoundState(big.NewInt(1), big.NewInt(2)),
+	}
+	if atomic.LoadUint32(&c.backlogPending) != 0 {
+		t.Fatalf("backlog pending without any message")
+	}
+
+	c.storeBacklog(msg, val)
+	if atomic.LoadUint32(&c.backlogPending) != 1 {
+		t.Fatalf("backlog not pending after storing a message")
+	}
+
+	// the vote stays in the backlog at the propose step
+	c.setStep(propose)
+	if atomic.LoadUint32(&c.backlogPending) != 1 {
+		t.Fatalf("backlog not pending with a future step message")
+	}
+
+	c.setStep(prevote)
+	select {
+	case ev := <-evChan:
+		if e, ok := ev.(backlogEvent); !ok || e.msg.Code != msg.Code {
+			t.Errorf("unexpected event: %v", ev)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("backlog message not processed")
+	}
+	if atomic.LoadUint32(&c.backlogPending) != 0 {
+		t.Fatalf("backlog pending once emptied")
+	}
+}
+
+func BenchmarkSetStepEmptyBacklog(b *testing.B) {
+	valSet := newTestValidatorSet(21)
+	c := &core{
+		logger:            log.New("backend", "test", "id", 0),
+		backlogs:          make(map[validator.Validator]*prque.Prque),
+		currentRoundState: NewRoundState(big.NewInt(1), big.NewInt(2)),
+	}
+	// queues left empty by earlier processing
+	for _, val := range valSet.List() {
+		c.backlogs[val] = prque.New()
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.setStep(Step(i % 3))
+	}
+}
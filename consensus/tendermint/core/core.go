@@ -22,15 +22,20 @@ import (
 	"errors"
 	"math"
 	"math/big"
+	"math/rand"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/clearmatics/autonity/common"
 	"github.com/clearmatics/autonity/consensus/tendermint/config"
+	"github.com/clearmatics/autonity/consensus/tendermint/crypto"
 	"github.com/clearmatics/autonity/consensus/tendermint/validator"
 	"github.com/clearmatics/autonity/core/types"
 	"github.com/clearmatics/autonity/event"
 	"github.com/clearmatics/autonity/log"
+	lru "github.com/hashicorp/golang-lru"
 	"gopkg.in/karalabe/cookiejar.v2/collections/prque"
 )
 
@@ -69,11 +74,31 @@ var (
 	errNilPrecommitSent = errors.New("timer expired and nil precommit sent")
 	// errMovedToNewRound is returned when timer could be stopped in time
 	errMovedToNewRound = errors.New("timer expired and new round started")
+	// errFarFutureMessage is returned when the view of the received message is beyond the accepted future window.
+	errFarFutureMessage = errors.New("message too far in the future")
+	// errMessageRateExceeded is returned when a validator sends more messages than its rate limit allows.
+	errMessageRateExceeded = errors.New("message rate exceeded")
+	// errNotCurrentHeight is returned when a round change is forced for another height than the current one.
+	errNotCurrentHeight = errors.New("not the current height")
+	// errNotValidator is returned when a message is signed by a key which isn't in the validator set.
+	errNotValidator = errors.New("message not signed by a validator")
+	// errReplayedMessage is returned when a validator message was already received, whatever its payload is cached.
+	errReplayedMessage = errors.New("replayed message")
+	// errInvalidSequence is returned when a message lacks the sequence its height requires, or carries one before the
+	// sequence block.
+	errInvalidSequence = errors.New("invalid message sequence")
+	// errTooManySequences is returned when a validator sent more messages in a round than an honest one ever does.
+	errTooManySequences = errors.New("too many messages in round")
+	// errPayloadTooLarge is returned when a message payload exceeds the maximum size, before it is decoded.
+	errPayloadTooLarge = errors.New("message payload too large")
 )
 
+const cachedSigners = 4096 // Number of recent message signatures whose signer is cached
+
 // New creates an Tendermint consensus core
 func New(backend Backend, config *config.Config) *core {
 	logger := log.New("addr", backend.Address().String())
+	messageLimits, _ := lru.New(rateLimitedValidators)
 	return &core{
 		config:                       config,
 		address:                      backend.Address(),
@@ -96,6 +121,12 @@ func New(backend Backend, config *config.Config) *core {
 		proposeTimeout:               newTimeout(propose, logger),
 		prevoteTimeout:               newTimeout(prevote, logger),
 		precommitTimeout:             newTimeout(precommit, logger),
+		commitTimeout:                newTimeout(precommitDone, logger),
+		messageLimits:                messageLimits,
+		signers:                      crypto.NewSignerCache(cachedSigners),
+		jitter:                       newJitterSource(backend.Address()),
+		seenSequences:                make(map[sequenceKey]map[uint64]struct{}),
+		now:                          time.Now,
 	}
 }
 
@@ -114,6 +145,7 @@ type core struct {
 	syncEventSub            *event.TypeMuxSubscription
 	futureProposalTimer     *time.Timer
 	stopped                 chan struct{}
+	running                 int32 // number of goroutines started by Start which haven't signaled stopped yet
 	isStarted               *uint32
 	isStarting              *uint32
 	isStopping              *uint32
@@ -123,6 +155,9 @@ type core struct {
 
 	backlogs   map[validator.Validator]*prque.Prque
 	backlogsMu sync.Mutex
+	// backlogPending is set to 1 while a backlog may hold messages, so that setStep skips processBacklog otherwise.
+	// It is written with backlogsMu held and read atomically.
+	backlogPending uint32
 
 	currentRoundState *roundState
 
@@ -139,8 +174,13 @@ type core struct {
 
 	lockedRound *big.Int
 	validRound  *big.Int
-	lockedValue *types.Block
-	validValue  *types.Block
+	lockedValue Value
+	validValue  Value
+	// guards the writes of lockedValue and validValue, which are read by the diagnostics API
+	valuesMu sync.RWMutex
+
+	// lock state persisted before the last stop, applied when the first round starts
+	restoredLockState *lockState
 
 	currentHeightOldRoundsStates   map[int64]*roundState
 	currentHeightOldRoundsStatesMu sync.RWMutex
@@ -148,22 +188,74 @@ type core struct {
 	proposeTimeout   *timeout
 	prevoteTimeout   *timeout
 	precommitTimeout *timeout
+	// started once a quorum of precommits is reached if config.CommitTimeout is set, it keeps on running through the
+	// round changes of the height
+	commitTimeout *timeout
+	// the value decided by a quorum of precommits, committed once the commit timeout expires
+	pendingDecision *decision
+	// source of the propose timeout jitter, only drawn from by the event loop as the round starts, the timer goroutine
+	// reads the drawn duration from proposeTimeout
+	jitter *rand.Rand
+	// size above which message payloads are rejected, set as each round starts, 0 meaning no limit
+	maxPayloadSize int64
+	// sequence of the last message sent at the current height, the sequence persisted as reserved up to, and the
+	// sequences received from the validators per round at the current and future heights, only used by the event loop
+	sequence         uint64
+	reservedSequence uint64
+	seenSequences    map[sequenceKey]map[uint64]struct{}
 
 	//map[futureRoundNumber]NumberOfMessagesReceivedForTheRound
-	futureRoundsChange map[int64]int64
+	futureRoundsChange   map[int64]int64
+	futureRoundsChangeMu sync.RWMutex
+
+	// message rate limits of the validators, map[common.Address]*ratelimit.Bucket
+	messageLimits *lru.Cache
+	// signers recovered from the recent message signatures
+	signers *crypto.SignerCache
+
+	// closed once the last commit started has been handed to the backend, drained by Stop
+	commitDone   chan struct{}
+	commitDoneMu sync.Mutex
+
+	liveness      livenessWatchdog
+	equivocations equivocationDetector
+
+	// clock used by the liveness watchdog, tests can freeze it
+	now func() time.Time
+
+	// set to 1 while the node doesn't propose new blocks on its turn, it is read and written atomically
+	proposingDisabled uint32
 }
 
+// SetProposingEnabled turns the proposing of new blocks on or off, the node keeps on voting either way. While it is
+// off the node only proposes its valid value on its turn, if any, letting the round time out otherwise.
+func (c *core) SetProposingEnabled(enabled bool) {
+	var disabled uint32
+	if !enabled {
+		disabled = 1
+	}
+	atomic.StoreUint32(&c.proposingDisabled, disabled)
+	c.logger.Info("Set proposing", "enabled", enabled)
+}
+
+func (c *core) isProposingEnabled() bool {
+	return atomic.LoadUint32(&c.proposingDisabled) == 0
+}
+
+// GetCurrentHeightMessages returns the messages of the current height ordered by round, then in the order they were
+// received within a round.
 func (c *core) GetCurrentHeightMessages() []*Message {
 	c.currentHeightOldRoundsStatesMu.RLock()
 	defer c.currentHeightOldRoundsStatesMu.RUnlock()
 
-	msgs := make([][]*Message, len(c.currentHeightOldRoundsStates)+1)
+	// the old rounds may not start at round 0 once pruned, so they are not indexed by round
+	msgs := make([][]*Message, 0, len(c.currentHeightOldRoundsStates)+1)
 	var totalLen int
-	for i, state := range c.currentHeightOldRoundsStates {
-		msgs[i] = state.GetMessages()
-		totalLen += len(msgs[i])
+	for _, r := range c.sortedOldRounds() {
+		msgs = append(msgs, c.currentHeightOldRoundsStates[r].GetMessages())
+		totalLen += len(msgs[len(msgs)-1])
 	}
-	msgs[len(msgs)-1] = c.currentRoundState.GetMessages()
+	msgs = append(msgs, c.currentRoundState.GetMessages())
 
 	totalLen += len(msgs[len(msgs)-1])
 
@@ -175,6 +267,45 @@ func (c *core) GetCurrentHeightMessages() []*Message {
 	return result
 }
 
+// currentHeightMessagesFrom returns the messages of the current height a peer at the given view may miss, those of
+// the rounds at or above the given round if the peer is at the current height. A nil height returns all messages.
+func (c *core) currentHeightMessagesFrom(height, round *big.Int) []*Message {
+	if height == nil || round == nil {
+		return c.GetCurrentHeightMessages()
+	}
+	switch height.Cmp(c.currentRoundState.Height()) {
+	case -1:
+		return c.GetCurrentHeightMessages()
+	case 1:
+		return nil
+	}
+
+	c.currentHeightOldRoundsStatesMu.RLock()
+	defer c.currentHeightOldRoundsStatesMu.RUnlock()
+
+	var result []*Message
+	for _, r := range c.sortedOldRounds() {
+		if r >= round.Int64() {
+			result = append(result, c.currentHeightOldRoundsStates[r].GetMessages()...)
+		}
+	}
+	if c.currentRoundState.Round().Cmp(round) >= 0 {
+		result = append(result, c.currentRoundState.GetMessages()...)
+	}
+	return result
+}
+
+// sortedOldRounds returns the past rounds of the current height with a state in increasing order, it must be called
+// with currentHeightOldRoundsStatesMu held.
+func (c *core) sortedOldRounds() []int64 {
+	rounds := make([]int64, 0, len(c.currentHeightOldRoundsStates))
+	for r := range c.currentHeightOldRoundsStates {
+		rounds = append(rounds, r)
+	}
+	sort.Slice(rounds, func(i, j int) bool { return rounds[i] < rounds[j] })
+	return rounds
+}
+
 func (c *core) IsValidator(address common.Address) bool {
 	_, val := c.valSet.GetByAddress(address)
 	return val != nil
@@ -202,8 +333,28 @@ func (c *core) finalizeMessage(msg *Message) ([]byte, error) {
 	return payload, nil
 }
 
+// roundLogger returns the core logger tagged with the current height, round and step, all the log lines
+// of the consensus hot path should go through it so that they can be correlated.
+func (c *core) roundLogger() log.Logger {
+	if c.currentRoundState == nil {
+		return c.logger
+	}
+	height, round, _ := c.currentRoundState.State()
+	return c.logger.New("height", height, "round", round, "step", c.currentRoundState.Step())
+}
+
+// CurrentRoundTally returns the votes received so far in the current round, it is safe to call while the core is
+// running.
+func (c *core) CurrentRoundTally() *RoundTally {
+	return c.currentRoundState.Tally()
+}
+
 func (c *core) broadcast(ctx context.Context, msg *Message) {
-	logger := c.logger.New("step", c.currentRoundState.Step())
+	logger := c.roundLogger()
+
+	if c.config.IsSequenced(c.currentRoundState.Height()) {
+		msg.Sequence = c.nextSequence()
+	}
 
 	payload, err := c.finalizeMessage(msg)
 	if err != nil {
@@ -223,34 +374,84 @@ func (c *core) isProposer() bool {
 	return c.valSet.IsProposer(c.address)
 }
 
+// decision is a value decided by a quorum of precommits along with the precommits of its round, copied out of the round
+// state which is reused when the node moves to another round.
+type decision struct {
+	round      int64
+	proposal   *Proposal
+	precommits messageSet
+}
+
 func (c *core) commit() {
+	c.commitDecision(&decision{
+		round:      c.currentRoundState.Round().Int64(),
+		proposal:   c.currentRoundState.Proposal(),
+		precommits: c.currentRoundState.Precommits,
+	})
+}
+
+// commitDecision commits the decided value with the committed seals of the precommits of its round.
+func (c *core) commitDecision(d *decision) {
+	done := make(chan struct{})
+	c.commitDoneMu.Lock()
+	c.commitDone = done
+	c.commitDoneMu.Unlock()
+	defer close(done)
+
 	c.setStep(precommitDone)
+	c.pendingDecision = nil
 
-	proposal := c.currentRoundState.Proposal()
+	proposal := d.proposal
+	logger := c.roundLogger()
 
 	if proposal != nil {
-		if proposal.ProposalBlock != nil {
-			c.logger.Warn("commit a block", "hash", proposal.ProposalBlock.Header().Hash())
-		} else {
-			c.logger.Error("commit a NIL block",
-				"block", proposal.ProposalBlock,
-				"height", c.currentRoundState.height.String(),
-				"round", c.currentRoundState.round.String())
+		if proposal.ProposalBlock == nil {
+			logger.Error("commit a NIL block", "block", proposal.ProposalBlock)
+			return
 		}
+		logger.Warn("commit a block", "hash", proposal.ProposalBlock.Hash())
 
-		committedSeals := make([][]byte, c.currentRoundState.Precommits.VotesSize(proposal.ProposalBlock.Hash()))
-		for i, v := range c.currentRoundState.Precommits.Values(proposal.ProposalBlock.Hash()) {
-			committedSeals[i] = make([]byte, types.BFTExtraSeal)
-			copy(committedSeals[i][:], v.CommittedSeal[:])
-		}
+		committedSeals := c.committedSeals(&d.precommits, proposal.ProposalBlock.Hash())
 
-		if err := c.backend.Commit(*proposal.ProposalBlock, committedSeals); err != nil {
-			c.logger.Error("Failed to Commit block", "err", err)
+		if err := c.backend.Commit(proposal.ProposalBlock, committedSeals); err != nil {
+			logger.Error("Failed to Commit block", "err", err)
 			return
 		}
 	}
 }
 
+// committedSeals returns the committed seals of the precommits for the given hash. Only one seal is kept per
+// validator, seals which don't recover to a validator of the current set are dropped.
+func (c *core) committedSeals(precommits *messageSet, hash common.Hash) [][]byte {
+	logger := c.roundLogger()
+	sealData := PrepareCommittedSeal(hash)
+	signers := make(map[common.Address]struct{})
+	seals := make([][]byte, 0, precommits.VotesSize(hash))
+
+	for _, v := range precommits.Values(hash) {
+		signer, err := types.GetSignatureAddress(sealData, v.CommittedSeal)
+		if err != nil {
+			logger.Error("Invalid committed seal", "from", v.Address, "err", err)
+			continue
+		}
+		if _, val := c.valSet.GetByAddress(signer); val == nil {
+			logger.Error("Committed seal not signed by a validator", "from", v.Address, "signer", signer)
+			continue
+		}
+		if _, ok := signers[signer]; ok {
+			logger.Error("Duplicated committed seal", "from", v.Address, "signer", signer)
+			continue
+		}
+		signers[signer] = struct{}{}
+
+		seal := make([]byte, types.BFTExtraSeal)
+		copy(seal, v.CommittedSeal)
+		seals = append(seals, seal)
+	}
+
+	return seals
+}
+
 // Metric collecton of round change and height change.
 func (c *core) measureHeightRoundMetrics(round *big.Int) {
 	if round.Cmp(common.Big0) == 0 {
@@ -268,39 +469,45 @@ func (c *core) startRound(ctx context.Context, round *big.Int) {
 	c.measureHeightRoundMetrics(round)
 	lastCommittedProposalBlock, lastCommittedProposalBlockProposer := c.backend.LastCommittedProposal()
 	height := new(big.Int).Add(lastCommittedProposalBlock.Number(), common.Big1)
+	atomic.StoreInt64(&c.maxPayloadSize, int64(c.config.GetMaxPayloadSize(lastCommittedProposalBlock.GasLimit())))
 
 	c.setCore(round, height, lastCommittedProposalBlockProposer)
 
 	// c.setStep(propose) will process the pending unmined blocks sent by the backed.Seal() and set c.lastestPendingRequest
 	c.setStep(propose)
 
-	c.logger.Debug("Starting new Round", "Height", height, "Round", round)
+	c.roundLogger().Debug("Starting new Round")
 
 	// If the node is the proposer for this round then it would propose validValue or a new block, otherwise,
 	// proposeTimeout is started, where the node waits for a proposal from the proposer of the current round.
-	if c.isProposer() {
+	// A proposer with proposing disabled only proposes validValue, it otherwise lets the round time out as well.
+	isProposer := c.isProposer()
+	if isProposer && (c.validValue != nil || c.isProposingEnabled()) {
 		// validValue and validRound represent a block they received a quorum of prevote and the round quorum was
 		// received, respectively. If the block is not committed in that round then the round is changed.
 		// The new proposer will chose the validValue, if present, which was set in one of the previous rounds otherwise
 		// they propose a new block.
-		var p *types.Block
+		var p Value
 		if c.validValue != nil {
 			p = c.validValue
+		} else if b := c.getUnminedBlock(); b != nil {
+			p = b
 		} else {
-			p = c.getUnminedBlock()
-			if p == nil {
-				select {
-				case <-ctx.Done():
-					return
-				case p = <-c.pendingUnminedBlockCh:
-				}
+			select {
+			case <-ctx.Done():
+				return
+			case b = <-c.pendingUnminedBlockCh:
+				p = b
 			}
 		}
 		c.sendProposal(ctx, p)
 	} else {
-		timeoutDuration := timeoutPropose(round.Int64())
+		if isProposer {
+			c.roundLogger().Info("Proposing disabled, declining to propose a new block")
+		}
+		timeoutDuration := c.timeoutPropose(round.Int64())
 		c.proposeTimeout.scheduleTimeout(timeoutDuration, round.Int64(), height.Int64(), c.onTimeoutPropose)
-		c.logger.Debug("Scheduled Propose Timeout", "Timeout Duration", timeoutDuration)
+		c.roundLogger().Debug("Scheduled Propose Timeout", "Timeout Duration", timeoutDuration)
 	}
 }
 
@@ -308,13 +515,21 @@ func (c *core) setCore(r *big.Int, h *big.Int, lastProposer common.Address) {
 	// Start of new height where round is 0
 	if r.Int64() == 0 {
 		// Set the shared round values to initial values
+		c.valuesMu.Lock()
 		c.lockedRound = big.NewInt(-1)
 		c.lockedValue = nil
 		c.validRound = big.NewInt(-1)
 		c.validValue = nil
+		c.valuesMu.Unlock()
+		c.restoreLockState(h)
 
 		// Set validator set for height
-		valSet := c.backend.Validators(h.Uint64())
+		valSet, err := c.backend.Validators(h.Uint64())
+		if err != nil {
+			// without its validators the node can't take part in the height, it waits for the block from its peers
+			c.logger.Error("Failed to get the validators of the height", "height", h, "err", err)
+			valSet = validator.NewSet(nil, c.config.GetProposerPolicy())
+		}
 		c.valSet.set(valSet)
 
 		// Assuming that round == 0 only when the node moves to a new height
@@ -322,7 +537,15 @@ func (c *core) setCore(r *big.Int, h *big.Int, lastProposer common.Address) {
 		c.currentHeightOldRoundsStatesMu.Lock()
 		c.currentHeightOldRoundsStates = make(map[int64]*roundState)
 		c.currentHeightOldRoundsStatesMu.Unlock()
+		c.futureRoundsChangeMu.Lock()
 		c.futureRoundsChange = make(map[int64]int64)
+		c.futureRoundsChangeMu.Unlock()
+		c.pruneSequences(h)
+		c.restoreSequence(h)
+
+		// a decision pending at the new height belongs to a height committed in the meantime
+		c.commitTimeout.reset(precommitDone)
+		c.pendingDecision = nil
 	}
 	// Reset all timeouts
 	c.proposeTimeout.reset(propose)
@@ -331,18 +554,21 @@ func (c *core) setCore(r *big.Int, h *big.Int, lastProposer common.Address) {
 
 	// Get all rounds from c.futureRoundsChange and remove previous rounds
 	var i int64
+	c.futureRoundsChangeMu.Lock()
 	for i = 0; i <= r.Int64(); i++ {
 		if _, ok := c.futureRoundsChange[i]; ok {
 			delete(c.futureRoundsChange, i)
 		}
 	}
+	c.futureRoundsChangeMu.Unlock()
 	// Add a copy of c.currentRoundState to c.currentHeightOldRoundsStates and then update c.currentRoundState
 	// We only add old round prevote messages to c.currentHeightOldRoundsStates, while future messages are sent to the
 	// backlog which are processed when the step is set to propose
 	if r.Int64() > 0 {
-		// This is a shallow copy, should be fine for now
+		// The snapshot keeps the votes of the round, Update replaces the message sets of the current round state
 		c.currentHeightOldRoundsStatesMu.Lock()
-		c.currentHeightOldRoundsStates[r.Int64()-1] = c.currentRoundState
+		c.currentHeightOldRoundsStates[r.Int64()-1] = c.currentRoundState.snapshot()
+		c.pruneOldRoundStates(r.Int64())
 		c.currentHeightOldRoundsStatesMu.Unlock()
 	}
 	c.currentRoundState.Update(r, h)
@@ -355,7 +581,38 @@ func (c *core) setCore(r *big.Int, h *big.Int, lastProposer common.Address) {
 	c.setValidRoundAndValue = false
 }
 
+// isOldRoundRetained reports whether the state of the given past round is kept, only the config.OldRoundStates rounds
+// preceding the current one are. The states of the locked and valid rounds are always kept whatever their age: a
+// proposal re-proposing the valid value can only be prevoted for with the prevotes of its valid round.
+func (c *core) isOldRoundRetained(round, current int64) bool {
+	if round == c.lockedRound.Int64() || round == c.validRound.Int64() {
+		return true
+	}
+	return round >= current-c.config.GetOldRoundStates()
+}
+
+// pruneOldRoundStates drops the states of the past rounds which are no longer retained at the current round, it must
+// be called with currentHeightOldRoundsStatesMu held.
+func (c *core) pruneOldRoundStates(current int64) {
+	for r := range c.currentHeightOldRoundsStates {
+		if !c.isOldRoundRetained(r, current) {
+			delete(c.currentHeightOldRoundsStates, r)
+		}
+	}
+}
+
+// acceptVote adds a vote to the given round state. A vote conflicting with another one of the same validator for the
+// same step is reported as a double vote and not counted, only the first vote of a validator counts.
 func (c *core) acceptVote(roundState *roundState, step Step, hash common.Hash, msg Message) {
+	votes := &roundState.Prevotes
+	if step == precommit {
+		votes = &roundState.Precommits
+	}
+	if firstHash, first, ok := votes.GetVote(msg.Address); ok && firstHash != hash {
+		c.reportDoubleVote(roundState, step, first, msg)
+		return
+	}
+
 	emptyHash := hash == (common.Hash{})
 	switch step {
 	case prevote:
@@ -375,7 +632,9 @@ func (c *core) acceptVote(roundState *roundState, step Step, hash common.Hash, m
 
 func (c *core) setStep(step Step) {
 	c.currentRoundState.SetStep(step)
-	c.processBacklog()
+	if atomic.LoadUint32(&c.backlogPending) == 1 {
+		c.processBacklog()
+	}
 }
 
 func (c *core) stopFutureProposalTimer() {
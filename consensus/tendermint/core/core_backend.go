@@ -7,6 +7,7 @@ import (
 
 	"github.com/clearmatics/autonity/common"
 	"github.com/clearmatics/autonity/consensus"
+	"github.com/clearmatics/autonity/consensus/tendermint/events"
 	"github.com/clearmatics/autonity/consensus/tendermint/validator"
 	"github.com/clearmatics/autonity/core/state"
 	"github.com/clearmatics/autonity/core/types"
@@ -62,7 +63,17 @@ func (c *core) CalcDifficulty(chain consensus.ChainReader, time uint64, parent *
 }
 
 func (c *core) APIs(chain consensus.ChainReader) []rpc.API {
-	return c.backend.APIs(chain)
+	return append(c.backend.APIs(chain), rpc.API{
+		Namespace: "tendermint",
+		Version:   "1.0",
+		Service:   &API{core: c},
+		Public:    false,
+	}, rpc.API{
+		Namespace: "admin",
+		Version:   "1.0",
+		Service:   &AdminAPI{core: c},
+		Public:    false,
+	})
 }
 
 func (c *core) Close() error {
@@ -87,11 +98,26 @@ func (c *core) Protocol() (protocolName string, extraMsgCodes uint64) {
 
 // Synchronize new connected peer with current height state
 func (c *core) SyncPeer(address common.Address) {
+	c.syncPeer(context.Background(), address, nil, nil)
+}
+
+// syncPeer sends the current height state to a validator peer, leaving out the rounds older than the peer's view
+// if it is known. The sending stops once ctx is done.
+func (c *core) syncPeer(ctx context.Context, address common.Address, height, round *big.Int) {
 	if c.IsValidator(address) {
-		c.backend.SyncPeer(address, c.GetCurrentHeightMessages())
+		messages := c.currentHeightMessagesFrom(height, round)
+		tendermintSyncServedCounter.Inc(1)
+		tendermintSyncMessagesGauge.Update(int64(len(messages)))
+		c.backend.SyncPeer(ctx, address, messages)
 	}
 }
 
+// askSync asks the validators for the current height messages the node misses at the given view.
+func (c *core) askSync(height, round *big.Int) {
+	tendermintSyncAskedCounter.Inc(1)
+	c.backend.AskSync(c.valSet.Copy(), height, round)
+}
+
 func (c *core) ResetPeerCache(address common.Address) {
 	c.backend.ResetPeerCache(address)
 }
@@ -105,26 +131,34 @@ type Backend interface {
 	// Address returns the owner's address
 	Address() common.Address
 
-	// Validators returns the validator set
-	Validators(number uint64) validator.Set
+	// Validators returns the validator set of the block at the given height, an error if it can't be derived
+	Validators(number uint64) (validator.Set, error)
 
 	Subscribe(types ...interface{}) *event.TypeMuxSubscription
 
 	Post(ev interface{})
 
+	// StoreEvidence persists the evidence of a validator having signed the conflicting messages first and second for
+	// the same step of a round, so that it survives a restart
+	StoreEvidence(step string, height *big.Int, round int64, validator common.Address, first, second []byte)
+
+	// ReportNilVote hands a nil vote sent on timeout expiry over to its monitoring subscribers without waiting for them
+	ReportNilVote(ev events.NilVoteEvent)
+
 	// Broadcast sends a message to all validators (include self)
 	Broadcast(ctx context.Context, valSet validator.Set, payload []byte) error
 
 	// Gossip sends a message to all validators (exclude self)
-	Gossip(ctx context.Context, valSet validator.Set, payload []byte)
+	Gossip(ctx context.Context, valSet validator.Set, payload []byte) error
 
 	// Commit delivers an approved proposal to backend.
 	// The delivered proposal will be put into blockchain.
-	Commit(proposalBlock types.Block, seals [][]byte) error
+	Commit(proposalBlock Value, seals [][]byte) error
 
 	// VerifyProposal verifies the proposal. If a consensus.ErrFutureBlock error is returned,
-	// the time difference of the proposal and current time is also returned.
-	VerifyProposal(types.Block) (time.Duration, error)
+	// the time difference of the proposal and current time is also returned. On success the
+	// time spent verifying the proposal is returned, it is zero for any other error.
+	VerifyProposal(Value) (time.Duration, error)
 
 	// Sign signs input data with the backend's private key
 	Sign([]byte) ([]byte, error)
@@ -145,11 +179,13 @@ type Backend interface {
 	// Setter for proposed block hash
 	SetProposedBlockHash(hash common.Hash)
 
-	SyncPeer(address common.Address, messages []*Message)
+	SyncPeer(ctx context.Context, address common.Address, messages []*Message)
 
 	ResetPeerCache(address common.Address)
 
-	AskSync(set validator.Set)
+	// AskSync asks a quorum of validators to send their current height messages, the given view of the local node
+	// lets them leave out older rounds.
+	AskSync(set validator.Set, height, round *big.Int)
 
 	HandleUnhandledMsgs(ctx context.Context)
 
@@ -158,4 +194,20 @@ type Backend interface {
 	GetContractABI() string
 
 	WhiteList() []string
+
+	// SaveLockState persists the encoded lock state of the core
+	SaveLockState(data []byte) error
+
+	// LoadLockState returns the last persisted lock state of the core, nil if none was saved
+	LoadLockState() ([]byte, error)
+
+	// ForgetMessage removes the payload from the messages already received, so that a copy relayed by another peer
+	// is handled again
+	ForgetMessage(payload []byte)
+
+	// SaveSequence persists the encoded message sequence reserved by the core
+	SaveSequence(data []byte) error
+
+	// LoadSequence returns the last persisted message sequence of the core, nil if none was saved
+	LoadSequence() ([]byte, error)
 }
@@ -7,8 +7,10 @@ import (
 	"reflect"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
+	"gopkg.in/karalabe/cookiejar.v2/collections/prque"
 
 	"github.com/clearmatics/autonity/common"
 	"github.com/clearmatics/autonity/consensus/tendermint/events"
@@ -202,18 +204,25 @@ func TestCore_APIs(t *testing.T) {
 		ctrl := gomock.NewController(t)
 		defer ctrl.Finish()
 
-		var expected []rpc.API
+		backendAPI := rpc.API{Namespace: "tendermint"}
 
 		backendMock := NewMockBackend(ctrl)
-		backendMock.EXPECT().APIs(nil).Return(expected)
+		backendMock.EXPECT().APIs(nil).Return([]rpc.API{backendAPI})
 
 		c := &core{
 			backend: backendMock,
 		}
 
 		APIS := c.APIs(nil)
-		if !reflect.DeepEqual(APIS, expected) {
-			t.Fatalf("Expected %v, got %v", expected, APIS)
+		if len(APIS) != 3 || !reflect.DeepEqual(APIS[0], backendAPI) {
+			t.Fatalf("Expected %v followed by the core APIs, got %v", backendAPI, APIS)
+		}
+		if api, ok := APIS[1].Service.(*API); !ok || api.core != c || APIS[1].Public {
+			t.Fatalf("Expected private core API, got %v", APIS[1])
+		}
+		// the operator methods are kept out of the tendermint namespace
+		if api, ok := APIS[2].Service.(*AdminAPI); !ok || api.core != c || APIS[2].Public || APIS[2].Namespace != "admin" {
+			t.Fatalf("Expected private admin API, got %v", APIS[2])
 		}
 	})
 }
@@ -381,7 +390,7 @@ func TestCore_SyncPeer(t *testing.T) {
 		}
 
 		backendMock := NewMockBackend(ctrl)
-		backendMock.EXPECT().SyncPeer(addr, gomock.Any())
+		backendMock.EXPECT().SyncPeer(gomock.Any(), addr, gomock.Any())
 
 		c := &core{
 			backend:           backendMock,
@@ -389,10 +398,148 @@ func TestCore_SyncPeer(t *testing.T) {
 			valSet:            valSet,
 		}
 
+		served := tendermintSyncServedCounter.Count()
 		c.SyncPeer(addr)
+		if have := tendermintSyncServedCounter.Count(); have != served+1 {
+			t.Fatalf("served syncs: have %d, want %d", have, served+1)
+		}
+	})
+
+	t.Run("not a validator, nothing served", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		addr := common.HexToAddress("0x0123456789")
+		valSetMock := validator.NewMockSet(ctrl)
+		valSetMock.EXPECT().GetByAddress(addr).Return(-1, nil)
+
+		c := &core{
+			backend:           NewMockBackend(ctrl),
+			currentRoundState: NewRoundState(big.NewInt(2), big.NewInt(1)),
+			valSet:            &validatorSet{Set: valSetMock},
+		}
+
+		served := tendermintSyncServedCounter.Count()
+		c.SyncPeer(addr)
+		if have := tendermintSyncServedCounter.Count(); have != served {
+			t.Fatalf("served syncs: have %d, want %d", have, served)
+		}
 	})
 }
 
+func TestCore_AskSyncCounted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	valSetMock := validator.NewMockSet(ctrl)
+	valSetMock.EXPECT().Copy().Return(valSetMock)
+	backendMock := NewMockBackend(ctrl)
+	backendMock.EXPECT().AskSync(valSetMock, big.NewInt(4), big.NewInt(1))
+
+	c := &core{
+		backend: backendMock,
+		valSet:  &validatorSet{Set: valSetMock},
+	}
+
+	asked := tendermintSyncAskedCounter.Count()
+	c.askSync(big.NewInt(4), big.NewInt(1))
+	if have := tendermintSyncAskedCounter.Count(); have != asked+1 {
+		t.Fatalf("asked syncs: have %d, want %d", have, asked+1)
+	}
+}
+
+func TestCore_SyncLoopSyncEventView(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	addr := common.HexToAddress("0x0123456789")
+	height := big.NewInt(3)
+	oldRound := NewRoundState(big.NewInt(0), height)
+	oldRound.SetProposal(&Proposal{}, &Message{Code: msgProposal, Address: common.HexToAddress("0x01")})
+	curRoundState := NewRoundState(big.NewInt(1), height)
+	currentMsg := &Message{Code: msgProposal, Address: common.HexToAddress("0x02")}
+	curRoundState.SetProposal(&Proposal{}, currentMsg)
+
+	valSetMock := validator.NewMockSet(ctrl)
+	valSetMock.EXPECT().Copy().Return(valSetMock).AnyTimes()
+	valSetMock.EXPECT().GetByAddress(addr).Return(1, validator.NewMockValidator(ctrl))
+
+	synced := make(chan struct{})
+	backendMock := NewMockBackend(ctrl)
+	backendMock.EXPECT().AskSync(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	// the requester is at the current round, the older round is left out
+	backendMock.EXPECT().SyncPeer(gomock.Any(), addr, []*Message{currentMsg}).Do(func(_, _, _ interface{}) {
+		close(synced)
+	})
+
+	evmux := new(event.TypeMux)
+	c := &core{
+		backend:                      backendMock,
+		logger:                       log.New("backend", "test", "id", 0),
+		currentRoundState:            curRoundState,
+		currentHeightOldRoundsStates: map[int64]*roundState{0: oldRound},
+		valSet:                       &validatorSet{Set: valSetMock},
+		syncEventSub:                 evmux.Subscribe(events.SyncEvent{}),
+		now:                          time.Now,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.syncLoop(ctx)
+
+	if err := evmux.Post(events.SyncEvent{Addr: addr, Height: big.NewInt(3), Round: big.NewInt(1)}); err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	select {
+	case <-synced:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("SyncPeer not called")
+	}
+}
+
+func TestCore_RequestSync(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	evmux := new(event.TypeMux)
+	valSetMock := validator.NewMockSet(ctrl)
+	valSetMock.EXPECT().Copy().Return(valSetMock).AnyTimes()
+
+	asked := make(chan struct{}, 2)
+	backendMock := NewMockBackend(ctrl)
+	backendMock.EXPECT().Post(syncRequestEvent{}).Do(func(ev interface{}) {
+		if err := evmux.Post(ev); err != nil {
+			t.Errorf("Expected <nil>, got %v", err)
+		}
+	})
+	// once as the loop starts, then on request
+	backendMock.EXPECT().AskSync(valSetMock, big.NewInt(3), big.NewInt(1)).Do(func(_, _, _ interface{}) {
+		asked <- struct{}{}
+	}).Times(2)
+
+	c := &core{
+		backend:           backendMock,
+		logger:            log.New("backend", "test", "id", 0),
+		currentRoundState: NewRoundState(big.NewInt(1), big.NewInt(3)),
+		valSet:            &validatorSet{Set: valSetMock},
+		syncEventSub:      evmux.Subscribe(events.SyncEvent{}, syncRequestEvent{}),
+		now:               time.Now,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.syncLoop(ctx)
+	<-asked
+
+	api := &API{core: c}
+	api.RequestSync()
+	select {
+	case <-asked:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("AskSync not called")
+	}
+}
+
 func TestCore_Close(t *testing.T) {
 	t.Run("backend method called", func(t *testing.T) {
 		ctrl := gomock.NewController(t)
@@ -431,6 +578,7 @@ func TestCore_Close(t *testing.T) {
 			proposeTimeout:          newTimeout(propose, logger),
 			prevoteTimeout:          newTimeout(prevote, logger),
 			precommitTimeout:        newTimeout(precommit, logger),
+			commitTimeout:           newTimeout(precommitDone, logger),
 			timeoutEventSub:         timeoutEventSub,
 			syncEventSub:            syncEventSub,
 			stopped:                 stopped,
@@ -480,6 +628,7 @@ func TestCore_Close(t *testing.T) {
 			proposeTimeout:          newTimeout(propose, logger),
 			prevoteTimeout:          newTimeout(prevote, logger),
 			precommitTimeout:        newTimeout(precommit, logger),
+			commitTimeout:           newTimeout(precommitDone, logger),
 			timeoutEventSub:         timeoutEventSub,
 			syncEventSub:            syncEventSub,
 			stopped:                 stopped,
@@ -491,6 +640,88 @@ func TestCore_Close(t *testing.T) {
 		}
 	})
 
+	t.Run("in-flight commit completes before the backend is closed", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		committing := make(chan struct{})
+		release := make(chan struct{})
+		var committed uint32
+
+		backendMock := NewMockBackend(ctrl)
+		backendMock.EXPECT().Commit(gomock.Any(), gomock.Any()).DoAndReturn(func(block *types.Block, seals [][]byte) error {
+			close(committing)
+			<-release
+			atomic.StoreUint32(&committed, 1)
+			return nil
+		})
+		backendMock.EXPECT().Close().Do(func() {
+			if atomic.LoadUint32(&committed) == 0 {
+				t.Errorf("backend closed before the commit completed")
+			}
+		})
+
+		_, cancel := context.WithCancel(context.Background())
+
+		evmux := new(event.TypeMux)
+
+		stopped := make(chan struct{}, 2)
+		stopped <- struct{}{}
+		stopped <- struct{}{}
+
+		logger := log.New("backend", "test", "id", 0)
+		roundState := NewRoundState(big.NewInt(0), big.NewInt(1))
+		block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1)})
+		roundState.SetProposal(NewProposal(big.NewInt(0), big.NewInt(1), big.NewInt(-1), block, logger), nil)
+
+		c := &core{
+			backend:                 backendMock,
+			cancel:                  cancel,
+			isStarting:              new(uint32),
+			isStarted:               new(uint32),
+			isStopping:              new(uint32),
+			isStopped:               new(uint32),
+			committedSub:            evmux.Subscribe(events.CommitEvent{}),
+			logger:                  logger,
+			messageEventSub:         evmux.Subscribe(events.MessageEvent{}, backlogEvent{}),
+			newUnminedBlockEventSub: evmux.Subscribe(events.NewUnminedBlockEvent{}),
+			proposeTimeout:          newTimeout(propose, logger),
+			prevoteTimeout:          newTimeout(prevote, logger),
+			precommitTimeout:        newTimeout(precommit, logger),
+			commitTimeout:           newTimeout(precommitDone, logger),
+			timeoutEventSub:         evmux.Subscribe(TimeoutEvent{}),
+			syncEventSub:            evmux.Subscribe(events.SyncEvent{}),
+			stopped:                 stopped,
+			currentRoundState:       roundState,
+			backlogs:                make(map[validator.Validator]*prque.Prque),
+			valSet:                  new(validatorSet),
+		}
+
+		go c.commit()
+		<-committing
+
+		stopErr := make(chan error)
+		go func() {
+			stopErr <- c.Stop()
+		}()
+
+		select {
+		case <-stopErr:
+			t.Fatalf("Stop returned before the commit completed")
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		close(release)
+		select {
+		case err := <-stopErr:
+			if err != nil {
+				t.Fatalf("Expected <nil>, got %v", err)
+			}
+		case <-time.After(commitDrainTimeout):
+			t.Fatalf("Stop did not return")
+		}
+	})
+
 	t.Run("the system is already stopped, nothing done", func(t *testing.T) {
 		isStopped := new(uint32)
 		atomic.StoreUint32(isStopped, 1)
@@ -1,11 +1,25 @@
 package core
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"gopkg.in/karalabe/cookiejar.v2/collections/prque"
+
 	"github.com/clearmatics/autonity/common"
+	"github.com/clearmatics/autonity/consensus/tendermint/config"
+	"github.com/clearmatics/autonity/consensus/tendermint/validator"
+	"github.com/clearmatics/autonity/core/types"
+	"github.com/clearmatics/autonity/crypto"
 	"github.com/clearmatics/autonity/log"
 	"github.com/clearmatics/autonity/metrics"
-	"math/big"
-	"testing"
+	"github.com/clearmatics/autonity/rlp"
 )
 
 func TestCore_MeasureHeightRoundMetrics(t *testing.T) {
@@ -16,6 +30,7 @@ func TestCore_MeasureHeightRoundMetrics(t *testing.T) {
 			proposeTimeout:   newTimeout(propose, log.New("core", "test", "id", 0)),
 			prevoteTimeout:   newTimeout(prevote, log.New("core", "test", "id", 0)),
 			precommitTimeout: newTimeout(precommit, log.New("core", "test", "id", 0)),
+			commitTimeout:    newTimeout(precommitDone, log.New("core", "test", "id", 0)),
 
 			currentRoundState: NewRoundState(big.NewInt(0), big.NewInt(1)),
 		}
@@ -32,6 +47,7 @@ func TestCore_MeasureHeightRoundMetrics(t *testing.T) {
 			proposeTimeout:    newTimeout(propose, log.New("core", "test", "id", 0)),
 			prevoteTimeout:    newTimeout(prevote, log.New("core", "test", "id", 0)),
 			precommitTimeout:  newTimeout(precommit, log.New("core", "test", "id", 0)),
+			commitTimeout:     newTimeout(precommitDone, log.New("core", "test", "id", 0)),
 			currentRoundState: NewRoundState(big.NewInt(0), big.NewInt(1)),
 		}
 		c.measureHeightRoundMetrics(common.Big1)
@@ -49,9 +65,10 @@ func TestCore_measureMetricsOnTimeOut(t *testing.T) {
 			proposeTimeout:    newTimeout(propose, log.New("core", "test", "id", 0)),
 			prevoteTimeout:    newTimeout(prevote, log.New("core", "test", "id", 0)),
 			precommitTimeout:  newTimeout(precommit, log.New("core", "test", "id", 0)),
+			commitTimeout:     newTimeout(precommitDone, log.New("core", "test", "id", 0)),
 			currentRoundState: NewRoundState(big.NewInt(0), big.NewInt(1)),
 		}
-		c.measureMetricsOnTimeOut(msgProposal, 2)
+		c.measureMetricsOnTimeOut(msgProposal)
 		if m := metrics.Get("tendermint/timer/propose"); m == nil {
 			t.Fatalf("test case failed.")
 		}
@@ -64,9 +81,10 @@ func TestCore_measureMetricsOnTimeOut(t *testing.T) {
 			proposeTimeout:    newTimeout(propose, log.New("core", "test", "id", 0)),
 			prevoteTimeout:    newTimeout(prevote, log.New("core", "test", "id", 0)),
 			precommitTimeout:  newTimeout(precommit, log.New("core", "test", "id", 0)),
+			commitTimeout:     newTimeout(precommitDone, log.New("core", "test", "id", 0)),
 			currentRoundState: NewRoundState(big.NewInt(0), big.NewInt(1)),
 		}
-		c.measureMetricsOnTimeOut(msgPrevote, 2)
+		c.measureMetricsOnTimeOut(msgPrevote)
 		if m := metrics.Get("tendermint/timer/prevote"); m == nil {
 			t.Fatalf("test case failed.")
 		}
@@ -79,11 +97,450 @@ func TestCore_measureMetricsOnTimeOut(t *testing.T) {
 			proposeTimeout:    newTimeout(propose, log.New("core", "test", "id", 0)),
 			prevoteTimeout:    newTimeout(prevote, log.New("core", "test", "id", 0)),
 			precommitTimeout:  newTimeout(precommit, log.New("core", "test", "id", 0)),
+			commitTimeout:     newTimeout(precommitDone, log.New("core", "test", "id", 0)),
 			currentRoundState: NewRoundState(big.NewInt(0), big.NewInt(1)),
 		}
-		c.measureMetricsOnTimeOut(msgPrecommit, 2)
+		c.measureMetricsOnTimeOut(msgPrecommit)
 		if m := metrics.Get("tendermint/timer/precommit"); m == nil {
 			t.Fatalf("test case failed.")
 		}
 	})
 }
+
+func TestCore_CommittedSeals(t *testing.T) {
+	valSet, keys := newTestValidatorSetWithKeys(2)
+	proposalHash := common.HexToHash("0x0123456789")
+	sealData := crypto.Keccak256(PrepareCommittedSeal(proposalHash))
+
+	sign := func(key *ecdsa.PrivateKey) []byte {
+		seal, err := crypto.Sign(sealData, key)
+		if err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		return seal
+	}
+
+	validators := valSet.List()
+	sealA := sign(keys[validators[0].Address()])
+	sealB := sign(keys[validators[1].Address()])
+	outsider, _ := crypto.GenerateKey()
+
+	roundState := NewRoundState(big.NewInt(0), big.NewInt(1))
+	roundState.Precommits.AddVote(proposalHash, Message{Address: validators[0].Address(), CommittedSeal: sealA})
+	roundState.Precommits.AddVote(proposalHash, Message{Address: validators[1].Address(), CommittedSeal: sealB})
+	// a faulty store returning the seal of validator A for another sender
+	roundState.Precommits.AddVote(proposalHash, Message{Address: common.HexToAddress("0x01"), CommittedSeal: sealA})
+	// a seal which wasn't signed by a validator
+	roundState.Precommits.AddVote(proposalHash, Message{Address: common.HexToAddress("0x02"), CommittedSeal: sign(outsider)})
+
+	c := &core{
+		logger:            log.New("core", "test", "id", 0),
+		currentRoundState: roundState,
+		valSet:            &validatorSet{Set: valSet},
+	}
+
+	seals := c.committedSeals(&roundState.Precommits, proposalHash)
+	if len(seals) != 2 {
+		t.Fatalf("Expected 2 committed seals, got %d", len(seals))
+	}
+	signers := make(map[common.Address]bool)
+	for _, seal := range seals {
+		signer, err := types.GetSignatureAddress(PrepareCommittedSeal(proposalHash), seal)
+		if err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		signers[signer] = true
+	}
+	if !signers[validators[0].Address()] || !signers[validators[1].Address()] {
+		t.Fatalf("Expected seals of both validators, got %v", signers)
+	}
+}
+
+func TestCore_RoundLoggerContext(t *testing.T) {
+	valSet, _ := newTestValidatorSetWithKeys(2)
+	proposalHash := common.HexToHash("0x0123456789")
+	outsider, _ := crypto.GenerateKey()
+	seal, err := crypto.Sign(crypto.Keccak256(PrepareCommittedSeal(proposalHash)), outsider)
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+
+	roundState := NewRoundState(big.NewInt(2), big.NewInt(5))
+	roundState.SetStep(precommitDone)
+	roundState.Precommits.AddVote(proposalHash, Message{Address: common.HexToAddress("0x01"), CommittedSeal: seal})
+
+	var records []*log.Record
+	logger := log.New("core", "test")
+	logger.SetHandler(log.FuncHandler(func(r *log.Record) error {
+		records = append(records, r)
+		return nil
+	}))
+
+	c := &core{
+		logger:            logger,
+		currentRoundState: roundState,
+		valSet:            &validatorSet{Set: valSet},
+	}
+	c.committedSeals(&roundState.Precommits, proposalHash)
+
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 log line, got %d", len(records))
+	}
+	fields := make(map[string]string)
+	for i := 0; i+1 < len(records[0].Ctx); i += 2 {
+		fields[records[0].Ctx[i].(string)] = fmt.Sprint(records[0].Ctx[i+1])
+	}
+	want := map[string]string{"height": "5", "round": "2", "step": precommitDone.String()}
+	for k, v := range want {
+		if fields[k] != v {
+			t.Errorf("Expected %s=%s in %q, got %q", k, v, records[0].Msg, fields[k])
+		}
+	}
+}
+
+func TestCore_CommitFakeValue(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	logger := log.New("core", "test", "id", 0)
+	value := &fakeValue{number: 1, hash: common.HexToHash("0xabcd")}
+	roundState := NewRoundState(big.NewInt(0), big.NewInt(1))
+	roundState.SetProposal(NewProposal(big.NewInt(0), big.NewInt(1), big.NewInt(-1), value, logger), nil)
+
+	backendMock := NewMockBackend(ctrl)
+	backendMock.EXPECT().Commit(value, [][]byte{})
+
+	c := &core{
+		logger:            logger,
+		backend:           backendMock,
+		backlogs:          make(map[validator.Validator]*prque.Prque),
+		currentRoundState: roundState,
+		valSet:            new(validatorSet),
+	}
+	c.commit()
+
+	if c.currentRoundState.Step() != precommitDone {
+		t.Fatalf("Expected %v, got %v", precommitDone, c.currentRoundState.Step())
+	}
+}
+
+func TestTendermintCommitBlock(t *testing.T) {
+	sys := newTestSystemWithBackend(4)
+	closer := sys.Run()
+	defer closer()
+
+	block := sys.newUnminedBlock(1)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for _, b := range sys.backends {
+		for len(b.committed()) == 0 {
+			if time.Now().After(deadline) {
+				t.Fatalf("backend %d did not commit", b.id)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		committed := b.committed()[0]
+		if committed.commitProposal.Hash() != block.Hash() {
+			t.Errorf("backend %d committed %v, want %v", b.id, committed.commitProposal.Hash(), block.Hash())
+		}
+		if quorum := b.peers.Quorum(); len(committed.committedSeals) < quorum {
+			t.Errorf("backend %d committed %d seals, want at least %d", b.id, len(committed.committedSeals), quorum)
+		}
+	}
+}
+
+func TestCore_CurrentHeightMessagesFrom(t *testing.T) {
+	height := big.NewInt(4)
+	states := make(map[int64]*roundState)
+	for r := int64(0); r < 2; r++ {
+		states[r] = NewRoundState(big.NewInt(r), height)
+		states[r].SetProposal(&Proposal{}, &Message{Code: msgProposal, Address: common.BigToAddress(big.NewInt(r))})
+	}
+	current := NewRoundState(big.NewInt(2), height)
+	current.SetProposal(&Proposal{}, &Message{Code: msgProposal, Address: common.BigToAddress(big.NewInt(2))})
+	c := &core{
+		currentRoundState:            current,
+		currentHeightOldRoundsStates: states,
+	}
+
+	tests := []struct {
+		name          string
+		height, round *big.Int
+		want          []int64
+	}{
+		{"no view", nil, nil, []int64{0, 1, 2}},
+		{"lower height", big.NewInt(3), big.NewInt(5), []int64{0, 1, 2}},
+		{"higher height", big.NewInt(5), big.NewInt(0), nil},
+		{"same height, old round", height, big.NewInt(1), []int64{1, 2}},
+		{"same height, current round", height, big.NewInt(2), []int64{2}},
+		{"same height, future round", height, big.NewInt(3), nil},
+	}
+	for _, test := range tests {
+		msgs := c.currentHeightMessagesFrom(test.height, test.round)
+		have := make(map[common.Address]bool)
+		for _, msg := range msgs {
+			have[msg.Address] = true
+		}
+		if len(msgs) != len(test.want) || len(have) != len(test.want) {
+			t.Fatalf("%s: have %d messages, want %d", test.name, len(msgs), len(test.want))
+		}
+		for _, r := range test.want {
+			if !have[common.BigToAddress(big.NewInt(r))] {
+				t.Errorf("%s: message of round %d missing", test.name, r)
+			}
+		}
+	}
+}
+
+func TestCore_SetCoreValidatorsUnavailable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	height := big.NewInt(7)
+	backendMock := NewMockBackend(ctrl)
+	backendMock.EXPECT().Validators(height.Uint64()).Return(nil, errors.New("missing state"))
+
+	logger := log.New("core", "test", "id", 0)
+	c := &core{
+		config:                       &config.Config{},
+		backend:                      backendMock,
+		logger:                       logger,
+		currentRoundState:            NewRoundState(big.NewInt(0), height),
+		currentHeightOldRoundsStates: make(map[int64]*roundState),
+		futureRoundsChange:           make(map[int64]int64),
+		valSet:                       new(validatorSet),
+		proposeTimeout:               newTimeout(propose, logger),
+		prevoteTimeout:               newTimeout(prevote, logger),
+		precommitTimeout:             newTimeout(precommit, logger),
+		commitTimeout:                newTimeout(precommitDone, logger),
+	}
+	c.setCore(big.NewInt(0), height, common.Address{})
+
+	// the node doesn't take part in the height rather than electing a proposer of its own
+	if size := c.valSet.Size(); size != 0 {
+		t.Fatalf("have %d validators, want 0", size)
+	}
+}
+
+func TestCore_OldRoundStatesCapped(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	height := big.NewInt(7)
+	validators, _ := newTestValidatorSetWithKeys(4)
+	backendMock := NewMockBackend(ctrl)
+	backendMock.EXPECT().Validators(height.Uint64()).Return(validators, nil)
+
+	logger := log.New("core", "test", "id", 0)
+	c := &core{
+		config:                       &config.Config{OldRoundStates: 5},
+		backend:                      backendMock,
+		logger:                       logger,
+		currentRoundState:            NewRoundState(big.NewInt(0), height),
+		currentHeightOldRoundsStates: make(map[int64]*roundState),
+		lockedRound:                  big.NewInt(-1),
+		validRound:                   big.NewInt(-1),
+		futureRoundsChange:           make(map[int64]int64),
+		valSet:                       new(validatorSet),
+		proposeTimeout:               newTimeout(propose, logger),
+		prevoteTimeout:               newTimeout(prevote, logger),
+		precommitTimeout:             newTimeout(precommit, logger),
+		commitTimeout:                newTimeout(precommitDone, logger),
+	}
+	c.setCore(big.NewInt(0), height, common.Address{})
+
+	const rounds = 40
+	for r := int64(1); r <= rounds; r++ {
+		c.currentRoundState.SetProposal(&Proposal{}, &Message{Code: msgProposal, Address: common.BigToAddress(big.NewInt(r))})
+		c.setCore(big.NewInt(r), height, common.Address{})
+	}
+
+	if have := len(c.currentHeightOldRoundsStates); have != 5 {
+		t.Fatalf("have %d old round states, want %d", have, 5)
+	}
+	for r := int64(rounds - 5); r < rounds; r++ {
+		if _, ok := c.currentHeightOldRoundsStates[r]; !ok {
+			t.Errorf("state of round %d missing", r)
+		}
+	}
+	if !c.isOldRoundRetained(rounds-5, rounds) || c.isOldRoundRetained(rounds-6, rounds) {
+		t.Fatalf("unexpected retained rounds at round %d", rounds)
+	}
+
+	var want int
+	for _, state := range c.currentHeightOldRoundsStates {
+		want += len(state.GetMessages())
+	}
+	want += len(c.currentRoundState.GetMessages())
+	if have := len(c.GetCurrentHeightMessages()); have != want {
+		t.Fatalf("have %d current height messages, want %d", have, want)
+	}
+}
+
+func TestCore_OldRoundStatesKeepValidRound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	height := big.NewInt(1)
+	validators := newTestValidatorSet(4)
+	block := types.NewBlockWithHeader(&types.Header{Number: height})
+
+	var sent *common.Hash
+	backendMock := NewMockBackend(ctrl)
+	backendMock.EXPECT().Validators(height.Uint64()).Return(validators, nil)
+	backendMock.EXPECT().VerifyProposal(gomock.Any()).Return(time.Duration(0), nil)
+	backendMock.EXPECT().Sign(gomock.Any()).AnyTimes()
+	backendMock.EXPECT().Broadcast(gomock.Any(), gomock.Any(), gomock.Any()).Do(func(_ context.Context, _ validator.Set, payload []byte) {
+		prevoteMsg := new(Message)
+		if err := rlp.DecodeBytes(payload, prevoteMsg); err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		var prevote Vote
+		if err := prevoteMsg.Decode(&prevote); err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		sent = &prevote.ProposedBlockHash
+	})
+
+	logger := log.New("core", "test", "id", 0)
+	c := &core{
+		address:                      validators.GetByIndex(1).Address(),
+		config:                       &config.Config{OldRoundStates: 2},
+		backend:                      backendMock,
+		logger:                       logger,
+		currentRoundState:            NewRoundState(big.NewInt(0), height),
+		currentHeightOldRoundsStates: make(map[int64]*roundState),
+		futureRoundsChange:           make(map[int64]int64),
+		lockedRound:                  big.NewInt(-1),
+		validRound:                   big.NewInt(-1),
+		valSet:                       new(validatorSet),
+		proposeTimeout:               newTimeout(propose, logger),
+		prevoteTimeout:               newTimeout(prevote, logger),
+		precommitTimeout:             newTimeout(precommit, logger),
+		commitTimeout:                newTimeout(precommitDone, logger),
+	}
+	c.setCore(big.NewInt(0), height, common.Address{})
+	c.setCore(big.NewInt(1), height, common.Address{})
+
+	// the node locks on the block at round 1 with a quorum of prevotes
+	for _, val := range validators.List()[:3] {
+		c.currentRoundState.Prevotes.AddVote(block.Hash(), Message{Address: val.Address()})
+	}
+	c.lockedRound, c.lockedValue = big.NewInt(1), block
+	c.validRound, c.validValue = big.NewInt(1), block
+
+	// the height stalls for many more rounds than the old round states kept
+	const rounds = 10
+	for r := int64(2); r <= rounds; r++ {
+		c.setCore(big.NewInt(r), height, common.Address{})
+	}
+	if have := len(c.currentHeightOldRoundsStates); have != 3 {
+		t.Fatalf("have %d old round states, want %d", have, 3)
+	}
+	if _, ok := c.currentHeightOldRoundsStates[1]; !ok {
+		t.Fatalf("state of the valid round missing")
+	}
+
+	// the valid value re-proposed with its valid round is still prevoted for
+	proposal, err := Encode(NewProposal(big.NewInt(rounds), height, big.NewInt(1), block, logger))
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	msg := &Message{Code: msgProposal, Msg: proposal, Address: c.valSet.GetProposer().Address(), CommittedSeal: []byte{}, Signature: []byte{0x1}}
+	if err := c.handleProposal(context.Background(), msg); err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	if sent == nil || *sent != block.Hash() {
+		t.Fatalf("have prevote %v, want %v", sent, block.Hash().Hex())
+	}
+}
+
+func TestCore_GetCurrentHeightMessagesOrdered(t *testing.T) {
+	height := big.NewInt(2)
+	msg := func(round, i int64) *Message {
+		return &Message{Code: msgPrevote, Address: common.BigToAddress(big.NewInt(round*10 + i))}
+	}
+	vote := func(state *roundState, m *Message) {
+		state.Prevotes.AddVote(common.BytesToHash(m.Address.Bytes()), *m)
+	}
+
+	var want []*Message
+	states := make(map[int64]*roundState)
+	for r := int64(0); r < 6; r++ {
+		states[r] = NewRoundState(big.NewInt(r), height)
+		proposal := &Message{Code: msgProposal, Address: common.BigToAddress(big.NewInt(r*10 + 9))}
+		states[r].SetProposal(&Proposal{}, proposal)
+		want = append(want, proposal)
+		for i := int64(0); i < 3; i++ {
+			m := msg(r, i)
+			vote(states[r], m)
+			want = append(want, m)
+		}
+	}
+	current := NewRoundState(big.NewInt(6), height)
+	last := msg(6, 0)
+	vote(current, last)
+	want = append(want, last)
+
+	c := &core{
+		currentRoundState:            current,
+		currentHeightOldRoundsStates: states,
+	}
+	for i := 0; i < 10; i++ {
+		have := c.GetCurrentHeightMessages()
+		if len(have) != len(want) {
+			t.Fatalf("have %d messages, want %d", len(have), len(want))
+		}
+		for j := range want {
+			if have[j].Address != want[j].Address {
+				t.Fatalf("message %d: have %v, want %v", j, have[j].Address, want[j].Address)
+			}
+		}
+	}
+}
+
+func TestCore_CurrentRoundTally(t *testing.T) {
+	roundState := NewRoundState(big.NewInt(2), big.NewInt(5))
+	c := &core{currentRoundState: roundState}
+	api := &API{core: c}
+
+	blockA, blockB := common.HexToHash("0xa"), common.HexToHash("0xb")
+	vote := func(i int64) Message {
+		return Message{Address: common.BigToAddress(big.NewInt(i))}
+	}
+
+	// the accessor must be safe to call while votes are added
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			api.GetRoundTally()
+		}
+	}()
+	roundState.Prevotes.AddVote(blockA, vote(1))
+	roundState.Prevotes.AddVote(blockA, vote(2))
+	roundState.Prevotes.AddVote(blockB, vote(3))
+	roundState.Prevotes.AddNilVote(vote(4))
+	roundState.Precommits.AddVote(blockA, vote(1))
+	roundState.Precommits.AddNilVote(vote(3))
+	roundState.Precommits.AddNilVote(vote(4))
+	<-done
+
+	tally := api.GetRoundTally()
+	if tally.Height.Int64() != 5 || tally.Round.Int64() != 2 {
+		t.Fatalf("have height %v round %v, want 5 2", tally.Height, tally.Round)
+	}
+	if len(tally.Votes) != 2 {
+		t.Fatalf("have %d block hashes, want 2", len(tally.Votes))
+	}
+	if a := tally.Votes[blockA]; a.Prevotes != 2 || a.Precommits != 1 {
+		t.Fatalf("have %+v for block A, want 2 prevotes and 1 precommit", a)
+	}
+	if b := tally.Votes[blockB]; b.Prevotes != 1 || b.Precommits != 0 {
+		t.Fatalf("have %+v for block B, want 1 prevote and 0 precommit", b)
+	}
+	if tally.NilPrevotes != 1 || tally.NilPrecommits != 2 {
+		t.Fatalf("have %d nil prevotes and %d nil precommits, want 1 and 2", tally.NilPrevotes, tally.NilPrecommits)
+	}
+}
@@ -0,0 +1,180 @@
+package core
+
+import (
+	"errors"
+	"math/big"
+	"sync"
+
+	"github.com/clearmatics/autonity/common"
+	"github.com/clearmatics/autonity/consensus/tendermint/crypto"
+	"github.com/clearmatics/autonity/consensus/tendermint/events"
+	"github.com/clearmatics/autonity/consensus/tendermint/validator"
+)
+
+// ErrNoConflict is returned by CheckFault when the messages don't prove a fault.
+var ErrNoConflict = errors.New("messages don't conflict")
+
+const maxEquivocations = 100 // Number of the most recent equivocations and double votes whose evidence is kept
+
+// equivocationDetector remembers the first proposal received for each round of the current height, so that a
+// proposer signing another block for the same round is caught. The evidence of the double votes found when the
+// votes are accepted is kept alongside.
+type equivocationDetector struct {
+	mu          sync.Mutex
+	height      *big.Int
+	proposals   map[int64]*Message
+	evidence    []events.EquivocationEvent
+	doubleVotes []events.DoubleVoteEvent
+}
+
+// checkEquivocation records the proposal of a validly signed message from the round proposer. If another block was
+// proposed for the same round, the evidence is kept, persisted by the backend and an EquivocationEvent posted.
+func (c *core) checkEquivocation(msg *Message, proposal *Proposal) {
+	d := &c.equivocations
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.height == nil || d.height.Cmp(proposal.Height) != 0 {
+		d.height = new(big.Int).Set(proposal.Height)
+		d.proposals = make(map[int64]*Message)
+	}
+
+	round := proposal.Round.Int64()
+	first, ok := d.proposals[round]
+	if !ok {
+		d.proposals[round] = msg
+		return
+	}
+	var firstProposal Proposal
+	if err := first.Decode(&firstProposal); err != nil || firstProposal.ProposalBlock.Hash() == proposal.ProposalBlock.Hash() {
+		return
+	}
+
+	firstPayload, err := first.Payload()
+	if err != nil {
+		return
+	}
+	secondPayload, err := msg.Payload()
+	if err != nil {
+		return
+	}
+	ev := events.EquivocationEvent{
+		Height:   new(big.Int).Set(proposal.Height),
+		Round:    round,
+		Proposer: msg.Address,
+		First:    firstPayload,
+		Second:   secondPayload,
+	}
+	if len(d.evidence) == maxEquivocations {
+		d.evidence = d.evidence[1:]
+	}
+	d.evidence = append(d.evidence, ev)
+	tendermintEquivocationCounter.Inc(1)
+
+	c.roundLogger().Warn("Proposer equivocation", "proposer", msg.Address, "round", round,
+		"first", firstProposal.ProposalBlock.Hash(), "second", proposal.ProposalBlock.Hash())
+	c.backend.StoreEvidence(propose.String(), ev.Height, ev.Round, ev.Proposer, ev.First, ev.Second)
+	c.sendEvent(ev)
+}
+
+// Equivocations returns the evidence of the most recent proposer equivocations, oldest first.
+func (c *core) Equivocations() []events.EquivocationEvent {
+	c.equivocations.mu.Lock()
+	defer c.equivocations.mu.Unlock()
+	return append([]events.EquivocationEvent(nil), c.equivocations.evidence...)
+}
+
+// reportDoubleVote keeps the evidence of a validator having sent two different votes for the same step of a round,
+// has the backend persist it and posts a DoubleVoteEvent.
+func (c *core) reportDoubleVote(roundState *roundState, step Step, first, second Message) {
+	firstPayload, err := first.Payload()
+	if err != nil {
+		return
+	}
+	secondPayload, err := second.Payload()
+	if err != nil {
+		return
+	}
+	ev := events.DoubleVoteEvent{
+		Height:    new(big.Int).Set(roundState.Height()),
+		Round:     roundState.Round().Int64(),
+		Step:      step.String(),
+		Validator: second.Address,
+		First:     firstPayload,
+		Second:    secondPayload,
+	}
+
+	d := &c.equivocations
+	d.mu.Lock()
+	if len(d.doubleVotes) == maxEquivocations {
+		d.doubleVotes = d.doubleVotes[1:]
+	}
+	d.doubleVotes = append(d.doubleVotes, ev)
+	d.mu.Unlock()
+	tendermintDoubleVoteCounter.Inc(1)
+
+	c.roundLogger().Warn("Double vote", "validator", second.Address, "step", ev.Step, "round", ev.Round)
+	c.backend.StoreEvidence(ev.Step, ev.Height, ev.Round, ev.Validator, ev.First, ev.Second)
+	c.sendEvent(ev)
+}
+
+// DoubleVotes returns the evidence of the most recent double votes, oldest first.
+func (c *core) DoubleVotes() []events.DoubleVoteEvent {
+	c.equivocations.mu.Lock()
+	defer c.equivocations.mu.Unlock()
+	return append([]events.DoubleVoteEvent(nil), c.equivocations.doubleVotes...)
+}
+
+// Fault describes the fault proven by two conflicting messages.
+type Fault struct {
+	Height    *big.Int
+	Round     int64
+	Step      string
+	Validator common.Address
+}
+
+// CheckFault decodes two signed messages and checks that they prove a fault of a validator of valSet: two proposals
+// or two votes of the same step for the same height and round and for different values.
+func CheckFault(first, second []byte, valSet validator.Set) (*Fault, error) {
+	var msgs [2]Message
+	for i, payload := range [][]byte{first, second} {
+		if _, err := msgs[i].FromPayload(payload, valSet, crypto.CheckValidatorSignature); err != nil {
+			return nil, err
+		}
+	}
+	if msgs[0].Address != msgs[1].Address || msgs[0].Code != msgs[1].Code {
+		return nil, ErrNoConflict
+	}
+
+	var heights, rounds [2]*big.Int
+	var values [2]common.Hash
+	for i := range msgs {
+		switch msgs[i].Code {
+		case msgProposal:
+			var proposal Proposal
+			if err := msgs[i].Decode(&proposal); err != nil {
+				return nil, errFailedDecodeProposal
+			}
+			heights[i], rounds[i], values[i] = proposal.Height, proposal.Round, proposal.ProposalBlock.Hash()
+		case msgPrevote, msgPrecommit:
+			var vote Vote
+			if err := msgs[i].Decode(&vote); err != nil {
+				return nil, errFailedDecodeVote
+			}
+			heights[i], rounds[i], values[i] = vote.Height, vote.Round, vote.ProposedBlockHash
+		default:
+			return nil, errInvalidMessage
+		}
+	}
+	if heights[0].Cmp(heights[1]) != 0 || rounds[0].Cmp(rounds[1]) != 0 || values[0] == values[1] {
+		return nil, ErrNoConflict
+	}
+
+	step := map[uint64]Step{msgProposal: propose, msgPrevote: prevote, msgPrecommit: precommit}[msgs[0].Code]
+	return &Fault{
+		Height:    heights[0],
+		Round:     rounds[0].Int64(),
+		Step:      step.String(),
+		Validator: msgs[0].Address,
+	}, nil
+}
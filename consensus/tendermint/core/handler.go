@@ -30,6 +30,10 @@ import (
 	"github.com/clearmatics/autonity/core/types"
 )
 
+// commitDrainTimeout bounds the time Stop waits for a commit in progress to reach the backend before tearing down
+// the engine. Without it a block decided right before the shutdown could be lost and the node restart one block short.
+const commitDrainTimeout = 5 * time.Second
+
 // Start implements core.Engine.Start
 func (c *core) Start(ctx context.Context, chain consensus.ChainReader, currentBlock func() *types.Block, hasBadBlock func(hash common.Hash) bool) error {
 	// prevent double start
@@ -54,18 +58,23 @@ func (c *core) Start(ctx context.Context, chain consensus.ChainReader, currentBl
 
 	c.subscribeEvents()
 
+	// restore the locks of the height being decided before the engine was stopped
+	c.loadLockState()
+
 	// set currentRoundState before starting go routines
 	lastCommittedProposalBlock, _ := c.backend.LastCommittedProposal()
 	height := new(big.Int).Add(lastCommittedProposalBlock.Number(), common.Big1)
 	c.currentRoundState.Update(big.NewInt(0), height)
+	// the time spent stopped doesn't count as a stall
+	c.liveness = livenessWatchdog{}
 
 	//We need a separate go routine to keep c.latestPendingUnminedBlock up to date
-	go c.handleNewUnminedBlockEvent(ctx)
+	c.goTracked(func() { c.handleNewUnminedBlockEvent(ctx) })
 
 	//We want to sequentially handle all the event which modify the current consensus state
-	go c.handleConsensusEvents(ctx)
+	c.goTracked(func() { c.handleConsensusEvents(ctx) })
 
-	go c.backend.HandleUnhandledMsgs(ctx)
+	c.goTracked(func() { c.backend.HandleUnhandledMsgs(ctx) })
 
 	return nil
 }
@@ -87,17 +96,23 @@ func (c *core) Stop() error {
 
 	c.logger.Info("stopping tendermint.core", "addr", c.address.String())
 
+	c.drainCommit()
+
 	_ = c.proposeTimeout.stopTimer()
 	_ = c.prevoteTimeout.stopTimer()
 	_ = c.precommitTimeout.stopTimer()
+	_ = c.commitTimeout.stopTimer()
 
 	c.cancel()
 
 	c.stopFutureProposalTimer()
 	c.unsubscribeEvents()
 
-	<-c.stopped
-	<-c.stopped
+	// wait for every goroutine started by Start to return
+	for atomic.LoadInt32(&c.running) > 0 {
+		<-c.stopped
+		atomic.AddInt32(&c.running, -1)
+	}
 
 	err := c.backend.Close()
 	if err != nil {
@@ -107,6 +122,31 @@ func (c *core) Stop() error {
 	return nil
 }
 
+// goTracked runs f in a new goroutine which signals c.stopped when f returns, Stop waits for all of them.
+func (c *core) goTracked(f func()) {
+	atomic.AddInt32(&c.running, 1)
+	go func() {
+		defer func() { c.stopped <- struct{}{} }()
+		f()
+	}()
+}
+
+// drainCommit waits up to commitDrainTimeout for the commit in progress, if any, to complete.
+func (c *core) drainCommit() {
+	c.commitDoneMu.Lock()
+	done := c.commitDone
+	c.commitDoneMu.Unlock()
+	if done == nil {
+		return
+	}
+
+	select {
+	case <-done:
+	case <-time.After(commitDrainTimeout):
+		c.logger.Warn("Stopping before the commit in progress completed", "timeout", commitDrainTimeout)
+	}
+}
+
 func (c *core) subscribeEvents() {
 	s := c.backend.Subscribe(events.MessageEvent{}, backlogEvent{})
 	c.messageEventSub = s
@@ -114,13 +154,13 @@ func (c *core) subscribeEvents() {
 	s1 := c.backend.Subscribe(events.NewUnminedBlockEvent{})
 	c.newUnminedBlockEventSub = s1
 
-	s2 := c.backend.Subscribe(TimeoutEvent{})
+	s2 := c.backend.Subscribe(TimeoutEvent{}, forceRoundChangeEvent{})
 	c.timeoutEventSub = s2
 
 	s3 := c.backend.Subscribe(events.CommitEvent{})
 	c.committedSub = s3
 
-	s4 := c.backend.Subscribe(events.SyncEvent{})
+	s4 := c.backend.Subscribe(events.SyncEvent{}, syncRequestEvent{})
 	c.syncEventSub = s4
 }
 
@@ -151,15 +191,13 @@ eventLoop:
 			break eventLoop
 		}
 	}
-
-	c.stopped <- struct{}{}
 }
 
 func (c *core) handleConsensusEvents(ctx context.Context) {
 	// Start a new round from last height + 1
 	c.startRound(ctx, common.Big0)
 
-	go c.syncLoop(ctx)
+	c.goTracked(func() { c.syncLoop(ctx) })
 
 eventLoop:
 	for {
@@ -175,11 +213,17 @@ eventLoop:
 					c.logger.Error("core.handleConsensusEvents Get message(MessageEvent) empty payload")
 				}
 
-				if err := c.handleMsg(ctx, e.Payload); err != nil {
+				if err := c.handleMsg(ctx, e.Sender, e.Payload); err != nil {
 					c.logger.Debug("core.handleConsensusEvents Get message(MessageEvent) payload failed", "err", err)
+					if err == errMessageRateExceeded {
+						// a copy received later from another peer is handled once the validator is below its rate
+						c.backend.ForgetMessage(e.Payload)
+					}
 					continue
 				}
-				c.backend.Gossip(ctx, c.valSet.Copy(), e.Payload)
+				if err := c.backend.Gossip(ctx, c.valSet.Copy(), e.Payload); err != nil {
+					c.logger.Debug("core.handleConsensusEvents Gossip message failed", "err", err)
+				}
 			case backlogEvent:
 				// No need to check signature for internal messages
 				c.logger.Debug("Started handling backlogEvent")
@@ -195,21 +239,28 @@ eventLoop:
 					continue
 				}
 
-				c.backend.Gossip(ctx, c.valSet.Copy(), p)
+				if err := c.backend.Gossip(ctx, c.valSet.Copy(), p); err != nil {
+					c.logger.Debug("core.handleConsensusEvents Gossip message failed", "err", err)
+				}
 			}
 		case ev, ok := <-c.timeoutEventSub.Chan():
 			if !ok {
 				break eventLoop
 			}
-			if timeoutE, ok := ev.Data.(TimeoutEvent); ok {
-				switch timeoutE.step {
+			switch e := ev.Data.(type) {
+			case TimeoutEvent:
+				switch e.step {
 				case msgProposal:
-					c.handleTimeoutPropose(ctx, timeoutE)
+					c.handleTimeoutPropose(ctx, e)
 				case msgPrevote:
-					c.handleTimeoutPrevote(ctx, timeoutE)
+					c.handleTimeoutPrevote(ctx, e)
 				case msgPrecommit:
-					c.handleTimeoutPrecommit(ctx, timeoutE)
+					c.handleTimeoutPrecommit(ctx, e)
+				case commitTimeoutStep:
+					c.handleTimeoutCommit(ctx, e)
 				}
+			case forceRoundChangeEvent:
+				c.handleForceRoundChange(ctx, e)
 			}
 		case ev, ok := <-c.committedSub.Chan():
 			if !ok {
@@ -224,8 +275,6 @@ eventLoop:
 			break eventLoop
 		}
 	}
-
-	c.stopped <- struct{}{}
 }
 
 func (c *core) syncLoop(ctx context.Context) {
@@ -239,7 +288,8 @@ func (c *core) syncLoop(ctx context.Context) {
 	height := c.currentRoundState.Height()
 
 	// Ask for sync when the engine starts
-	c.backend.AskSync(c.valSet.Copy())
+	c.askSync(c.currentRoundState.Height(), c.currentRoundState.Round())
+	c.checkLiveness()
 
 	for {
 		select {
@@ -249,46 +299,82 @@ func (c *core) syncLoop(ctx context.Context) {
 
 			// we only ask for sync if the current view stayed the same for the past 10 seconds
 			if currentHeight.Cmp(height) == 0 && currentRound.Cmp(round) == 0 {
-				c.backend.AskSync(c.valSet.Copy())
+				c.askSync(currentHeight, currentRound)
 			}
 			round = currentRound
 			height = currentHeight
+			c.checkLiveness()
 			timer = time.NewTimer(10 * time.Second)
 		case ev, ok := <-c.syncEventSub.Chan():
 			if !ok {
 				return
 			}
-			event := ev.Data.(events.SyncEvent)
-			c.logger.Info("Processing sync message", "from", event.Addr)
-			c.SyncPeer(event.Addr)
+			switch event := ev.Data.(type) {
+			case events.SyncEvent:
+				c.logger.Info("Processing sync message", "from", event.Addr)
+				c.syncPeer(ctx, event.Addr, event.Height, event.Round)
+			case syncRequestEvent:
+				c.askSync(c.currentRoundState.Height(), c.currentRoundState.Round())
+			}
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
+// syncRequestEvent asks the sync loop to ask the network for the current consensus state right away.
+type syncRequestEvent struct{}
+
+// RequestSync asks the network for the current consensus state without waiting for the consensus to stall.
+func (c *core) RequestSync() {
+	c.logger.Info("Sync requested")
+	c.sendEvent(syncRequestEvent{})
+}
+
 // sendEvent sends event to mux
 func (c *core) sendEvent(ev interface{}) {
 	c.backend.Post(ev)
 }
 
-func (c *core) handleMsg(ctx context.Context, payload []byte) error {
+func (c *core) handleMsg(ctx context.Context, peer common.Address, payload []byte) error {
 	logger := c.logger.New()
 
+	// Drop oversized payloads before allocating for their decoding
+	if max := atomic.LoadInt64(&c.maxPayloadSize); max > 0 && int64(len(payload)) > max {
+		tendermintOversizedMessageCounter.Inc(1)
+		logger.Warn("Rejected oversized message", "peer", peer, "size", len(payload), "max", max)
+		return errPayloadTooLarge
+	}
+
 	// Decode message and check its signature
 	msg := new(Message)
 
-	sender, err := msg.FromPayload(payload, c.valSet.Copy(), crypto.CheckValidatorSignature)
+	sender, err := msg.FromPayload(payload, c.valSet.Copy(), c.signers.CheckValidatorSignature)
+	if err == crypto.ErrUnauthorizedAddress {
+		tendermintNotValidatorCounter.Inc(1)
+		logger.Warn("Rejected message not signed by a validator", "peer", peer, "claimed", msg.Address)
+		return errNotValidator
+	}
 	if err != nil {
 		logger.Error("Failed to decode message from payload", "err", err)
 		return err
 	}
 
+	// Drop the messages of flooding validators, once their signer is known
+	if err := c.checkMessageRate(msg.Address); err != nil {
+		return err
+	}
+
+	if err := c.checkSequence(msg); err != nil {
+		logger.Debug("Rejected replayed message", "peer", peer, "from", msg.Address, "sequence", msg.Sequence)
+		return err
+	}
+
 	return c.handleCheckedMsg(ctx, msg, *sender)
 }
 
 func (c *core) handleCheckedMsg(ctx context.Context, msg *Message, sender validator.Validator) error {
-	logger := c.logger.New("address", c.address, "from", sender)
+	logger := c.roundLogger().New("address", c.address, "from", sender)
 
 	// Store the message if it's a future message
 	testBacklog := func(err error) error {
@@ -316,8 +402,10 @@ func (c *core) handleCheckedMsg(ctx context.Context, msg *Message, sender valida
 				msgRound = v.Round.Int64()
 			}
 
+			c.futureRoundsChangeMu.Lock()
 			c.futureRoundsChange[msgRound] = c.futureRoundsChange[msgRound] + 1
 			totalFutureRoundMessages := c.futureRoundsChange[msgRound]
+			c.futureRoundsChangeMu.Unlock()
 
 			if totalFutureRoundMessages > int64(c.valSet.F()) {
 				logger.Debug("Received ceil(N/3) - 1 messages for higher round", "New round", msgRound)
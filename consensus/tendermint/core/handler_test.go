@@ -2,11 +2,14 @@ package core
 
 import (
 	"context"
+	"crypto/ecdsa"
 	"github.com/clearmatics/autonity/common"
+	"github.com/clearmatics/autonity/consensus/tendermint/config"
 	"github.com/clearmatics/autonity/consensus/tendermint/validator"
 	"github.com/clearmatics/autonity/crypto"
 	"github.com/clearmatics/autonity/log"
 	"github.com/clearmatics/autonity/rlp"
+	"github.com/golang/mock/gomock"
 	"gopkg.in/karalabe/cookiejar.v2/collections/prque"
 	"math/big"
 	"testing"
@@ -119,6 +122,7 @@ func TestHandleCheckedMessage(t *testing.T) {
 			proposeTimeout:     newTimeout(propose, logger),
 			prevoteTimeout:     newTimeout(prevote, logger),
 			precommitTimeout:   newTimeout(precommit, logger),
+			commitTimeout:      newTimeout(precommitDone, logger),
 		}
 
 		err := engine.handleCheckedMsg(context.Background(), testCase.message, sender)
@@ -138,3 +142,83 @@ func TestHandleCheckedMessage(t *testing.T) {
 	}
 
 }
+
+func TestHandleMsgNotValidator(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	validators, keysMap := newTestValidatorSetWithKeys(4)
+	backendMock := NewMockBackend(ctrl)
+	backendMock.EXPECT().Address().AnyTimes().Return(validators.GetByIndex(0).Address())
+
+	c := New(backendMock, &config.Config{})
+	c.valSet = &validatorSet{Set: validators}
+
+	signedPayload := func(key *ecdsa.PrivateKey, address common.Address) []byte {
+		vote, err := rlp.EncodeToBytes(&Vote{Round: big.NewInt(0), Height: big.NewInt(1)})
+		if err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		msg := &Message{Code: msgPrevote, Msg: vote, Address: address}
+		data, err := msg.PayloadNoSig()
+		if err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		if msg.Signature, err = crypto.Sign(crypto.Keccak256(data), key); err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		payload, err := msg.Payload()
+		if err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		return payload
+	}
+
+	outsider, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	outsiderAddress := crypto.PubkeyToAddress(outsider.PublicKey)
+
+	// a message signed by a non validator is rejected and counted, whoever it claims to come from
+	before := tendermintNotValidatorCounter.Count()
+	for _, claimed := range []common.Address{outsiderAddress, validators.GetByIndex(1).Address()} {
+		if err := c.handleMsg(context.Background(), outsiderAddress, signedPayload(outsider, claimed)); err != errNotValidator {
+			t.Fatalf("have %v, want %v", err, errNotValidator)
+		}
+	}
+	if have := tendermintNotValidatorCounter.Count() - before; have != 2 {
+		t.Fatalf("have %d rejected messages, want 2", have)
+	}
+
+	// a validator signing a message on behalf of another one is a different error
+	sender := validators.GetByIndex(1).Address()
+	payload := signedPayload(keysMap[sender], validators.GetByIndex(2).Address())
+	if err := c.handleMsg(context.Background(), sender, payload); err != ErrUnauthorizedAddress {
+		t.Fatalf("have %v, want %v", err, ErrUnauthorizedAddress)
+	}
+	if have := tendermintNotValidatorCounter.Count() - before; have != 2 {
+		t.Fatalf("have %d rejected messages, want 2", have)
+	}
+}
+
+func TestHandleMsgOversized(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	backendMock := NewMockBackend(ctrl)
+	backendMock.EXPECT().Address().AnyTimes().Return(common.HexToAddress("0x0123456789"))
+
+	// the validator set isn't expected to be used, the payload being rejected before its decoding
+	c := New(backendMock, &config.Config{MaxPayloadSize: 1024})
+	c.valSet = &validatorSet{Set: validator.NewMockSet(ctrl)}
+	c.maxPayloadSize = int64(c.config.GetMaxPayloadSize(0))
+
+	before := tendermintOversizedMessageCounter.Count()
+	if err := c.handleMsg(context.Background(), common.HexToAddress("0x01"), make([]byte, 1025)); err != errPayloadTooLarge {
+		t.Fatalf("have %v, want %v", err, errPayloadTooLarge)
+	}
+	if have := tendermintOversizedMessageCounter.Count() - before; have != 1 {
+		t.Fatalf("have %d rejected messages, want 1", have)
+	}
+}
@@ -0,0 +1,56 @@
+package core
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/clearmatics/autonity/consensus/tendermint/events"
+)
+
+// livenessWatchdog tracks how long the height stayed unchanged. It is only accessed by syncLoop, hence the checks
+// happen at the sync interval and a threshold shorter than it is rounded up to it.
+type livenessWatchdog struct {
+	height   *big.Int  // height seen by the last check
+	since    time.Time // when the height was last seen changing
+	reported time.Time // when the last StallEvent was posted, zero if none for this height
+}
+
+// checkLiveness posts a StallEvent if the height didn't change for longer than the stall threshold. While the node
+// stays stalled the event is posted again every threshold.
+func (c *core) checkLiveness() {
+	height, round, _ := c.currentRoundState.State()
+	if height == nil {
+		return
+	}
+
+	t := c.now()
+	w := &c.liveness
+	if w.height == nil || w.height.Cmp(height) != 0 {
+		w.height = new(big.Int).Set(height)
+		w.since = t
+		w.reported = time.Time{}
+		return
+	}
+
+	threshold := c.config.GetStallThreshold()
+	if t.Sub(w.since) < threshold || (!w.reported.IsZero() && t.Sub(w.reported) < threshold) {
+		return
+	}
+	w.reported = t
+
+	info := c.GetBacklogInfo()
+	var futureRoundsChange int64
+	for _, count := range info.FutureRoundsChange {
+		futureRoundsChange += count
+	}
+
+	c.roundLogger().Warn("Consensus stalled", "stalled", t.Sub(w.since), "backlog", info.Depth, "futureRoundsChange", futureRoundsChange)
+	c.sendEvent(events.StallEvent{
+		Height:             new(big.Int).Set(height),
+		Round:              round.Int64(),
+		Step:               c.currentRoundState.Step().String(),
+		Stalled:            t.Sub(w.since),
+		BacklogDepth:       info.Depth,
+		FutureRoundsChange: futureRoundsChange,
+	})
+}
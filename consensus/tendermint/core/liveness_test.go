@@ -0,0 +1,58 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/clearmatics/autonity/consensus/tendermint/config"
+	"github.com/clearmatics/autonity/consensus/tendermint/events"
+	"github.com/clearmatics/autonity/log"
+)
+
+func TestCheckLivenessStall(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clock := time.Unix(1000, 0)
+
+	roundState := NewRoundState(big.NewInt(1), big.NewInt(3))
+	roundState.SetStep(prevote)
+	backendMock := NewMockBackend(ctrl)
+	c := &core{
+		config:             &config.Config{StallThreshold: 30000},
+		logger:             log.New("backend", "test", "id", 0),
+		backend:            backendMock,
+		currentRoundState:  roundState,
+		futureRoundsChange: map[int64]int64{2: 1},
+		now:                func() time.Time { return clock },
+	}
+
+	c.checkLiveness()
+	clock = clock.Add(20 * time.Second)
+	c.checkLiveness()
+
+	// past the threshold with no height change
+	backendMock.EXPECT().Post(events.StallEvent{
+		Height:             big.NewInt(3),
+		Round:              1,
+		Step:               "prevote",
+		Stalled:            40 * time.Second,
+		FutureRoundsChange: 1,
+	})
+	clock = clock.Add(20 * time.Second)
+	c.checkLiveness()
+
+	// reported once per threshold
+	clock = clock.Add(10 * time.Second)
+	c.checkLiveness()
+
+	// a new height re-arms the watchdog
+	roundState.SetHeight(big.NewInt(4))
+	clock = clock.Add(20 * time.Second)
+	c.checkLiveness()
+	clock = clock.Add(20 * time.Second)
+	c.checkLiveness()
+}
@@ -0,0 +1,131 @@
+package core
+
+import (
+	"math/big"
+
+	"github.com/clearmatics/autonity/common"
+	"github.com/clearmatics/autonity/core/types"
+	"github.com/clearmatics/autonity/rlp"
+)
+
+// lockState is the part of the consensus state which must survive a restart, so that the node keeps honouring
+// the locks it committed to before stopping. Values are RLP encoded blocks, empty when not set, and rounds are
+// only meaningful when the matching value is set.
+type lockState struct {
+	Height      *big.Int
+	LockedRound uint64
+	LockedValue []byte
+	ValidRound  uint64
+	ValidValue  []byte
+}
+
+// saveLockState persists the locked and valid values of the current height.
+func (c *core) saveLockState() {
+	state := lockState{Height: c.currentRoundState.Height()}
+
+	var err error
+	if c.lockedValue != nil {
+		state.LockedRound = c.lockedRound.Uint64()
+		if state.LockedValue, err = rlp.EncodeToBytes(c.lockedValue); err != nil {
+			c.logger.Error("Failed to encode locked value", "err", err)
+			return
+		}
+	}
+	if c.validValue != nil {
+		state.ValidRound = c.validRound.Uint64()
+		if state.ValidValue, err = rlp.EncodeToBytes(c.validValue); err != nil {
+			c.logger.Error("Failed to encode valid value", "err", err)
+			return
+		}
+	}
+
+	data, err := rlp.EncodeToBytes(&state)
+	if err != nil {
+		c.logger.Error("Failed to encode lock state", "err", err)
+		return
+	}
+	if err := c.backend.SaveLockState(data); err != nil {
+		c.logger.Error("Failed to save lock state", "err", err)
+	}
+}
+
+// loadLockState reads the lock state persisted before the last stop, it is applied when the core starts its
+// first round if the height matches.
+func (c *core) loadLockState() {
+	c.restoredLockState = nil
+
+	data, err := c.backend.LoadLockState()
+	if err != nil {
+		c.logger.Error("Failed to load lock state", "err", err)
+		return
+	}
+	if len(data) == 0 {
+		return
+	}
+
+	state := new(lockState)
+	if err := rlp.DecodeBytes(data, state); err != nil {
+		c.logger.Error("Failed to decode lock state", "err", err)
+		return
+	}
+	c.restoredLockState = state
+}
+
+// restoreLockState applies the loaded lock state if it belongs to the given height.
+func (c *core) restoreLockState(height *big.Int) {
+	state := c.restoredLockState
+	c.restoredLockState = nil
+	if state == nil || state.Height == nil || state.Height.Cmp(height) != 0 {
+		return
+	}
+
+	var lockedValue, validValue *types.Block
+	if len(state.LockedValue) > 0 {
+		lockedValue = new(types.Block)
+		if err := rlp.DecodeBytes(state.LockedValue, lockedValue); err != nil {
+			c.logger.Error("Failed to decode locked value", "err", err)
+			return
+		}
+	}
+	if len(state.ValidValue) > 0 {
+		validValue = new(types.Block)
+		if err := rlp.DecodeBytes(state.ValidValue, validValue); err != nil {
+			c.logger.Error("Failed to decode valid value", "err", err)
+			return
+		}
+	}
+
+	c.valuesMu.Lock()
+	if lockedValue != nil {
+		c.lockedRound = new(big.Int).SetUint64(state.LockedRound)
+		c.lockedValue = lockedValue
+	}
+	if validValue != nil {
+		c.validRound = new(big.Int).SetUint64(state.ValidRound)
+		c.validValue = validValue
+	}
+	c.valuesMu.Unlock()
+	c.logger.Info("Restored lock state", "height", height, "lockedRound", c.lockedRound, "validRound", c.validRound)
+}
+
+// LockedValueHash returns the hash of the value the node is locked on, the zero hash if there is none. It is safe to
+// call while the core is running.
+func (c *core) LockedValueHash() common.Hash {
+	c.valuesMu.RLock()
+	defer c.valuesMu.RUnlock()
+	if c.lockedValue == nil {
+		return common.Hash{}
+	}
+	return c.lockedValue.Hash()
+}
+
+// ValidValueHash returns the hash of the valid value of the node, the zero hash if there is none. It is safe to call
+// while the core is running.
+func (c *core) ValidValueHash() common.Hash {
+	c.valuesMu.RLock()
+	defer c.valuesMu.RUnlock()
+	if c.validValue == nil {
+		return common.Hash{}
+	}
+	return c.validValue.Hash()
+}
@@ -0,0 +1,175 @@
+package core
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/clearmatics/autonity/common"
+	"github.com/clearmatics/autonity/consensus/tendermint/validator"
+	"github.com/clearmatics/autonity/core/types"
+	"github.com/clearmatics/autonity/log"
+	"github.com/golang/mock/gomock"
+	"gopkg.in/karalabe/cookiejar.v2/collections/prque"
+)
+
+func TestLockStateRestart(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	logger := log.New("backend", "test", "id", 0)
+	height := big.NewInt(3)
+	lockedBlock := types.NewBlockWithHeader(&types.Header{Number: height})
+
+	// before the restart the node locked on lockedBlock at round 1
+	var saved []byte
+	backendMock := NewMockBackend(ctrl)
+	backendMock.EXPECT().SaveLockState(gomock.Any()).DoAndReturn(func(data []byte) error {
+		saved = data
+		return nil
+	})
+	c := &core{
+		backend:           backendMock,
+		logger:            logger,
+		currentRoundState: NewRoundState(big.NewInt(1), height),
+		lockedRound:       big.NewInt(1),
+		lockedValue:       lockedBlock,
+		validRound:        big.NewInt(1),
+		validValue:        lockedBlock,
+	}
+	c.saveLockState()
+
+	// the restarted node starts again from round 0 of the same height
+	validators, _ := newTestValidatorSetWithKeys(4)
+	addr := common.HexToAddress("0x0123456789")
+	restartedBackend := NewMockBackend(ctrl)
+	restartedBackend.EXPECT().LoadLockState().Return(saved, nil)
+	restartedBackend.EXPECT().Validators(height.Uint64()).Return(validators, nil)
+	restarted := &core{
+		address:                      addr,
+		backend:                      restartedBackend,
+		logger:                       logger,
+		backlogs:                     make(map[validator.Validator]*prque.Prque),
+		currentRoundState:            NewRoundState(big.NewInt(0), height),
+		currentHeightOldRoundsStates: make(map[int64]*roundState),
+		futureRoundsChange:           make(map[int64]int64),
+		valSet:                       new(validatorSet),
+		lockedRound:                  big.NewInt(-1),
+		validRound:                   big.NewInt(-1),
+		proposeTimeout:               newTimeout(propose, logger),
+		prevoteTimeout:               newTimeout(prevote, logger),
+		precommitTimeout:             newTimeout(precommit, logger),
+		commitTimeout:                newTimeout(precommitDone, logger),
+	}
+	restarted.loadLockState()
+	restarted.setCore(big.NewInt(0), height, common.Address{})
+	restarted.setStep(propose)
+
+	if restarted.lockedRound.Int64() != 1 || restarted.lockedValue.Hash() != lockedBlock.Hash() {
+		t.Fatalf("lock not restored: round %v, value %v", restarted.lockedRound, restarted.lockedValue)
+	}
+	if restarted.validRound.Int64() != 1 || restarted.validValue.Hash() != lockedBlock.Hash() {
+		t.Fatalf("valid value not restored: round %v, value %v", restarted.validRound, restarted.validValue)
+	}
+
+	// a conflicting proposal must be answered with a nil prevote
+	conflictingBlock := types.NewBlockWithHeader(&types.Header{Number: height, GasLimit: 1})
+	proposal, err := Encode(NewProposal(big.NewInt(0), height, big.NewInt(-1), conflictingBlock, logger))
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	msg := &Message{
+		Code:          msgProposal,
+		Msg:           proposal,
+		Address:       restarted.valSet.GetProposer().Address(),
+		CommittedSeal: []byte{},
+		Signature:     []byte{0x1},
+	}
+
+	encodedVote, err := Encode(&Vote{Round: big.NewInt(0), Height: height, ProposedBlockHash: common.Hash{}})
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	nilPrevote := &Message{
+		Code:          msgPrevote,
+		Msg:           encodedVote,
+		Address:       addr,
+		CommittedSeal: []byte{},
+		Signature:     []byte{0x1},
+	}
+	payload, err := nilPrevote.Payload()
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+
+	restartedBackend.EXPECT().VerifyProposal(gomock.Any()).Return(time.Duration(0), nil)
+	restartedBackend.EXPECT().Sign(gomock.Any()).Return([]byte{0x1}, nil)
+	restartedBackend.EXPECT().Broadcast(gomock.Any(), gomock.Any(), payload)
+
+	if err := restarted.handleProposal(context.Background(), msg); err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+}
+
+func TestLockStateOtherHeight(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	logger := log.New("backend", "test", "id", 0)
+	lockedBlock := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(3)})
+
+	var saved []byte
+	backendMock := NewMockBackend(ctrl)
+	backendMock.EXPECT().SaveLockState(gomock.Any()).DoAndReturn(func(data []byte) error {
+		saved = data
+		return nil
+	})
+	backendMock.EXPECT().LoadLockState().DoAndReturn(func() ([]byte, error) {
+		return saved, nil
+	})
+	c := &core{
+		backend:           backendMock,
+		logger:            logger,
+		currentRoundState: NewRoundState(big.NewInt(1), big.NewInt(3)),
+		lockedRound:       big.NewInt(1),
+		lockedValue:       lockedBlock,
+		validRound:        big.NewInt(-1),
+	}
+	c.saveLockState()
+
+	c.loadLockState()
+	if c.restoredLockState == nil || len(c.restoredLockState.ValidValue) != 0 {
+		t.Fatalf("unexpected loaded lock state %+v", c.restoredLockState)
+	}
+
+	c.lockedRound = big.NewInt(-1)
+	c.lockedValue = nil
+	c.restoreLockState(big.NewInt(4))
+	if c.lockedValue != nil || c.lockedRound.Int64() != -1 || c.restoredLockState != nil {
+		t.Fatalf("lock of another height must not be restored")
+	}
+}
+
+func TestLockedAndValidValueHash(t *testing.T) {
+	c := &core{}
+	if hash := c.LockedValueHash(); hash != (common.Hash{}) {
+		t.Fatalf("have locked value hash %v, want the zero hash", hash)
+	}
+	if hash := c.ValidValueHash(); hash != (common.Hash{}) {
+		t.Fatalf("have valid value hash %v, want the zero hash", hash)
+	}
+
+	lockedBlock := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(3)})
+	validBlock := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(3), GasLimit: 1})
+	c.lockedValue = lockedBlock
+	c.validValue = validBlock
+
+	api := &API{core: c}
+	if hash := api.GetLockedValueHash(); hash != lockedBlock.Hash() {
+		t.Fatalf("have locked value hash %v, want %v", hash, lockedBlock.Hash())
+	}
+	if hash := api.GetValidValueHash(); hash != validBlock.Hash() {
+		t.Fatalf("have valid value hash %v, want %v", hash, validBlock.Hash())
+	}
+}
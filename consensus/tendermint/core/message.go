@@ -21,6 +21,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math/big"
 
 	"github.com/clearmatics/autonity/common"
 	"github.com/clearmatics/autonity/consensus/tendermint/validator"
@@ -40,6 +41,10 @@ type Message struct {
 	Address       common.Address
 	Signature     []byte
 	CommittedSeal []byte
+	// Sequence numbers the messages sent by a validator in a height from 1, so that a replayed message is told apart
+	// from a new one whatever the gossip caches still hold. It is only set from the sequence block of the chain on,
+	// messages without it being encoded as before.
+	Sequence uint64
 }
 
 // ==============================================
@@ -48,7 +53,10 @@ type Message struct {
 
 // EncodeRLP serializes m into the Ethereum RLP format.
 func (m *Message) EncodeRLP(w io.Writer) error {
-	return rlp.Encode(w, []interface{}{m.Code, m.Msg, m.Address, m.Signature, m.CommittedSeal})
+	if m.Sequence == 0 {
+		return rlp.Encode(w, []interface{}{m.Code, m.Msg, m.Address, m.Signature, m.CommittedSeal})
+	}
+	return rlp.Encode(w, []interface{}{m.Code, m.Msg, m.Address, m.Signature, m.CommittedSeal, m.Sequence})
 }
 
 func (m *Message) GetCode() uint64 {
@@ -67,12 +75,28 @@ func (m *Message) DecodeRLP(s *rlp.Stream) error {
 		Address       common.Address
 		Signature     []byte
 		CommittedSeal []byte
+		Rest          []rlp.RawValue `rlp:"tail"`
 	}
 
 	if err := s.Decode(&msg); err != nil {
 		return err
 	}
+	// the sequence is optional so that the messages of the nodes predating it still decode
+	var sequence uint64
+	switch len(msg.Rest) {
+	case 0:
+	case 1:
+		if err := rlp.DecodeBytes(msg.Rest[0], &sequence); err != nil {
+			return err
+		}
+		if sequence == 0 {
+			return errInvalidSequence
+		}
+	default:
+		return errInvalidMessage
+	}
 	m.Code, m.Msg, m.Address, m.Signature, m.CommittedSeal = msg.Code, msg.Msg, msg.Address, msg.Signature, msg.CommittedSeal
+	m.Sequence = sequence
 	return nil
 }
 
@@ -127,9 +151,26 @@ func (m *Message) PayloadNoSig() ([]byte, error) {
 		Address:       m.Address,
 		Signature:     []byte{},
 		CommittedSeal: m.CommittedSeal,
+		Sequence:      m.Sequence,
 	})
 }
 
+// view returns the round and height of the proposal or vote carried by the message, without decoding the rest of it.
+func (m *Message) view() (round, height *big.Int, err error) {
+	s := rlp.NewStream(bytes.NewReader(m.Msg), uint64(len(m.Msg)))
+	if _, err := s.List(); err != nil {
+		return nil, nil, err
+	}
+	round, height = new(big.Int), new(big.Int)
+	if err := s.Decode(round); err != nil {
+		return nil, nil, err
+	}
+	if err := s.Decode(height); err != nil {
+		return nil, nil, err
+	}
+	return round, height, nil
+}
+
 func (m *Message) Decode(val interface{}) error {
 	return rlp.DecodeBytes(m.Msg, val)
 }
@@ -34,13 +34,16 @@ type messageSet struct {
 	votes      map[common.Hash]map[common.Address]Message // map[proposedBlockHash]map[validatorAddress]vote
 	nilvotes   map[common.Address]Message                 // map[validatorAddress]vote
 	messages   []*Message
-	messagesMu *sync.RWMutex
+	messagesMu *sync.RWMutex // also guards the writes of the vote maps, for tally to be called concurrently
 }
 
 func (ms *messageSet) AddVote(blockHash common.Hash, msg Message) {
 	var addressesMap map[common.Address]Message
 	var ok bool
 
+	ms.messagesMu.Lock()
+	defer ms.messagesMu.Unlock()
+
 	if _, ok = ms.votes[blockHash]; !ok {
 		ms.votes[blockHash] = make(map[common.Address]Message)
 	}
@@ -52,21 +55,31 @@ func (ms *messageSet) AddVote(blockHash common.Hash, msg Message) {
 	}
 
 	addressesMap[msg.Address] = msg
-
-	ms.messagesMu.Lock()
 	ms.messages = append(ms.messages, &msg)
-	ms.messagesMu.Unlock()
 }
 
 func (ms *messageSet) AddNilVote(msg Message) {
+	ms.messagesMu.Lock()
+	defer ms.messagesMu.Unlock()
 	if _, ok := ms.nilvotes[msg.Address]; !ok {
 		ms.nilvotes[msg.Address] = msg
-		ms.messagesMu.Lock()
 		ms.messages = append(ms.messages, &msg)
-		ms.messagesMu.Unlock()
 	}
 }
 
+// GetVote returns the vote of the given validator and the hash it is for, empty for a nil vote.
+func (ms *messageSet) GetVote(address common.Address) (common.Hash, Message, bool) {
+	if msg, ok := ms.nilvotes[address]; ok {
+		return common.Hash{}, msg, true
+	}
+	for hash, votes := range ms.votes {
+		if msg, ok := votes[address]; ok {
+			return hash, msg, true
+		}
+	}
+	return common.Hash{}, Message{}, false
+}
+
 func (ms *messageSet) GetMessages() []*Message {
 	ms.messagesMu.RLock()
 	defer ms.messagesMu.RUnlock()
@@ -96,6 +109,17 @@ func (ms *messageSet) TotalSize() int {
 	return total
 }
 
+// tally returns the number of votes for each block hash and the number of nil votes.
+func (ms *messageSet) tally() (map[common.Hash]int, int) {
+	ms.messagesMu.RLock()
+	defer ms.messagesMu.RUnlock()
+	votes := make(map[common.Hash]int, len(ms.votes))
+	for hash, v := range ms.votes {
+		votes[hash] = len(v)
+	}
+	return votes, len(ms.nilvotes)
+}
+
 func (ms *messageSet) Values(blockHash common.Hash) []Message {
 	if _, ok := ms.votes[blockHash]; !ok {
 		return nil
@@ -78,3 +78,23 @@ func TestMessageSetValues(t *testing.T) {
 		}
 	})
 }
+
+func TestMessageSetGetVote(t *testing.T) {
+	blockHash := common.BytesToHash([]byte("123456789"))
+	voter := Message{Address: common.BytesToAddress([]byte("987654321"))}
+	nilVoter := Message{Address: common.BytesToAddress([]byte("123"))}
+
+	ms := newMessageSet()
+	ms.AddVote(blockHash, voter)
+	ms.AddNilVote(nilVoter)
+
+	if hash, msg, ok := ms.GetVote(voter.Address); !ok || hash != blockHash || msg.Address != voter.Address {
+		t.Fatalf("Expected the vote for %v, got %v %v", blockHash, hash, ok)
+	}
+	if hash, _, ok := ms.GetVote(nilVoter.Address); !ok || hash != (common.Hash{}) {
+		t.Fatalf("Expected a nil vote, got %v %v", hash, ok)
+	}
+	if _, _, ok := ms.GetVote(common.Address{}); ok {
+		t.Fatalf("Expected no vote")
+	}
+}
@@ -26,4 +26,23 @@ var (
 	tendermintProposeTimer      = metrics.NewRegisteredTimer("tendermint/timer/propose", nil)
 	tendermintPrevoteTimer      = metrics.NewRegisteredTimer("tendermint/timer/prevote", nil)
 	tendermintPrecommitTimer    = metrics.NewRegisteredTimer("tendermint/timer/precommit", nil)
+	tendermintRateLimitedMeter  = metrics.NewRegisteredMeter("tendermint/message/ratelimited", nil)
+	tendermintSyncMessagesGauge = metrics.NewRegisteredGauge("tendermint/sync/messages", nil)
+
+	// nil votes sent on timeout expiry, the main sign of missed proposals
+	tendermintNilPrevoteCounter   = metrics.NewRegisteredCounter("tendermint/prevote/nil", nil)
+	tendermintNilPrecommitCounter = metrics.NewRegisteredCounter("tendermint/precommit/nil", nil)
+
+	// a node constantly asking to sync is likely stuck, these counters are kept even with metrics disabled
+	tendermintSyncAskedCounter  = metrics.NewRegisteredCounterForced("tendermint/sync/asked", nil)
+	tendermintSyncServedCounter = metrics.NewRegisteredCounterForced("tendermint/sync/served", nil)
+
+	// so are messages signed by non validators, either spoofed or from a misconfigured node, proposer equivocations
+	// and double votes
+	tendermintNotValidatorCounter = metrics.NewRegisteredCounterForced("tendermint/message/notvalidator", nil)
+	tendermintEquivocationCounter = metrics.NewRegisteredCounterForced("tendermint/proposal/equivocation", nil)
+	tendermintDoubleVoteCounter   = metrics.NewRegisteredCounterForced("tendermint/vote/double", nil)
+
+	// and oversized messages, which are expensive to decode
+	tendermintOversizedMessageCounter = metrics.NewRegisteredCounterForced("tendermint/message/oversized", nil)
 )
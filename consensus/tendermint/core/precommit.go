@@ -26,7 +26,7 @@ import (
 )
 
 func (c *core) sendPrecommit(ctx context.Context, isNil bool) {
-	logger := c.logger.New("step", c.currentRoundState.Step())
+	logger := c.roundLogger()
 
 	var precommit = Vote{
 		Round:  big.NewInt(c.currentRoundState.Round().Int64()),
@@ -37,7 +37,7 @@ func (c *core) sendPrecommit(ctx context.Context, isNil bool) {
 		precommit.ProposedBlockHash = common.Hash{}
 	} else {
 		if h := c.currentRoundState.GetCurrentProposalHash(); h == (common.Hash{}) {
-			c.logger.Error("core.sendPrecommit Proposal is empty! It should not be empty!")
+			logger.Error("core.sendPrecommit Proposal is empty! It should not be empty!")
 			return
 		}
 		precommit.ProposedBlockHash = c.currentRoundState.GetCurrentProposalHash()
@@ -62,7 +62,7 @@ func (c *core) sendPrecommit(ctx context.Context, isNil bool) {
 	seal := PrepareCommittedSeal(precommit.ProposedBlockHash)
 	msg.CommittedSeal, err = c.backend.Sign(seal)
 	if err != nil {
-		c.logger.Error("core.sendPrecommit error while signing committed seal", "err", err)
+		logger.Error("core.sendPrecommit error while signing committed seal", "err", err)
 	}
 
 	c.sentPrecommit = true
@@ -120,7 +120,25 @@ func (c *core) handlePrecommit(ctx context.Context, msg *Message) error {
 		if err := c.precommitTimeout.stopTimer(); err != nil {
 			return err
 		}
-		c.logger.Debug("Stopped Scheduled Precommit Timeout")
+		c.roundLogger().Debug("Stopped Scheduled Precommit Timeout")
+
+		// the precommits received until the commit timeout expires are committed along, there is nothing left to
+		// wait for once every validator precommitted
+		if timeoutDuration := c.config.GetCommitTimeout(); timeoutDuration > 0 {
+			if c.currentRoundState.Precommits.VotesSize(curProposalHash) < c.valSet.Size() {
+				if !c.commitTimeout.timerStarted() {
+					c.pendingDecision = &decision{
+						round:      curR,
+						proposal:   c.currentRoundState.Proposal(),
+						precommits: c.currentRoundState.Precommits,
+					}
+					c.commitTimeout.scheduleTimeout(timeoutDuration, curR, curH, c.onTimeoutCommit)
+					c.roundLogger().Debug("Scheduled Commit Timeout", "Timeout Duration", timeoutDuration)
+				}
+				return nil
+			}
+			_ = c.commitTimeout.stopTimer()
+		}
 
 		select {
 		case <-ctx.Done():
@@ -131,9 +149,9 @@ func (c *core) handlePrecommit(ctx context.Context, msg *Message) error {
 
 		// Line 47 in Algorithm 1 of The latest gossip on BFT consensus
 	} else if !c.precommitTimeout.timerStarted() && c.Quorum(c.currentRoundState.Precommits.TotalSize()) {
-		timeoutDuration := timeoutPrecommit(curR)
+		timeoutDuration := c.timeoutPrecommit(curR)
 		c.precommitTimeout.scheduleTimeout(timeoutDuration, curR, curH, c.onTimeoutPrecommit)
-		c.logger.Debug("Scheduled Precommit Timeout", "Timeout Duration", timeoutDuration)
+		c.roundLogger().Debug("Scheduled Precommit Timeout", "Timeout Duration", timeoutDuration)
 	}
 
 	return nil
@@ -144,13 +162,13 @@ func (c *core) verifyPrecommitCommittedSeal(addressMsg common.Address, committed
 
 	addressOfSignerOfCommittedSeal, err := types.GetSignatureAddress(committedSeal, committedSealMsg)
 	if err != nil {
-		c.logger.Error("Failed to get signer address", "err", err)
+		c.roundLogger().Error("Failed to get signer address", "err", err)
 		return err
 	}
 
 	// ensure sender signed the committed seal
 	if !bytes.Equal(addressOfSignerOfCommittedSeal.Bytes(), addressMsg.Bytes()) {
-		c.logger.Error("verify precommit seal error", "got", addressMsg.String(), "expected", addressOfSignerOfCommittedSeal.String())
+		c.roundLogger().Error("verify precommit seal error", "got", addressMsg.String(), "expected", addressOfSignerOfCommittedSeal.String())
 
 		return errInvalidSenderOfCommittedSeal
 	}
@@ -5,15 +5,18 @@ import (
 	"errors"
 	"math/big"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 
 	"github.com/clearmatics/autonity/common"
+	"github.com/clearmatics/autonity/consensus/tendermint/config"
 	"github.com/clearmatics/autonity/consensus/tendermint/validator"
 	"github.com/clearmatics/autonity/core/types"
 	"github.com/clearmatics/autonity/crypto"
 	"github.com/clearmatics/autonity/crypto/secp256k1"
 	"github.com/clearmatics/autonity/log"
+	"gopkg.in/karalabe/cookiejar.v2/collections/prque"
 )
 
 func TestSendPrecommit(t *testing.T) {
@@ -285,7 +288,7 @@ func TestHandlePrecommit(t *testing.T) {
 		}
 
 		backendMock := NewMockBackend(ctrl)
-		backendMock.EXPECT().Commit(*proposal.ProposalBlock, gomock.Any()).Return(nil)
+		backendMock.EXPECT().Commit(proposal.ProposalBlock, gomock.Any()).Return(nil)
 
 		c := &core{
 			address:           addr,
@@ -294,6 +297,7 @@ func TestHandlePrecommit(t *testing.T) {
 			logger:            logger,
 			valSet:            new(validatorSet),
 			precommitTimeout:  newTimeout(precommit, logger),
+			commitTimeout:     newTimeout(precommitDone, logger),
 		}
 
 		err = c.handlePrecommit(context.Background(), expectedMsg)
@@ -355,6 +359,7 @@ func TestHandlePrecommit(t *testing.T) {
 			logger:            logger,
 			valSet:            new(validatorSet),
 			precommitTimeout:  newTimeout(precommit, logger),
+			commitTimeout:     newTimeout(precommitDone, logger),
 		}
 
 		ctx, cancel := context.WithCancel(context.Background())
@@ -409,7 +414,9 @@ func TestHandlePrecommit(t *testing.T) {
 			logger:            logger,
 			valSet:            new(validatorSet),
 			precommitTimeout:  newTimeout(precommit, logger),
+			commitTimeout:     newTimeout(precommitDone, logger),
 		}
+		defer c.precommitTimeout.stopTimer()
 
 		err = c.handlePrecommit(context.Background(), expectedMsg)
 		if err != nil {
@@ -497,7 +504,7 @@ func TestHandleCommit(t *testing.T) {
 	valSet.EXPECT().CalcProposer(addr, uint64(0))
 	valSet.EXPECT().IsProposer(addr).Return(false)
 
-	backendMock.EXPECT().Validators(uint64(1)).Return(valSet)
+	backendMock.EXPECT().Validators(uint64(1)).Return(valSet, nil)
 
 	c := &core{
 		address:           addr,
@@ -507,7 +514,169 @@ func TestHandleCommit(t *testing.T) {
 		proposeTimeout:    newTimeout(propose, logger),
 		prevoteTimeout:    newTimeout(prevote, logger),
 		precommitTimeout:  newTimeout(precommit, logger),
+		commitTimeout:     newTimeout(precommitDone, logger),
 		valSet:            new(validatorSet),
 	}
 	c.handleCommit(context.Background())
 }
+
+func TestHandlePrecommitCommitTimeout(t *testing.T) {
+	logger := log.New("backend", "test", "id", 0)
+	validators, keysMap := newTestValidatorSetWithKeys(4)
+	block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(3)})
+
+	precommitFrom := func(val validator.Validator) *Message {
+		encodedVote, err := Encode(&Vote{Round: big.NewInt(2), Height: big.NewInt(3), ProposedBlockHash: block.Hash()})
+		if err != nil {
+			t.Fatalf("Expected nil, got %v", err)
+		}
+		seal, err := crypto.Sign(crypto.Keccak256(PrepareCommittedSeal(block.Hash())), keysMap[val.Address()])
+		if err != nil {
+			t.Fatalf("Expected nil, got %v", err)
+		}
+		return &Message{Code: msgPrecommit, Msg: encodedVote, Address: val.Address(), CommittedSeal: seal}
+	}
+
+	// run handles the precommits of the first n validators and returns the number of seals first committed
+	run := func(cfg *config.Config, n int) int {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		curRoundState := NewRoundState(big.NewInt(2), big.NewInt(3))
+		curRoundState.SetProposal(NewProposal(big.NewInt(2), big.NewInt(3), big.NewInt(-1), block, logger), nil)
+		curRoundState.SetStep(precommit)
+
+		timeouts := make(chan TimeoutEvent, 1)
+		var seals [][]byte
+		backendMock := NewMockBackend(ctrl)
+		backendMock.EXPECT().Post(gomock.Any()).AnyTimes().Do(func(ev interface{}) {
+			timeouts <- ev.(TimeoutEvent)
+		})
+		// the precommits received once committed commit again, the backend ignoring it, only the first commit counts
+		backendMock.EXPECT().Commit(block, gomock.Any()).MinTimes(1).Do(func(_ Value, committed [][]byte) {
+			if seals == nil {
+				seals = committed
+			}
+		})
+
+		c := &core{
+			backend:           backendMock,
+			config:            cfg,
+			currentRoundState: curRoundState,
+			logger:            logger,
+			valSet:            &validatorSet{Set: validators},
+			precommitTimeout:  newTimeout(precommit, logger),
+			commitTimeout:     newTimeout(precommitDone, logger),
+		}
+
+		for i, val := range validators.List()[:n] {
+			if err := c.handlePrecommit(context.Background(), precommitFrom(val)); err != nil {
+				t.Fatalf("precommit %d: expected nil, got %v", i, err)
+			}
+		}
+		if c.currentRoundState.Step() != precommitDone {
+			if seals != nil {
+				t.Fatalf("committed before the commit timeout")
+			}
+			select {
+			case ev := <-timeouts:
+				c.handleTimeoutCommit(context.Background(), ev)
+			case <-time.After(2 * time.Second):
+				t.Fatalf("commit timeout not triggered")
+			}
+		}
+		if c.currentRoundState.Step() != precommitDone {
+			t.Fatalf("have step %v, want %v", c.currentRoundState.Step(), precommitDone)
+		}
+		return len(seals)
+	}
+
+	// the block is committed with the quorum of seals at once by default
+	if have := run(&config.Config{}, 4); have != 3 {
+		t.Fatalf("have %d seals, want 3", have)
+	}
+	// the precommits received until the commit timeout expires are included
+	if have := run(&config.Config{CommitTimeout: 50}, 3); have != 3 {
+		t.Fatalf("have %d seals, want 3", have)
+	}
+	// there is no need to wait once every validator precommitted
+	if have := run(&config.Config{CommitTimeout: 60000}, 4); have != 4 {
+		t.Fatalf("have %d seals, want 4", have)
+	}
+}
+
+func TestHandleTimeoutCommitAfterRoundChange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	logger := log.New("backend", "test", "id", 0)
+	validators, keysMap := newTestValidatorSetWithKeys(4)
+	lastBlock := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(2)})
+	block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(3)})
+
+	curRoundState := NewRoundState(big.NewInt(2), big.NewInt(3))
+	curRoundState.SetProposal(NewProposal(big.NewInt(2), big.NewInt(3), big.NewInt(-1), block, logger), nil)
+	curRoundState.SetStep(precommit)
+
+	timeouts := make(chan TimeoutEvent, 1)
+	var seals [][]byte
+	backendMock := NewMockBackend(ctrl)
+	backendMock.EXPECT().Post(gomock.Any()).AnyTimes().Do(func(ev interface{}) {
+		if e, ok := ev.(TimeoutEvent); ok && e.step == commitTimeoutStep {
+			timeouts <- e
+		}
+	})
+	backendMock.EXPECT().LastCommittedProposal().Return(lastBlock, common.Address{})
+	backendMock.EXPECT().Commit(block, gomock.Any()).Do(func(_ Value, committed [][]byte) {
+		seals = committed
+	})
+
+	c := &core{
+		backend:                      backendMock,
+		config:                       &config.Config{CommitTimeout: 50},
+		currentRoundState:            curRoundState,
+		currentHeightOldRoundsStates: make(map[int64]*roundState),
+		futureRoundsChange:           make(map[int64]int64),
+		lockedRound:                  big.NewInt(-1),
+		validRound:                   big.NewInt(-1),
+		backlogs:                     make(map[validator.Validator]*prque.Prque),
+		logger:                       logger,
+		valSet:                       &validatorSet{Set: validators},
+		proposeTimeout:               newTimeout(propose, logger),
+		prevoteTimeout:               newTimeout(prevote, logger),
+		precommitTimeout:             newTimeout(precommit, logger),
+		commitTimeout:                newTimeout(precommitDone, logger),
+	}
+	defer c.proposeTimeout.stopTimer()
+
+	for i, val := range validators.List()[:3] {
+		encodedVote, err := Encode(&Vote{Round: big.NewInt(2), Height: big.NewInt(3), ProposedBlockHash: block.Hash()})
+		if err != nil {
+			t.Fatalf("Expected nil, got %v", err)
+		}
+		seal, err := crypto.Sign(crypto.Keccak256(PrepareCommittedSeal(block.Hash())), keysMap[val.Address()])
+		if err != nil {
+			t.Fatalf("Expected nil, got %v", err)
+		}
+		msg := &Message{Code: msgPrecommit, Msg: encodedVote, Address: val.Address(), CommittedSeal: seal}
+		if err := c.handlePrecommit(context.Background(), msg); err != nil {
+			t.Fatalf("precommit %d: expected nil, got %v", i, err)
+		}
+	}
+
+	// the node moves to the next round of the height before the commit timeout expires
+	c.startRound(context.Background(), big.NewInt(3))
+
+	select {
+	case ev := <-timeouts:
+		c.handleTimeoutCommit(context.Background(), ev)
+	case <-time.After(2 * time.Second):
+		t.Fatalf("commit timeout not triggered")
+	}
+	if len(seals) != 3 {
+		t.Fatalf("have %d seals, want 3", len(seals))
+	}
+	if c.currentRoundState.Step() != precommitDone {
+		t.Fatalf("have step %v, want %v", c.currentRoundState.Step(), precommitDone)
+	}
+}
@@ -24,7 +24,7 @@ import (
 )
 
 func (c *core) sendPrevote(ctx context.Context, isNil bool) {
-	logger := c.logger.New("step", c.currentRoundState.Step())
+	logger := c.roundLogger()
 
 	var prevote = Vote{
 		Round:  big.NewInt(c.currentRoundState.Round().Int64()),
@@ -35,7 +35,7 @@ func (c *core) sendPrevote(ctx context.Context, isNil bool) {
 		prevote.ProposedBlockHash = common.Hash{}
 	} else {
 		if h := c.currentRoundState.GetCurrentProposalHash(); h == (common.Hash{}) {
-			c.logger.Error("sendPrecommit Proposal is empty! It should not be empty!")
+			logger.Error("sendPrevote Proposal is empty! It should not be empty!")
 			return
 		}
 		prevote.ProposedBlockHash = c.currentRoundState.GetCurrentProposalHash()
@@ -73,6 +73,10 @@ func (c *core) handlePrevote(ctx context.Context, msg *Message) error {
 			defer c.currentHeightOldRoundsStatesMu.Unlock()
 			oldRoundState, ok := c.currentHeightOldRoundsStates[preVote.Round.Int64()]
 			if !ok {
+				if !c.isOldRoundRetained(preVote.Round.Int64(), c.currentRoundState.Round().Int64()) {
+					// the round is too old for its state to be kept
+					return err
+				}
 				oldRoundState = NewRoundState(
 					big.NewInt(preVote.Round.Int64()),
 					big.NewInt(c.currentRoundState.Height().Int64()),
@@ -105,32 +109,37 @@ func (c *core) handlePrevote(ctx context.Context, msg *Message) error {
 			if err := c.prevoteTimeout.stopTimer(); err != nil {
 				return err
 			}
-			c.logger.Debug("Stopped Scheduled Prevote Timeout")
+			c.roundLogger().Debug("Stopped Scheduled Prevote Timeout")
 
 			if c.currentRoundState.Step() == prevote {
+				c.valuesMu.Lock()
 				c.lockedValue = c.currentRoundState.Proposal().ProposalBlock
 				c.lockedRound = big.NewInt(curR)
+				c.valuesMu.Unlock()
 				c.sendPrecommit(ctx, false)
 				c.setStep(precommit)
 			}
+			c.valuesMu.Lock()
 			c.validValue = c.currentRoundState.Proposal().ProposalBlock
 			c.validRound = big.NewInt(curR)
+			c.valuesMu.Unlock()
 			c.setValidRoundAndValue = true
+			c.saveLockState()
 			// Line 44 in Algorithm 1 of The latest gossip on BFT consensus
 		} else if c.currentRoundState.Step() == prevote && c.Quorum(c.currentRoundState.Prevotes.NilVotesSize()) {
 			if err := c.prevoteTimeout.stopTimer(); err != nil {
 				return err
 			}
-			c.logger.Debug("Stopped Scheduled Prevote Timeout")
+			c.roundLogger().Debug("Stopped Scheduled Prevote Timeout")
 
 			c.sendPrecommit(ctx, true)
 			c.setStep(precommit)
 
 			// Line 34 in Algorithm 1 of The latest gossip on BFT consensus
 		} else if c.currentRoundState.Step() == prevote && !c.prevoteTimeout.timerStarted() && !c.sentPrecommit && c.Quorum(c.currentRoundState.Prevotes.TotalSize()) {
-			timeoutDuration := timeoutPrevote(curR)
+			timeoutDuration := c.timeoutPrevote(curR)
 			c.prevoteTimeout.scheduleTimeout(timeoutDuration, curR, curH, c.onTimeoutPrevote)
-			c.logger.Debug("Scheduled Prevote Timeout", "Timeout Duration", timeoutDuration)
+			c.roundLogger().Debug("Scheduled Prevote Timeout", "Timeout Duration", timeoutDuration)
 		}
 	}
 
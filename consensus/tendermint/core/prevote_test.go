@@ -9,8 +9,10 @@ import (
 	"github.com/golang/mock/gomock"
 
 	"github.com/clearmatics/autonity/common"
+	"github.com/clearmatics/autonity/consensus/tendermint/events"
 	"github.com/clearmatics/autonity/core/types"
 	"github.com/clearmatics/autonity/log"
+	"github.com/clearmatics/autonity/rlp"
 )
 
 func TestSendPrevote(t *testing.T) {
@@ -152,6 +154,8 @@ func TestHandlePrevote(t *testing.T) {
 			address:                      addr,
 			currentRoundState:            curRoundState,
 			currentHeightOldRoundsStates: make(map[int64]*roundState),
+			lockedRound:                  big.NewInt(-1),
+			validRound:                   big.NewInt(-1),
 			logger:                       log.New("backend", "test", "id", 0),
 			valSet:                       new(validatorSet),
 		}
@@ -291,6 +295,7 @@ func TestHandlePrevote(t *testing.T) {
 		}
 
 		backendMock.EXPECT().Broadcast(context.Background(), gomock.Any(), payload)
+		backendMock.EXPECT().SaveLockState(gomock.Any()).Return(nil)
 
 		c := &core{
 			address:           addr,
@@ -434,6 +439,7 @@ func TestHandlePrevote(t *testing.T) {
 		c := New(backendMock, nil)
 		c.currentRoundState = curRoundState
 		c.prevoteTimeout = newTimeout(prevote, logger)
+		defer c.prevoteTimeout.stopTimer()
 		c.valSet = &validatorSet{
 			Set: newTestValidatorSet(2),
 		}
@@ -444,3 +450,71 @@ func TestHandlePrevote(t *testing.T) {
 		}
 	})
 }
+
+func TestHandlePrevoteDoubleVote(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sender := common.HexToAddress("0x0123456789")
+	prevoteMsg := func(hash common.Hash) *Message {
+		encoded, err := rlp.EncodeToBytes(&Vote{Round: big.NewInt(1), Height: big.NewInt(2), ProposedBlockHash: hash})
+		if err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		return &Message{Code: msgPrevote, Msg: encoded, Address: sender, Signature: []byte{0x1}}
+	}
+	blockA, blockB := common.BytesToHash([]byte{0xa}), common.BytesToHash([]byte{0xb})
+
+	var posted []events.DoubleVoteEvent
+	backendMock := NewMockBackend(ctrl)
+	backendMock.EXPECT().Post(gomock.Any()).Times(2).Do(func(ev interface{}) {
+		posted = append(posted, ev.(events.DoubleVoteEvent))
+	})
+	backendMock.EXPECT().StoreEvidence("prevote", big.NewInt(2), int64(1), sender, gomock.Any(), gomock.Any()).Times(2)
+
+	// the prevotes are for an old round, they are only accepted in its state
+	c := &core{
+		backend:                      backendMock,
+		currentRoundState:            NewRoundState(big.NewInt(2), big.NewInt(2)),
+		currentHeightOldRoundsStates: make(map[int64]*roundState),
+		lockedRound:                  big.NewInt(-1),
+		validRound:                   big.NewInt(-1),
+		logger:                       log.New("backend", "test", "id", 0),
+	}
+	for _, msg := range []*Message{prevoteMsg(blockA), prevoteMsg(blockA), prevoteMsg(blockB), prevoteMsg(common.Hash{})} {
+		if err := c.handlePrevote(context.Background(), msg); err != errOldRoundMessage {
+			t.Fatalf("Expected %v, got %v", errOldRoundMessage, err)
+		}
+	}
+
+	// the repeated vote isn't a double vote, the vote for another block and the nil vote are
+	if len(posted) != 2 {
+		t.Fatalf("have %d events, want 2", len(posted))
+	}
+	if !reflect.DeepEqual(c.DoubleVotes(), posted) {
+		t.Fatalf("have evidence %v, want %v", c.DoubleVotes(), posted)
+	}
+	first, err := prevoteMsg(blockA).Payload()
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	for i, hash := range []common.Hash{blockB, {}} {
+		second, err := prevoteMsg(hash).Payload()
+		if err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		ev := posted[i]
+		if ev.Validator != sender || ev.Step != prevote.String() || ev.Height.Cmp(big.NewInt(2)) != 0 || ev.Round != 1 {
+			t.Fatalf("event %d: have %v from %v, want prevote 2/1 from %v", i, ev, ev.Validator, sender)
+		}
+		if !reflect.DeepEqual(ev.First, first) || !reflect.DeepEqual(ev.Second, second) {
+			t.Fatalf("event %d: have other evidence", i)
+		}
+	}
+
+	// only the first vote is counted
+	rs := c.currentHeightOldRoundsStates[1]
+	if rs.Prevotes.VotesSize(blockA) != 1 || rs.Prevotes.VotesSize(blockB) != 0 || rs.Prevotes.NilVotesSize() != 0 {
+		t.Fatalf("have %d/%d/%d votes, want 1/0/0", rs.Prevotes.VotesSize(blockA), rs.Prevotes.VotesSize(blockB), rs.Prevotes.NilVotesSize())
+	}
+}
@@ -22,18 +22,20 @@ import (
 	"time"
 
 	"github.com/clearmatics/autonity/consensus"
-	"github.com/clearmatics/autonity/core/types"
 )
 
-func (c *core) sendProposal(ctx context.Context, p *types.Block) {
-	logger := c.logger.New("step", c.currentRoundState.Step())
+// prunedAncestorRetryDelay is the delay before verifying again a proposal whose parent state isn't available
+const prunedAncestorRetryDelay = 500 * time.Millisecond
+
+func (c *core) sendProposal(ctx context.Context, p Value) {
+	logger := c.roundLogger()
 
 	// If I'm the proposer and I have the same height with the proposal
 	if c.currentRoundState.Height().Int64() == p.Number().Int64() && c.isProposer() && !c.sentProposal {
 		proposalBlock := NewProposal(c.currentRoundState.Round(), c.currentRoundState.Height(), c.validRound, p, c.logger)
 		proposal, err := Encode(proposalBlock)
 		if err != nil {
-			logger.Error("Failed to encode", "Round", proposalBlock.Round, "Height", proposalBlock.Height, "ValidRound", c.validRound)
+			logger.Error("Failed to encode", "ValidRound", c.validRound)
 			return
 		}
 
@@ -66,33 +68,36 @@ func (c *core) handleProposal(ctx context.Context, msg *Message) error {
 
 	// Check if the message comes from currentRoundState proposer
 	if !c.valSet.IsProposer(msg.Address) {
-		c.logger.Warn("Ignore proposal messages from non-proposer")
+		c.roundLogger().Warn("Ignore proposal messages from non-proposer", "from", msg.Address)
 		return errNotFromProposer
 	}
+	c.checkEquivocation(msg, &proposal)
 
 	// Verify the proposal we received
-	if duration, err := c.backend.VerifyProposal(*proposal.ProposalBlock); err != nil {
+	if duration, err := c.backend.VerifyProposal(proposal.ProposalBlock); err != nil {
+		// the state of the parent isn't available, the proposal is neither accepted nor rejected and its verification
+		// is retried until the propose timeout expires
+		if err == consensus.ErrPrunedAncestor {
+			c.roundLogger().Warn("Parent state of proposal unavailable, retrying", "hash", proposal.ProposalBlock.Hash())
+			if c.currentRoundState.Step() == propose {
+				c.retryProposal(msg, prunedAncestorRetryDelay)
+			}
+			return err
+		}
 		if timeoutErr := c.proposeTimeout.stopTimer(); timeoutErr != nil {
 			return timeoutErr
 		}
-		c.logger.Debug("Stopped Scheduled Proposal Timeout")
+		c.roundLogger().Debug("Stopped Scheduled Proposal Timeout")
 		c.sendPrevote(ctx, true)
 		// do not to accept another proposal in current round
 		c.setStep(prevote)
 
-		c.logger.Warn("Failed to verify proposal", "err", err, "duration", duration)
+		c.roundLogger().Warn("Failed to verify proposal", "err", err, "duration", duration)
 		// if it's a future block, we will handle it again after the duration
 		// TIME FIELD OF HEADER CHECKED HERE - NOT HEIGHT
 		// TODO: implement wiggle time / median time
 		if err == consensus.ErrFutureBlock {
-			c.stopFutureProposalTimer()
-			c.futureProposalTimer = time.AfterFunc(duration, func() {
-				_, sender := c.valSet.GetByAddress(msg.Address)
-				c.sendEvent(backlogEvent{
-					src: sender,
-					msg: msg,
-				})
-			})
+			c.retryProposal(msg, duration)
 		}
 		return err
 	}
@@ -102,7 +107,7 @@ func (c *core) handleProposal(ctx context.Context, msg *Message) error {
 		if err := c.proposeTimeout.stopTimer(); err != nil {
 			return err
 		}
-		c.logger.Debug("Stopped Scheduled Proposal Timeout")
+		c.roundLogger().Debug("Stopped Scheduled Proposal Timeout")
 
 		// Set the proposal for the current round
 		c.currentRoundState.SetProposal(&proposal, msg)
@@ -118,12 +123,8 @@ func (c *core) handleProposal(ctx context.Context, msg *Message) error {
 
 		// Line 22 in Algorithm 1 of The latest gossip on BFT consensus
 		if vr == -1 {
-			var voteForProposal = false
-			if c.lockedValue != nil {
-				voteForProposal = c.lockedRound.Int64() == -1 || h == c.lockedValue.Hash()
-
-			}
-			c.sendPrevote(ctx, voteForProposal)
+			voteForProposal := c.lockedValue == nil || c.lockedRound.Int64() == -1 || h == c.lockedValue.Hash()
+			c.sendPrevote(ctx, !voteForProposal)
 			c.setStep(prevote)
 			return nil
 		}
@@ -140,12 +141,8 @@ func (c *core) handleProposal(ctx context.Context, msg *Message) error {
 
 		// Line 28 in Algorithm 1 of The latest gossip on BFT consensus
 		if ok && vr < curR && c.Quorum(rs.Prevotes.VotesSize(h)) {
-			var voteForProposal = false
-			if c.lockedValue != nil {
-				voteForProposal = c.lockedRound.Int64() <= vr || h == c.lockedValue.Hash()
-
-			}
-			c.sendPrevote(ctx, voteForProposal)
+			voteForProposal := c.lockedValue == nil || c.lockedRound.Int64() <= vr || h == c.lockedValue.Hash()
+			c.sendPrevote(ctx, !voteForProposal)
 			c.setStep(prevote)
 		}
 	}
@@ -169,3 +166,15 @@ func (c *core) logProposalMessageEvent(message string, proposal Proposal, from,
 		"hash", proposal.ProposalBlock.Hash(),
 	)
 }
+
+// retryProposal handles the proposal message again after the given delay, through the backlog.
+func (c *core) retryProposal(msg *Message, delay time.Duration) {
+	c.stopFutureProposalTimer()
+	c.futureProposalTimer = time.AfterFunc(delay, func() {
+		_, sender := c.valSet.GetByAddress(msg.Address)
+		c.sendEvent(backlogEvent{
+			src: sender,
+			msg: msg,
+		})
+	})
+}
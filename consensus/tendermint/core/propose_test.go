@@ -11,9 +11,14 @@ import (
 
 	"github.com/clearmatics/autonity/common"
 	"github.com/clearmatics/autonity/consensus"
+	"github.com/clearmatics/autonity/consensus/tendermint/config"
+	tendermintCrypto "github.com/clearmatics/autonity/consensus/tendermint/crypto"
+	"github.com/clearmatics/autonity/consensus/tendermint/events"
 	"github.com/clearmatics/autonity/consensus/tendermint/validator"
 	"github.com/clearmatics/autonity/core/types"
+	"github.com/clearmatics/autonity/crypto"
 	"github.com/clearmatics/autonity/log"
+	"github.com/clearmatics/autonity/rlp"
 )
 
 func TestSendPropose(t *testing.T) {
@@ -79,6 +84,53 @@ func TestSendPropose(t *testing.T) {
 
 		c.sendProposal(context.Background(), block)
 	})
+
+	t.Run("fake value given, proposal is broadcast", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		addr := common.HexToAddress("0x0123456789")
+		value := &fakeValue{number: 1, hash: common.HexToHash("0xabcd")}
+		logger := log.New("backend", "test", "id", 0)
+
+		valSetMock := validator.NewMockSet(ctrl)
+		valSetMock.EXPECT().IsProposer(addr).Return(true).AnyTimes()
+		valSetMock.EXPECT().GetProposer()
+		valSetMock.EXPECT().Copy()
+
+		backendMock := NewMockBackend(ctrl)
+		backendMock.EXPECT().SetProposedBlockHash(value.Hash())
+		backendMock.EXPECT().Sign(gomock.Any()).Return([]byte{0x1}, nil)
+		backendMock.EXPECT().Broadcast(gomock.Any(), gomock.Any(), gomock.Any()).Do(
+			func(ctx context.Context, valSet validator.Set, payload []byte) {
+				msg := new(Message)
+				if err := rlp.DecodeBytes(payload, msg); err != nil {
+					t.Fatalf("Expected <nil>, got %v", err)
+				}
+				// Proposal decodes blocks, the fake value is decoded in a mirror of its layout
+				var proposal struct {
+					Round, Height, ValidRound, IsValidRoundNil *big.Int
+					ProposalBlock                              fakeValue
+				}
+				if err := msg.Decode(&proposal); err != nil {
+					t.Fatalf("Expected <nil>, got %v", err)
+				}
+				if got := proposal.ProposalBlock.Hash(); got != value.Hash() {
+					t.Fatalf("Expected %v, got %v", value.Hash(), got)
+				}
+			})
+
+		c := &core{
+			address:           addr,
+			backend:           backendMock,
+			currentRoundState: NewRoundState(big.NewInt(1), big.NewInt(1)),
+			logger:            logger,
+			validRound:        big.NewInt(-1),
+			valSet:            &validatorSet{Set: valSetMock},
+		}
+
+		c.sendProposal(context.Background(), value)
+	})
 }
 
 func TestHandleProposal(t *testing.T) {
@@ -268,6 +320,65 @@ func TestHandleProposal(t *testing.T) {
 		}
 	})
 
+	t.Run("parent state unavailable, verification retried", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		addr := common.HexToAddress("0x0123456789")
+		block := types.NewBlockWithHeader(&types.Header{
+			Number: big.NewInt(1),
+		})
+
+		curRoundState := NewRoundState(big.NewInt(2), big.NewInt(1))
+		logger := log.New("backend", "test", "id", 0)
+		proposal, err := Encode(NewProposal(curRoundState.Round(), curRoundState.Height(), big.NewInt(1), block, logger))
+		if err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		msg := &Message{
+			Code:          msgProposal,
+			Msg:           proposal,
+			Address:       addr,
+			CommittedSeal: []byte{},
+			Signature:     []byte{0x1},
+		}
+
+		sender := validator.NewMockValidator(ctrl)
+		valSetMock := validator.NewMockSet(ctrl)
+		valSetMock.EXPECT().IsProposer(addr).Return(true).AnyTimes()
+		valSetMock.EXPECT().GetByAddress(msg.Address).Return(1, sender).AnyTimes()
+
+		// no prevote is sent, the mock backend failing on any other call
+		retried := make(chan struct{})
+		backendMock := NewMockBackend(ctrl)
+		backendMock.EXPECT().VerifyProposal(gomock.Any()).Return(time.Duration(0), consensus.ErrPrunedAncestor)
+		backendMock.EXPECT().Post(backlogEvent{src: sender, msg: msg}).Do(func(ev interface{}) {
+			close(retried)
+		})
+
+		c := &core{
+			address:           addr,
+			backend:           backendMock,
+			currentRoundState: curRoundState,
+			logger:            logger,
+			proposeTimeout:    newTimeout(propose, logger),
+			validRound:        big.NewInt(1),
+			valSet:            &validatorSet{Set: valSetMock},
+		}
+
+		if err := c.handleProposal(context.Background(), msg); err != consensus.ErrPrunedAncestor {
+			t.Fatalf("Expected %v, got %v", consensus.ErrPrunedAncestor, err)
+		}
+		if c.currentRoundState.Step() != propose {
+			t.Fatalf("have step %v, want %v", c.currentRoundState.Step(), propose)
+		}
+		select {
+		case <-retried:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("proposal verification not retried")
+		}
+	})
+
 	t.Run("valid proposal given, no error returned", func(t *testing.T) {
 		ctrl := gomock.NewController(t)
 		defer ctrl.Finish()
@@ -309,7 +420,7 @@ func TestHandleProposal(t *testing.T) {
 		}
 
 		backendMock := NewMockBackend(ctrl)
-		backendMock.EXPECT().VerifyProposal(*decProposal.ProposalBlock)
+		backendMock.EXPECT().VerifyProposal(decProposal.ProposalBlock)
 
 		c := &core{
 			address:           addr,
@@ -402,7 +513,7 @@ func TestHandleProposal(t *testing.T) {
 		}
 
 		backendMock := NewMockBackend(ctrl)
-		backendMock.EXPECT().VerifyProposal(*decProposal.ProposalBlock)
+		backendMock.EXPECT().VerifyProposal(decProposal.ProposalBlock)
 		backendMock.EXPECT().Sign(payloadNoSig)
 		backendMock.EXPECT().Broadcast(gomock.Any(), gomock.Any(), payload)
 
@@ -411,7 +522,7 @@ func TestHandleProposal(t *testing.T) {
 			backend:           backendMock,
 			currentRoundState: curRoundState,
 			lockedValue:       types.NewBlockWithHeader(&types.Header{}),
-			lockedRound:       big.NewInt(-1),
+			lockedRound:       big.NewInt(0),
 			logger:            logger,
 			proposeTimeout:    newTimeout(propose, logger),
 			validRound:        validRound,
@@ -499,7 +610,7 @@ func TestHandleProposal(t *testing.T) {
 		}
 
 		backendMock := NewMockBackend(ctrl)
-		backendMock.EXPECT().VerifyProposal(*decProposal.ProposalBlock)
+		backendMock.EXPECT().VerifyProposal(decProposal.ProposalBlock)
 		backendMock.EXPECT().Sign(payloadNoSig)
 		backendMock.EXPECT().Broadcast(gomock.Any(), gomock.Any(), payload)
 
@@ -510,7 +621,7 @@ func TestHandleProposal(t *testing.T) {
 			currentHeightOldRoundsStates: map[int64]*roundState{
 				0: curRoundState,
 			},
-			lockedRound:    big.NewInt(-1),
+			lockedRound:    big.NewInt(1),
 			lockedValue:    types.NewBlockWithHeader(&types.Header{}),
 			logger:         logger,
 			proposeTimeout: newTimeout(propose, logger),
@@ -528,3 +639,253 @@ func TestHandleProposal(t *testing.T) {
 		}
 	})
 }
+
+func TestHandleProposalPrevote(t *testing.T) {
+	validators := newTestValidatorSet(4)
+	proposer := validators.GetProposer().Address()
+	logger := log.New("backend", "test", "id", 0)
+	block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1)})
+	otherBlock := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1), GasLimit: 1})
+
+	testCases := []struct {
+		name        string
+		validRound  int64
+		quorum      bool
+		lockedRound int64
+		lockedValue *types.Block
+		sent        bool
+		want        common.Hash
+	}{
+		// Line 22 in Algorithm 1 of The latest gossip on BFT consensus
+		{"unlocked, prevote for the proposal", -1, false, -1, nil, true, block.Hash()},
+		{"locked on the proposal, prevote for the proposal", -1, false, 1, block, true, block.Hash()},
+		{"locked on another value, nil prevote", -1, false, 1, otherBlock, true, common.Hash{}},
+		// Line 28 in Algorithm 1 of The latest gossip on BFT consensus
+		{"valid round, unlocked, prevote for the proposal", 0, true, -1, nil, true, block.Hash()},
+		{"valid round, locked from the valid round, prevote for the proposal", 0, true, 0, otherBlock, true, block.Hash()},
+		{"valid round, locked later on the proposal, prevote for the proposal", 0, true, 1, block, true, block.Hash()},
+		{"valid round, locked later on another value, nil prevote", 0, true, 1, otherBlock, true, common.Hash{}},
+		{"valid round without quorum, no prevote", 0, false, -1, nil, false, common.Hash{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			proposal, err := Encode(NewProposal(big.NewInt(2), big.NewInt(1), big.NewInt(tc.validRound), block, logger))
+			if err != nil {
+				t.Fatalf("Expected <nil>, got %v", err)
+			}
+			msg := &Message{Code: msgProposal, Msg: proposal, Address: proposer, CommittedSeal: []byte{}, Signature: []byte{0x1}}
+
+			// the prevotes of the valid round
+			validRoundState := NewRoundState(big.NewInt(0), big.NewInt(1))
+			votes := 1
+			if tc.quorum {
+				votes = 3
+			}
+			for _, val := range validators.List()[:votes] {
+				validRoundState.Prevotes.AddVote(block.Hash(), Message{Address: val.Address()})
+			}
+
+			var sent *common.Hash
+			backendMock := NewMockBackend(ctrl)
+			backendMock.EXPECT().VerifyProposal(gomock.Any()).Return(time.Duration(0), nil)
+			backendMock.EXPECT().Sign(gomock.Any()).AnyTimes()
+			backendMock.EXPECT().Broadcast(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().Do(func(_ context.Context, _ validator.Set, payload []byte) {
+				prevoteMsg := new(Message)
+				if err := rlp.DecodeBytes(payload, prevoteMsg); err != nil {
+					t.Fatalf("Expected <nil>, got %v", err)
+				}
+				var prevote Vote
+				if err := prevoteMsg.Decode(&prevote); err != nil {
+					t.Fatalf("Expected <nil>, got %v", err)
+				}
+				sent = &prevote.ProposedBlockHash
+			})
+
+			c := &core{
+				address:                      validators.GetByIndex(1).Address(),
+				backend:                      backendMock,
+				currentRoundState:            NewRoundState(big.NewInt(2), big.NewInt(1)),
+				currentHeightOldRoundsStates: map[int64]*roundState{0: validRoundState},
+				lockedRound:                  big.NewInt(tc.lockedRound),
+				lockedValue:                  tc.lockedValue,
+				logger:                       logger,
+				proposeTimeout:               newTimeout(propose, logger),
+				validRound:                   big.NewInt(-1),
+				valSet:                       &validatorSet{Set: validators},
+			}
+			if err := c.handleProposal(context.Background(), msg); err != nil {
+				t.Fatalf("Expected <nil>, got %v", err)
+			}
+
+			if (sent != nil) != tc.sent {
+				t.Fatalf("have prevote sent %v, want %v", sent != nil, tc.sent)
+			}
+			if sent != nil && *sent != tc.want {
+				t.Fatalf("have prevote %v, want %v", sent.Hex(), tc.want.Hex())
+			}
+		})
+	}
+}
+
+func TestHandleProposalEquivocation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	validators, keysMap := newTestValidatorSetWithKeys(4)
+	proposer := validators.GetProposer().Address()
+	logger := log.New("backend", "test", "id", 0)
+
+	// the node already moved to prevote, the proposals are only verified
+	curRoundState := NewRoundState(big.NewInt(1), big.NewInt(5))
+	curRoundState.SetStep(prevote)
+
+	signedProposal := func(extra string) *Message {
+		block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(5), Extra: []byte(extra)})
+		proposal, err := Encode(NewProposal(big.NewInt(1), big.NewInt(5), big.NewInt(-1), block, logger))
+		if err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		msg := &Message{Code: msgProposal, Msg: proposal, Address: proposer, CommittedSeal: []byte{}}
+		data, err := msg.PayloadNoSig()
+		if err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		if msg.Signature, err = crypto.Sign(crypto.Keccak256(data), keysMap[proposer]); err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		return msg
+	}
+	first, second := signedProposal("first"), signedProposal("second")
+
+	var posted []events.EquivocationEvent
+	backendMock := NewMockBackend(ctrl)
+	backendMock.EXPECT().VerifyProposal(gomock.Any()).AnyTimes().Return(time.Duration(0), nil)
+	backendMock.EXPECT().Post(gomock.Any()).Do(func(ev interface{}) {
+		posted = append(posted, ev.(events.EquivocationEvent))
+	})
+	var stored [][]byte
+	backendMock.EXPECT().StoreEvidence("propose", big.NewInt(5), int64(1), proposer, gomock.Any(), gomock.Any()).Do(
+		func(_ string, _ *big.Int, _ int64, _ common.Address, first, second []byte) {
+			stored = [][]byte{first, second}
+		})
+
+	c := &core{
+		backend:           backendMock,
+		currentRoundState: curRoundState,
+		logger:            logger,
+		valSet:            &validatorSet{Set: validators},
+	}
+
+	// the same proposal received twice is no equivocation
+	for _, msg := range []*Message{first, first, second} {
+		if err := c.handleProposal(context.Background(), msg); err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+	}
+
+	if len(posted) != 1 {
+		t.Fatalf("have %d events, want 1", len(posted))
+	}
+	evidence := c.Equivocations()
+	if len(evidence) != 1 || !reflect.DeepEqual(evidence[0], posted[0]) {
+		t.Fatalf("have evidence %v, want %v", evidence, posted)
+	}
+	ev := evidence[0]
+	if ev.Height.Cmp(big.NewInt(5)) != 0 || ev.Round != 1 || ev.Proposer != proposer {
+		t.Fatalf("have %v/%d from %v, want 5/1 from %v", ev.Height, ev.Round, ev.Proposer, proposer)
+	}
+	if !reflect.DeepEqual(stored, [][]byte{ev.First, ev.Second}) {
+		t.Fatalf("stored evidence mismatch")
+	}
+
+	// the evidence holds both signed proposals, which check against the validator set
+	for i, payload := range [][]byte{ev.First, ev.Second} {
+		want := []*Message{first, second}[i]
+		decoded := new(Message)
+		if _, err := decoded.FromPayload(payload, validators, tendermintCrypto.CheckValidatorSignature); err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		if !reflect.DeepEqual(decoded.Msg, want.Msg) {
+			t.Fatalf("evidence %d: have another proposal", i)
+		}
+	}
+}
+
+func TestStartRoundProposingDisabled(t *testing.T) {
+	validators := newTestValidatorSet(4)
+	lastBlock := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(0)})
+	block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1)})
+
+	// newCore returns a core whose node is the proposer of the given round of height 1
+	newCore := func(ctrl *gomock.Controller, round uint64) (*core, *MockBackend) {
+		proposers := validators.Copy()
+		proposers.CalcProposer(common.Address{}, round)
+
+		backendMock := NewMockBackend(ctrl)
+		backendMock.EXPECT().Address().Return(proposers.GetProposer().Address()).AnyTimes()
+		backendMock.EXPECT().LastCommittedProposal().Return(lastBlock, common.Address{})
+		backendMock.EXPECT().Validators(uint64(1)).Return(validators.Copy(), nil).AnyTimes()
+		backendMock.EXPECT().Post(gomock.Any()).AnyTimes()
+
+		c := New(backendMock, config.DefaultConfig())
+		c.pendingUnminedBlocks[1] = block
+		c.SetProposingEnabled(false)
+		return c, backendMock
+	}
+
+	t.Run("new block not proposed on its turn", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		// nothing is broadcast, the mock backend failing on any other call
+		c, _ := newCore(ctrl, 0)
+		c.startRound(context.Background(), big.NewInt(0))
+		defer func() { _ = c.proposeTimeout.stopTimer() }()
+
+		if c.sentProposal {
+			t.Fatalf("proposal sent with proposing disabled")
+		}
+		if !c.proposeTimeout.timerStarted() {
+			t.Fatalf("propose timeout not started")
+		}
+	})
+
+	t.Run("valid value proposed on its turn", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		c, backendMock := newCore(ctrl, 1)
+		backendMock.EXPECT().SetProposedBlockHash(block.Hash())
+		backendMock.EXPECT().Sign(gomock.Any()).Return([]byte{0x1}, nil)
+		backendMock.EXPECT().Broadcast(gomock.Any(), gomock.Any(), gomock.Any())
+
+		c.setCore(big.NewInt(0), big.NewInt(1), common.Address{})
+		c.validRound = big.NewInt(0)
+		c.validValue = block
+		c.startRound(context.Background(), big.NewInt(1))
+
+		if !c.sentProposal {
+			t.Fatalf("valid value not proposed")
+		}
+	})
+
+	t.Run("new block proposed once proposing is enabled again", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		c, backendMock := newCore(ctrl, 0)
+		backendMock.EXPECT().SetProposedBlockHash(block.Hash())
+		backendMock.EXPECT().Sign(gomock.Any()).Return([]byte{0x1}, nil)
+		backendMock.EXPECT().Broadcast(gomock.Any(), gomock.Any(), gomock.Any())
+
+		c.SetProposingEnabled(true)
+		c.startRound(context.Background(), big.NewInt(0))
+
+		if !c.sentProposal {
+			t.Fatalf("new block not proposed")
+		}
+	})
+}
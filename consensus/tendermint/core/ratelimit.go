@@ -0,0 +1,31 @@
+package core
+
+import (
+	"github.com/clearmatics/autonity/common"
+	"github.com/clearmatics/autonity/common/ratelimit"
+)
+
+const rateLimitedValidators = 256 // Number of validators whose message rate is tracked
+
+// checkMessageRate takes a token from the bucket of the validator which signed a message, whichever peer relayed it.
+// Messages of the local node are never limited, nor is anything when no message rate is configured.
+func (c *core) checkMessageRate(validator common.Address) error {
+	rate, burst := c.config.GetMessageRate()
+	if validator == c.address || rate == 0 || c.messageLimits == nil {
+		return nil
+	}
+
+	var bucket *ratelimit.Bucket
+	if b, ok := c.messageLimits.Get(validator); ok {
+		bucket = b.(*ratelimit.Bucket)
+	} else {
+		bucket = ratelimit.NewBucketWithRate(float64(rate), int64(burst))
+		c.messageLimits.Add(validator, bucket)
+	}
+
+	if bucket.TakeAvailable(1) == 0 {
+		tendermintRateLimitedMeter.Mark(1)
+		return errMessageRateExceeded
+	}
+	return nil
+}
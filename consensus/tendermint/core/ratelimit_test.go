@@ -0,0 +1,100 @@
+package core
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/clearmatics/autonity/common"
+	"github.com/clearmatics/autonity/consensus/tendermint/config"
+	"github.com/clearmatics/autonity/crypto"
+)
+
+// signedPrevote returns the payload of a prevote of the given round signed by key.
+func signedPrevote(t *testing.T, key *ecdsa.PrivateKey, round int64) []byte {
+	vote, err := Encode(&Vote{Round: big.NewInt(round), Height: big.NewInt(1)})
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	msg := &Message{Code: msgPrevote, Msg: vote, Address: crypto.PubkeyToAddress(key.PublicKey)}
+	data, err := msg.PayloadNoSig()
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	if msg.Signature, err = crypto.Sign(crypto.Keccak256(data), key); err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	payload, err := msg.Payload()
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	return payload
+}
+
+func TestHandleMsgRateLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	validators, keysMap := newTestValidatorSetWithKeys(4)
+	backendMock := NewMockBackend(ctrl)
+	local := validators.GetByIndex(0).Address()
+	backendMock.EXPECT().Address().AnyTimes().Return(local)
+
+	c := New(backendMock, &config.Config{MessageRate: 10, MessageBurst: 10})
+	c.valSet = &validatorSet{Set: validators}
+	c.currentRoundState = NewRoundState(big.NewInt(0), big.NewInt(1))
+
+	flooder := validators.GetByIndex(1).Address()
+	honest := validators.GetByIndex(2).Address()
+	relays := []common.Address{validators.GetByIndex(2).Address(), validators.GetByIndex(3).Address()}
+
+	// the flood is limited whichever peers relay it
+	dropped := 0
+	for i := 0; i < 100; i++ {
+		if err := c.handleMsg(context.Background(), relays[i%2], signedPrevote(t, keysMap[flooder], int64(i))); err == errMessageRateExceeded {
+			dropped++
+		}
+	}
+	if dropped < 89 {
+		t.Fatalf("expected the flood to be limited, %d messages dropped", dropped)
+	}
+
+	// the other validators are not affected by the flood, even when relayed by the same peers
+	if err := c.handleMsg(context.Background(), relays[0], signedPrevote(t, keysMap[honest], 0)); err == errMessageRateExceeded {
+		t.Fatalf("message of another validator dropped")
+	}
+	// neither are the messages of the local node
+	if err := c.handleMsg(context.Background(), common.Address{}, signedPrevote(t, keysMap[local], 0)); err == errMessageRateExceeded {
+		t.Fatalf("message of the local node dropped")
+	}
+
+	// the flooding validator is served again once its bucket refilled
+	time.Sleep(200 * time.Millisecond)
+	if err := c.handleMsg(context.Background(), relays[0], signedPrevote(t, keysMap[flooder], 0)); err == errMessageRateExceeded {
+		t.Fatalf("message dropped after the bucket refilled")
+	}
+}
+
+func TestHandleMsgNoRateLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	validators, keysMap := newTestValidatorSetWithKeys(4)
+	backendMock := NewMockBackend(ctrl)
+	backendMock.EXPECT().Address().AnyTimes().Return(validators.GetByIndex(0).Address())
+
+	c := New(backendMock, &config.Config{})
+	c.valSet = &validatorSet{Set: validators}
+	c.currentRoundState = NewRoundState(big.NewInt(0), big.NewInt(1))
+
+	sender := validators.GetByIndex(1).Address()
+	for i := 0; i < 100; i++ {
+		if err := c.handleMsg(context.Background(), sender, signedPrevote(t, keysMap[sender], int64(i))); err == errMessageRateExceeded {
+			t.Fatalf("message %d dropped without a configured rate", i)
+		}
+	}
+}
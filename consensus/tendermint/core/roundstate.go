@@ -60,6 +60,22 @@ func (s *roundState) Update(r *big.Int, h *big.Int) {
 	s.Precommits = newMessageSet()
 }
 
+// snapshot returns a copy of the state which shares its proposal and votes, it keeps them once the state is updated
+// to a new round.
+func (s *roundState) snapshot() *roundState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return &roundState{
+		round:       s.round,
+		height:      s.height,
+		step:        s.step,
+		proposal:    s.proposal,
+		proposalMsg: s.proposalMsg,
+		Prevotes:    s.Prevotes,
+		Precommits:  s.Precommits,
+	}
+}
+
 func (s *roundState) SetProposal(proposal *Proposal, msg *Message) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -153,3 +169,49 @@ func (s *roundState) GetMessages() []*Message {
 	result = append(result, precommitMsgs...)
 	return result
 }
+
+// VoteTally is the number of votes received for a block hash.
+type VoteTally struct {
+	Prevotes   int `json:"prevotes"`
+	Precommits int `json:"precommits"`
+}
+
+// RoundTally is a snapshot of the votes received in a round.
+type RoundTally struct {
+	Height        *big.Int                   `json:"height"`
+	Round         *big.Int                   `json:"round"`
+	Votes         map[common.Hash]*VoteTally `json:"votes"`
+	NilPrevotes   int                        `json:"nilPrevotes"`
+	NilPrecommits int                        `json:"nilPrecommits"`
+}
+
+// Tally counts the votes of the round for each block hash and the nil votes.
+func (s *roundState) Tally() *RoundTally {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tally := &RoundTally{Votes: make(map[common.Hash]*VoteTally)}
+	if s.height != nil {
+		tally.Height = new(big.Int).Set(s.height)
+	}
+	if s.round != nil {
+		tally.Round = new(big.Int).Set(s.round)
+	}
+	voteTally := func(hash common.Hash) *VoteTally {
+		if _, ok := tally.Votes[hash]; !ok {
+			tally.Votes[hash] = new(VoteTally)
+		}
+		return tally.Votes[hash]
+	}
+
+	prevotes, nilPrevotes := s.Prevotes.tally()
+	for hash, count := range prevotes {
+		voteTally(hash).Prevotes = count
+	}
+	precommits, nilPrecommits := s.Precommits.tally()
+	for hash, count := range precommits {
+		voteTally(hash).Precommits = count
+	}
+	tally.NilPrevotes, tally.NilPrecommits = nilPrevotes, nilPrecommits
+	return tally
+}
@@ -0,0 +1,132 @@
+package core
+
+import (
+	"math/big"
+
+	"github.com/clearmatics/autonity/common"
+	"github.com/clearmatics/autonity/rlp"
+)
+
+const (
+	// Number of sequences reserved at once in the database, so that the sequence isn't persisted with every message.
+	sequenceReservation = 64
+	// Number of messages a validator may send in a round. An honest one sends at most a proposal, a prevote and a
+	// precommit per round, again after each restart in the same round.
+	maxRoundSequences = 16
+)
+
+// sequenceKey identifies the round of a validator whose sequences are tracked.
+type sequenceKey struct {
+	address common.Address
+	height  uint64
+	round   int64
+}
+
+// sequenceState is the sequence reserved at a height, persisted so that a restarted node never reuses a sequence
+// it may already have sent.
+type sequenceState struct {
+	Height   *big.Int
+	Sequence uint64
+}
+
+// nextSequence returns the sequence of the next message sent at the current height, reserving more sequences in the
+// database when the reserved ones are used up.
+func (c *core) nextSequence() uint64 {
+	c.sequence++
+	if c.sequence > c.reservedSequence {
+		reserved := c.sequence + sequenceReservation - 1
+		data, err := rlp.EncodeToBytes(&sequenceState{Height: c.currentRoundState.Height(), Sequence: reserved})
+		if err != nil {
+			c.logger.Error("Failed to encode sequence", "err", err)
+		} else if err := c.backend.SaveSequence(data); err != nil {
+			c.logger.Error("Failed to save sequence", "err", err)
+		} else {
+			c.reservedSequence = reserved
+		}
+	}
+	return c.sequence
+}
+
+// restoreSequence sets the sequence of a new height, resuming after the sequences reserved before a restart at the
+// same height.
+func (c *core) restoreSequence(height *big.Int) {
+	c.sequence, c.reservedSequence = 0, 0
+	if !c.config.IsSequenced(height) {
+		return
+	}
+
+	data, err := c.backend.LoadSequence()
+	if err != nil {
+		c.logger.Error("Failed to load sequence", "err", err)
+		return
+	}
+	if len(data) == 0 {
+		return
+	}
+	state := new(sequenceState)
+	if err := rlp.DecodeBytes(data, state); err != nil {
+		c.logger.Error("Failed to decode sequence", "err", err)
+		return
+	}
+	if state.Height != nil && state.Height.Cmp(height) == 0 {
+		c.sequence, c.reservedSequence = state.Sequence, state.Sequence
+	}
+}
+
+// checkSequence rejects a message whose sequence was already received from its sender at its height, and the
+// messages whose presence or lack of sequence doesn't match their height. Only the rounds of the current and accepted
+// future heights within the future round window are tracked, the others being dropped by the view checks.
+func (c *core) checkSequence(msg *Message) error {
+	round, height, err := msg.view()
+	if err != nil || c.currentRoundState == nil || c.currentRoundState.Height() == nil {
+		// left to the handlers to reject
+		return nil
+	}
+	if c.config.IsSequenced(height) != (msg.Sequence != 0) {
+		return errInvalidSequence
+	}
+	if msg.Sequence == 0 {
+		return nil
+	}
+
+	current := c.currentRoundState.Height()
+	maxHeight := new(big.Int).Add(current, new(big.Int).SetUint64(c.config.GetFutureHeightWindow()))
+	if height.Cmp(current) < 0 || height.Cmp(maxHeight) > 0 {
+		return nil
+	}
+	// the rounds of future heights are bounded from round 0
+	maxRound := new(big.Int).SetUint64(c.config.GetFutureRoundWindow())
+	if height.Cmp(current) == 0 {
+		maxRound.Add(maxRound, c.currentRoundState.Round())
+	}
+	if round.Sign() < 0 || round.Cmp(maxRound) > 0 {
+		return nil
+	}
+
+	key := sequenceKey{address: msg.Address, height: height.Uint64(), round: round.Int64()}
+	seen := c.seenSequences[key]
+	if _, ok := seen[msg.Sequence]; ok {
+		return errReplayedMessage
+	}
+	if len(seen) >= maxRoundSequences {
+		return errTooManySequences
+	}
+	if seen == nil {
+		if c.seenSequences == nil {
+			c.seenSequences = make(map[sequenceKey]map[uint64]struct{})
+		}
+		seen = make(map[uint64]struct{})
+		c.seenSequences[key] = seen
+	}
+	seen[msg.Sequence] = struct{}{}
+	return nil
+}
+
+// pruneSequences forgets the sequences received for the heights below the given one.
+func (c *core) pruneSequences(height *big.Int) {
+	for key := range c.seenSequences {
+		if key.height < height.Uint64() {
+			delete(c.seenSequences, key)
+		}
+	}
+}
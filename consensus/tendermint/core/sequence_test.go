@@ -0,0 +1,235 @@
+package core
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/clearmatics/autonity/common"
+	"github.com/clearmatics/autonity/consensus/tendermint/config"
+	"github.com/clearmatics/autonity/core/types"
+	"github.com/clearmatics/autonity/crypto"
+	"github.com/clearmatics/autonity/log"
+	"github.com/clearmatics/autonity/rlp"
+)
+
+func TestHandleMsgReplayed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	validators, keysMap := newTestValidatorSetWithKeys(7)
+	backendMock := NewMockBackend(ctrl)
+	backendMock.EXPECT().Address().AnyTimes().Return(validators.GetByIndex(0).Address())
+
+	c := New(backendMock, &config.Config{SequenceBlock: big.NewInt(1)})
+	c.valSet = &validatorSet{Set: validators}
+	c.currentRoundState = NewRoundState(big.NewInt(0), big.NewInt(1))
+
+	sender := validators.GetByIndex(1).Address()
+	prevote := func(round int64, sequence uint64) []byte {
+		vote, err := Encode(&Vote{Round: big.NewInt(round), Height: big.NewInt(1)})
+		if err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		msg := &Message{Code: msgPrevote, Msg: vote, Address: sender, Sequence: sequence}
+		data, err := msg.PayloadNoSig()
+		if err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		if msg.Signature, err = crypto.Sign(crypto.Keccak256(data), keysMap[sender]); err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		payload, err := msg.Payload()
+		if err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		return payload
+	}
+
+	// the future round prevote is stored in the backlog
+	payload := prevote(1, 1)
+	if err := c.handleMsg(context.Background(), sender, payload); err != errFutureRoundMessage {
+		t.Fatalf("have %v, want %v", err, errFutureRoundMessage)
+	}
+
+	// the gossip caches having evicted it, the same message reaches the core again and is rejected
+	if err := c.handleMsg(context.Background(), sender, payload); err != errReplayedMessage {
+		t.Fatalf("have %v, want %v", err, errReplayedMessage)
+	}
+
+	// while the next message of the sender is not
+	if err := c.handleMsg(context.Background(), sender, prevote(1, 2)); err != errFutureRoundMessage {
+		t.Fatalf("have %v, want %v", err, errFutureRoundMessage)
+	}
+
+	// a message without sequence is rejected from the sequence block on
+	if err := c.handleMsg(context.Background(), sender, prevote(1, 0)); err != errInvalidSequence {
+		t.Fatalf("have %v, want %v", err, errInvalidSequence)
+	}
+
+	// the rounds beyond the future round window aren't tracked
+	far := new(Message)
+	if err := rlp.DecodeBytes(prevote(int64(c.config.GetFutureRoundWindow())+1, 3), far); err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	if err := c.checkSequence(far); err != nil {
+		t.Fatalf("have %v, want <nil>", err)
+	}
+	if len(c.seenSequences) != 1 {
+		t.Fatalf("have %d rounds, want 1", len(c.seenSequences))
+	}
+
+	// a validator can't send more messages in a round than an honest one ever does
+	for seq := uint64(3); seq <= maxRoundSequences+1; seq++ {
+		msg := new(Message)
+		if err := rlp.DecodeBytes(prevote(1, seq), msg); err != nil {
+			t.Fatalf("Expected <nil>, got %v", err)
+		}
+		want := error(nil)
+		if seq > maxRoundSequences {
+			want = errTooManySequences
+		}
+		if err := c.checkSequence(msg); err != want {
+			t.Fatalf("have %v, want %v", err, want)
+		}
+	}
+
+	// the sequences are forgotten once the height is over
+	c.pruneSequences(big.NewInt(2))
+	if len(c.seenSequences) != 0 {
+		t.Fatalf("have %d rounds, want 0", len(c.seenSequences))
+	}
+}
+
+func TestCheckSequenceBeforeSequenceBlock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	backendMock := NewMockBackend(ctrl)
+	backendMock.EXPECT().Address().AnyTimes().Return(common.Address{})
+
+	c := New(backendMock, &config.Config{SequenceBlock: big.NewInt(2)})
+	c.currentRoundState = NewRoundState(big.NewInt(0), big.NewInt(1))
+
+	vote, err := Encode(&Vote{Round: big.NewInt(0), Height: big.NewInt(1)})
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	if err := c.checkSequence(&Message{Code: msgPrevote, Msg: vote}); err != nil {
+		t.Fatalf("have %v, want <nil>", err)
+	}
+	if err := c.checkSequence(&Message{Code: msgPrevote, Msg: vote, Sequence: 1}); err != errInvalidSequence {
+		t.Fatalf("have %v, want %v", err, errInvalidSequence)
+	}
+	if len(c.seenSequences) != 0 {
+		t.Fatalf("have %d rounds, want 0", len(c.seenSequences))
+	}
+}
+
+func TestMessageDecodeWithoutSequence(t *testing.T) {
+	// a message encoded by a node predating the sequence
+	old, err := rlp.EncodeToBytes([]interface{}{msgPrevote, []byte{0x1}, common.HexToAddress("0x01"), []byte{0x2}, []byte{0x3}})
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	msg := new(Message)
+	if err := rlp.DecodeBytes(old, msg); err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	if msg.Code != msgPrevote || msg.Sequence != 0 || msg.Address != common.HexToAddress("0x01") {
+		t.Fatalf("unexpected message %+v", msg)
+	}
+
+	// it is encoded back identically, so that its signature still verifies
+	payload, err := msg.Payload()
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	if string(payload) != string(old) {
+		t.Fatalf("have %x, want %x", payload, old)
+	}
+
+	msg.Sequence = 5
+	if payload, err = msg.Payload(); err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	decoded := new(Message)
+	if err := rlp.DecodeBytes(payload, decoded); err != nil || decoded.Sequence != 5 {
+		t.Fatalf("have %d %v, want 5 <nil>", decoded.Sequence, err)
+	}
+
+	// an explicit zero sequence isn't canonical
+	zero, err := rlp.EncodeToBytes([]interface{}{msgPrevote, []byte{0x1}, common.Address{}, []byte{}, []byte{}, uint64(0)})
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	if err := rlp.DecodeBytes(zero, new(Message)); err != errInvalidSequence {
+		t.Fatalf("have %v, want %v", err, errInvalidSequence)
+	}
+}
+
+func TestSequenceRestart(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var saved []byte
+	backendMock := NewMockBackend(ctrl)
+	backendMock.EXPECT().Address().AnyTimes().Return(common.Address{})
+	backendMock.EXPECT().SaveSequence(gomock.Any()).AnyTimes().DoAndReturn(func(data []byte) error {
+		saved = data
+		return nil
+	})
+	backendMock.EXPECT().LoadSequence().AnyTimes().DoAndReturn(func() ([]byte, error) {
+		return saved, nil
+	})
+
+	cfg := &config.Config{SequenceBlock: big.NewInt(0)}
+	c := New(backendMock, cfg)
+	c.currentRoundState = NewRoundState(big.NewInt(0), big.NewInt(3))
+	c.restoreSequence(big.NewInt(3))
+	for i := uint64(1); i <= 3; i++ {
+		if seq := c.nextSequence(); seq != i {
+			t.Fatalf("have %d, want %d", seq, i)
+		}
+	}
+
+	// the restarted node resumes after the sequences reserved at the same height, whatever its round
+	restarted := New(backendMock, cfg)
+	restarted.currentRoundState = NewRoundState(big.NewInt(0), big.NewInt(3))
+	restarted.restoreSequence(big.NewInt(3))
+	if seq := restarted.nextSequence(); seq <= 3 {
+		t.Fatalf("have %d, want more than 3", seq)
+	}
+
+	// and starts over at a new height
+	restarted.restoreSequence(big.NewInt(4))
+	if seq := restarted.nextSequence(); seq != 1 {
+		t.Fatalf("have %d, want 1", seq)
+	}
+}
+
+func TestMessageView(t *testing.T) {
+	vote, err := Encode(&Vote{Round: big.NewInt(3), Height: big.NewInt(9)})
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	round, height, err := (&Message{Code: msgPrevote, Msg: vote}).view()
+	if err != nil || round.Int64() != 3 || height.Int64() != 9 {
+		t.Fatalf("have %v %v %v, want 3 9 <nil>", round, height, err)
+	}
+
+	proposal, err := Encode(NewProposal(big.NewInt(3), big.NewInt(9), big.NewInt(-1), types.NewBlockWithHeader(&types.Header{}), log.New()))
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	round, height, err = (&Message{Code: msgProposal, Msg: proposal}).view()
+	if err != nil || round.Int64() != 3 || height.Int64() != 9 {
+		t.Fatalf("have %v %v %v, want 3 9 <nil>", round, height, err)
+	}
+
+	if _, _, err := (&Message{Code: msgPrevote, Msg: []byte{0x01}}).view(); err == nil {
+		t.Fatalf("expected an error")
+	}
+}
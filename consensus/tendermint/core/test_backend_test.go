@@ -1,12 +1,20 @@
 package core
 
 import (
+	"context"
 	"crypto/ecdsa"
+	"math/big"
+	"sync"
+	"time"
 
 	"github.com/clearmatics/autonity/common"
+	"github.com/clearmatics/autonity/consensus"
 	"github.com/clearmatics/autonity/consensus/tendermint/config"
+	"github.com/clearmatics/autonity/consensus/tendermint/events"
 	"github.com/clearmatics/autonity/consensus/tendermint/validator"
+	"github.com/clearmatics/autonity/core/types"
 	"github.com/clearmatics/autonity/crypto"
+	"github.com/clearmatics/autonity/event"
 )
 
 type addressKeyMap map[common.Address]*ecdsa.PrivateKey
@@ -41,3 +49,227 @@ func generatePrivateKey() (*ecdsa.PrivateKey, error) {
 func getAddress() common.Address {
 	return common.HexToAddress("0x70524d664ffe731100208a0154e556f9bb679ae6")
 }
+
+// ==============================================
+//
+// testSystemBackend implements the part of the tendermint Backend used by the core during rounds, the other
+// methods panic through the nil embedded interface.
+
+type testSystemBackend struct {
+	Backend
+
+	id  uint64
+	sys *testSystem
+
+	engine  *core
+	peers   validator.Set
+	events  *event.TypeMux
+	address common.Address
+	key     *ecdsa.PrivateKey
+
+	committedMsgs []testCommittedMsgs
+	lockState     []byte
+	sequence      []byte
+	msgMutex      sync.RWMutex
+}
+
+type testCommittedMsgs struct {
+	commitProposal Value
+	committedSeals [][]byte
+}
+
+func (b *testSystemBackend) Start(ctx context.Context, chain consensus.ChainReader, currentBlock func() *types.Block, hasBadBlock func(hash common.Hash) bool) error {
+	return nil
+}
+
+func (b *testSystemBackend) Close() error {
+	return nil
+}
+
+func (b *testSystemBackend) Address() common.Address {
+	return b.address
+}
+
+func (b *testSystemBackend) Validators(number uint64) (validator.Set, error) {
+	return b.peers, nil
+}
+
+func (b *testSystemBackend) Subscribe(types ...interface{}) *event.TypeMuxSubscription {
+	return b.events.Subscribe(types...)
+}
+
+func (b *testSystemBackend) Post(ev interface{}) {
+	_ = b.events.Post(ev)
+}
+
+// Broadcast enqueues the message for all the backends of the system, including this one.
+func (b *testSystemBackend) Broadcast(ctx context.Context, valSet validator.Set, payload []byte) error {
+	b.sys.queuedMessage <- events.MessageEvent{
+		Payload: payload,
+	}
+	return nil
+}
+
+// Gossip does nothing, Broadcast already reached every backend.
+func (b *testSystemBackend) Gossip(ctx context.Context, valSet validator.Set, payload []byte) error {
+	return nil
+}
+
+func (b *testSystemBackend) Commit(proposal Value, seals [][]byte) error {
+	b.msgMutex.Lock()
+	b.committedMsgs = append(b.committedMsgs, testCommittedMsgs{
+		commitProposal: proposal,
+		committedSeals: seals,
+	})
+	b.msgMutex.Unlock()
+
+	// fake new head events
+	go b.Post(events.CommitEvent{})
+	return nil
+}
+
+func (b *testSystemBackend) VerifyProposal(proposal Value) (time.Duration, error) {
+	return 0, nil
+}
+
+func (b *testSystemBackend) Sign(data []byte) ([]byte, error) {
+	return crypto.Sign(crypto.Keccak256(data), b.key)
+}
+
+func (b *testSystemBackend) LastCommittedProposal() (*types.Block, common.Address) {
+	b.msgMutex.RLock()
+	defer b.msgMutex.RUnlock()
+	if l := len(b.committedMsgs); l > 0 {
+		if block, ok := b.committedMsgs[l-1].commitProposal.(*types.Block); ok {
+			return block, common.Address{}
+		}
+	}
+	return makeBlock(0), common.Address{}
+}
+
+func (b *testSystemBackend) committed() []testCommittedMsgs {
+	b.msgMutex.RLock()
+	defer b.msgMutex.RUnlock()
+	return append([]testCommittedMsgs{}, b.committedMsgs...)
+}
+
+func (b *testSystemBackend) SetProposedBlockHash(hash common.Hash) {}
+
+func (b *testSystemBackend) AskSync(set validator.Set, height, round *big.Int) {}
+
+func (b *testSystemBackend) HandleUnhandledMsgs(ctx context.Context) {}
+
+func (b *testSystemBackend) SaveLockState(data []byte) error {
+	b.msgMutex.Lock()
+	defer b.msgMutex.Unlock()
+	b.lockState = data
+	return nil
+}
+
+func (b *testSystemBackend) LoadLockState() ([]byte, error) {
+	b.msgMutex.RLock()
+	defer b.msgMutex.RUnlock()
+	return b.lockState, nil
+}
+
+func (b *testSystemBackend) ForgetMessage(payload []byte) {}
+
+func (b *testSystemBackend) SaveSequence(data []byte) error {
+	b.msgMutex.Lock()
+	defer b.msgMutex.Unlock()
+	b.sequence = data
+	return nil
+}
+
+func (b *testSystemBackend) LoadSequence() ([]byte, error) {
+	b.msgMutex.RLock()
+	defer b.msgMutex.RUnlock()
+	return b.sequence, nil
+}
+
+// ==============================================
+//
+// testSystem wires n backends sharing a message queue to run full rounds in process.
+
+type testSystem struct {
+	backends []*testSystemBackend
+
+	queuedMessage chan events.MessageEvent
+	quit          chan struct{}
+}
+
+func newTestSystemWithBackend(n uint64) *testSystem {
+	addrs, keys := generateValidators(int(n))
+	sys := &testSystem{
+		backends:      make([]*testSystemBackend, n),
+		queuedMessage: make(chan events.MessageEvent),
+		quit:          make(chan struct{}),
+	}
+
+	for i := uint64(0); i < n; i++ {
+		vset := validator.NewSet(addrs, config.RoundRobin)
+		address := vset.GetByIndex(i).Address()
+		backend := &testSystemBackend{
+			id:      i,
+			sys:     sys,
+			peers:   vset,
+			events:  new(event.TypeMux),
+			address: address,
+			key:     keys[address],
+		}
+		backend.engine = New(backend, config.DefaultConfig())
+		sys.backends[i] = backend
+	}
+
+	return sys
+}
+
+// listen delivers the queued messages to every backend
+func (t *testSystem) listen() {
+	for {
+		select {
+		case <-t.quit:
+			return
+		case queuedMessage := <-t.queuedMessage:
+			for _, backend := range t.backends {
+				go backend.Post(queuedMessage)
+			}
+		}
+	}
+}
+
+// Run starts the cores of the system and returns a closer function stopping them.
+func (t *testSystem) Run() func() {
+	go t.listen()
+	for _, b := range t.backends {
+		_ = b.engine.Start(context.Background(), nil, nil, nil)
+	}
+	return t.stop
+}
+
+func (t *testSystem) stop() {
+	// keep delivering messages until the cores are stopped
+	for _, b := range t.backends {
+		_ = b.engine.Stop()
+	}
+	close(t.quit)
+}
+
+// newUnminedBlock hands a block to propose at the given height to every core.
+func (t *testSystem) newUnminedBlock(height uint64) *types.Block {
+	block := makeBlock(height)
+	for _, b := range t.backends {
+		go b.Post(events.NewUnminedBlockEvent{NewUnminedBlock: *block})
+	}
+	return block
+}
+
+func makeBlock(number uint64) *types.Block {
+	return types.NewBlockWithHeader(&types.Header{
+		Number:     new(big.Int).SetUint64(number),
+		Difficulty: big.NewInt(1),
+		GasLimit:   0,
+		GasUsed:    0,
+		Time:       0,
+	})
+}
@@ -2,21 +2,18 @@ package core
 
 import (
 	"context"
+	"encoding/binary"
 	"github.com/clearmatics/autonity/common"
+	"github.com/clearmatics/autonity/consensus/tendermint/events"
 	"github.com/clearmatics/autonity/log"
 	"math/big"
+	"math/rand"
 	"sync"
 	"time"
 )
 
-const (
-	initialProposeTimeout   = 3000 * time.Millisecond
-	proposeTimeoutDelta     = 500 * time.Millisecond
-	initialPrevoteTimeout   = 1000 * time.Millisecond
-	prevoteTimeoutDelta     = 500 * time.Millisecond
-	initialPrecommitTimeout = 1000 * time.Millisecond
-	precommitTimeoutDelta   = 500 * time.Millisecond
-)
+// commitTimeoutStep is the step of the TimeoutEvent of the commit timeout, which has no message type.
+const commitTimeoutStep = msgPrecommit + 1
 
 type TimeoutEvent struct {
 	roundWhenCalled  int64
@@ -30,8 +27,10 @@ type timeout struct {
 	started bool
 	step    Step
 	// start will be refreshed on each new schedule, it is used for metric collection of tendermint timeout.
-	start  time.Time
-	logger log.Logger
+	start time.Time
+	// duration of the last schedule, reported by the timeout metrics as the step timeout actually waited for
+	duration time.Duration
+	logger   log.Logger
 	sync.Mutex
 }
 
@@ -50,11 +49,18 @@ func (t *timeout) scheduleTimeout(stepTimeout time.Duration, round int64, height
 	defer t.Unlock()
 	t.started = true
 	t.start = time.Now()
+	t.duration = stepTimeout
 	t.timer = time.AfterFunc(stepTimeout, func() {
 		runAfterTimeout(round, height)
 	})
 }
 
+func (t *timeout) scheduledDuration() time.Duration {
+	t.Lock()
+	defer t.Unlock()
+	return t.duration
+}
+
 func (t *timeout) timerStarted() bool {
 	t.Lock()
 	defer t.Unlock()
@@ -106,19 +112,19 @@ func (t *timeout) reset(s Step) {
 }
 
 /////////////// On Timeout Functions ///////////////
-func (c *core) measureMetricsOnTimeOut(step uint64, r int64) {
+
+// measureMetricsOnTimeOut reports the duration the timeout was scheduled with, it runs on the timer goroutine so the
+// duration is not computed again: the propose one is drawn with a jitter only the event loop may draw from.
+func (c *core) measureMetricsOnTimeOut(step uint64) {
 	switch step {
 	case msgProposal:
-		duration := timeoutPropose(r)
-		tendermintProposeTimer.Update(duration)
+		tendermintProposeTimer.Update(c.proposeTimeout.scheduledDuration())
 		return
 	case msgPrevote:
-		duration := timeoutPrevote(r)
-		tendermintPrevoteTimer.Update(duration)
+		tendermintPrevoteTimer.Update(c.prevoteTimeout.scheduledDuration())
 		return
 	case msgPrecommit:
-		duration := timeoutPrecommit(r)
-		tendermintPrecommitTimer.Update(duration)
+		tendermintPrecommitTimer.Update(c.precommitTimeout.scheduledDuration())
 		return
 	}
 }
@@ -130,7 +136,7 @@ func (c *core) onTimeoutPropose(r int64, h int64) {
 		step:             msgProposal,
 	}
 	c.logTimeoutEvent("TimeoutEvent(Propose): Sent", "Propose", msg)
-	c.measureMetricsOnTimeOut(msg.step, r)
+	c.measureMetricsOnTimeOut(msg.step)
 	c.sendEvent(msg)
 }
 
@@ -141,7 +147,7 @@ func (c *core) onTimeoutPrevote(r int64, h int64) {
 		step:             msgPrevote,
 	}
 	c.logTimeoutEvent("TimeoutEvent(Prevote): Sent", "Prevote", msg)
-	c.measureMetricsOnTimeOut(msg.step, r)
+	c.measureMetricsOnTimeOut(msg.step)
 	c.sendEvent(msg)
 }
 
@@ -152,16 +158,49 @@ func (c *core) onTimeoutPrecommit(r int64, h int64) {
 		step:             msgPrecommit,
 	}
 	c.logTimeoutEvent("TimeoutEvent(Precommit): Sent", "Precommit", msg)
-	c.measureMetricsOnTimeOut(msg.step, r)
+	c.measureMetricsOnTimeOut(msg.step)
 	c.sendEvent(msg)
 }
 
+func (c *core) onTimeoutCommit(r int64, h int64) {
+	msg := TimeoutEvent{
+		roundWhenCalled:  r,
+		heightWhenCalled: h,
+		step:             commitTimeoutStep,
+	}
+	c.logTimeoutEvent("TimeoutEvent(Commit): Sent", "Commit", msg)
+	c.sendEvent(msg)
+}
+
+// forceRoundChangeEvent asks the consensus goroutine to move to the next round of the given height, the outcome is
+// sent on result.
+type forceRoundChangeEvent struct {
+	height *big.Int
+	result chan error
+}
+
+// ForceRoundChange moves the core to the next round of the given height, letting operators recover from an
+// unresponsive proposer without a restart. The request is posted with the timeout events and checked against the
+// current height by the consensus goroutine, which handles it as an expired precommit timeout: the propose timeout
+// only prevotes nil and leaves the round to the other validators, while the precommit timeout starts the next round.
+func (c *core) ForceRoundChange(ctx context.Context, height *big.Int) error {
+	result := make(chan error, 1)
+	c.sendEvent(forceRoundChangeEvent{height: height, result: result})
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 /////////////// Handle Timeout Functions ///////////////
 func (c *core) handleTimeoutPropose(ctx context.Context, msg TimeoutEvent) {
 	if msg.heightWhenCalled == c.currentRoundState.Height().Int64() && msg.roundWhenCalled == c.currentRoundState.Round().Int64() && c.currentRoundState.Step() == propose {
 		c.logTimeoutEvent("TimeoutEvent(Propose): Received", "Propose", msg)
 		c.sendPrevote(ctx, true)
 		c.setStep(prevote)
+		c.reportNilVote(prevote)
 	}
 }
 
@@ -170,6 +209,7 @@ func (c *core) handleTimeoutPrevote(ctx context.Context, msg TimeoutEvent) {
 		c.logTimeoutEvent("TimeoutEvent(Prevote): Received", "Prevote", msg)
 		c.sendPrecommit(ctx, true)
 		c.setStep(precommit)
+		c.reportNilVote(precommit)
 	}
 }
 
@@ -182,18 +222,71 @@ func (c *core) handleTimeoutPrecommit(ctx context.Context, msg TimeoutEvent) {
 	}
 }
 
+func (c *core) handleForceRoundChange(ctx context.Context, e forceRoundChangeEvent) {
+	if e.height == nil || e.height.Cmp(c.currentRoundState.Height()) != 0 {
+		e.result <- errNotCurrentHeight
+		return
+	}
+	c.logger.Warn("Forcing round change", "height", e.height, "round", c.currentRoundState.Round())
+	c.handleTimeoutPrecommit(ctx, TimeoutEvent{
+		roundWhenCalled:  c.currentRoundState.Round().Int64(),
+		heightWhenCalled: e.height.Int64(),
+		step:             msgPrecommit,
+	})
+	e.result <- nil
+}
+
+// handleTimeoutCommit commits the pending decision, even if the node moved to another round of the height since the
+// quorum of precommits was reached.
+func (c *core) handleTimeoutCommit(ctx context.Context, msg TimeoutEvent) {
+	d := c.pendingDecision
+	if d != nil && d.round == msg.roundWhenCalled && msg.heightWhenCalled == c.currentRoundState.Height().Int64() && c.currentRoundState.Step() != precommitDone {
+		c.logTimeoutEvent("TimeoutEvent(Commit): Received", "Commit", msg)
+		select {
+		case <-ctx.Done():
+		default:
+			c.commitDecision(d)
+		}
+	}
+}
+
+// reportNilVote accounts for a nil vote sent on timeout expiry and hands it over to the backend for its subscribers.
+func (c *core) reportNilVote(s Step) {
+	switch s {
+	case prevote:
+		tendermintNilPrevoteCounter.Inc(1)
+	case precommit:
+		tendermintNilPrecommitCounter.Inc(1)
+	}
+	c.backend.ReportNilVote(events.NilVoteEvent{
+		Height: c.currentRoundState.Height(),
+		Round:  c.currentRoundState.Round().Int64(),
+		Step:   s.String(),
+	})
+}
+
 /////////////// Calculate Timeout Duration Functions ///////////////
 // The timeout may need to be changed depending on the Step
-func timeoutPropose(round int64) time.Duration {
-	return initialProposeTimeout + time.Duration(round)*proposeTimeoutDelta
+func (c *core) timeoutPropose(round int64) time.Duration {
+	timeout := c.config.TimeoutPropose(round)
+	if jitter := c.config.GetProposeTimeoutJitter(); jitter > 0 && c.jitter != nil {
+		timeout += time.Duration(c.jitter.Int63n(int64(jitter) + 1))
+	}
+	return timeout
+}
+
+// newJitterSource returns the source of the propose timeout jitter of the node, seeded by its address so that the
+// validators draw different jitters while each node draws the same ones from one run to another.
+func newJitterSource(address common.Address) *rand.Rand {
+	return rand.New(rand.NewSource(int64(binary.BigEndian.Uint64(address[:8]))))
 }
 
-func timeoutPrevote(round int64) time.Duration {
-	return initialPrevoteTimeout + time.Duration(round)*prevoteTimeoutDelta
+func (c *core) timeoutPrevote(round int64) time.Duration {
+	return c.config.TimeoutPrevote(round)
 }
 
-func timeoutPrecommit(round int64) time.Duration {
-	return initialPrecommitTimeout + time.Duration(round)*precommitTimeoutDelta
+func (c *core) timeoutPrecommit(round int64) time.Duration {
+	return c.config.TimeoutPrecommit(round)
 }
 
 func (c *core) logTimeoutEvent(message string, msgType string, timeout TimeoutEvent) {
@@ -3,6 +3,8 @@ package core
 import (
 	"context"
 	"github.com/clearmatics/autonity/common"
+	"github.com/clearmatics/autonity/consensus/tendermint/config"
+	"github.com/clearmatics/autonity/consensus/tendermint/events"
 	"github.com/clearmatics/autonity/consensus/tendermint/validator"
 	"github.com/clearmatics/autonity/core/types"
 	"github.com/clearmatics/autonity/log"
@@ -82,6 +84,7 @@ func TestHandleTimeoutPrevote(t *testing.T) {
 			proposeTimeout:     newTimeout(propose, logger),
 			prevoteTimeout:     newTimeout(prevote, logger),
 			precommitTimeout:   newTimeout(precommit, logger),
+			commitTimeout:      newTimeout(precommitDone, logger),
 		}
 		timeoutEvent := TimeoutEvent{
 			roundWhenCalled:  1,
@@ -110,6 +113,7 @@ func TestHandleTimeoutPrevote(t *testing.T) {
 					t.Fatalf("bad message view")
 				}
 			})
+		mockBackend.EXPECT().ReportNilVote(events.NilVoteEvent{Height: big.NewInt(2), Round: 1, Step: "precommit"})
 
 		engine.handleTimeoutPrevote(context.Background(), timeoutEvent)
 
@@ -119,6 +123,78 @@ func TestHandleTimeoutPrevote(t *testing.T) {
 	})
 }
 
+func TestHandleTimeoutPropose(t *testing.T) {
+	t.Run("on timeout received, send prevote nil and switch step", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		validators, _ := newTestValidatorSetWithKeys(4)
+		currentValidator := validators.GetByIndex(0)
+		logger := log.New("backend", "test", "id", 0)
+		currentState := NewRoundState(new(big.Int).SetUint64(1), new(big.Int).SetUint64(2))
+		currentState.SetStep(propose)
+		mockBackend := NewMockBackend(ctrl)
+		engine := core{
+			logger:             logger,
+			backend:            mockBackend,
+			address:            currentValidator.Address(),
+			backlogs:           make(map[validator.Validator]*prque.Prque),
+			currentRoundState:  currentState,
+			futureRoundsChange: make(map[int64]int64),
+			valSet:             &validatorSet{Set: validators},
+			proposeTimeout:     newTimeout(propose, logger),
+			prevoteTimeout:     newTimeout(prevote, logger),
+			precommitTimeout:   newTimeout(precommit, logger),
+			commitTimeout:      newTimeout(precommitDone, logger),
+		}
+		timeoutEvent := TimeoutEvent{
+			roundWhenCalled:  1,
+			heightWhenCalled: 2,
+			step:             msgProposal,
+		}
+		// should send prevote nil
+		mockBackend.EXPECT().Sign(gomock.Any())
+		mockBackend.EXPECT().Broadcast(gomock.Any(), gomock.Any(), gomock.Any()).Do(
+			func(ctx context.Context, valSet validator.Set, payload []byte) {
+				message := new(Message)
+				if err := rlp.DecodeBytes(payload, message); err != nil {
+					t.Fatalf("could not decode payload")
+				}
+				if message.Code != msgPrevote {
+					t.Fatalf("unexpected message code, should be prevote")
+				}
+				prevote := new(Vote)
+				if err := rlp.DecodeBytes(message.Msg, prevote); err != nil {
+					t.Fatalf("could not decode prevote")
+				}
+				if prevote.ProposedBlockHash != (common.Hash{}) {
+					t.Fatalf("not a nil vote")
+				}
+			})
+		mockBackend.EXPECT().ReportNilVote(events.NilVoteEvent{Height: big.NewInt(2), Round: 1, Step: "prevote"})
+
+		engine.handleTimeoutPropose(context.Background(), timeoutEvent)
+
+		if engine.currentRoundState.step != prevote {
+			t.Fatalf("should be prevote step now")
+		}
+	})
+
+	t.Run("timeout of a previous round is ignored", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		currentState := NewRoundState(new(big.Int).SetUint64(2), new(big.Int).SetUint64(2))
+		currentState.SetStep(propose)
+		engine := core{
+			logger:            log.New("backend", "test", "id", 0),
+			backend:           NewMockBackend(ctrl),
+			currentRoundState: currentState,
+		}
+
+		// no nil prevote is reported to the backend
+		engine.handleTimeoutPropose(context.Background(), TimeoutEvent{roundWhenCalled: 1, heightWhenCalled: 2, step: msgProposal})
+	})
+}
+
 func TestHandleTimeoutPrecommit(t *testing.T) {
 	t.Run("on timeout precommit received, start new round", func(t *testing.T) {
 		ctrl := gomock.NewController(t)
@@ -137,10 +213,13 @@ func TestHandleTimeoutPrecommit(t *testing.T) {
 			currentRoundState:            currentState,
 			currentHeightOldRoundsStates: make(map[int64]*roundState),
 			futureRoundsChange:           make(map[int64]int64),
+			lockedRound:                  big.NewInt(-1),
+			validRound:                   big.NewInt(-1),
 			valSet:                       &validatorSet{Set: validators},
 			proposeTimeout:               newTimeout(propose, logger),
 			prevoteTimeout:               newTimeout(prevote, logger),
 			precommitTimeout:             newTimeout(precommit, logger),
+			commitTimeout:                newTimeout(precommitDone, logger),
 		}
 		timeoutEvent := TimeoutEvent{
 			roundWhenCalled:  1,
@@ -166,10 +245,12 @@ func TestOnTimeoutPrevote(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 	mockBackend := NewMockBackend(ctrl)
+	logger := log.New("backend", "test", "id", 0)
 	engine := core{
 		backend:           mockBackend,
-		logger:            log.New("backend", "test", "id", 0),
+		logger:            logger,
 		currentRoundState: NewRoundState(new(big.Int).SetUint64(2), new(big.Int).SetUint64(4)),
+		prevoteTimeout:    newTimeout(prevote, logger),
 	}
 	mockBackend.EXPECT().Post(gomock.Any()).Times(1).Do(func(ev interface{}) {
 		timeoutEvent, ok := ev.(TimeoutEvent)
@@ -190,10 +271,12 @@ func TestOnTimeoutPrecommit(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 	mockBackend := NewMockBackend(ctrl)
+	logger := log.New("backend", "test", "id", 0)
 	engine := core{
 		backend:           mockBackend,
-		logger:            log.New("backend", "test", "id", 0),
+		logger:            logger,
 		currentRoundState: NewRoundState(new(big.Int).SetUint64(2), new(big.Int).SetUint64(4)),
+		precommitTimeout:  newTimeout(precommit, logger),
 	}
 	mockBackend.EXPECT().Post(gomock.Any()).Times(1).Do(func(ev interface{}) {
 		timeoutEvent, ok := ev.(TimeoutEvent)
@@ -209,3 +292,181 @@ func TestOnTimeoutPrecommit(t *testing.T) {
 	})
 	engine.onTimeoutPrecommit(2, 4)
 }
+
+func TestForceRoundChange(t *testing.T) {
+	t.Run("current height, next round started", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		validators, _ := newTestValidatorSetWithKeys(4)
+		currentValidator := validators.GetByIndex(0)
+		logger := log.New("backend", "test", "id", 0)
+		currentState := NewRoundState(new(big.Int).SetUint64(1), new(big.Int).SetUint64(2))
+		currentState.SetStep(propose)
+		mockBackend := NewMockBackend(ctrl)
+		engine := core{
+			logger:                       logger,
+			backend:                      mockBackend,
+			address:                      currentValidator.Address(),
+			backlogs:                     make(map[validator.Validator]*prque.Prque),
+			currentRoundState:            currentState,
+			currentHeightOldRoundsStates: make(map[int64]*roundState),
+			futureRoundsChange:           make(map[int64]int64),
+			lockedRound:                  big.NewInt(-1),
+			validRound:                   big.NewInt(-1),
+			valSet:                       &validatorSet{Set: validators},
+			proposeTimeout:               newTimeout(propose, logger),
+			prevoteTimeout:               newTimeout(prevote, logger),
+			precommitTimeout:             newTimeout(precommit, logger),
+			commitTimeout:                newTimeout(precommitDone, logger),
+		}
+
+		block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1)})
+		mockBackend.EXPECT().LastCommittedProposal().Return(block, currentValidator.Address())
+		// the request is handled by the consensus goroutine, played here by the event handler
+		mockBackend.EXPECT().Post(gomock.Any()).Times(1).Do(func(ev interface{}) {
+			e, ok := ev.(forceRoundChangeEvent)
+			if !ok {
+				t.Fatalf("could not cast to forceRoundChangeEvent")
+			}
+			engine.handleForceRoundChange(context.Background(), e)
+		})
+		if err := engine.ForceRoundChange(context.Background(), big.NewInt(2)); err != nil {
+			t.Fatalf("expected <nil>, got %v", err)
+		}
+
+		if engine.currentRoundState.height.Uint64() != 2 || engine.currentRoundState.round.Uint64() != 2 {
+			t.Fatalf("should be next round")
+		}
+		if engine.currentRoundState.step != propose {
+			t.Fatalf("should be propose step")
+		}
+	})
+
+	t.Run("other height, error returned", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		mockBackend := NewMockBackend(ctrl)
+		engine := core{
+			backend:           mockBackend,
+			logger:            log.New("backend", "test", "id", 0),
+			currentRoundState: NewRoundState(new(big.Int).SetUint64(1), new(big.Int).SetUint64(2)),
+		}
+		mockBackend.EXPECT().Post(gomock.Any()).Times(2).Do(func(ev interface{}) {
+			engine.handleForceRoundChange(context.Background(), ev.(forceRoundChangeEvent))
+		})
+
+		if err := engine.ForceRoundChange(context.Background(), big.NewInt(1)); err != errNotCurrentHeight {
+			t.Fatalf("expected %v, got %v", errNotCurrentHeight, err)
+		}
+		if err := engine.ForceRoundChange(context.Background(), nil); err != errNotCurrentHeight {
+			t.Fatalf("expected %v, got %v", errNotCurrentHeight, err)
+		}
+		if engine.currentRoundState.round.Uint64() != 1 {
+			t.Fatalf("round should not change")
+		}
+	})
+
+	t.Run("request not handled, context error returned", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		mockBackend := NewMockBackend(ctrl)
+		mockBackend.EXPECT().Post(gomock.Any()).Times(1)
+		engine := core{backend: mockBackend, logger: log.New("backend", "test", "id", 0)}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := engine.ForceRoundChange(ctx, big.NewInt(2)); err != context.Canceled {
+			t.Fatalf("expected %v, got %v", context.Canceled, err)
+		}
+	})
+}
+
+func TestCoreTimeoutsFromConfig(t *testing.T) {
+	c := &core{config: &config.Config{ProposeTimeout: 100, ProposeTimeoutDelta: 10, PrevoteTimeout: 50, PrecommitTimeout: 70}}
+
+	if got := c.timeoutPropose(2); got != 120*time.Millisecond {
+		t.Errorf("propose timeout: got %v, want %v", got, 120*time.Millisecond)
+	}
+	// unset deltas fall back to the default increment
+	if got := c.timeoutPrevote(2); got != 1050*time.Millisecond {
+		t.Errorf("prevote timeout: got %v, want %v", got, 1050*time.Millisecond)
+	}
+	if got := c.timeoutPrecommit(0); got != 70*time.Millisecond {
+		t.Errorf("precommit timeout: got %v, want %v", got, 70*time.Millisecond)
+	}
+}
+
+func TestTimeoutProposeJitter(t *testing.T) {
+	cfg := &config.Config{ProposeTimeout: 100, ProposeTimeoutDelta: 50, ProposeTimeoutJitter: 20}
+	addr := common.HexToAddress("0x0123456789abcdef0123")
+	c1 := &core{config: cfg, jitter: newJitterSource(addr)}
+	c2 := &core{config: cfg, jitter: newJitterSource(addr)}
+
+	jittered := false
+	for round := int64(0); round < 100; round++ {
+		base := cfg.TimeoutPropose(round)
+		got := c1.timeoutPropose(round)
+		if got < base || got > base+20*time.Millisecond {
+			t.Fatalf("round %d: propose timeout %v not within [%v, %v]", round, got, base, base+20*time.Millisecond)
+		}
+		jittered = jittered || got != base
+		// the jitter is drawn from a source seeded by the node address
+		if other := c2.timeoutPropose(round); other != got {
+			t.Fatalf("round %d: propose timeout mismatch: got %v, want %v", round, other, got)
+		}
+	}
+	if !jittered {
+		t.Fatalf("no jitter added")
+	}
+
+	// without jitter configured the base timeout is used
+	c1.config = &config.Config{ProposeTimeout: 100, ProposeTimeoutDelta: 50}
+	if got := c1.timeoutPropose(2); got != 200*time.Millisecond {
+		t.Errorf("propose timeout: got %v, want %v", got, 200*time.Millisecond)
+	}
+}
+
+func TestTimeoutProposeJitterConcurrentTimeout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	fired := make(chan TimeoutEvent)
+	backendMock := NewMockBackend(ctrl)
+	backendMock.EXPECT().Post(gomock.Any()).AnyTimes().Do(func(ev interface{}) {
+		fired <- ev.(TimeoutEvent)
+	})
+
+	logger := log.New("backend", "test", "id", 0)
+	c := &core{
+		backend:           backendMock,
+		config:            &config.Config{ProposeTimeout: 1, ProposeTimeoutDelta: 1, ProposeTimeoutJitter: 2},
+		currentRoundState: NewRoundState(big.NewInt(0), big.NewInt(1)),
+		jitter:            newJitterSource(common.HexToAddress("0x0123456789abcdef0123")),
+		logger:            logger,
+		proposeTimeout:    newTimeout(propose, logger),
+	}
+
+	for round := int64(0); round < 20; round++ {
+		scheduled := c.timeoutPropose(round)
+		c.proposeTimeout.scheduleTimeout(scheduled, round, 1, c.onTimeoutPropose)
+
+		// the event loop keeps on drawing jitters while the propose timeout fires, as it would starting new rounds
+		var ev TimeoutEvent
+	wait:
+		for {
+			select {
+			case ev = <-fired:
+				break wait
+			default:
+				c.timeoutPropose(round + 1)
+			}
+		}
+		if ev.roundWhenCalled != round || ev.step != msgProposal {
+			t.Fatalf("have timeout %+v, want propose timeout of round %d", ev, round)
+		}
+		// the metric reports the timeout which was scheduled rather than a new draw
+		if have := c.proposeTimeout.scheduledDuration(); have != scheduled {
+			t.Fatalf("round %d: have scheduled duration %v, want %v", round, have, scheduled)
+		}
+	}
+}
@@ -27,17 +27,31 @@ import (
 	"github.com/clearmatics/autonity/rlp"
 )
 
+// Value is a value the validators decide on, a *types.Block outside of tests. It mirrors istanbul.Proposal so the
+// core can be tested with lightweight values instead of full blocks.
+type Value interface {
+	// Number retrieves the height of the value.
+	Number() *big.Int
+
+	// Hash retrieves the hash of the value.
+	Hash() common.Hash
+
+	EncodeRLP(w io.Writer) error
+
+	DecodeRLP(s *rlp.Stream) error
+}
+
 type Proposal struct {
 	Round      *big.Int
 	Height     *big.Int
 	ValidRound *big.Int
 	// RLP decode sets nil to 0, so 0 = false and 1 = true
 	IsValidRoundNil *big.Int
-	ProposalBlock   *types.Block
+	ProposalBlock   Value
 	logger          log.Logger
 }
 
-func NewProposal(r *big.Int, h *big.Int, vr *big.Int, p *types.Block, logger log.Logger) *Proposal {
+func NewProposal(r *big.Int, h *big.Int, vr *big.Int, p Value, logger log.Logger) *Proposal {
 	return &Proposal{
 		Round:           r,
 		Height:          h,
@@ -95,9 +109,11 @@ func (p *Proposal) DecodeRLP(s *rlp.Stream) error {
 	p.Height = proposal.Height
 	p.ValidRound = proposal.ValidRound
 	p.IsValidRoundNil = proposal.IsValidRoundNil
-	p.ProposalBlock = proposal.ProposalBlock
+	p.ProposalBlock = nil
 
-	if proposal.ProposalBlock == nil {
+	if proposal.ProposalBlock != nil {
+		p.ProposalBlock = proposal.ProposalBlock
+	} else {
 		p.logger.Error("decode nil proposal block",
 			"height", p.Height.String(),
 			"round", p.Round.String(),
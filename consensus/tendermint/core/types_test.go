@@ -3,6 +3,7 @@ package core
 import (
 	"bytes"
 	"github.com/clearmatics/autonity/log"
+	"io"
 	"math/big"
 	"reflect"
 	"testing"
@@ -124,3 +125,29 @@ func TestVoteString(t *testing.T) {
 		t.Errorf("Vote is not stringified correctly: have %v, want %v", has, want)
 	}
 }
+
+// fakeValue is a lightweight Value standing for a block in tests.
+type fakeValue struct {
+	number uint64
+	hash   common.Hash
+}
+
+func (v *fakeValue) Number() *big.Int { return new(big.Int).SetUint64(v.number) }
+
+func (v *fakeValue) Hash() common.Hash { return v.hash }
+
+func (v *fakeValue) EncodeRLP(w io.Writer) error {
+	return rlp.Encode(w, []interface{}{v.number, v.hash})
+}
+
+func (v *fakeValue) DecodeRLP(s *rlp.Stream) error {
+	var value struct {
+		Number uint64
+		Hash   common.Hash
+	}
+	if err := s.Decode(&value); err != nil {
+		return err
+	}
+	v.number, v.hash = value.Number, value.Hash
+	return nil
+}
@@ -99,6 +99,15 @@ func (v *validatorSet) CalcProposer(lastProposer common.Address, round uint64) {
 	v.Set.CalcProposer(lastProposer, round)
 }
 
+func (v *validatorSet) ProposerAt(lastProposer common.Address, round uint64) common.Address {
+	v.RLock()
+	defer v.RUnlock()
+	if v.Set == nil {
+		return common.Address{}
+	}
+	return v.Set.ProposerAt(lastProposer, round)
+}
+
 func (v *validatorSet) IsProposer(address common.Address) bool {
 	v.RLock()
 	defer v.RUnlock()
@@ -127,3 +136,12 @@ func (v *validatorSet) RemoveValidator(address common.Address) bool {
 	}
 	return v.Set.RemoveValidator(address)
 }
+
+func (v *validatorSet) Weight(address common.Address) uint64 {
+	v.RLock()
+	defer v.RUnlock()
+	if v.Set == nil {
+		return 0
+	}
+	return v.Set.Weight(address)
+}
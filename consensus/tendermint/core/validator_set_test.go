@@ -114,6 +114,14 @@ func TestValidatorSetCalcProposerNil(t *testing.T) {
 	}
 }
 
+func TestValidatorSetProposerAtNil(t *testing.T) {
+	valSet := validatorSet{}
+	proposer := valSet.ProposerAt(common.Address{}, 0)
+	if proposer != (common.Address{}) {
+		t.Fatalf("validator set proposer expected zero address, got %v", proposer)
+	}
+}
+
 func TestValidatorSetAddValidatorNil(t *testing.T) {
 	valSet := validatorSet{}
 	res := valSet.AddValidator(common.Address{})
@@ -315,6 +323,30 @@ func TestValidatorSetCalcProposer(t *testing.T) {
 	valSet.CalcProposer(lastProposer, round)
 }
 
+func TestValidatorSetProposerAt(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	validatorSetMock := validator.NewMockSet(ctrl)
+
+	lastProposer := common.Address{}
+	lastProposer[0] = 1
+	expectedProposer := common.Address{}
+	expectedProposer[0] = 2
+	round := uint64(1)
+
+	validatorSetMock.EXPECT().
+		ProposerAt(lastProposer, round).
+		Return(expectedProposer)
+
+	valSet := validatorSet{}
+	valSet.set(validatorSetMock)
+
+	if proposer := valSet.ProposerAt(lastProposer, round); proposer != expectedProposer {
+		t.Fatalf("validator set expected proposer %v, got %v", expectedProposer, proposer)
+	}
+}
+
 func TestValidatorSetIsProposer(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -0,0 +1,50 @@
+package crypto
+
+import (
+	"github.com/clearmatics/autonity/common"
+	"github.com/clearmatics/autonity/consensus/tendermint/validator"
+	"github.com/clearmatics/autonity/core/types"
+	"github.com/clearmatics/autonity/crypto"
+	"github.com/clearmatics/autonity/log"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// SignerCache remembers the signers recovered from the most recent signatures, so that the messages gossiped
+// again by several peers are only recovered once.
+type SignerCache struct {
+	signers *lru.Cache
+}
+
+// NewSignerCache returns a cache of the signers of the size most recent signatures.
+func NewSignerCache(size int) *SignerCache {
+	signers, _ := lru.New(size)
+	return &SignerCache{signers: signers}
+}
+
+// CheckValidatorSignature is CheckValidatorSignature with the signer recovery cached. Only the recovered signer
+// is cached, it is checked against valSet on every call. A nil cache doesn't cache anything.
+func (sc *SignerCache) CheckValidatorSignature(valSet validator.Set, data []byte, sig []byte) (common.Address, error) {
+	if sc == nil {
+		return CheckValidatorSignature(valSet, data, sig)
+	}
+
+	// the data is hashed first so that the key can't be made to match another data and signature pair
+	key := crypto.Keccak256Hash(crypto.Keccak256(data), sig)
+
+	var signer common.Address
+	if cached, ok := sc.signers.Get(key); ok {
+		signer = cached.(common.Address)
+	} else {
+		var err error
+		if signer, err = types.GetSignatureAddress(data, sig); err != nil {
+			log.Error("Failed to get signer address", "err", err)
+			return common.Address{}, err
+		}
+		sc.signers.Add(key, signer)
+	}
+
+	if _, val := valSet.GetByAddress(signer); val != nil {
+		return val.Address(), nil
+	}
+	return common.Address{}, ErrUnauthorizedAddress
+}
@@ -0,0 +1,89 @@
+package crypto
+
+import (
+	"testing"
+
+	"github.com/clearmatics/autonity/common"
+	"github.com/clearmatics/autonity/consensus/tendermint/config"
+	"github.com/clearmatics/autonity/consensus/tendermint/validator"
+	"github.com/clearmatics/autonity/crypto"
+)
+
+func TestSignerCache(t *testing.T) {
+	vset, keys := newTestValidatorSet(4)
+	cache := NewSignerCache(16)
+
+	data := []byte("dummy data")
+	sig, err := crypto.Sign(crypto.Keccak256(data), keys[0])
+	if err != nil {
+		t.Fatalf("error mismatch: have %v, want nil", err)
+	}
+	want := vset.GetByIndex(0).Address()
+
+	// the signer is the same whether it is recovered or cached
+	for i := 0; i < 2; i++ {
+		addr, err := cache.CheckValidatorSignature(vset, data, sig)
+		if err != nil {
+			t.Fatalf("error mismatch: have %v, want nil", err)
+		}
+		if addr != want {
+			t.Fatalf("validator address mismatch: have %v, want %v", addr, want)
+		}
+	}
+	if cache.signers.Len() != 1 {
+		t.Fatalf("have %d cached signers, want 1", cache.signers.Len())
+	}
+
+	// the same signature over other data doesn't match the cached entry
+	other := []byte("other data")
+	if addr, err := cache.CheckValidatorSignature(vset, other, sig); err == nil && addr == want {
+		t.Fatalf("signature accepted for other data")
+	}
+
+	// the validator set is checked again on a cache hit
+	others := validator.NewSet([]common.Address{vset.GetByIndex(1).Address()}, config.RoundRobin)
+	if _, err := cache.CheckValidatorSignature(others, data, sig); err != ErrUnauthorizedAddress {
+		t.Fatalf("error mismatch: have %v, want %v", err, ErrUnauthorizedAddress)
+	}
+
+	// invalid signatures are not cached
+	size := cache.signers.Len()
+	if _, err := cache.CheckValidatorSignature(vset, data, []byte("invalid")); err == nil {
+		t.Fatalf("error mismatch: have nil, want an error")
+	}
+	if cache.signers.Len() != size {
+		t.Fatalf("have %d cached signers, want %d", cache.signers.Len(), size)
+	}
+
+	// a nil cache recovers the signer every time
+	var nilCache *SignerCache
+	if addr, err := nilCache.CheckValidatorSignature(vset, data, sig); err != nil || addr != want {
+		t.Fatalf("have %v %v, want %v nil", addr, err, want)
+	}
+}
+
+func BenchmarkCheckValidatorSignature(b *testing.B) {
+	vset, keys := newTestValidatorSet(4)
+	data := []byte("dummy data")
+	sig, err := crypto.Sign(crypto.Keccak256(data), keys[0])
+	if err != nil {
+		b.Fatalf("error mismatch: have %v, want nil", err)
+	}
+
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := CheckValidatorSignature(vset, data, sig); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("cached", func(b *testing.B) {
+		cache := NewSignerCache(16)
+		for i := 0; i < b.N; i++ {
+			if _, err := cache.CheckValidatorSignature(vset, data, sig); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
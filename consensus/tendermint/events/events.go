@@ -17,6 +17,9 @@
 package events
 
 import (
+	"math/big"
+	"time"
+
 	"github.com/clearmatics/autonity/common"
 	"github.com/clearmatics/autonity/core/types"
 )
@@ -29,6 +32,7 @@ type NewUnminedBlockEvent struct {
 // MessageEvent is posted for Istanbul engine communication
 type MessageEvent struct {
 	Payload []byte
+	Sender  common.Address // peer the message was received from, empty for the messages of the local node
 }
 
 type Poster interface {
@@ -39,6 +43,64 @@ type Poster interface {
 type CommitEvent struct {
 }
 
+// SyncEvent is posted when a peer asks for the current height messages, Height and Round are the peer's view or nil
+// if the peer did not send it.
 type SyncEvent struct {
-	Addr common.Address
+	Addr   common.Address
+	Height *big.Int
+	Round  *big.Int
+}
+
+// WhitelistChangedEvent is posted when the whitelist of a new chain head differs from the previous one
+type WhitelistChangedEvent struct {
+	Added   []string
+	Removed []string
+}
+
+// StallEvent is posted when the height didn't change for longer than the configured stall threshold
+type StallEvent struct {
+	Height  *big.Int
+	Round   int64
+	Step    string
+	Stalled time.Duration // time elapsed since the height last changed
+
+	BacklogDepth       int   // number of messages waiting in the backlogs
+	FutureRoundsChange int64 // number of messages received for future rounds
+}
+
+// NilVoteEvent is posted when the prevote or precommit timeout expires and the node votes nil
+type NilVoteEvent struct {
+	Height *big.Int
+	Round  int64
+	Step   string
+}
+
+// EquivocationEvent is posted when the proposer of a round is seen signing two proposals for different blocks,
+// First and Second are the signed messages which can be submitted as evidence.
+type EquivocationEvent struct {
+	Height   *big.Int
+	Round    int64
+	Proposer common.Address
+	First    []byte
+	Second   []byte
+}
+
+// DoubleVoteEvent is posted when a validator is seen sending two different prevotes or precommits for the same round,
+// a nil vote and a vote for a block conflicting too. First and Second are the signed messages.
+type DoubleVoteEvent struct {
+	Height    *big.Int
+	Round     int64
+	Step      string
+	Validator common.Address
+	First     []byte
+	Second    []byte
+}
+
+// EpochEvent is posted when the chain head enters a new epoch of config.Epoch blocks, Number being the head. The
+// validator set isn't only refreshed at epochs, it is read from the Autonity contract for every block, Validators is
+// the set of the block following the head.
+type EpochEvent struct {
+	Epoch      uint64
+	Number     *big.Int
+	Validators []common.Address
 }
@@ -47,6 +47,11 @@ type defaultSet struct {
 	proposer    Validator
 	validatorMu sync.RWMutex
 	selector    ProposalSelector
+
+	// proposing weights of the validators, nil if all validators weigh the same
+	weights map[common.Address]uint64
+	// height of the block proposed by the set, used to seed the stake weighted selection
+	height uint64
 }
 
 func newDefaultSet(addrs []common.Address, policy config.ProposerPolicy) *defaultSet {
@@ -67,6 +72,10 @@ func newDefaultSet(addrs []common.Address, policy config.ProposerPolicy) *defaul
 		valSet.selector = stickyProposer
 	case config.RoundRobin:
 		valSet.selector = roundRobinProposer
+	case config.StakeWeighted:
+		valSet.selector = func(set Set, _ common.Address, round uint64) Validator {
+			return stakeWeightedProposer(set, valSet.height, round)
+		}
 	default:
 		valSet.selector = roundRobinProposer
 	}
@@ -155,6 +164,16 @@ func (valSet *defaultSet) CalcProposer(lastProposer common.Address, round uint64
 	valSet.validatorMu.Unlock()
 }
 
+// ProposerAt returns the proposer CalcProposer would select without changing the proposer of the set, the zero
+// address if the set is empty.
+func (valSet *defaultSet) ProposerAt(lastProposer common.Address, round uint64) common.Address {
+	proposer := valSet.selector(valSet, lastProposer, round)
+	if proposer == nil {
+		return common.Address{}
+	}
+	return proposer.Address()
+}
+
 func (valSet *defaultSet) AddValidator(address common.Address) bool {
 	valSet.validatorMu.Lock()
 	defer valSet.validatorMu.Unlock()
@@ -178,6 +197,7 @@ func (valSet *defaultSet) RemoveValidator(address common.Address) bool {
 	for i, v := range valSet.validators {
 		if v.Address() == address {
 			valSet.validators = append(valSet.validators[:i], valSet.validators[i+1:]...)
+			delete(valSet.weights, address)
 			return true
 		}
 	}
@@ -192,7 +212,15 @@ func (valSet *defaultSet) Copy() Set {
 	for _, v := range valSet.validators {
 		addresses = append(addresses, v.Address())
 	}
-	return NewSet(addresses, valSet.policy)
+	copySet := newDefaultSet(addresses, valSet.policy)
+	copySet.height = valSet.height
+	if valSet.weights != nil {
+		copySet.weights = make(map[common.Address]uint64, len(valSet.weights))
+		for addr, weight := range valSet.weights {
+			copySet.weights[addr] = weight
+		}
+	}
+	return copySet
 }
 
 func (valSet *defaultSet) F() int { return int(math.Ceil(float64(valSet.Size())/3)) - 1 }
@@ -200,3 +228,13 @@ func (valSet *defaultSet) F() int { return int(math.Ceil(float64(valSet.Size())/
 func (valSet *defaultSet) Quorum() int { return int(math.Ceil((2 * float64(valSet.Size())) / 3.)) }
 
 func (valSet *defaultSet) Policy() config.ProposerPolicy { return valSet.policy }
+
+func (valSet *defaultSet) Weight(address common.Address) uint64 {
+	valSet.validatorMu.RLock()
+	defer valSet.validatorMu.RUnlock()
+
+	if valSet.weights == nil {
+		return 1
+	}
+	return valSet.weights[address]
+}
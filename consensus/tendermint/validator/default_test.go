@@ -221,3 +221,37 @@ func testStickyProposer(t *testing.T) {
 		t.Errorf("proposer mismatch: have %v, want %v", val, val2)
 	}
 }
+
+func TestProposerAt(t *testing.T) {
+	addrs := []common.Address{
+		common.HexToAddress(testAddress),
+		common.HexToAddress(testAddress2),
+		common.HexToAddress("0x0123456789"),
+	}
+
+	for _, policy := range []config.ProposerPolicy{config.RoundRobin, config.Sticky, config.StakeWeighted} {
+		valSet := NewWeightedSet(7, addrs, []uint64{1, 2, 3}, policy)
+		proposer := valSet.GetProposer()
+
+		for _, lastProposer := range addrs {
+			for round := uint64(0); round < 5; round++ {
+				have := valSet.ProposerAt(lastProposer, round)
+
+				// the proposer of the set is left unchanged
+				if val := valSet.GetProposer(); !reflect.DeepEqual(val, proposer) {
+					t.Fatalf("policy %v: proposer changed: have %v, want %v", policy, val, proposer)
+				}
+
+				calculated := valSet.Copy()
+				calculated.CalcProposer(lastProposer, round)
+				if want := calculated.GetProposer().Address(); have != want {
+					t.Fatalf("policy %v, round %d: proposer mismatch: have %v, want %v", policy, round, have, want)
+				}
+			}
+		}
+	}
+
+	if have := NewSet(nil, config.RoundRobin).ProposerAt(addrs[0], 0); have != (common.Address{}) {
+		t.Fatalf("proposer mismatch: have %v, want the zero address", have)
+	}
+}
@@ -0,0 +1,42 @@
+package validator
+
+import (
+	"encoding/binary"
+	"math/big"
+
+	"github.com/clearmatics/autonity/crypto"
+)
+
+// stakeWeightedProposer picks a validator with a probability proportional to its weight, seeded by the
+// height and the round so that every node computes the same proposer. The validators are walked in address
+// order, so that validators of equal weight are told apart by their address.
+func stakeWeightedProposer(valSet Set, height uint64, round uint64) Validator {
+	validators := valSet.List()
+	if len(validators) == 0 {
+		return nil
+	}
+
+	weights := make([]*big.Int, len(validators))
+	total := new(big.Int)
+	for i, val := range validators {
+		weights[i] = new(big.Int).SetUint64(valSet.Weight(val.Address()))
+		total.Add(total, weights[i])
+	}
+	if total.Sign() == 0 {
+		return valSet.GetByIndex((height + round) % uint64(len(validators)))
+	}
+
+	var seed [16]byte
+	binary.BigEndian.PutUint64(seed[:8], height)
+	binary.BigEndian.PutUint64(seed[8:], round)
+	pick := new(big.Int).SetBytes(crypto.Keccak256(seed[:]))
+	pick.Mod(pick, total)
+
+	for i, val := range validators {
+		if pick.Cmp(weights[i]) < 0 {
+			return val
+		}
+		pick.Sub(pick, weights[i])
+	}
+	return nil
+}
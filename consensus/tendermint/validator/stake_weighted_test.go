@@ -0,0 +1,138 @@
+package validator
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/clearmatics/autonity/common"
+	"github.com/clearmatics/autonity/consensus/tendermint/config"
+)
+
+func TestStakeWeightedProposerDistribution(t *testing.T) {
+	addrs := []common.Address{
+		common.BytesToAddress(bytes.Repeat([]byte{1}, common.AddressLength)),
+		common.BytesToAddress(bytes.Repeat([]byte{2}, common.AddressLength)),
+		common.BytesToAddress(bytes.Repeat([]byte{3}, common.AddressLength)),
+		common.BytesToAddress(bytes.Repeat([]byte{4}, common.AddressLength)),
+	}
+	weights := []uint64{100, 200, 300, 400}
+	const heights = 20000
+	const tolerance = 0.02
+
+	counts := make(map[common.Address]int)
+	lastProposer := common.Address{}
+	for height := uint64(1); height <= heights; height++ {
+		valSet := NewWeightedSet(height, addrs, weights, config.StakeWeighted)
+		valSet.CalcProposer(lastProposer, 0)
+		lastProposer = valSet.GetProposer().Address()
+		counts[lastProposer]++
+	}
+
+	for i, addr := range addrs {
+		have := float64(counts[addr]) / heights
+		want := float64(weights[i]) / 1000
+		if math.Abs(have-want) > tolerance {
+			t.Errorf("proposer share of %v: have %.3f, want %.3f", addr.String(), have, want)
+		}
+	}
+}
+
+func TestStakeWeightedProposerDeterministic(t *testing.T) {
+	addrs := []common.Address{
+		common.BytesToAddress(bytes.Repeat([]byte{1}, common.AddressLength)),
+		common.BytesToAddress(bytes.Repeat([]byte{2}, common.AddressLength)),
+		common.BytesToAddress(bytes.Repeat([]byte{3}, common.AddressLength)),
+	}
+	weights := []uint64{1, 5, 10}
+
+	for round := uint64(0); round < 10; round++ {
+		valSet1 := NewWeightedSet(10, addrs, weights, config.StakeWeighted)
+		valSet2 := valSet1.Copy()
+		valSet1.CalcProposer(addrs[0], round)
+		valSet2.CalcProposer(addrs[0], round)
+		if valSet1.GetProposer().Address() != valSet2.GetProposer().Address() {
+			t.Fatalf("proposer mismatch at round %d: %v != %v", round, valSet1.GetProposer(), valSet2.GetProposer())
+		}
+	}
+}
+
+func TestProposerEqualWeightsDeterministic(t *testing.T) {
+	addrs := []common.Address{
+		common.BytesToAddress(bytes.Repeat([]byte{0xa1}, common.AddressLength)),
+		common.BytesToAddress(bytes.Repeat([]byte{0x3f}, common.AddressLength)),
+		common.BytesToAddress(bytes.Repeat([]byte{0xb2}, common.AddressLength)),
+		common.BytesToAddress(bytes.Repeat([]byte{0x07}, common.AddressLength)),
+	}
+	// the same validators in another order, as another node may read them
+	shuffled := []common.Address{addrs[2], addrs[0], addrs[3], addrs[1]}
+	weights := []uint64{10, 10, 10, 10}
+
+	for _, policy := range []config.ProposerPolicy{config.RoundRobin, config.Sticky, config.StakeWeighted} {
+		for height := uint64(1); height < 5; height++ {
+			valSet1 := NewWeightedSet(height, addrs, weights, policy)
+			valSet2 := NewWeightedSet(height, shuffled, weights, policy)
+			for round := uint64(0); round < 10; round++ {
+				for _, lastProposer := range addrs {
+					valSet1.CalcProposer(lastProposer, round)
+					valSet2.CalcProposer(lastProposer, round)
+					if valSet1.GetProposer().Address() != valSet2.GetProposer().Address() {
+						t.Fatalf("policy %v, height %d, round %d: proposer mismatch: %v != %v", policy, height, round,
+							valSet1.GetProposer(), valSet2.GetProposer())
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestStakeWeightedProposerZeroWeights(t *testing.T) {
+	addrs := []common.Address{
+		common.BytesToAddress(bytes.Repeat([]byte{1}, common.AddressLength)),
+		common.BytesToAddress(bytes.Repeat([]byte{2}, common.AddressLength)),
+	}
+
+	// without stakes the selection rotates with the height and the round
+	valSet := NewWeightedSet(3, addrs, nil, config.StakeWeighted)
+	valSet.CalcProposer(addrs[0], 0)
+	if proposer := valSet.GetProposer().Address(); proposer != addrs[1] {
+		t.Errorf("proposer mismatch: have %v, want %v", proposer, addrs[1])
+	}
+	valSet.CalcProposer(addrs[0], 1)
+	if proposer := valSet.GetProposer().Address(); proposer != addrs[0] {
+		t.Errorf("proposer mismatch: have %v, want %v", proposer, addrs[0])
+	}
+
+	// a validator without stake is never selected
+	valSet = NewWeightedSet(3, addrs, []uint64{0, 1}, config.StakeWeighted)
+	for round := uint64(0); round < 20; round++ {
+		valSet.CalcProposer(addrs[1], round)
+		if proposer := valSet.GetProposer().Address(); proposer != addrs[1] {
+			t.Fatalf("proposer mismatch at round %d: have %v, want %v", round, proposer, addrs[1])
+		}
+	}
+
+	if val := stakeWeightedProposer(NewWeightedSet(1, nil, nil, config.StakeWeighted), 1, 0); val != nil {
+		t.Errorf("expected nil proposer for an empty set, got %v", val)
+	}
+}
+
+func TestWeight(t *testing.T) {
+	addrs := []common.Address{
+		common.BytesToAddress(bytes.Repeat([]byte{1}, common.AddressLength)),
+		common.BytesToAddress(bytes.Repeat([]byte{2}, common.AddressLength)),
+	}
+
+	if w := NewSet(addrs, config.RoundRobin).Weight(addrs[0]); w != 1 {
+		t.Errorf("weight mismatch: have %d, want 1", w)
+	}
+
+	valSet := NewWeightedSet(1, addrs, []uint64{7, 9}, config.StakeWeighted)
+	if w := valSet.Copy().Weight(addrs[1]); w != 9 {
+		t.Errorf("weight mismatch: have %d, want 9", w)
+	}
+	valSet.RemoveValidator(addrs[1])
+	if w := valSet.Weight(addrs[1]); w != 0 {
+		t.Errorf("weight mismatch: have %d, want 0", w)
+	}
+}
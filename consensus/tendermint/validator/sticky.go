@@ -4,6 +4,8 @@ import (
 	"github.com/clearmatics/autonity/common"
 )
 
+// stickyProposer keeps the last proposer for round 0 of the next height, the rotation only advances
+// with the rounds that failed to commit a block.
 func stickyProposer(valSet Set, proposer common.Address, round uint64) Validator {
 	size := valSet.Size()
 	if size == 0 {
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/clearmatics/autonity/common"
+	"github.com/clearmatics/autonity/consensus/tendermint/config"
 	"github.com/golang/mock/gomock"
 )
 
@@ -393,3 +394,37 @@ func TestStickyProposer(t *testing.T) {
 		})
 	}
 }
+
+func TestStickyProposerRounds(t *testing.T) {
+	addrs := []common.Address{
+		common.BytesToAddress(bytes.Repeat([]byte{1}, common.AddressLength)),
+		common.BytesToAddress(bytes.Repeat([]byte{2}, common.AddressLength)),
+		common.BytesToAddress(bytes.Repeat([]byte{3}, common.AddressLength)),
+	}
+
+	testCases := []struct {
+		name         string
+		policy       config.ProposerPolicy
+		lastProposer common.Address
+		round        uint64
+		expected     common.Address
+	}{
+		{"sticky, last proposer succeeded", config.Sticky, addrs[0], 0, addrs[0]},
+		{"sticky, one failed round", config.Sticky, addrs[0], 1, addrs[1]},
+		{"sticky, two failed rounds", config.Sticky, addrs[0], 2, addrs[2]},
+		{"sticky, failed rounds wrap around", config.Sticky, addrs[2], 1, addrs[0]},
+		{"round robin, last proposer succeeded", config.RoundRobin, addrs[0], 0, addrs[1]},
+		{"round robin, one failed round", config.RoundRobin, addrs[0], 1, addrs[2]},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			valSet := NewSet(addrs, testCase.policy)
+			valSet.CalcProposer(testCase.lastProposer, testCase.round)
+			if proposer := valSet.GetProposer().Address(); proposer != testCase.expected {
+				t.Errorf("proposer mismatch: have %v, want %v", proposer, testCase.expected)
+			}
+		})
+	}
+}
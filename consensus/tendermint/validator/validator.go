@@ -31,6 +31,20 @@ func NewSet(addrs []common.Address, policy config.ProposerPolicy) *defaultSet {
 	return newDefaultSet(addrs, policy)
 }
 
+// NewWeightedSet creates the validator set of the block at the given height where weights[i] is the
+// proposing weight of addrs[i], validators without a weight have a zero weight.
+func NewWeightedSet(height uint64, addrs []common.Address, weights []uint64, policy config.ProposerPolicy) *defaultSet {
+	valSet := newDefaultSet(addrs, policy)
+	valSet.height = height
+	valSet.weights = make(map[common.Address]uint64, len(addrs))
+	for i, addr := range addrs {
+		if i < len(weights) {
+			valSet.weights[addr] = weights[i]
+		}
+	}
+	return valSet
+}
+
 func ExtractValidators(extraData []byte) []common.Address {
 	// get the validator addresses
 	addrs := make([]common.Address, len(extraData)/common.AddressLength)
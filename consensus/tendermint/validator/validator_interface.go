@@ -39,6 +39,9 @@ func (slice Validators) Len() int {
 	return len(slice)
 }
 
+// Less orders the validators by address, the addresses being unique this is a total order: the validators of a
+// set are in the same order whatever the order they were given in, which is the tie-break every proposer
+// selection relies on.
 func (slice Validators) Less(i, j int) bool {
 	return strings.Compare(slice[i].String(), slice[j].String()) < 0
 }
@@ -52,6 +55,8 @@ func (slice Validators) Swap(i, j int) {
 type Set interface {
 	// Calculate the proposer
 	CalcProposer(lastProposer common.Address, round uint64)
+	// Return the proposer of the round following lastProposer, leaving the current proposer unchanged
+	ProposerAt(lastProposer common.Address, round uint64) common.Address
 	// Return the validator size
 	Size() int
 	// Return the validator array
@@ -76,6 +81,8 @@ type Set interface {
 	Quorum() int
 	// Get proposer policy
 	Policy() config.ProposerPolicy
+	// Get the proposing weight of the validator with given address
+	Weight(address common.Address) uint64
 }
 
 // ----------------------------------------------------------------------------
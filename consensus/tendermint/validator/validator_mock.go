@@ -97,6 +97,20 @@ func (mr *MockSetMockRecorder) CalcProposer(lastProposer, round interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CalcProposer", reflect.TypeOf((*MockSet)(nil).CalcProposer), lastProposer, round)
 }
 
+// ProposerAt mocks base method
+func (m *MockSet) ProposerAt(lastProposer common.Address, round uint64) common.Address {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ProposerAt", lastProposer, round)
+	ret0, _ := ret[0].(common.Address)
+	return ret0
+}
+
+// ProposerAt indicates an expected call of ProposerAt
+func (mr *MockSetMockRecorder) ProposerAt(lastProposer, round interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProposerAt", reflect.TypeOf((*MockSet)(nil).ProposerAt), lastProposer, round)
+}
+
 // Size mocks base method
 func (m *MockSet) Size() int {
 	m.ctrl.T.Helper()
@@ -265,3 +279,17 @@ func (mr *MockSetMockRecorder) Policy() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Policy", reflect.TypeOf((*MockSet)(nil).Policy))
 }
+
+// Weight mocks base method
+func (m *MockSet) Weight(address common.Address) uint64 {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Weight", address)
+	ret0, _ := ret[0].(uint64)
+	return ret0
+}
+
+// Weight indicates an expected call of Weight
+func (mr *MockSetMockRecorder) Weight(address interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Weight", reflect.TypeOf((*MockSet)(nil).Weight), address)
+}
@@ -2,6 +2,7 @@ package autonity
 
 import (
 	"errors"
+	"fmt"
 	"github.com/clearmatics/autonity/accounts/abi"
 	"github.com/clearmatics/autonity/common"
 	"github.com/clearmatics/autonity/consensus"
@@ -225,6 +226,42 @@ func (ac *Contract) ContractGetValidators(chain consensus.ChainReader, header *t
 	return sortableAddresses, nil
 }
 
+// ContractGetStakes returns the stake of each of the given validators, in the same order.
+func (ac *Contract) ContractGetStakes(chain consensus.ChainReader, header *types.Header, statedb *state.StateDB, validators []common.Address) ([]uint64, error) {
+	sender := vm.AccountRef(chain.Config().AutonityContractConfig.Deployer)
+	gas := uint64(0xFFFFFFFF)
+	evm := ac.getEVM(header, chain.Config().AutonityContractConfig.Deployer, statedb)
+	contractABI, err := ac.abi()
+	if err != nil {
+		return nil, err
+	}
+
+	stakes := make([]uint64, len(validators))
+	for i, addr := range validators {
+		input, err := contractABI.Pack("getAccountStake", addr)
+		if err != nil {
+			return nil, err
+		}
+
+		ret, _, vmerr := evm.StaticCall(sender, ac.Address(), input, gas)
+		if vmerr != nil {
+			return nil, vmerr
+		}
+
+		stake := new(big.Int)
+		if err := contractABI.Unpack(&stake, "getAccountStake", ret); err != nil {
+			log.Error("Could not unpack getAccountStake returned value", "err", err)
+			return nil, err
+		}
+		if !stake.IsUint64() {
+			return nil, fmt.Errorf("stake of %v overflows uint64", addr)
+		}
+		stakes[i] = stake.Uint64()
+	}
+
+	return stakes, nil
+}
+
 var ErrAutonityContract = errors.New("could not call Autonity contract")
 
 func (ac *Contract) UpdateEnodesWhitelist(state *state.StateDB, block *types.Block) error {
@@ -430,6 +467,48 @@ func (ac *Contract) ApplyPerformRedistribution(transactions types.Transactions,
 	return ac.PerformRedistribution(header, statedb, blockGas)
 }
 
+// ErrNoProposerPolicy is returned by GetProposerPolicy when the contract doesn't expose a proposer policy.
+var ErrNoProposerPolicy = errors.New("no proposer policy in Autonity contract")
+
+// GetProposerPolicy returns the proposer policy set by the governance of the contract in the given state. The
+// policy is read with the getProposerPolicy method, if the ABI of the contract has none ErrNoProposerPolicy is
+// returned.
+func (ac *Contract) GetProposerPolicy(header *types.Header, statedb *state.StateDB) (uint64, error) {
+	ABI, err := ac.abi()
+	if err != nil {
+		return 0, err
+	}
+	if _, ok := ABI.Methods["getProposerPolicy"]; !ok {
+		return 0, ErrNoProposerPolicy
+	}
+
+	deployer := ac.bc.Config().AutonityContractConfig.Deployer
+	sender := vm.AccountRef(deployer)
+	gas := uint64(0xFFFFFFFF)
+	evm := ac.getEVM(header, deployer, statedb)
+
+	input, err := ABI.Pack("getProposerPolicy")
+	if err != nil {
+		return 0, err
+	}
+
+	ret, _, vmerr := evm.StaticCall(sender, ac.Address(), input, gas)
+	if vmerr != nil {
+		log.Error("Error Autonity Contract getProposerPolicy()")
+		return 0, vmerr
+	}
+
+	policy := new(big.Int)
+	if err := ABI.Unpack(&policy, "getProposerPolicy", ret); err != nil {
+		log.Error("Could not unpack getProposerPolicy returned value", "err", err, "header.num", header.Number.Uint64())
+		return 0, err
+	}
+	if !policy.IsUint64() {
+		return 0, fmt.Errorf("proposer policy %v overflows uint64", policy)
+	}
+	return policy.Uint64(), nil
+}
+
 func (ac *Contract) Address() common.Address {
 	if reflect.DeepEqual(ac.address, common.Address{}) {
 		addr, err := ac.bc.Config().AutonityContractConfig.GetContractAddress()
@@ -35,4 +35,8 @@ var (
 
 	// ErrNoGenesis is returned when there is no Genesis Block.
 	ErrNoGenesis = errors.New("genesis not found in chain")
+
+	// ErrGasPriceBelowMinimum is returned if the gas price of a transaction is lower
+	// than the minimum gas price set in the Autonity contract.
+	ErrGasPriceBelowMinimum = errors.New("gas price must be greater minGasPrice")
 )
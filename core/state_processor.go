@@ -17,7 +17,6 @@
 package core
 
 import (
-	"errors"
 	"github.com/clearmatics/autonity/common"
 	"github.com/clearmatics/autonity/consensus"
 	"github.com/clearmatics/autonity/consensus/misc"
@@ -74,19 +73,11 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg
 		misc.ApplyDAOHardFork(statedb)
 	}
 
-	var contractMinGasPrice = new(big.Int)
-	if p.autonityContract != nil {
-		minGasPrice, err := p.autonityContract.GetMinimumGasPrice(block, statedb)
-		if err == nil {
-			contractMinGasPrice.SetUint64(minGasPrice)
-		}
-	}
+	contractMinGasPrice := MinimumGasPrice(p.autonityContract, block, statedb)
 	// Iterate over and process the individual transactions
 	for i, tx := range block.Transactions() {
-		if contractMinGasPrice.Uint64() != 0 {
-			if tx.GasPrice().Cmp(contractMinGasPrice) == -1 {
-				return nil, nil, 0, errors.New("gas price must be greater minGasPrice")
-			}
+		if err := CheckMinimumGasPrice(tx, contractMinGasPrice); err != nil {
+			return nil, nil, 0, err
 		}
 
 		statedb.Prepare(tx.Hash(), block.Hash(), i)
@@ -109,6 +100,28 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg
 	return receipts, allLogs, *usedGas, nil
 }
 
+// MinimumGasPrice returns the minimum gas price the Autonity contract enforces on the
+// transactions of block, statedb must be the state the transactions are applied to.
+// Zero means no minimum, which is also the case without contract.
+func MinimumGasPrice(contract *autonity.Contract, block *types.Block, statedb *state.StateDB) *big.Int {
+	minGasPrice := new(big.Int)
+	if contract != nil {
+		if price, err := contract.GetMinimumGasPrice(block, statedb); err == nil {
+			minGasPrice.SetUint64(price)
+		}
+	}
+	return minGasPrice
+}
+
+// CheckMinimumGasPrice returns ErrGasPriceBelowMinimum if the gas price of tx is
+// lower than a non zero minGasPrice.
+func CheckMinimumGasPrice(tx *types.Transaction, minGasPrice *big.Int) error {
+	if minGasPrice.Sign() != 0 && tx.GasPrice().Cmp(minGasPrice) < 0 {
+		return ErrGasPriceBelowMinimum
+	}
+	return nil
+}
+
 // ApplyTransaction attempts to apply a transaction to the given state database
 // and uses the input parameters for its environment. It returns the receipt
 // for the transaction, gas used and an error if the transaction failed,
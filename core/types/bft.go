@@ -38,7 +38,7 @@ var (
 	BFTExtraVanity = 32 // Fixed number of extra-data bytes reserved for validator vanity
 	BFTExtraSeal   = 65 // Fixed number of extra-data bytes reserved for validator seal
 
-	inmemoryAddresses  = 20 // Number of recent addresses from ecrecover
+	inmemoryAddresses  = 256 // Number of recent addresses from ecrecover
 	recentAddresses, _ = lru.NewARC(inmemoryAddresses)
 
 	// ErrInvalidBFTHeaderExtra is returned if the length of extra-data is less than 32 bytes
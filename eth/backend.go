@@ -166,6 +166,12 @@ func New(ctx *node.ServiceContext, config *Config, cons func(basic consensus.Eng
 
 	log.Info("Initialised chain configuration", "config", chainConfig)
 
+	if chainConfig.Tendermint != nil {
+		if err := config.Tendermint.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
 	consEngine := CreateConsensusEngine(ctx, chainConfig, config, config.Miner.Notify, config.Miner.Noverify, chainDb, &vmConfig)
 	if cons != nil {
 		consEngine = cons(consEngine)
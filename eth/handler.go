@@ -21,7 +21,6 @@ import (
 	"errors"
 	"fmt"
 	"github.com/clearmatics/autonity/core/rawdb"
-	"github.com/clearmatics/autonity/crypto"
 	"math"
 	"math/big"
 	"sync"
@@ -257,6 +256,9 @@ func (pm *ProtocolManager) removePeer(id string) {
 	if err := pm.peers.Unregister(id); err != nil {
 		log.Error("Peer removal failed", "peer", id, "err", err)
 	}
+	if pm.blockchain.Config().Tendermint != nil {
+		pm.blockchain.Engine().(consensus.Syncer).PeersChanged()
+	}
 	// Hard disconnect at the networking layer
 	if peer != nil {
 		peer.Peer.Disconnect(p2p.DiscUselessPeer)
@@ -399,8 +401,8 @@ func (pm *ProtocolManager) handle(p *peer) error {
 
 	if pm.blockchain.Config().Tendermint != nil {
 		syncer := pm.blockchain.Engine().(consensus.Syncer)
-		address := crypto.PubkeyToAddress(*p.Node().Pubkey())
-		syncer.ResetPeerCache(address)
+		syncer.ResetPeerCache(enode.AddressFromEnode(p.Node()))
+		syncer.PeersChanged()
 	}
 
 	// If we have a trusted CHT, reject all peers below that (avoid fast sync eclipse)
@@ -451,11 +453,10 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 	defer msg.Discard()
 
 	if handler, ok := pm.engine.(consensus.Handler); ok {
-		pubKey := p.Node().Pubkey()
-		if pubKey == nil {
+		addr := enode.AddressFromEnode(p.Node())
+		if addr == (common.Address{}) {
 			return errResp(ErrNoPubKeyFound, "%s", p.Node().ID().GoString())
 		}
-		addr := crypto.PubkeyToAddress(*pubKey)
 		handled, err := handler.HandleMsg(addr, msg)
 		if handled {
 			return err
@@ -918,11 +919,10 @@ func (pm *ProtocolManager) FindPeers(targets map[common.Address]struct{}) map[co
 	m := make(map[common.Address]consensus.Peer)
 
 	for _, p := range pm.peers.Peers() {
-		pubKey := p.Node().Pubkey()
-		if pubKey == nil {
+		addr := enode.AddressFromEnode(p.Node())
+		if addr == (common.Address{}) {
 			continue
 		}
-		addr := crypto.PubkeyToAddress(*pubKey)
 		if _, ok := targets[addr]; ok {
 			m[addr] = p
 		}
@@ -199,6 +199,12 @@ func (p *peer) Send(msgcode uint64, data interface{}) error {
 	return p2p.Send(p.rw, msgcode, data)
 }
 
+// SupportsCompression returns whether the negotiated protocol version carries
+// compressed consensus messages.
+func (p *peer) SupportsCompression() bool {
+	return p.version >= eth64
+}
+
 // SendTransactions sends transactions to the peer and includes the hashes
 // in its transaction hash set for future reference.
 func (p *peer) SendTransactions(txs types.Transactions) error {
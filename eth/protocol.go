@@ -32,16 +32,18 @@ import (
 const (
 	eth62 = 62
 	eth63 = 63
+	// eth64 adds the snappy compressed consensus message
+	eth64 = 64
 )
 
 // protocolName is the official short name of the protocol used during capability negotiation.
 const protocolName = "eth"
 
 // ProtocolVersions are the supported versions of the eth protocol (first is primary).
-var ProtocolVersions = []uint{eth63}
+var ProtocolVersions = []uint{eth64, eth63}
 
 // protocolLengths are the number of implemented message corresponding to different protocol versions.
-var protocolLengths = map[uint]uint64{eth63: 19, eth62: 8}
+var protocolLengths = map[uint]uint64{eth64: 20, eth63: 19, eth62: 8}
 
 // Protocol defines the protocol of the consensus
 type Protocol struct {
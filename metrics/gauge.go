@@ -26,6 +26,12 @@ func NewGauge() Gauge {
 	return &StandardGauge{0}
 }
 
+// NewGaugeForced constructs a new StandardGauge and returns it no matter if
+// the global switch is enabled or not.
+func NewGaugeForced() Gauge {
+	return &StandardGauge{0}
+}
+
 // NewRegisteredGauge constructs and registers a new StandardGauge.
 func NewRegisteredGauge(name string, r Registry) Gauge {
 	c := NewGauge()
@@ -36,6 +42,17 @@ func NewRegisteredGauge(name string, r Registry) Gauge {
 	return c
 }
 
+// NewRegisteredGaugeForced constructs and registers a new StandardGauge
+// no matter the global switch is enabled or not.
+func NewRegisteredGaugeForced(name string, r Registry) Gauge {
+	c := NewGaugeForced()
+	if nil == r {
+		r = DefaultRegistry
+	}
+	r.Register(name, c)
+	return c
+}
+
 // NewFunctionalGauge constructs a new FunctionalGauge.
 func NewFunctionalGauge(f func() int64) Gauge {
 	if !Enabled {
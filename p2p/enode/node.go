@@ -61,9 +61,19 @@ func MustParse(rawurl string) *Node {
 	return n
 }
 
+// ParseNode parses a node given as an enode:// URL, a bare hex node ID or an enr: record.
+// Records are verified against ValidSchemes, the other forms are handled by ParseV4.
+func ParseNode(rawurl string) (*Node, error) {
+	input := strings.TrimSpace(rawurl)
+	if strings.HasPrefix(input, "enr:") {
+		return Parse(ValidSchemes, input)
+	}
+	return ParseV4(input)
+}
+
 // Parse decodes and verifies a base64-encoded node record.
 func Parse(validSchemes enr.IdentityScheme, input string) (*Node, error) {
-	if strings.HasPrefix(input, "enode://") {
+	if strings.HasPrefix(strings.TrimSpace(input), "enode://") {
 		return ParseV4(input)
 	}
 	if !strings.HasPrefix(input, "enr:") {
@@ -248,6 +258,15 @@ func parseID(in string) (ID, error) {
 	return id, nil
 }
 
+// SameIdentity reports whether a and b are the same node, i.e. have the same
+// ID, regardless of their IP address and ports.
+func SameIdentity(a, b *Node) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.ID() == b.ID()
+}
+
 // DistCmp compares the distances a->target and b->target.
 // Returns -1 if a is closer to target, 1 if b is closer to target
 // and 0 if they are equal.
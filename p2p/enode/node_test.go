@@ -21,9 +21,12 @@ import (
 	"encoding/hex"
 	"fmt"
 	"math/big"
+	"net"
+	"reflect"
 	"testing"
 	"testing/quick"
 
+	"github.com/clearmatics/autonity/crypto"
 	"github.com/clearmatics/autonity/p2p/enr"
 	"github.com/clearmatics/autonity/rlp"
 	"github.com/stretchr/testify/assert"
@@ -64,6 +67,54 @@ func TestPythonInterop(t *testing.T) {
 	}
 }
 
+func TestParseNodeSchemes(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip := net.IP{127, 0, 0, 1}
+	var r enr.Record
+	r.Set(enr.IP(ip))
+	r.Set(enr.TCP(30303))
+	r.Set(enr.UDP(30301))
+	if err := SignV4(&r, key); err != nil {
+		t.Fatal(err)
+	}
+	record, err := New(ValidSchemes, &r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := NewV4(&key.PublicKey, ip, 30303, 30301).String()
+
+	fromURL, err := ParseNode(url)
+	if err != nil {
+		t.Fatalf("enode: unexpected error: %v", err)
+	}
+	fromRecord, err := ParseNode(record.String())
+	if err != nil {
+		t.Fatalf("enr: unexpected error: %v", err)
+	}
+	if fromURL.ID() != fromRecord.ID() || !reflect.DeepEqual(fromURL.Pubkey(), fromRecord.Pubkey()) {
+		t.Fatalf("key mismatch: enode %v, enr %v", fromURL.ID(), fromRecord.ID())
+	}
+	if !fromURL.IP().Equal(fromRecord.IP()) || fromURL.TCP() != fromRecord.TCP() || fromURL.UDP() != fromRecord.UDP() {
+		t.Fatalf("endpoint mismatch: enode %v, enr %v", fromURL, fromRecord)
+	}
+
+	// a bare node ID is an incomplete node of the same key
+	bare, err := ParseNode(fmt.Sprintf("%x", crypto.FromECDSAPub(&key.PublicKey)[1:]))
+	if err != nil {
+		t.Fatalf("bare id: unexpected error: %v", err)
+	}
+	if bare.ID() != fromURL.ID() || !bare.Incomplete() {
+		t.Fatalf("bare id: have %v, want incomplete node %v", bare, fromURL.ID())
+	}
+
+	if _, err := ParseNode("enr:x"); err == nil {
+		t.Fatal("expected an error for an invalid record")
+	}
+}
+
 func TestHexID(t *testing.T) {
 	ref := ID{0, 0, 0, 0, 0, 0, 0, 128, 106, 217, 182, 31, 165, 174, 1, 67, 7, 235, 220, 150, 66, 83, 173, 205, 159, 44, 10, 57, 42, 161, 26, 188}
 	id1 := HexID("0x00000000000000806ad9b61fa5ae014307ebdc964253adcd9f2c0a392aa11abc")
@@ -143,3 +194,28 @@ func TestID_logdistEqual(t *testing.T) {
 		t.Errorf("LogDist(x, x) != 0")
 	}
 }
+
+func TestSameIdentity(t *testing.T) {
+	key1, _ := crypto.GenerateKey()
+	key2, _ := crypto.GenerateKey()
+	a := NewV4(&key1.PublicKey, net.ParseIP("10.0.0.1"), 30303, 30303)
+	moved := NewV4(&key1.PublicKey, net.ParseIP("10.0.0.2"), 30304, 30305)
+	other := NewV4(&key2.PublicKey, net.ParseIP("10.0.0.1"), 30303, 30303)
+
+	tests := []struct {
+		a, b *Node
+		want bool
+	}{
+		{a, a, true},
+		{a, moved, true},
+		{a, IncompleteNodeFromPubkey(&key1.PublicKey), true},
+		{a, other, false},
+		{a, nil, false},
+		{nil, nil, true},
+	}
+	for i, test := range tests {
+		if have := SameIdentity(test.a, test.b); have != test.want {
+			t.Errorf("test %d: have %v, want %v", i, have, test.want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package enode
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/clearmatics/autonity/common/mclock"
+	"github.com/clearmatics/autonity/log"
+)
+
+// Resolver keeps the address of a hostname based enode URL up to date. It
+// re-resolves the URL every interval and invokes the change callback when the
+// resolved IP differs from the previous one, e.g. for peers behind dynamic DNS.
+type Resolver struct {
+	rawurl   string
+	interval time.Duration
+	clock    mclock.Clock
+	lookup   func(string) ([]net.IP, error)
+	onChange func(old, new *Node)
+
+	mu   sync.Mutex
+	node *Node
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewResolver resolves rawurl like ParseV4WithResolve and returns a Resolver
+// refreshing it every interval once started.
+func NewResolver(rawurl string, interval time.Duration, onChange func(old, new *Node)) (*Resolver, error) {
+	return NewResolverWithClock(rawurl, interval, mclock.System{}, lookupIP, onChange)
+}
+
+// NewResolverWithClock is like NewResolver but schedules the refreshes on the
+// given clock and resolves domain names with lookup.
+func NewResolverWithClock(rawurl string, interval time.Duration, clock mclock.Clock, lookup func(string) ([]net.IP, error), onChange func(old, new *Node)) (*Resolver, error) {
+	node, err := parseV4(rawurl, lookup)
+	if err != nil {
+		return nil, err
+	}
+	return &Resolver{
+		rawurl:   rawurl,
+		interval: interval,
+		clock:    clock,
+		lookup:   lookup,
+		onChange: onChange,
+		node:     node,
+		quit:     make(chan struct{}),
+	}, nil
+}
+
+// Node returns the last resolved node.
+func (r *Resolver) Node() *Node {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.node
+}
+
+// Refresh resolves the URL again and invokes the change callback if the IP
+// changed. The previous node is kept if the resolution fails.
+func (r *Resolver) Refresh() error {
+	node, err := parseV4(r.rawurl, r.lookup)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	old := r.node
+	changed := !old.IP().Equal(node.IP())
+	if changed {
+		r.node = node
+	}
+	r.mu.Unlock()
+
+	if changed {
+		log.Info("Resolved enode address changed", "id", node.ID(), "old", old.IP(), "new", node.IP())
+		if r.onChange != nil {
+			r.onChange(old, node)
+		}
+	}
+	return nil
+}
+
+// Start launches the refresh loop.
+func (r *Resolver) Start() {
+	r.wg.Add(1)
+	go r.loop()
+}
+
+// Stop terminates the refresh loop and waits for it to return.
+func (r *Resolver) Stop() {
+	close(r.quit)
+	r.wg.Wait()
+}
+
+func (r *Resolver) loop() {
+	defer r.wg.Done()
+	for {
+		select {
+		case <-r.clock.After(r.interval):
+			if err := r.Refresh(); err != nil {
+				log.Debug("Failed to refresh enode address", "url", r.rawurl, "err", err)
+			}
+		case <-r.quit:
+			return
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package enode
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/clearmatics/autonity/common/mclock"
+)
+
+func TestResolverIPChange(t *testing.T) {
+	const rawurl = "enode://1dd9d65c4552b5eb43d5ad55a2ee3f56c6cbc1c64a5c8d659f51fcd51bace24351232b8d7821617d2b29b54b81cdefb9b3e9c37d7fd5f63270bcc9e1a6f6a439@node.example.com:3"
+	var (
+		calls    int32
+		oldIP    = net.ParseIP("10.0.0.1")
+		newIP    = net.ParseIP("10.0.0.2")
+		clock    = new(mclock.Simulated)
+		interval = time.Minute
+		changes  = make(chan [2]*Node, 1)
+	)
+	lookup := func(string) ([]net.IP, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return []net.IP{oldIP}, nil
+		}
+		return []net.IP{newIP}, nil
+	}
+	onChange := func(old, new *Node) { changes <- [2]*Node{old, new} }
+
+	r, err := NewResolverWithClock(rawurl, interval, clock, lookup, onChange)
+	if err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	if !r.Node().IP().Equal(oldIP) {
+		t.Fatalf("have IP %v, want %v", r.Node().IP(), oldIP)
+	}
+	r.Start()
+	defer r.Stop()
+
+	clock.WaitForTimers(1)
+	clock.Run(interval)
+	select {
+	case change := <-changes:
+		if !change[0].IP().Equal(oldIP) || !change[1].IP().Equal(newIP) {
+			t.Errorf("have change %v -> %v, want %v -> %v", change[0].IP(), change[1].IP(), oldIP, newIP)
+		}
+		if change[1].ID() != change[0].ID() {
+			t.Errorf("have ID %v, want %v", change[1].ID(), change[0].ID())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("change callback not invoked")
+	}
+	if !r.Node().IP().Equal(newIP) {
+		t.Errorf("have IP %v, want %v", r.Node().IP(), newIP)
+	}
+
+	// The address is stable from now on, so a refresh must not report a change.
+	if err := r.Refresh(); err != nil {
+		t.Fatalf("Expected <nil>, got %v", err)
+	}
+	select {
+	case change := <-changes:
+		t.Errorf("unexpected change %v -> %v", change[0].IP(), change[1].IP())
+	default:
+	}
+}
@@ -17,6 +17,7 @@
 package enode
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"encoding/hex"
 	"errors"
@@ -25,10 +26,12 @@ import (
 	"net"
 	"net/url"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/clearmatics/autonity/common"
 	"github.com/clearmatics/autonity/common/math"
 	"github.com/clearmatics/autonity/crypto"
 	"github.com/clearmatics/autonity/p2p/enr"
@@ -38,6 +41,11 @@ var incompleteNodeURL = regexp.MustCompile("(?i)^(?:enode://)?([0-9a-f]+)$")
 
 const defaultPort = ":30303"
 
+const (
+	maxHostnameLength      = 253
+	maxHostnameLabelLength = 63
+)
+
 // MustParseV4 parses a node URL. It panics if the URL is not valid.
 func MustParseV4(rawurl string) *Node {
 	n, err := ParseV4(rawurl)
@@ -71,20 +79,26 @@ func MustParseV4(rawurl string) *Node {
 // and UDP discovery port 30301.
 //
 //    enode://<hex node id>@10.3.58.6:30303?discport=30301
+//
+// Surrounding whitespace and a single trailing slash, as often found in copied
+// URLs, are ignored.
 func ParseV4(rawurl string) (*Node, error) {
-	return parseV4(rawurl, false)
+	return parseV4(rawurl, nil)
 }
 
-func parseV4(rawurl string, resolve bool) (*Node, error) {
+// parseV4 parses an enode URL. Domain names are resolved with lookup, they are
+// rejected if lookup is nil.
+func parseV4(rawurl string, lookup func(string) ([]net.IP, error)) (*Node, error) {
+	rawurl = strings.TrimSuffix(strings.TrimSpace(rawurl), "/")
 	if m := incompleteNodeURL.FindStringSubmatch(rawurl); m != nil {
 		id, err := parsePubkey(m[1])
 		if err != nil {
 			return nil, fmt.Errorf("invalid public key (%v)", err)
 		}
-		return NewV4(id, nil, 0, 0), nil
+		return IncompleteNodeFromPubkey(id), nil
 	}
 
-	return parseComplete(rawurl, resolve)
+	return parseComplete(rawurl, lookup)
 }
 
 func GetParseV4WithResolveMaxTry(maxTry int, wait time.Duration) func(rawurl string) (*Node, error) {
@@ -109,7 +123,59 @@ func ParseV4WithResolveMaxTry(rawurl string, maxTry int, wait time.Duration) (*N
 }
 
 func ParseV4WithResolve(rawurl string) (*Node, error) {
-	return parseV4(rawurl, true)
+	return parseV4(rawurl, lookupIP)
+}
+
+// lookupIP resolves domain names in parseComplete. It is a variable so tests
+// can substitute a resolver.
+var lookupIP = net.LookupIP
+
+// uniqueSortedIPs drops duplicate addresses and sorts the rest, IPv4 first, so
+// that a resolver returning the same set in a different order (e.g. round-robin
+// DNS) always yields the same first address.
+func uniqueSortedIPs(ips []net.IP) []net.IP {
+	result := make([]net.IP, 0, len(ips))
+	seen := make(map[string]bool, len(ips))
+	for _, ip := range ips {
+		key := string(ip.To16())
+		if ip.To16() == nil || seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, ip)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		iv4, jv4 := result[i].To4() != nil, result[j].To4() != nil
+		if iv4 != jv4 {
+			return iv4
+		}
+		return bytes.Compare(result[i].To16(), result[j].To16()) < 0
+	})
+	return result
+}
+
+// checkHostname is a cheap syntactic check of a domain name, following RFC 1123,
+// done before resolving it. Underscores are tolerated as some container runtimes
+// use them in service names.
+func checkHostname(host string) error {
+	host = strings.TrimSuffix(host, ".")
+	if len(host) == 0 || len(host) > maxHostnameLength {
+		return fmt.Errorf("invalid hostname: length %d, want 1 to %d", len(host), maxHostnameLength)
+	}
+	for _, label := range strings.Split(host, ".") {
+		if len(label) == 0 || len(label) > maxHostnameLabelLength {
+			return fmt.Errorf("invalid hostname: label %q, want 1 to %d characters", label, maxHostnameLabelLength)
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("invalid hostname: label %q starts or ends with a hyphen", label)
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return fmt.Errorf("invalid hostname: character %q", c)
+			}
+		}
+	}
+	return nil
 }
 
 // NewV4 creates a node from discovery v4 node information. The record
@@ -133,13 +199,19 @@ func NewV4(pubkey *ecdsa.PublicKey, ip net.IP, tcp, udp int) *Node {
 	return n
 }
 
+// IncompleteNodeFromPubkey creates a node with no IP address from the given public key, e.g. to
+// refer to a validator whose network address isn't known.
+func IncompleteNodeFromPubkey(pub *ecdsa.PublicKey) *Node {
+	return NewV4(pub, nil, 0, 0)
+}
+
 // isNewV4 returns true for nodes created by NewV4.
 func isNewV4(n *Node) bool {
 	var k s256raw
 	return n.r.IdentityScheme() == "" && n.r.Load(&k) == nil && len(n.r.Signature()) == 0
 }
 
-func parseComplete(rawurl string, resolve bool) (*Node, error) {
+func parseComplete(rawurl string, lookup func(string) ([]net.IP, error)) (*Node, error) {
 	var (
 		id               *ecdsa.PublicKey
 		ip               net.IP
@@ -159,9 +231,10 @@ func parseComplete(rawurl string, resolve bool) (*Node, error) {
 	if id, err = parsePubkey(u.User.String()); err != nil {
 		return nil, fmt.Errorf("invalid public key (%v)", err)
 	}
-	if strings.LastIndex(u.Host, ":") == -1 {
-		//set default port
-		u.Host += defaultPort
+	if u.Port() == "" && !strings.HasSuffix(u.Host, ":") {
+		// set default port, the host may be a bracketed IPv6 address and the discovery port may be given in the
+		// query regardless
+		u.Host = net.JoinHostPort(u.Hostname(), strings.TrimPrefix(defaultPort, ":"))
 	}
 	// Parse the IP address.
 	host, port, err := net.SplitHostPort(u.Host)
@@ -170,17 +243,20 @@ func parseComplete(rawurl string, resolve bool) (*Node, error) {
 	}
 
 	if ip = net.ParseIP(host); ip == nil {
-		if !resolve {
+		if lookup == nil {
 			return nil, errors.New("invalid IP address")
 		}
 		// if host is not IPV4/6, resolve host is a domain
+		if err := checkHostname(host); err != nil {
+			return nil, err
+		}
 
-		hostIPs, err := net.LookupIP(host)
+		hostIPs, err := lookup(host)
 		if err != nil {
-			return NewV4(id, nil, 0, 0), errors.New("invalid domain or IP address")
+			return IncompleteNodeFromPubkey(id), errors.New("invalid domain or IP address")
 		}
-		if len(hostIPs) > 0 {
-			ip = hostIPs[len(hostIPs)-1]
+		if hostIPs = uniqueSortedIPs(hostIPs); len(hostIPs) > 0 {
+			ip = hostIPs[0]
 		}
 	}
 	// Parse the port numbers.
@@ -259,3 +335,17 @@ func PubkeyToIDV4(key *ecdsa.PublicKey) ID {
 	math.ReadBits(key.Y, e[len(e)/2:])
 	return ID(crypto.Keccak256Hash(e))
 }
+
+// AddressFromEnode derives the account address of the node's public key, which is the
+// address of the node in the validator set. The zero address is returned if the node
+// has no secp256k1 public key.
+func AddressFromEnode(n *Node) common.Address {
+	if n == nil {
+		return common.Address{}
+	}
+	key := n.Pubkey()
+	if key == nil {
+		return common.Address{}
+	}
+	return crypto.PubkeyToAddress(*key)
+}
@@ -26,6 +26,14 @@ var parseNodeWithResolveTests = []struct {
 		rawurl:    "enode://1dd9d65c4552b5eb43d5ad55a2ee3f56c6cbc1c64a5c8d659f51fcd51bace24351232b8d7821617d2b29b54b81cdefb9b3e9c37d7fd5f63270bcc9e1a6f6a439@hostname:3",
 		wantError: `invalid domain or IP address`,
 	},
+	{
+		rawurl:    "enode://1dd9d65c4552b5eb43d5ad55a2ee3f56c6cbc1c64a5c8d659f51fcd51bace24351232b8d7821617d2b29b54b81cdefb9b3e9c37d7fd5f63270bcc9e1a6f6a439@" + strings.Repeat("a.", 127) + "com:3",
+		wantError: `invalid hostname`,
+	},
+	{
+		rawurl:    "enode://1dd9d65c4552b5eb43d5ad55a2ee3f56c6cbc1c64a5c8d659f51fcd51bace24351232b8d7821617d2b29b54b81cdefb9b3e9c37d7fd5f63270bcc9e1a6f6a439@bad$host:3",
+		wantError: `invalid hostname`,
+	},
 	{
 		rawurl:    "enode://1dd9d65c4552b5eb43d5ad55a2ee3f56c6cbc1c64a5c8d659f51fcd51bace24351232b8d7821617d2b29b54b81cdefb9b3e9c37d7fd5f63270bcc9e1a6f6a439@127.0.0.1:foo",
 		wantError: `invalid port`,
@@ -184,3 +192,68 @@ func TestParseNodeWithDomainResolution(t *testing.T) {
 		}
 	}
 }
+
+func TestCheckHostname(t *testing.T) {
+	valid := []string{"localhost", "node-1.example.com", "example.com.", "autonity_node_1"}
+	for _, host := range valid {
+		if err := checkHostname(host); err != nil {
+			t.Errorf("host %q: unexpected error: %v", host, err)
+		}
+	}
+	invalid := []string{
+		"",
+		strings.Repeat("a", 64) + ".com",
+		strings.Repeat("a.", 127) + "com",
+		"-node.example.com",
+		"node-.example.com",
+		"node..example.com",
+		"bad$host",
+	}
+	for _, host := range invalid {
+		if err := checkHostname(host); err == nil {
+			t.Errorf("host %q: expected error, got nil", host)
+		}
+	}
+}
+
+func TestParseNodeWithResolveStableIP(t *testing.T) {
+	defer func(orig func(string) ([]net.IP, error)) { lookupIP = orig }(lookupIP)
+
+	const rawurl = "enode://1dd9d65c4552b5eb43d5ad55a2ee3f56c6cbc1c64a5c8d659f51fcd51bace24351232b8d7821617d2b29b54b81cdefb9b3e9c37d7fd5f63270bcc9e1a6f6a439@node.example.com:3"
+	orders := [][]net.IP{
+		{net.ParseIP("10.0.0.3"), net.ParseIP("10.0.0.1"), net.ParseIP("2001:db8::1"), net.ParseIP("10.0.0.2")},
+		{net.ParseIP("2001:db8::1"), net.ParseIP("10.0.0.2"), net.ParseIP("10.0.0.3"), net.ParseIP("10.0.0.1")},
+		{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.1").To4(), net.ParseIP("10.0.0.2"), net.ParseIP("2001:db8::1"), net.ParseIP("10.0.0.3")},
+	}
+	want := net.ParseIP("10.0.0.1")
+	for i, ips := range orders {
+		lookupIP = func(string) ([]net.IP, error) { return ips, nil }
+		n, err := ParseV4WithResolve(rawurl)
+		if err != nil {
+			t.Fatalf("order %d: unexpected error: %v", i, err)
+		}
+		if !n.IP().Equal(want) {
+			t.Errorf("order %d: have IP %v, want %v", i, n.IP(), want)
+		}
+	}
+}
+
+func TestUniqueSortedIPs(t *testing.T) {
+	ips := []net.IP{
+		net.ParseIP("2001:db8::1"),
+		net.ParseIP("10.0.0.2"),
+		net.ParseIP("10.0.0.1"),
+		net.ParseIP("10.0.0.2").To4(),
+		net.ParseIP("2001:db8::1"),
+	}
+	want := []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), net.ParseIP("2001:db8::1")}
+	have := uniqueSortedIPs(ips)
+	if len(have) != len(want) {
+		t.Fatalf("have %v, want %v", have, want)
+	}
+	for i := range want {
+		if !have[i].Equal(want[i]) {
+			t.Fatalf("have %v, want %v", have, want)
+		}
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/clearmatics/autonity/common"
 	"github.com/clearmatics/autonity/crypto"
 	"github.com/clearmatics/autonity/p2p/enr"
 )
@@ -178,6 +179,29 @@ func TestParseNode(t *testing.T) {
 	}
 }
 
+func TestParseNodeDefaultPort(t *testing.T) {
+	const id = "1dd9d65c4552b5eb43d5ad55a2ee3f56c6cbc1c64a5c8d659f51fcd51bace24351232b8d7821617d2b29b54b81cdefb9b3e9c37d7fd5f63270bcc9e1a6f6a439"
+	tests := []struct {
+		input string
+		want  *Node
+	}{
+		{"enode://" + id + "@1.2.3.4", NewV4(hexPubkey(id), net.IP{1, 2, 3, 4}, 30303, 30303)},
+		{"enode://" + id + "@1.2.3.4?discport=30301", NewV4(hexPubkey(id), net.IP{1, 2, 3, 4}, 30303, 30301)},
+		{"enode://" + id + "@[2001:db8::1]", NewV4(hexPubkey(id), net.ParseIP("2001:db8::1"), 30303, 30303)},
+		{"enode://" + id + "@[2001:db8::1]?discport=30301", NewV4(hexPubkey(id), net.ParseIP("2001:db8::1"), 30303, 30301)},
+	}
+	for _, test := range tests {
+		n, err := Parse(ValidSchemes, test.input)
+		if err != nil {
+			t.Errorf("test %q:\n  unexpected error: %v", test.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(n, test.want) {
+			t.Errorf("test %q:\n  result mismatch:\ngot:  %#v\nwant: %#v", test.input, n, test.want)
+		}
+	}
+}
+
 func TestNodeString(t *testing.T) {
 	for i, test := range parseNodeTests {
 		if test.wantError == "" && strings.HasPrefix(test.input, "enode://") {
@@ -188,3 +212,78 @@ func TestNodeString(t *testing.T) {
 		}
 	}
 }
+
+func TestParseV4Lenient(t *testing.T) {
+	const (
+		id  = "1dd9d65c4552b5eb43d5ad55a2ee3f56c6cbc1c64a5c8d659f51fcd51bace24351232b8d7821617d2b29b54b81cdefb9b3e9c37d7fd5f63270bcc9e1a6f6a439"
+		url = "enode://" + id + "@127.0.0.1:30303"
+	)
+	want, err := ParseV4(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, input := range []string{
+		" " + url + " ",
+		url + "/",
+		"\t" + url + "/\n",
+		url + "?discport=30303/",
+	} {
+		n, err := ParseV4(input)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", input, err)
+			continue
+		}
+		if !reflect.DeepEqual(n, want) {
+			t.Errorf("%q: result mismatch:\ngot:  %#v\nwant: %#v", input, n, want)
+		}
+	}
+	if n, err := Parse(ValidSchemes, " "+url+"/"); err != nil || !reflect.DeepEqual(n, want) {
+		t.Errorf("Parse: got %v, %v, want %v", n, err, want)
+	}
+
+	// the node ID and the port are still strictly checked
+	for input, wantErr := range map[string]string{
+		" enode://" + id[1:] + "@127.0.0.1:30303 ": "invalid public key",
+		"enode://" + id + "@127.0.0.1:30303x/":     "invalid port",
+	} {
+		_, err := ParseV4(input)
+		if err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("%q: got error %v, want %q", input, err, wantErr)
+		}
+	}
+}
+
+func TestIncompleteNodeFromPubkey(t *testing.T) {
+	pub := hexPubkey("1dd9d65c4552b5eb43d5ad55a2ee3f56c6cbc1c64a5c8d659f51fcd51bace24351232b8d7821617d2b29b54b81cdefb9b3e9c37d7fd5f63270bcc9e1a6f6a439")
+	n := IncompleteNodeFromPubkey(pub)
+
+	if !n.Incomplete() {
+		t.Errorf("node with IP %v is not incomplete", n.IP())
+	}
+	if got, want := n.ID(), PubkeyToIDV4(pub); got != want {
+		t.Errorf("ID mismatch: got %v, want %v", got, want)
+	}
+	want := "enode://1dd9d65c4552b5eb43d5ad55a2ee3f56c6cbc1c64a5c8d659f51fcd51bace24351232b8d7821617d2b29b54b81cdefb9b3e9c37d7fd5f63270bcc9e1a6f6a439"
+	if got := n.URLv4(); got != want {
+		t.Errorf("URL mismatch: got %s, want %s", got, want)
+	}
+}
+
+func TestAddressFromEnode(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := NewV4(&key.PublicKey, net.IP{127, 0, 0, 1}, 30303, 30303)
+
+	if got, want := AddressFromEnode(n), crypto.PubkeyToAddress(*n.Pubkey()); got != want {
+		t.Errorf("address mismatch: got %x, want %x", got, want)
+	}
+	if got, want := AddressFromEnode(n), crypto.PubkeyToAddress(key.PublicKey); got != want {
+		t.Errorf("address mismatch: got %x, want %x", got, want)
+	}
+	if got := AddressFromEnode(nil); got != (common.Address{}) {
+		t.Errorf("expected the zero address for a nil node, got %x", got)
+	}
+}
@@ -375,7 +375,7 @@ func (src *Server) UpdateWhitelist(enodes []*enode.Node) {
 	for _, connectedPeer := range src.Peers() {
 		found := false
 		for _, whitelistedEnode := range enodes {
-			if connectedPeer.Node().ID() == whitelistedEnode.ID() {
+			if enode.SameIdentity(connectedPeer.Node(), whitelistedEnode) {
 				found = true
 				break
 			}
@@ -391,7 +391,7 @@ func (src *Server) UpdateWhitelist(enodes []*enode.Node) {
 	for _, whitelistedEnode := range enodes {
 		found := false
 		for _, oldEnode := range src.TrustedNodes {
-			if oldEnode.ID() == whitelistedEnode.ID() {
+			if enode.SameIdentity(oldEnode, whitelistedEnode) {
 				found = true
 				break
 			}
@@ -339,6 +339,8 @@ type TendermintConfig struct {
 	ProposerPolicy uint64 `json:"policy"` // The policy for proposer selection
 	BlockPeriod    uint64 `json:"block-period"`
 	RequestTimeout uint64 `json:"request-timeout"`
+	// SequenceBlock is the block from which consensus messages carry a sequence, nil meaning never
+	SequenceBlock *big.Int `json:"sequence-block,omitempty"`
 }
 
 // String implements the stringer interface, returning the consensus engine details.
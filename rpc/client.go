@@ -80,6 +80,9 @@ type Client struct {
 
 	idCounter uint32
 
+	// allowSubscribe is false if the services of the client can't be subscribed to.
+	allowSubscribe bool
+
 	// This function, if non-nil, is called when the connection is lost.
 	reconnectFunc reconnectFunc
 
@@ -110,8 +113,13 @@ type clientConn struct {
 }
 
 func (c *Client) newClientConn(conn ServerCodec) *clientConn {
-	ctx := context.WithValue(context.Background(), clientContextKey{}, c)
+	connCtx := context.Background()
+	if cc, ok := conn.(*contextCodec); ok {
+		connCtx = cc.ctx
+	}
+	ctx := context.WithValue(connCtx, clientContextKey{}, c)
 	handler := newHandler(ctx, conn, c.idgen, c.services)
+	handler.allowSubscribe = c.allowSubscribe
 	return &clientConn{conn, handler}
 }
 
@@ -197,27 +205,28 @@ func newClient(initctx context.Context, connect reconnectFunc) (*Client, error)
 	if err != nil {
 		return nil, err
 	}
-	c := initClient(conn, randomIDGenerator(), new(serviceRegistry))
+	c := initClient(conn, randomIDGenerator(), new(serviceRegistry), true)
 	c.reconnectFunc = connect
 	return c, nil
 }
 
-func initClient(conn ServerCodec, idgen func() ID, services *serviceRegistry) *Client {
+func initClient(conn ServerCodec, idgen func() ID, services *serviceRegistry, allowSubscribe bool) *Client {
 	_, isHTTP := conn.(*httpConn)
 	c := &Client{
-		idgen:       idgen,
-		isHTTP:      isHTTP,
-		services:    services,
-		writeConn:   conn,
-		close:       make(chan struct{}),
-		closing:     make(chan struct{}),
-		didClose:    make(chan struct{}),
-		reconnected: make(chan ServerCodec),
-		readOp:      make(chan readOp),
-		readErr:     make(chan error),
-		reqInit:     make(chan *requestOp),
-		reqSent:     make(chan error, 1),
-		reqTimeout:  make(chan *requestOp),
+		idgen:          idgen,
+		isHTTP:         isHTTP,
+		services:       services,
+		allowSubscribe: allowSubscribe,
+		writeConn:      conn,
+		close:          make(chan struct{}),
+		closing:        make(chan struct{}),
+		didClose:       make(chan struct{}),
+		reconnected:    make(chan ServerCodec),
+		readOp:         make(chan readOp),
+		readErr:        make(chan error),
+		reqInit:        make(chan *requestOp),
+		reqSent:        make(chan error, 1),
+		reqTimeout:     make(chan *requestOp),
 	}
 	if !isHTTP {
 		go c.dispatch(conn)
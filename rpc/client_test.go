@@ -26,6 +26,7 @@ import (
 	"os"
 	"reflect"
 	"runtime"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -232,6 +233,145 @@ func TestClientSubscribeInvalidArg(t *testing.T) {
 	check(false, make(chan<- int))
 }
 
+func TestClientReadWriteRate(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	client := DialInProcWithReadWriteRate(server, 1<<20, 1<<20, 1<<10, 1<<10)
+	defer client.Close()
+
+	var resp Result
+	if err := client.Call(&resp, "test_echo", "hello", 10, &Args{"world"}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(resp, Result{"hello", 10, &Args{"world"}}) {
+		t.Errorf("incorrect result %#v", resp)
+	}
+}
+
+func TestClientRateStats(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	client, stats := DialInProcWithRateStats(server, 2000, 100, nil)
+	defer client.Close()
+
+	var resp Result
+	for i := 0; i < 5; i++ {
+		if err := client.Call(&resp, "test_echo", "hello", 10, &Args{"world"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	clientStats, serverStats := stats.Stats()
+	if clientStats.BytesWritten == 0 || clientStats.BytesRead == 0 {
+		t.Fatalf("no traffic counted: %+v", clientStats)
+	}
+	if serverStats.BytesRead != clientStats.BytesWritten {
+		t.Fatalf("server read %d bytes, client wrote %d", serverStats.BytesRead, clientStats.BytesWritten)
+	}
+	if clientStats.Blocked+serverStats.Blocked == 0 {
+		t.Fatalf("throttled traffic not counted as blocked: client %+v, server %+v", clientStats, serverStats)
+	}
+}
+
+func TestClientCloserStopsServer(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+
+	serving := func() int {
+		buf := make([]byte, 1<<20)
+		n := runtime.Stack(buf, true)
+		return strings.Count(string(buf[:n]), "(*Server).ServeCodec(")
+	}
+	before := serving()
+
+	client, closer := DialInProcWithCloser(server)
+	var resp Result
+	if err := client.Call(&resp, "test_echo", "hello", 10, &Args{"world"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := serving(); n != before+1 {
+		t.Fatalf("wrong number of serving goroutines: got %d, want %d", n, before+1)
+	}
+
+	closer()
+	if n := serving(); n != before {
+		t.Fatalf("serving goroutine still running after close: got %d, want %d", n, before)
+	}
+	if err := client.Call(&resp, "test_echo", "hello", 10, &Args{"world"}); err != ErrClientQuit {
+		t.Fatalf("wrong error after close: got %v, want %v", err, ErrClientQuit)
+	}
+}
+
+func TestClientInProcContext(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+
+	ctx := context.WithValue(context.Background(), testIdentityKey{}, "tenant-a")
+	client := DialInProcWithContext(server, ctx)
+	defer client.Close()
+
+	var identity string
+	if err := client.Call(&identity, "test_identity"); err != nil {
+		t.Fatal(err)
+	}
+	if identity != "tenant-a" {
+		t.Errorf("have identity %q, want %q", identity, "tenant-a")
+	}
+
+	// other connections don't see it
+	plain := DialInProc(server)
+	defer plain.Close()
+	if err := plain.Call(&identity, "test_identity"); err != nil {
+		t.Fatal(err)
+	}
+	if identity != "" {
+		t.Errorf("have identity %q, want none", identity)
+	}
+}
+
+func TestClientMaxMessageSize(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	client := DialInProcWithMaxMessageSize(server, OptionMethodInvocation|OptionSubscriptions, 1024)
+	defer client.Close()
+
+	var resp Result
+	if err := client.Call(&resp, "test_echo", "hello", 10, &Args{"world"}); err != nil {
+		t.Fatal(err)
+	}
+	if resp.String != "hello" {
+		t.Errorf("have %q, want %q", resp.String, "hello")
+	}
+
+	// the oversized result is replaced by an error, the connection staying usable
+	want := (&messageTooLargeError{1024}).Error()
+	if err := client.Call(&resp, "test_echo", strings.Repeat("x", 2048), 10, &Args{"world"}); err == nil || err.Error() != want {
+		t.Fatalf("have error %v, want %q", err, want)
+	}
+	if err := client.Call(&resp, "test_echo", "again", 10, &Args{"world"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientSubscribeDisabled(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	client := DialInProcWithOptions(server, OptionMethodInvocation)
+	defer client.Close()
+
+	// method calls still work
+	var resp Result
+	if err := client.Call(&resp, "test_echo", "hello", 10, &Args{"world"}); err != nil {
+		t.Fatal(err)
+	}
+
+	nc := make(chan int)
+	_, err := client.Subscribe(context.Background(), "nftest", nc, "someSubscription", 10, 0)
+	if err == nil || err.Error() != ErrNotificationsUnsupported.Error() {
+		t.Fatalf("wrong error: got %v, want %v", err, ErrNotificationsUnsupported)
+	}
+}
+
 func TestClientSubscribe(t *testing.T) {
 	server := newTestServer()
 	defer server.Stop()
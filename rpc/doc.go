@@ -79,7 +79,7 @@ An example server which uses the JSON codec:
  for {
 	c, _ := l.AcceptUnix()
 	codec := v2.NewJSONCodec(c)
-	go server.ServeCodec(codec, 0)
+	go server.ServeCodec(codec, OptionMethodInvocation|OptionSubscriptions)
  }
 
 Subscriptions
@@ -57,6 +57,15 @@ func (e *invalidMessageError) ErrorCode() int { return -32700 }
 
 func (e *invalidMessageError) Error() string { return e.message }
 
+// the encoded result or notification exceeds the size limit of the connection
+type messageTooLargeError struct{ limit int }
+
+func (e *messageTooLargeError) ErrorCode() int { return defaultErrorCode }
+
+func (e *messageTooLargeError) Error() string {
+	return fmt.Sprintf("message exceeds the size limit of %d bytes", e.limit)
+}
+
 // unable to decode supplied params, or an invalid number of parameters
 type invalidParamsError struct{ message string }
 
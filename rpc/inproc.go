@@ -19,32 +19,157 @@ package rpc
 import (
 	"context"
 	"net"
+	"sync"
 
 	"github.com/clearmatics/autonity/common/ratelimit"
 )
 
 // DialInProc attaches an in-process connection to the given RPC server.
 func DialInProc(handler *Server) *Client {
+	return DialInProcWithOptions(handler, OptionMethodInvocation|OptionSubscriptions)
+}
+
+// DialInProcWithOptions attaches an in-process connection to the given RPC server, served
+// with the given codec options. Subscriptions fail unless opts include OptionSubscriptions.
+func DialInProcWithOptions(handler *Server, opts CodecOption) *Client {
+	return DialInProcWithMaxMessageSize(handler, opts, 0)
+}
+
+// DialInProcWithMaxMessageSize is like DialInProcWithOptions, but the results and notifications
+// the server sends are at most maxSize bytes once encoded, an error being returned for the calls
+// whose result is larger. A maxSize of 0 means no limit.
+func DialInProcWithMaxMessageSize(handler *Server, opts CodecOption, maxSize int) *Client {
 	initctx := context.Background()
 	c, _ := newClient(initctx, func(context.Context) (ServerCodec, error) {
 		p1, p2 := net.Pipe()
-		go handler.ServeCodec(NewJSONCodec(p1), OptionMethodInvocation|OptionSubscriptions)
+		go handler.ServeCodec(NewSizeLimitedCodec(NewJSONCodec(p1), maxSize), opts)
 		return NewJSONCodec(p2), nil
 	})
 	return c
 }
 
+// DialInProcWithContext is like DialInProc, but the calls are served with a context derived from ctx, so that the
+// methods can tell the callers apart from the values it carries, e.g. an identity. Cancelling ctx cancels the
+// calls in progress.
+func DialInProcWithContext(handler *Server, ctx context.Context) *Client {
+	initctx := context.Background()
+	c, _ := newClient(initctx, func(context.Context) (ServerCodec, error) {
+		p1, p2 := net.Pipe()
+		go handler.ServeCodec(&contextCodec{ServerCodec: NewJSONCodec(p1), ctx: ctx}, OptionMethodInvocation|OptionSubscriptions)
+		return NewJSONCodec(p2), nil
+	})
+	return c
+}
+
+// contextCodec is a ServerCodec whose calls are served with the given context.
+type contextCodec struct {
+	ServerCodec
+	ctx context.Context
+}
+
+// DialInProcWithCloser is like DialInProc, but also returns a function closing both ends of
+// the connection. Once it returns the server has stopped serving the connection.
+func DialInProcWithCloser(handler *Server) (*Client, func()) {
+	var (
+		mu     sync.Mutex
+		codecs []ServerCodec
+		wg     sync.WaitGroup
+	)
+	initctx := context.Background()
+	c, _ := newClient(initctx, func(context.Context) (ServerCodec, error) {
+		p1, p2 := net.Pipe()
+		codec := NewJSONCodec(p1)
+		mu.Lock()
+		codecs = append(codecs, codec)
+		mu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handler.ServeCodec(codec, OptionMethodInvocation|OptionSubscriptions)
+		}()
+		return NewJSONCodec(p2), nil
+	})
+	closer := func() {
+		c.Close()
+		mu.Lock()
+		for _, codec := range codecs {
+			codec.Close()
+		}
+		mu.Unlock()
+		wg.Wait()
+	}
+	return c, closer
+}
+
 func DialInProcWithRate(handler *Server, rate, capacity int64) *Client {
 	return DialInProcWithRateClock(handler, rate, capacity, nil)
 }
 
+// DialInProcWithReadWriteRate attaches an in-process connection to the given RPC server, the
+// client reading the responses at most at readRate B/s and writing the requests at most at
+// writeRate B/s, each direction being limited independently.
+func DialInProcWithReadWriteRate(handler *Server, readRate, readCapacity, writeRate, writeCapacity int64) *Client {
+	initctx := context.Background()
+	c, _ := newClient(initctx, func(context.Context) (ServerCodec, error) {
+		p1, p2 := ratelimit.NewPipesWithReadWriteRates(float64(readRate), readCapacity, float64(writeRate), writeCapacity, nil)
+
+		go handler.ServeCodec(NewJSONCodec(p1), OptionMethodInvocation|OptionSubscriptions)
+		return NewJSONCodec(p2), nil
+	})
+	return c
+}
+
+// DialInProcWithRateClock is like DialInProcWithRate, but the rate limits of both directions are
+// measured with the given clock, allowing tests to control exactly when bytes are released.
 func DialInProcWithRateClock(handler *Server, rate, capacity int64, clock ratelimit.Clock) *Client {
+	c, _ := DialInProcWithRateStats(handler, rate, capacity, clock)
+	return c
+}
+
+// DialInProcWithRateStats is like DialInProcWithRateClock, but also returns the traffic counters
+// of the connection, helping to tell whether the rate is too low.
+func DialInProcWithRateStats(handler *Server, rate, capacity int64, clock ratelimit.Clock) (*Client, *RateStats) {
+	stats := new(RateStats)
 	initctx := context.Background()
 	c, _ := newClient(initctx, func(context.Context) (ServerCodec, error) {
 		p1, p2 := ratelimit.NewPipesWithClock(float64(rate), capacity, clock)
+		stats.add(p1, p2)
 
 		go handler.ServeCodec(NewJSONCodec(p1), OptionMethodInvocation|OptionSubscriptions)
 		return NewJSONCodec(p2), nil
 	})
-	return c
+	return c, stats
+}
+
+// RateStats counts the traffic of a rate limited in-process connection, summed over reconnections.
+type RateStats struct {
+	mu      sync.Mutex
+	servers []net.Conn
+	clients []net.Conn
+}
+
+func (s *RateStats) add(server, client net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.servers = append(s.servers, server)
+	s.clients = append(s.clients, client)
+}
+
+// Stats returns the counters of the client and server ends of the connection. The bytes the
+// client writes are read by the server and the other way around, but each end has its own
+// limiter and is blocked on its own.
+func (s *RateStats) Stats() (client, server ratelimit.Stats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sum := func(conns []net.Conn) (total ratelimit.Stats) {
+		for _, conn := range conns {
+			stats, _ := ratelimit.ConnStats(conn)
+			total.BytesRead += stats.BytesRead
+			total.BytesWritten += stats.BytesWritten
+			total.Blocked += stats.Blocked
+		}
+		return total
+	}
+	return sum(s.clients), sum(s.servers)
 }
@@ -196,6 +196,55 @@ func NewJSONCodec(conn Conn) ServerCodec {
 	return newCodec(conn, enc.Encode, dec.Decode)
 }
 
+// NewSizeLimitedCodec wraps codec so that the results and notifications it writes are at most maxSize bytes once
+// encoded. An oversized result is replaced by an error response, an oversized notification is not sent. A maxSize
+// of 0 means no limit.
+func NewSizeLimitedCodec(codec ServerCodec, maxSize int) ServerCodec {
+	if maxSize <= 0 {
+		return codec
+	}
+	return &sizeLimitedCodec{ServerCodec: codec, maxSize: maxSize}
+}
+
+type sizeLimitedCodec struct {
+	ServerCodec
+	maxSize int
+}
+
+func (c *sizeLimitedCodec) Write(ctx context.Context, v interface{}) error {
+	switch msg := v.(type) {
+	case *jsonrpcMessage:
+		limited, err := c.limit(msg)
+		if err != nil {
+			return err
+		}
+		v = limited
+	case []*jsonrpcMessage:
+		batch := make([]*jsonrpcMessage, len(msg))
+		for i := range msg {
+			limited, err := c.limit(msg[i])
+			if err != nil {
+				return err
+			}
+			batch[i] = limited
+		}
+		v = batch
+	}
+	return c.ServerCodec.Write(ctx, v)
+}
+
+// limit returns the message to write in place of msg, an error if it must not be written.
+func (c *sizeLimitedCodec) limit(msg *jsonrpcMessage) (*jsonrpcMessage, error) {
+	if len(msg.Result)+len(msg.Params) <= c.maxSize {
+		return msg, nil
+	}
+	err := &messageTooLargeError{c.maxSize}
+	if msg.isResponse() {
+		return msg.errorResponse(err), nil
+	}
+	return nil, err
+}
+
 func (c *jsonCodec) RemoteAddr() string {
 	return c.remoteAddr
 }
@@ -29,7 +29,7 @@ const MetadataApi = "rpc"
 
 // CodecOption specifies which type of messages a codec supports.
 //
-// Deprecated: this option is no longer honored by Server.
+// Only OptionSubscriptions is honored by Server, method calls are always supported.
 type CodecOption int
 
 const (
@@ -70,7 +70,7 @@ func (s *Server) RegisterName(name string, receiver interface{}) error {
 // the response back using the given codec. It will block until the codec is closed or the
 // server is stopped. In either case the codec is closed.
 //
-// Note that codec options are no longer supported.
+// Subscriptions are rejected unless options include OptionSubscriptions.
 func (s *Server) ServeCodec(codec ServerCodec, options CodecOption) {
 	defer codec.Close()
 
@@ -83,7 +83,7 @@ func (s *Server) ServeCodec(codec ServerCodec, options CodecOption) {
 	s.codecs.Add(codec)
 	defer s.codecs.Remove(codec)
 
-	c := initClient(codec, s.idgen, &s.services)
+	c := initClient(codec, s.idgen, &s.services, options&OptionSubscriptions != 0)
 	<-codec.Closed()
 	c.Close()
 }
@@ -73,6 +73,13 @@ func (s *testService) EchoWithCtx(ctx context.Context, str string, i int, args *
 	return Result{str, i, args}
 }
 
+type testIdentityKey struct{}
+
+func (s *testService) Identity(ctx context.Context) string {
+	identity, _ := ctx.Value(testIdentityKey{}).(string)
+	return identity
+}
+
 func (s *testService) Sleep(ctx context.Context, duration time.Duration) {
 	time.Sleep(duration)
 }